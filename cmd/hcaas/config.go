@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// config holds the settings of the all-in-one binary. The embedded services read their
+// own settings from the same environment variables as when they run standalone.
+type config struct {
+	Port        string
+	DatabaseURL string
+	OTLPConfig  otlpConfig
+}
+
+// otlpConfig holds OpenTelemetry tracing configuration.
+type otlpConfig struct {
+	Endpoint string
+	Protocol string
+	Insecure bool
+}
+
+// loadConfig reads environment variables and returns a config or an error.
+func loadConfig() (*config, error) {
+	cfg := &config{}
+
+	getString := func(key, def string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return def
+	}
+
+	port, err := strconv.Atoi(getString("PORT", "8080"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PORT: %w", err)
+	}
+	cfg.Port = strconv.Itoa(port)
+
+	// All services share one database
+	cfg.DatabaseURL = os.Getenv("DATABASE_URL")
+	if cfg.DatabaseURL == "" {
+		return nil, fmt.Errorf("DATABASE_URL is required")
+	}
+	// The auth and notification services read their database from DB_URL
+	if err := os.Setenv("DB_URL", cfg.DatabaseURL); err != nil {
+		return nil, err
+	}
+
+	// OTLP tracing configuration - use standard OpenTelemetry environment variables
+	cfg.OTLPConfig.Endpoint = getString("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317")
+	cfg.OTLPConfig.Protocol = getString("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	cfg.OTLPConfig.Insecure = getString("OTEL_EXPORTER_OTLP_INSECURE", "true") == "true"
+
+	return cfg, nil
+}
@@ -0,0 +1,197 @@
+// Command hcaas runs the auth, URL and notification services in a single process for
+// development and small installations. The services share one database and one HTTP
+// listener, pass notification events over an in-process bus and validate tokens without
+// calling the auth service over HTTP.
+//
+// Each service migrates its schema on startup; "hcaas migrate up|down [N]|status" manages
+// the schemas of all services without starting them.
+//
+// Each service is mounted under its own path prefix with its usual routes below it:
+//
+//	/auth/...          auth service, e.g. POST /auth/auth/login
+//	/url/...           URL service, e.g. GET /url/urls/
+//	/notification/...  notification service, e.g. GET /notification/channels
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+	authapp "github.com/kernelshard/hcaas/services/auth/app"
+	notificationapp "github.com/kernelshard/hcaas/services/notification/app"
+	urlapp "github.com/kernelshard/hcaas/services/url/app"
+)
+
+const serviceName = "hcaas"
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	l := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(l)
+
+	if err := godotenv.Load(); err != nil {
+		l.Info("No .env file loaded", "err", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		l.Error("Failed to load configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// Setup OpenTelemetry tracing shared by the embedded services
+	tracingConfig := otelkit.NewProviderConfig(serviceName, "v1.0.0").
+		WithOTLPExporter(cfg.OTLPConfig.Endpoint, cfg.OTLPConfig.Protocol, cfg.OTLPConfig.Insecure).
+		WithSampling("probabilistic", 0.1).                        // 10% sampling rate
+		WithBatchOptions(2*time.Second, 10*time.Second, 512, 2048) // Optimized batch settings
+
+	provider, err := otelkit.NewProvider(ctx, tracingConfig)
+	if err != nil {
+		l.Error("Failed to initialize OpenTelemetry tracing provider", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			l.Error("Failed to gracefully shutdown tracing provider", slog.String("error", err.Error()))
+		}
+	}()
+
+	authCfg, err := authapp.LoadConfig()
+	if err != nil {
+		l.Error("Failed to load auth configuration", "err", err)
+		os.Exit(1)
+	}
+	urlCfg, err := urlapp.LoadConfig()
+	if err != nil {
+		l.Error("Failed to load URL configuration", "err", err)
+		os.Exit(1)
+	}
+	notifCfg, err := notificationapp.LoadConfig()
+	if err != nil {
+		l.Error("Failed to load notification configuration", "err", err)
+		os.Exit(1)
+	}
+	authCfg.DBConfig.URL = cfg.DatabaseURL
+	urlCfg.DBConfig.URL = cfg.DatabaseURL
+	notifCfg.DBConfig.URL = cfg.DatabaseURL
+	// Events published by the URL service must reach the notification consumer
+	notifCfg.ConsumerConfig.KafkaTopic = urlCfg.KafkaConfig.NotifTopic
+
+	// "hcaas migrate up|down [N]|status" manages the schema of every service and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrations := []struct {
+			service string
+			run     func() error
+		}{
+			{authapp.ServiceName, func() error { return authapp.Migrate(ctx, authCfg, os.Args[2:], os.Stdout) }},
+			{urlapp.ServiceName, func() error { return urlapp.Migrate(ctx, urlCfg, os.Args[2:], os.Stdout) }},
+			{notificationapp.ServiceName, func() error { return notificationapp.Migrate(ctx, notifCfg, os.Args[2:], os.Stdout) }},
+		}
+		for _, m := range migrations {
+			fmt.Printf("%s:\n", m.service)
+			if err := m.run(); err != nil {
+				l.Error("Migration failed", "service", m.service, "err", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	// The URL service is created after the auth service, whose validator it needs, and
+	// before any account can be deleted
+	var urlApp *urlapp.App
+	deleteUserData := authapp.UserDataDeleterFunc(func(ctx context.Context, userID, _ string) error {
+		return urlApp.DeleteUserURLs(ctx, userID)
+	})
+
+	authApp, err := authapp.New(ctx, authCfg, authapp.Options{UserData: deleteUserData}, l.With("service", authapp.ServiceName))
+	if err != nil {
+		l.Error("Failed to initialize auth service", "err", err)
+		os.Exit(1)
+	}
+	defer authApp.Close()
+
+	// Notification events and tokens never leave the process
+	eventBus := bus.NewMemory()
+	defer eventBus.Close()
+	validator := authApp.Validator()
+
+	urlApp, err = urlapp.New(ctx, urlCfg, urlapp.Options{Validator: validator, Publisher: eventBus},
+		l.With("service", urlapp.ServiceName))
+	if err != nil {
+		l.Error("Failed to initialize URL service", "err", err)
+		os.Exit(1)
+	}
+	defer urlApp.Close()
+
+	notifApp, err := notificationapp.New(ctx, notifCfg, notificationapp.Options{Validator: validator, Bus: eventBus},
+		l.With("service", notificationapp.ServiceName))
+	if err != nil {
+		l.Error("Failed to initialize notification service", "err", err)
+		os.Exit(1)
+	}
+	defer notifApp.Close()
+
+	// Background workers of the services run until shutdown
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		urlApp.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		notifApp.Run(ctx)
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", http.StripPrefix("/auth", authApp.Handler()))
+	mux.Handle("/url/", http.StripPrefix("/url", urlApp.Handler()))
+	mux.Handle("/notification/", http.StripPrefix("/notification", notifApp.Handler()))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: mux,
+	}
+
+	go func() {
+		l.Info("Server started", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Error("Failed to start server", "err", err)
+			cancel()
+		}
+	}()
+
+	<-ctx.Done()
+	l.Info("Shutting down server...")
+
+	ctxTimeout, cancelTimeout := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTimeout()
+	if err := server.Shutdown(ctxTimeout); err != nil {
+		l.Error("Shutdown failed", "err", err)
+	}
+
+	// Wait for the workers before the deferred Close calls release their connections
+	wg.Wait()
+	l.Info("Server exited cleanly")
+}
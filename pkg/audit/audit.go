@@ -0,0 +1,300 @@
+// Package audit is the append-only log of security and configuration events, such as
+// logins, lockouts and changes of monitors. Every service keeps the events it records in its
+// own database and lets admins query them. The database stores keep them in the
+// audit_events table, which each service creates with Migration.
+//
+// Events carry the user who acted and the client of the request, which Middleware and
+// WithActor put into the request context, and for changes the fields before and after them.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of the auth service.
+const (
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionLockout         = "auth.lockout"
+	ActionTokenIssued     = "auth.token_issued"
+	ActionAPIKeyCreated   = "auth.api_key_created"
+	ActionAPIKeyRevoked   = "auth.api_key_revoked"
+	ActionProfileUpdated  = "auth.profile_updated"
+	ActionPasswordChanged = "auth.password_changed"
+	ActionUserDisabled    = "auth.user_disabled"
+	ActionUserEnabled     = "auth.user_enabled"
+	ActionUserDeleted     = "auth.user_deleted"
+)
+
+// Actions of the URL service.
+const (
+	ActionMonitorCreated = "monitor.created"
+	ActionMonitorUpdated = "monitor.updated"
+	ActionMonitorDeleted = "monitor.deleted"
+)
+
+// Event is an entry of the audit log.
+type Event struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Action     string    `json:"action"`
+	// ActorID is the user who acted; empty when unknown, e.g. for failed logins
+	ActorID    string `json:"actor_id,omitempty"`
+	ActorEmail string `json:"actor_email,omitempty"`
+	// TargetType and TargetID name what was acted on, e.g. "monitor" and its ID
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   string `json:"target_id,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	// Before and After are JSON objects of the fields a change modified, see Diff. Before
+	// is empty for creations and After for deletions.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Filter selects events. Zero fields match everything.
+type Filter struct {
+	ActorID string
+	Action  string
+	// Since and Until bound OccurredAt; Until is exclusive
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of events, newest first
+	Limit  int
+	Offset int
+}
+
+// Matches reports whether e is selected by f, ignoring Limit and Offset.
+func (f Filter) Matches(e Event) bool {
+	return (f.ActorID == "" || e.ActorID == f.ActorID) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Since.IsZero() || !e.OccurredAt.Before(f.Since)) &&
+		(f.Until.IsZero() || e.OccurredAt.Before(f.Until))
+}
+
+// Page sizes of ParseFilter.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// ParseFilter reads a Filter from the query parameters actor, action, since, until (RFC
+// 3339 times), limit and offset of an admin endpoint. limit defaults to DefaultLimit.
+func ParseFilter(q url.Values) (Filter, error) {
+	f := Filter{ActorID: q.Get("actor"), Action: q.Get("action"), Limit: DefaultLimit}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return Filter{}, fmt.Errorf("%s must be an RFC 3339 time", p.name)
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Filter{}, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		f.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Filter{}, errors.New("offset must not be negative")
+		}
+		f.Offset = n
+	}
+	return f, nil
+}
+
+// Store appends events to an audit log and queries them. Events are never changed or
+// deleted once appended.
+type Store interface {
+	// Append stores e and sets its ID
+	Append(ctx context.Context, e *Event) error
+	// Query returns the events matching f, newest first
+	Query(ctx context.Context, f Filter) ([]Event, error)
+}
+
+// Recorder records events of the current request.
+type Recorder interface {
+	// Record completes e with the time, and the actor and client of ctx where e has none,
+	// and appends it. A failure is logged but does not fail the audited operation.
+	Record(ctx context.Context, e Event)
+}
+
+// recorder is a Recorder appending to a Store
+type recorder struct {
+	store  Store
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewRecorder creates a Recorder appending to store.
+func NewRecorder(store Store, logger *slog.Logger) Recorder {
+	return &recorder{store: store, logger: logger, now: time.Now}
+}
+
+func (r *recorder) Record(ctx context.Context, e Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = r.now().UTC()
+	}
+	if e.ActorID == "" && e.ActorEmail == "" {
+		e.ActorID, e.ActorEmail = ActorFrom(ctx)
+	}
+	client := ClientFrom(ctx)
+	if e.IP == "" {
+		e.IP = client.IP
+	}
+	if e.UserAgent == "" {
+		e.UserAgent = client.UserAgent
+	}
+	// The request may have been cancelled once the operation completed
+	if err := r.store.Append(context.WithoutCancel(ctx), &e); err != nil {
+		r.logger.Error("Failed to record audit event",
+			slog.String("action", e.Action),
+			slog.String("actor_id", e.ActorID),
+			slog.String("target_id", e.TargetID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// Discard is a Recorder dropping all events.
+var Discard Recorder = discard{}
+
+type discard struct{}
+
+func (discard) Record(context.Context, Event) {}
+
+// Diff returns the top-level fields of the JSON encodings of before and after that differ.
+// A nil before or after, as for creations and deletions, yields nil and all fields of the
+// other one.
+func Diff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b != nil && a != nil {
+		for k, v := range b {
+			if bytes.Equal(v, a[k]) {
+				delete(b, k)
+				delete(a, k)
+			}
+		}
+	}
+	bj, err := encode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	aj, err := encode(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bj, aj, nil
+}
+
+// fields returns the top-level fields of the JSON object v encodes to, nil for nil
+func fields(v any) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, errors.New("audit: diffed values must encode to JSON objects")
+	}
+	return m, nil
+}
+
+// encode encodes m, nil for a nil map
+func encode(m map[string]json.RawMessage) (json.RawMessage, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Client is the client of a request.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type contextKey int
+
+const (
+	clientKey contextKey = iota
+	actorKey
+)
+
+type actor struct {
+	id, email string
+}
+
+// WithClient returns a copy of ctx carrying client.
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey, client)
+}
+
+// ClientFrom returns the client of ctx, if any.
+func ClientFrom(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey).(Client)
+	return client
+}
+
+// WithActor returns a copy of ctx carrying the authenticated user of a request.
+func WithActor(ctx context.Context, userID, email string) context.Context {
+	return context.WithValue(ctx, actorKey, actor{id: userID, email: email})
+}
+
+// ActorFrom returns the user ID and email of the authenticated user of ctx, if any.
+func ActorFrom(ctx context.Context) (string, string) {
+	a, _ := ctx.Value(actorKey).(actor)
+	return a.id, a.email
+}
+
+// Middleware stores the client of each request in its context. The IP is the peer address,
+// or the first address of X-Forwarded-For with trustProxyHeaders, as clients can set it to
+// anything when the service is not behind a proxy that overwrites it.
+func Middleware(trustProxyHeaders bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if trustProxyHeaders {
+				if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+					ip = strings.TrimSpace(strings.Split(fwd, ",")[0])
+				}
+			}
+			client := Client{IP: ip, UserAgent: r.UserAgent()}
+			next.ServeHTTP(w, r.WithContext(WithClient(r.Context(), client)))
+		})
+	}
+}
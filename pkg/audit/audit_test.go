@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestDiff tests that only changed top-level fields are kept.
+// Table Driven Test Pattern used
+func TestDiff(t *testing.T) {
+	type monitor struct {
+		Address string            `json:"address"`
+		Labels  map[string]string `json:"labels,omitempty"`
+	}
+	tests := []struct {
+		name       string
+		before     any
+		after      any
+		wantBefore string
+		wantAfter  string
+		wantErr    bool
+	}{
+		{
+			name:      "creation",
+			after:     monitor{Address: "https://example.com"},
+			wantAfter: `{"address":"https://example.com"}`,
+		},
+		{
+			name:       "deletion",
+			before:     &monitor{Address: "https://example.com"},
+			after:      (*monitor)(nil),
+			wantBefore: `{"address":"https://example.com"}`,
+		},
+		{
+			name:       "change",
+			before:     monitor{Address: "https://example.com", Labels: map[string]string{"env": "prod"}},
+			after:      monitor{Address: "https://example.org", Labels: map[string]string{"env": "prod"}},
+			wantBefore: `{"address":"https://example.com"}`,
+			wantAfter:  `{"address":"https://example.org"}`,
+		},
+		{
+			name:       "field added",
+			before:     monitor{Address: "https://example.com"},
+			after:      monitor{Address: "https://example.com", Labels: map[string]string{"env": "prod"}},
+			wantBefore: `{}`,
+			wantAfter:  `{"labels":{"env":"prod"}}`,
+		},
+		{
+			name:       "nothing changed",
+			before:     monitor{Address: "https://example.com"},
+			after:      monitor{Address: "https://example.com"},
+			wantBefore: `{}`,
+			wantAfter:  `{}`,
+		},
+		{name: "not an object", before: "a", after: "b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after, err := Diff(tt.before, tt.after)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Diff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(before) != tt.wantBefore || string(after) != tt.wantAfter {
+				t.Errorf("Diff() = %s, %s, want %s, %s", before, after, tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+}
+
+// TestRecorder tests that events are completed from the request context.
+// Table Driven Test Pattern used
+func TestRecorder(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := WithActor(WithClient(context.Background(), Client{IP: "192.0.2.1", UserAgent: "curl/8.0"}), "alice", "alice@example.com")
+
+	tests := []struct {
+		name  string
+		event Event
+		want  Event
+	}{
+		{
+			name:  "from context",
+			event: Event{Action: ActionLogin},
+			want:  Event{OccurredAt: now, Action: ActionLogin, ActorID: "alice", ActorEmail: "alice@example.com", IP: "192.0.2.1", UserAgent: "curl/8.0"},
+		},
+		{
+			name:  "actor of the event",
+			event: Event{Action: ActionLoginFailed, ActorEmail: "bob@example.com"},
+			want:  Event{OccurredAt: now, Action: ActionLoginFailed, ActorEmail: "bob@example.com", IP: "192.0.2.1", UserAgent: "curl/8.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			r := &recorder{store: store, now: func() time.Time { return now }}
+			r.Record(ctx, tt.event)
+
+			got, _ := store.Query(context.Background(), Filter{})
+			if len(got) != 1 {
+				t.Fatalf("%d events recorded, want 1", len(got))
+			}
+			tt.want.ID = got[0].ID
+			if got[0].OccurredAt != tt.want.OccurredAt || got[0].Action != tt.want.Action || got[0].ActorID != tt.want.ActorID ||
+				got[0].ActorEmail != tt.want.ActorEmail || got[0].IP != tt.want.IP || got[0].UserAgent != tt.want.UserAgent {
+				t.Errorf("recorded %+v, want %+v", got[0], tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFilter tests the query parameters of the admin endpoints.
+// Table Driven Test Pattern used
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    Filter
+		wantErr bool
+	}{
+		{name: "defaults", want: Filter{Limit: DefaultLimit}},
+		{
+			name:  "all",
+			query: "actor=alice&action=auth.login&since=2026-01-01T00:00:00Z&until=2026-02-01T00:00:00Z&limit=10&offset=20",
+			want: Filter{
+				ActorID: "alice",
+				Action:  ActionLogin,
+				Since:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				Until:   time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+				Limit:   10,
+				Offset:  20,
+			},
+		},
+		{name: "bad time", query: "since=yesterday", wantErr: true},
+		{name: "limit too large", query: "limit=1001", wantErr: true},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			got, err := ParseFilter(q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.ActorID != tt.want.ActorID || got.Action != tt.want.Action || !got.Since.Equal(tt.want.Since) ||
+				!got.Until.Equal(tt.want.Until) || got.Limit != tt.want.Limit || got.Offset != tt.want.Offset) {
+				t.Errorf("ParseFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMiddleware tests which IP is taken as the client's.
+// Table Driven Test Pattern used
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		trust      bool
+		forwarded  string
+		wantClient Client
+	}{
+		{name: "peer", wantClient: Client{IP: "192.0.2.1", UserAgent: "curl/8.0"}},
+		{name: "forwarded ignored", forwarded: "198.51.100.7", wantClient: Client{IP: "192.0.2.1", UserAgent: "curl/8.0"}},
+		{name: "forwarded trusted", trust: true, forwarded: "198.51.100.7, 10.0.0.1", wantClient: Client{IP: "198.51.100.7", UserAgent: "curl/8.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Client
+			h := Middleware(tt.trust)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = ClientFrom(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:4321"
+			req.Header.Set("User-Agent", "curl/8.0")
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.wantClient {
+				t.Errorf("client = %+v, want %+v", got, tt.wantClient)
+			}
+		})
+	}
+}
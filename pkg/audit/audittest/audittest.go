@@ -0,0 +1,146 @@
+// Package audittest is the conformance suite every audit.Store must pass.
+package audittest
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+)
+
+// Factory returns an empty store.
+type Factory func(t *testing.T) audit.Store
+
+// Run runs the conformance suite against the stores returned by newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Run("AppendAndQuery", func(t *testing.T) { testAppendAndQuery(t, newStore) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newStore) })
+	t.Run("Pages", func(t *testing.T) { testPages(t, newStore) })
+}
+
+var base = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func mustAppend(t *testing.T, s audit.Store, events ...audit.Event) {
+	t.Helper()
+	for i := range events {
+		if err := s.Append(context.Background(), &events[i]); err != nil {
+			t.Fatalf("Append(%s) error = %v", events[i].Action, err)
+		}
+		if events[i].ID == 0 {
+			t.Fatalf("Append(%s) did not set the ID", events[i].Action)
+		}
+	}
+}
+
+func actions(events []audit.Event) []string {
+	var list []string
+	for _, e := range events {
+		list = append(list, e.Action)
+	}
+	return list
+}
+
+func testAppendAndQuery(t *testing.T, newStore Factory) {
+	s := newStore(t)
+	want := audit.Event{
+		OccurredAt: base,
+		Action:     audit.ActionMonitorUpdated,
+		ActorID:    "alice",
+		ActorEmail: "alice@example.com",
+		TargetType: "monitor",
+		TargetID:   "u1",
+		IP:         "192.0.2.1",
+		UserAgent:  "curl/8.0",
+		Before:     json.RawMessage(`{"address":"https://example.com"}`),
+		After:      json.RawMessage(`{"address":"https://example.org"}`),
+	}
+	mustAppend(t, s, want, audit.Event{OccurredAt: base.Add(time.Second), Action: audit.ActionLoginFailed})
+
+	got, err := s.Query(context.Background(), audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Query() returned %d events, want 2", len(got))
+	}
+	e := got[1]
+	if e.ID == 0 || !e.OccurredAt.Equal(want.OccurredAt) || e.Action != want.Action || e.ActorID != want.ActorID ||
+		e.ActorEmail != want.ActorEmail || e.TargetType != want.TargetType || e.TargetID != want.TargetID ||
+		e.IP != want.IP || e.UserAgent != want.UserAgent {
+		t.Errorf("Query()[1] = %+v, want %+v", e, want)
+	}
+	if !jsonEqual(e.Before, want.Before) || !jsonEqual(e.After, want.After) {
+		t.Errorf("Query()[1] before, after = %s, %s, want %s, %s", e.Before, e.After, want.Before, want.After)
+	}
+	if e := got[0]; e.ActorID != "" || e.Before != nil || e.After != nil {
+		t.Errorf("Query()[0] = %+v, want no actor and no changes", e)
+	}
+}
+
+// Table Driven Test Pattern used
+func testFilters(t *testing.T, newStore Factory) {
+	s := newStore(t)
+	mustAppend(t, s,
+		audit.Event{OccurredAt: base, Action: audit.ActionLogin, ActorID: "alice"},
+		audit.Event{OccurredAt: base.Add(time.Minute), Action: audit.ActionLogin, ActorID: "bob"},
+		audit.Event{OccurredAt: base.Add(2 * time.Minute), Action: audit.ActionMonitorCreated, ActorID: "alice"},
+		audit.Event{OccurredAt: base.Add(3 * time.Minute), Action: audit.ActionLoginFailed},
+	)
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   []string
+	}{
+		{name: "all newest first", want: []string{audit.ActionLoginFailed, audit.ActionMonitorCreated, audit.ActionLogin, audit.ActionLogin}},
+		{name: "actor", filter: audit.Filter{ActorID: "alice"}, want: []string{audit.ActionMonitorCreated, audit.ActionLogin}},
+		{name: "action", filter: audit.Filter{Action: audit.ActionLogin}, want: []string{audit.ActionLogin, audit.ActionLogin}},
+		{name: "since is inclusive", filter: audit.Filter{Since: base.Add(2 * time.Minute)}, want: []string{audit.ActionLoginFailed, audit.ActionMonitorCreated}},
+		{name: "until is exclusive", filter: audit.Filter{Until: base.Add(time.Minute)}, want: []string{audit.ActionLogin}},
+		{name: "range and actor", filter: audit.Filter{ActorID: "alice", Since: base.Add(time.Second), Until: base.Add(time.Hour)}, want: []string{audit.ActionMonitorCreated}},
+		{name: "no match", filter: audit.Filter{ActorID: "carol"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Query(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if got := actions(got); !slices.Equal(got, tt.want) {
+				t.Errorf("Query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testPages(t *testing.T, newStore Factory) {
+	s := newStore(t)
+	for i := range 5 {
+		mustAppend(t, s, audit.Event{OccurredAt: base.Add(time.Duration(i) * time.Second), Action: audit.ActionLogin, TargetID: string(rune('a' + i))})
+	}
+
+	got, err := s.Query(context.Background(), audit.Filter{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(got) != 2 || got[0].TargetID != "d" || got[1].TargetID != "c" {
+		t.Errorf("Query() = %+v, want the events d and c", got)
+	}
+	if got, _ := s.Query(context.Background(), audit.Filter{Offset: 5}); len(got) != 0 {
+		t.Errorf("Query() past the end returned %d events, want none", len(got))
+	}
+}
+
+// jsonEqual reports whether a and b encode the same JSON value, as databases may reformat it
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
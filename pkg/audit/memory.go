@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemoryStore is a Store keeping events in memory, for tests and local experiments.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Append(_ context.Context, e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, *e)
+	return nil
+}
+
+func (s *MemoryStore) Query(_ context.Context, f Filter) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []Event
+	for _, e := range slices.Backward(s.events) {
+		if f.Matches(e) {
+			events = append(events, e)
+		}
+	}
+	events = events[min(f.Offset, len(events)):]
+	if f.Limit > 0 && len(events) > f.Limit {
+		events = events[:f.Limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,12 @@
+package audit_test
+
+import (
+	"testing"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/audit/audittest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	audittest.Run(t, func(*testing.T) audit.Store { return audit.NewMemoryStore() })
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// postgresStore is a Store backed by Postgres
+type postgresStore struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewPostgresStore creates a new Store backed by Postgres
+func NewPostgresStore(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) Store {
+	return &postgresStore{db: dbPool, tracer: tracer}
+}
+
+// Append stores an event
+func (s *postgresStore) Append(ctx context.Context, e *Event) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "auditStore.Append")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("audit.action", e.Action))
+	const query = `
+		INSERT INTO audit_events (occurred_at, action, actor_id, actor_email, target_type, target_id, ip, user_agent, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+	err := s.db.QueryRow(ctx, query, e.OccurredAt, e.Action, e.ActorID, e.ActorEmail, e.TargetType, e.TargetID,
+		e.IP, e.UserAgent, nullJSON(e.Before), nullJSON(e.After)).Scan(&e.ID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+// Query lists events, newest first
+func (s *postgresStore) Query(ctx context.Context, f Filter) ([]Event, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "auditStore.Query")
+	defer span.End()
+
+	where, args := auditWhere(f, func(operand string) string { return operand })
+	var limit any // NULL is no limit
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+	args = append(args, limit, f.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM audit_events%s ORDER BY occurred_at DESC, id DESC LIMIT $%d OFFSET $%d`,
+		auditColumns, where, len(args)-1, len(args))
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// nullJSON returns the argument storing m, NULL when it is empty
+func nullJSON(m []byte) any {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+)
+
+// schemaFS holds the audit_events table of the database stores, one directory per backend
+//
+//go:embed schema
+var schemaFS embed.FS
+
+// Migration returns the migration creating the audit_events table on backend, to be applied
+// as version among the migrations of a service, see migrate.New.
+func Migration(backend database.Backend, version int) (migrate.Migration, error) {
+	up, err := schemaFS.ReadFile(fmt.Sprintf("schema/%s/audit_log.up.sql", backend))
+	if err != nil {
+		return migrate.Migration{}, fmt.Errorf("no audit schema for %s: %w", backend, err)
+	}
+	down, err := schemaFS.ReadFile(fmt.Sprintf("schema/%s/audit_log.down.sql", backend))
+	if err != nil {
+		return migrate.Migration{}, fmt.Errorf("no audit schema for %s: %w", backend, err)
+	}
+	return migrate.Migration{Version: version, Name: "audit_log", Up: string(up), Down: string(down)}, nil
+}
+
+// auditColumns are the columns of audit_events in the order of scanAuditEvent
+const auditColumns = `id, occurred_at, action, actor_id, actor_email, target_type, target_id, ip, user_agent, before, after`
+
+// auditWhere returns the WHERE clause and arguments selecting the events of f. compare
+// wraps the time operands, as SQLite compares timestamps with julianday().
+func auditWhere(f Filter, compare func(string) string) (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, fmt.Sprintf("$%d", len(args))))
+	}
+	if f.ActorID != "" {
+		add("actor_id = %s", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = %s", f.Action)
+	}
+	if !f.Since.IsZero() {
+		add(compare("occurred_at")+" >= "+compare("%s"), f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		add(compare("occurred_at")+" < "+compare("%s"), f.Until.UTC())
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// scanAuditEvent scans a row of auditColumns
+func scanAuditEvent(row interface{ Scan(dest ...any) error }) (Event, error) {
+	var e Event
+	var before, after []byte
+	if err := row.Scan(&e.ID, &e.OccurredAt, &e.Action, &e.ActorID, &e.ActorEmail, &e.TargetType, &e.TargetID,
+		&e.IP, &e.UserAgent, &before, &after); err != nil {
+		return Event{}, err
+	}
+	e.Before, e.After = before, after
+	return e, nil
+}
@@ -0,0 +1,17 @@
+-- Append-only log of security and configuration events, see Store
+CREATE TABLE audit_events (
+    id          BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    action      TEXT        NOT NULL,
+    actor_id    TEXT        NOT NULL DEFAULT '',
+    actor_email TEXT        NOT NULL DEFAULT '',
+    target_type TEXT        NOT NULL DEFAULT '',
+    target_id   TEXT        NOT NULL DEFAULT '',
+    ip          TEXT        NOT NULL DEFAULT '',
+    user_agent  TEXT        NOT NULL DEFAULT '',
+    before      JSONB,
+    after       JSONB
+);
+
+CREATE INDEX idx_audit_events_occurred_at ON audit_events (occurred_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id, occurred_at);
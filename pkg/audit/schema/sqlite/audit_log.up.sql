@@ -0,0 +1,17 @@
+-- SQLite counterpart of the Postgres schema
+CREATE TABLE audit_events (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TIMESTAMP NOT NULL,
+    action      TEXT      NOT NULL,
+    actor_id    TEXT      NOT NULL DEFAULT '',
+    actor_email TEXT      NOT NULL DEFAULT '',
+    target_type TEXT      NOT NULL DEFAULT '',
+    target_id   TEXT      NOT NULL DEFAULT '',
+    ip          TEXT      NOT NULL DEFAULT '',
+    user_agent  TEXT      NOT NULL DEFAULT '',
+    before      TEXT,
+    after       TEXT
+);
+
+CREATE INDEX idx_audit_events_occurred_at ON audit_events (occurred_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id, occurred_at);
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sqliteStore is a Store backed by SQLite
+type sqliteStore struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteStore creates a new Store backed by SQLite. The changes of events
+// are stored as JSON text.
+func NewSQLiteStore(db *sql.DB, tracer *otelkit.Tracer) Store {
+	return &sqliteStore{db: db, tracer: tracer}
+}
+
+// Append stores an event
+func (s *sqliteStore) Append(ctx context.Context, e *Event) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "auditStore.Append")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("audit.action", e.Action))
+	const query = `
+		INSERT INTO audit_events (occurred_at, action, actor_id, actor_email, target_type, target_id, ip, user_agent, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+	err := s.db.QueryRowContext(ctx, query, e.OccurredAt.UTC(), e.Action, e.ActorID, e.ActorEmail, e.TargetType, e.TargetID,
+		e.IP, e.UserAgent, nullJSONText(e.Before), nullJSONText(e.After)).Scan(&e.ID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+// Query lists events, newest first
+func (s *sqliteStore) Query(ctx context.Context, f Filter) ([]Event, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "auditStore.Query")
+	defer span.End()
+
+	where, args := auditWhere(f, func(operand string) string { return "julianday(" + operand + ")" })
+	limit := -1 // no limit
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+	args = append(args, limit, f.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM audit_events%s ORDER BY julianday(occurred_at) DESC, id DESC LIMIT $%d OFFSET $%d`,
+		auditColumns, where, len(args)-1, len(args))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// nullJSONText returns the argument storing m as text, NULL when it is empty
+func nullJSONText(m []byte) any {
+	if len(m) == 0 {
+		return nil
+	}
+	return string(m)
+}
@@ -0,0 +1,38 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/audit/audittest"
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	tracer := otelkit.New("test")
+	audittest.Run(t, func(t *testing.T) audit.Store {
+		db, err := database.OpenSQLite("sqlite::memory:")
+		if err != nil {
+			t.Fatalf("OpenSQLite() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		mig, err := audit.Migration(database.SQLite, 1)
+		if err != nil {
+			t.Fatalf("Migration() error = %v", err)
+		}
+		migrator, err := migrate.New(db, database.SQLite, fstest.MapFS{}, "schema_migrations", mig)
+		if err != nil {
+			t.Fatalf("migrate.New() error = %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+		return audit.NewSQLiteStore(db, tracer)
+	})
+}
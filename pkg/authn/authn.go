@@ -0,0 +1,131 @@
+// Package authn resolves bearer tokens to the user they were issued to. Services verify
+// tokens locally with the key set the auth service publishes, ask the auth service over HTTP
+// or, when they run in the same process, validate tokens directly.
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthenticated is returned for missing, invalid or expired tokens.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Scopes of API keys. Tokens of a logged in user carry no scope and may do anything the
+// user may.
+const (
+	ScopeURLsRead  = "urls:read"
+	ScopeURLsWrite = "urls:write"
+)
+
+// Scopes are the scopes an API key can be given.
+var Scopes = []string{ScopeURLsRead, ScopeURLsWrite}
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs.
+const APIKeyPrefix = "hcaas_"
+
+// IsAPIKey reports whether token is an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// Identity is the authenticated user of a request.
+type Identity struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	// Scope is the space separated scopes of an API key; empty for user tokens
+	Scope string `json:"scope,omitempty"`
+}
+
+// HasScope reports whether the identity may act in scope.
+func (id Identity) HasScope(scope string) bool {
+	if id.Scope == "" {
+		return true
+	}
+	for _, s := range strings.Fields(id.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Validator validates bearer tokens.
+type Validator interface {
+	Validate(ctx context.Context, token string) (Identity, error)
+}
+
+// ValidatorFunc adapts a function to the Validator interface.
+type ValidatorFunc func(ctx context.Context, token string) (Identity, error)
+
+func (f ValidatorFunc) Validate(ctx context.Context, token string) (Identity, error) {
+	return f(ctx, token)
+}
+
+// BearerToken returns the token of the Authorization header of r.
+func BearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+type apiKeyValidator struct {
+	apiKeys Validator
+	tokens  Validator
+}
+
+// WithAPIKeys passes API keys to apiKeys and all other tokens to tokens.
+func WithAPIKeys(tokens, apiKeys Validator) Validator {
+	return &apiKeyValidator{apiKeys: apiKeys, tokens: tokens}
+}
+
+func (v *apiKeyValidator) Validate(ctx context.Context, token string) (Identity, error) {
+	if IsAPIKey(token) {
+		return v.apiKeys.Validate(ctx, token)
+	}
+	return v.tokens.Validate(ctx, token)
+}
+
+type remoteValidator struct {
+	validateURL string
+	client      *http.Client
+}
+
+// NewRemoteValidator validates tokens and API keys with the /auth/validate endpoint of the
+// auth service at authServiceURL.
+func NewRemoteValidator(authServiceURL string, client *http.Client) Validator {
+	return &remoteValidator{
+		validateURL: strings.TrimSuffix(authServiceURL, "/") + "/auth/validate",
+		client:      client,
+	}
+}
+
+func (v *remoteValidator) Validate(ctx context.Context, token string) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.validateURL, nil)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to create request to auth service: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to call auth service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("auth service returned status %d: %w", resp.StatusCode, ErrUnauthenticated)
+	}
+
+	var id Identity
+	if err := json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		return Identity{}, fmt.Errorf("failed to decode auth service response: %w", err)
+	}
+	if id.UserID == "" {
+		return Identity{}, fmt.Errorf("auth service response has no user ID: %w", ErrUnauthenticated)
+	}
+	return id, nil
+}
@@ -0,0 +1,87 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRemoteValidator_Validate tests token validation against a fake auth service.
+// Table Driven Test Pattern used
+func TestRemoteValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    Identity
+		wantErr error
+	}{
+		{
+			name:   "valid token",
+			status: http.StatusOK,
+			body:   `{"user_id":"u1","email":"a@example.com"}`,
+			want:   Identity{UserID: "u1", Email: "a@example.com"},
+		},
+		{
+			name:   "api key",
+			status: http.StatusOK,
+			body:   `{"user_id":"u1","email":"a@example.com","scope":"urls:read"}`,
+			want:   Identity{UserID: "u1", Email: "a@example.com", Scope: "urls:read"},
+		},
+		{
+			name:    "rejected token",
+			status:  http.StatusUnauthorized,
+			body:    `invalid or expired token`,
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name:    "response without user",
+			status:  http.StatusOK,
+			body:    `{"email":"a@example.com"}`,
+			wantErr: ErrUnauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/auth/validate" || r.Header.Get("Authorization") != "Bearer tok" {
+					t.Errorf("unexpected request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			got, err := NewRemoteValidator(srv.URL+"/", srv.Client()).Validate(context.Background(), "tok")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Validate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIdentity_HasScope tests the scopes of user tokens and API keys.
+// Table Driven Test Pattern used
+func TestIdentity_HasScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope string
+		want  bool
+	}{
+		{name: "user token", scope: "", want: true},
+		{name: "granted scope", scope: "urls:read urls:write", want: true},
+		{name: "missing scope", scope: "urls:read", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Identity{UserID: "u1", Scope: tt.scope}).HasScope(ScopeURLsWrite); got != tt.want {
+				t.Errorf("HasScope(%s) = %v, want %v", ScopeURLsWrite, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package authn
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+)
+
+// TestJWK_PublicKey tests that public keys survive a JWKS round trip.
+// Table Driven Test Pattern used
+func TestJWK_PublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pub     crypto.PublicKey
+		wantAlg string
+	}{
+		{name: "rsa", pub: &rsaKey.PublicKey, wantAlg: "RS256"},
+		{name: "ed25519", pub: edPub, wantAlg: "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewJWK("", tt.pub)
+			if err != nil {
+				t.Fatalf("NewJWK() error = %v", err)
+			}
+			if k.Algorithm != tt.wantAlg || k.KeyID != k.Thumbprint() {
+				t.Errorf("NewJWK() = %+v, want alg %s and the thumbprint as kid", k, tt.wantAlg)
+			}
+
+			b, err := json.Marshal(JWKS{Keys: []JWK{k}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var set JWKS
+			if err := json.Unmarshal(b, &set); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := set.Key(k.KeyID)
+			if !ok {
+				t.Fatalf("Key(%s) not found in %s", k.KeyID, b)
+			}
+			pub, err := got.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey() error = %v", err)
+			}
+			if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.pub) {
+				t.Errorf("PublicKey() = %v, want %v", pub, tt.pub)
+			}
+		})
+	}
+
+	if _, err := (JWK{KeyType: "OKP", Curve: "X25519", X: "AA"}).PublicKey(); err == nil {
+		t.Error("PublicKey() of an X25519 key error = nil, want an error")
+	}
+}
@@ -0,0 +1,141 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksMaxAge is how long a fetched key set is used before it is fetched again
+	jwksMaxAge = 5 * time.Minute
+	// jwksMinRefetch limits refetches for tokens with unknown key IDs, which anyone can send
+	jwksMinRefetch = 10 * time.Second
+)
+
+// errJWKSUnavailable is returned when the key set cannot be fetched
+var errJWKSUnavailable = errors.New("key set unavailable")
+
+type jwksValidator struct {
+	jwksURL  string
+	client   *http.Client
+	fallback Validator
+	now      func() time.Time
+
+	mu          sync.Mutex
+	keys        JWKS
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+}
+
+// NewJWKSValidator verifies RS256 and EdDSA tokens locally with the key set the auth service
+// at authServiceURL publishes at /.well-known/jwks.json. The key set is cached and fetched
+// again when it is older than five minutes or a token has an unknown key ID.
+//
+// Tokens it cannot verify locally, i.e. HS256 tokens or any token while the key set cannot
+// be fetched, are passed to fallback, e.g. a remote validator; a nil fallback rejects them.
+// Local verification does not see the revocation list of the auth service, so revoked tokens
+// are accepted until they expire.
+func NewJWKSValidator(authServiceURL string, client *http.Client, fallback Validator) Validator {
+	return &jwksValidator{
+		jwksURL:  strings.TrimSuffix(authServiceURL, "/") + "/.well-known/jwks.json",
+		client:   client,
+		fallback: fallback,
+		now:      time.Now,
+	}
+}
+
+func (v *jwksValidator) Validate(ctx context.Context, token string) (Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid, t.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		// HS256 tokens fail with an invalid signing method before the key set is consulted
+		if v.fallback != nil && (errors.Is(err, jwt.ErrTokenSignatureInvalid) && isSymmetric(token) || errors.Is(err, errJWKSUnavailable)) {
+			return v.fallback.Validate(ctx, token)
+		}
+		return Identity{}, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	userID, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if userID == "" {
+		return Identity{}, fmt.Errorf("token has no subject: %w", ErrUnauthenticated)
+	}
+	return Identity{UserID: userID, Email: email}, nil
+}
+
+// isSymmetric reports whether token is signed with an HMAC algorithm
+func isSymmetric(token string) bool {
+	t, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return false
+	}
+	_, ok := t.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// key returns the public key with ID kid for alg, fetching the key set when needed
+func (v *jwksValidator) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	k, ok := v.keys.Key(kid)
+	stale := now.Sub(v.fetchedAt) > jwksMaxAge
+	if (stale || !ok) && now.Sub(v.attemptedAt) > jwksMinRefetch {
+		v.attemptedAt = now
+		// On failure the last key set stays in use while the auth service is unavailable
+		v.fetchErr = v.fetch(ctx)
+		k, ok = v.keys.Key(kid)
+	}
+	if v.fetchedAt.IsZero() {
+		return nil, v.fetchErr
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if k.Algorithm != "" && k.Algorithm != alg {
+		return nil, fmt.Errorf("key %s is not meant for %s", kid, alg)
+	}
+	return k.PublicKey()
+}
+
+// fetch replaces the cached key set. It is called with mu held.
+func (v *jwksValidator) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errJWKSUnavailable, err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errJWKSUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: auth service returned status %d", errJWKSUnavailable, resp.StatusCode)
+	}
+
+	var keys JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return fmt.Errorf("%w: %v", errJWKSUnavailable, err)
+	}
+	v.keys = keys
+	v.fetchedAt = v.now()
+	return nil
+}
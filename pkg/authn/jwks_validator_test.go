@@ -0,0 +1,165 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeJWKS serves the public keys of its signers as the auth service does
+type fakeJWKS struct {
+	mu      sync.Mutex
+	keys    JWKS
+	fetches int
+	down    bool
+}
+
+func (f *fakeJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/.well-known/jwks.json" || f.down {
+		http.NotFound(w, r)
+		return
+	}
+	f.fetches++
+	json.NewEncoder(w).Encode(f.keys)
+}
+
+// publish adds a new Ed25519 key to the set and returns a function signing tokens with it
+func (f *fakeJWKS) publish(t *testing.T) func(claims jwt.MapClaims) string {
+	t.Helper()
+	pub, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewJWK("", pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.keys.Keys = append(f.keys.Keys, k)
+	f.mu.Unlock()
+	return func(claims jwt.MapClaims) string { return sign(t, jwt.SigningMethodEdDSA, k.KeyID, private, claims) }
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key crypto.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestJWKSValidator_Validate tests local verification, key rotation and the fallback.
+// Table Driven Test Pattern used
+func TestJWKSValidator_Validate(t *testing.T) {
+	jwks := &fakeJWKS{}
+	srv := httptest.NewServer(jwks)
+	defer srv.Close()
+
+	fallback := ValidatorFunc(func(ctx context.Context, token string) (Identity, error) {
+		return Identity{UserID: "remote"}, nil
+	})
+	now := time.Now()
+	v := NewJWKSValidator(srv.URL, srv.Client(), fallback).(*jwksValidator)
+	v.now = func() time.Time { return now }
+	noFallback := NewJWKSValidator(srv.URL, srv.Client(), nil)
+
+	signOld := jwks.publish(t)
+	_, foreign, _ := ed25519.GenerateKey(rand.Reader)
+	claims := func(exp time.Time) jwt.MapClaims {
+		return jwt.MapClaims{"sub": "u1", "email": "a@example.com", "exp": exp.Unix()}
+	}
+	valid := claims(now.Add(time.Minute))
+	local := Identity{UserID: "u1", Email: "a@example.com"}
+
+	tests := []struct {
+		name        string
+		validator   Validator
+		token       func() string
+		want        Identity
+		wantErr     error
+		wantFetches int
+	}{
+		{name: "valid token", validator: v, token: func() string { return signOld(valid) }, want: local, wantFetches: 1},
+		{name: "cached key set", validator: v, token: func() string { return signOld(valid) }, want: local, wantFetches: 1},
+		{name: "expired token", validator: v, token: func() string { return signOld(claims(now.Add(-time.Hour))) }, wantErr: ErrUnauthenticated, wantFetches: 1},
+		{
+			name:      "foreign key with a known kid",
+			validator: v,
+			token: func() string {
+				return sign(t, jwt.SigningMethodEdDSA, jwks.keys.Keys[0].KeyID, foreign, valid)
+			},
+			wantErr:     ErrUnauthenticated,
+			wantFetches: 1,
+		},
+		{
+			name:      "unknown kid before the refetch interval",
+			validator: v,
+			token: func() string {
+				return jwks.publish(t)(valid)
+			},
+			wantErr:     ErrUnauthenticated,
+			wantFetches: 1,
+		},
+		{
+			name:      "rotated key fetched",
+			validator: v,
+			token: func() string {
+				now = now.Add(jwksMinRefetch + time.Second)
+				return jwks.publish(t)(valid)
+			},
+			want:        local,
+			wantFetches: 2,
+		},
+		{name: "hs256 token to the fallback", validator: v, token: func() string { return sign(t, jwt.SigningMethodHS256, "", []byte("secret"), valid) }, want: Identity{UserID: "remote"}, wantFetches: 2},
+		{name: "hs256 token without fallback", validator: noFallback, token: func() string { return sign(t, jwt.SigningMethodHS256, "", []byte("secret"), valid) }, wantErr: ErrUnauthenticated, wantFetches: 2},
+		{
+			name:      "stale key set kept while the auth service is down",
+			validator: v,
+			token: func() string {
+				jwks.down = true
+				now = now.Add(jwksMaxAge + time.Second)
+				return signOld(claims(now.Add(time.Minute)))
+			},
+			want:        local,
+			wantFetches: 2,
+		},
+		{
+			name:        "key set unavailable from the start",
+			validator:   NewJWKSValidator(srv.URL, srv.Client(), fallback),
+			token:       func() string { return signOld(valid) },
+			want:        Identity{UserID: "remote"},
+			wantFetches: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.validator.Validate(context.Background(), tt.token())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Validate() = %+v, want %+v", got, tt.want)
+			}
+			if jwks.fetches != tt.wantFetches {
+				t.Errorf("key set fetched %d times, want %d", jwks.fetches, tt.wantFetches)
+			}
+		})
+	}
+}
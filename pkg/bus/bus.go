@@ -0,0 +1,50 @@
+// Package bus abstracts the message broker between the URL and notification services,
+// so deployments can choose between Kafka, NATS JetStream and an in-process bus.
+//
+// Delivery is at-least-once: a message is redelivered until a handler returns nil,
+// so handlers must be idempotent.
+package bus
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned when publishing to or subscribing on a closed bus.
+var ErrClosed = errors.New("bus closed")
+
+// Message is a transport independent message.
+type Message struct {
+	Topic string
+	// Key orders messages: messages with the same key are delivered in publish order
+	// where the transport supports it.
+	Key     string
+	Value   []byte
+	Headers map[string]string
+	// ID identifies the message within the transport (e.g. a stream sequence); it is
+	// stable across redeliveries and set on consumed messages only.
+	ID string
+}
+
+// Publisher publishes messages. Publish returns once the transport has accepted the message.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// Handler processes a consumed message. Returning an error asks for redelivery.
+type Handler func(ctx context.Context, msg Message) error
+
+// Subscriber consumes messages.
+type Subscriber interface {
+	// Subscribe delivers the messages of topic to h until ctx is cancelled. Subscribers
+	// sharing a group split the messages between them; every group receives every message.
+	Subscribe(ctx context.Context, topic, group string, h Handler) error
+	Close() error
+}
+
+// Bus both publishes and consumes messages.
+type Bus interface {
+	Publisher
+	Subscriber
+}
@@ -0,0 +1,162 @@
+package bus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	memoryQueueSize      = 1024
+	memoryRedeliverDelay = time.Second
+)
+
+// Memory is an in-process bus for single binary deployments and tests.
+// Messages are lost when the process exits.
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	seq    uint64
+	closed chan struct{}
+	once   sync.Once
+}
+
+type memoryTopic struct {
+	groups map[string]*memoryGroup
+	// backlog keeps messages published before the first subscriber joined
+	backlog []Message
+}
+
+// memoryGroup is the queue shared by the subscribers of one group. It is dropped, and gone
+// is closed, when the last subscriber returns.
+type memoryGroup struct {
+	queue   chan Message
+	members int
+	gone    chan struct{}
+}
+
+// NewMemory creates an empty in-memory bus.
+func NewMemory() *Memory {
+	return &Memory{topics: map[string]*memoryTopic{}, closed: make(chan struct{})}
+}
+
+// Publish hands msg to every group subscribed to its topic. It blocks while a group's
+// queue is full, until the group has no subscribers left.
+func (m *Memory) Publish(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	select {
+	case <-m.closed:
+		m.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	m.seq++
+	msg.ID = strconv.FormatUint(m.seq, 10)
+	t := m.topic(msg.Topic)
+	if len(t.groups) == 0 {
+		t.backlog = append(t.backlog, msg)
+		m.mu.Unlock()
+		return nil
+	}
+	groups := make([]*memoryGroup, 0, len(t.groups))
+	for _, g := range t.groups {
+		groups = append(groups, g)
+	}
+	m.mu.Unlock()
+
+	for _, g := range groups {
+		select {
+		case g.queue <- msg:
+		case <-g.gone:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.closed:
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+// Subscribe consumes topic as a member of group until ctx is cancelled or the bus is closed.
+// Messages the handler fails on are redelivered after a short delay. Messages still queued
+// for the group are dropped when its last subscriber returns.
+func (m *Memory) Subscribe(ctx context.Context, topic, group string, h Handler) error {
+	m.mu.Lock()
+	t := m.topic(topic)
+	g, ok := t.groups[group]
+	if !ok {
+		g = &memoryGroup{queue: make(chan Message, memoryQueueSize), gone: make(chan struct{})}
+		t.groups[group] = g
+	}
+	g.members++
+	backlog := t.backlog
+	t.backlog = nil
+	m.mu.Unlock()
+	defer m.leave(t, group, g)
+
+	for _, msg := range backlog {
+		m.deliver(ctx, g, msg, h)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.closed:
+			return ErrClosed
+		case msg := <-g.queue:
+			m.deliver(ctx, g, msg, h)
+		}
+	}
+}
+
+// leave removes a subscriber from g and drops the group once it has no subscribers, so
+// Publish no longer waits on its queue.
+func (m *Memory) leave(t *memoryTopic, name string, g *memoryGroup) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g.members--
+	if g.members == 0 {
+		delete(t.groups, name)
+		close(g.gone)
+	}
+}
+
+func (m *Memory) deliver(ctx context.Context, g *memoryGroup, msg Message, h Handler) {
+	if err := h(ctx, msg); err == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-time.After(memoryRedeliverDelay):
+		case <-ctx.Done():
+			return
+		case <-m.closed:
+			return
+		}
+		select {
+		case g.queue <- msg:
+		case <-g.gone:
+		case <-ctx.Done():
+		case <-m.closed:
+		}
+	}()
+}
+
+// Close stops all subscriptions and rejects further publishes.
+func (m *Memory) Close() error {
+	m.once.Do(func() { close(m.closed) })
+	return nil
+}
+
+// topic returns the topic state, creating it if needed. The caller must hold m.mu.
+func (m *Memory) topic(name string) *memoryTopic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: map[string]*memoryGroup{}}
+		m.topics[name] = t
+	}
+	return t
+}
+
+var _ Bus = (*Memory)(nil)
@@ -0,0 +1,123 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemory_DeliversBacklogToEveryGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := NewMemory()
+	defer m.Close()
+
+	// Published before anyone subscribed
+	if err := m.Publish(ctx, Message{Topic: "events", Value: []byte("first")}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	got := make(chan string, 4)
+	go m.Subscribe(ctx, "events", "a", func(_ context.Context, msg Message) error {
+		got <- "a:" + string(msg.Value)
+		return nil
+	})
+	if v := <-got; v != "a:first" {
+		t.Fatalf("backlog delivered %q, want a:first", v)
+	}
+
+	go m.Subscribe(ctx, "events", "b", func(_ context.Context, msg Message) error {
+		got <- "b:" + string(msg.Value)
+		return nil
+	})
+	// Wait until group b is registered before publishing
+	for {
+		m.mu.Lock()
+		n := len(m.topics["events"].groups)
+		m.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := m.Publish(ctx, Message{Topic: "events", Value: []byte("second")}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	seen := map[string]bool{<-got: true, <-got: true}
+	if !seen["a:second"] || !seen["b:second"] {
+		t.Errorf("fan-out delivered %v, want both groups", seen)
+	}
+}
+
+func TestMemory_RedeliversOnHandlerError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := NewMemory()
+	defer m.Close()
+
+	var calls atomic.Int32
+	done := make(chan string, 1)
+	go m.Subscribe(ctx, "events", "a", func(_ context.Context, msg Message) error {
+		if calls.Add(1) == 1 {
+			return errors.New("temporary failure")
+		}
+		done <- msg.ID
+		return nil
+	})
+	if err := m.Publish(ctx, Message{Topic: "events", Value: []byte("x")}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case id := <-done:
+		if id == "" {
+			t.Error("redelivered message has no ID")
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not redelivered")
+	}
+}
+
+func TestMemory_Closed(t *testing.T) {
+	m := NewMemory()
+	m.Close()
+	if err := m.Publish(context.Background(), Message{Topic: "events"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestMemory_DropsGroupWhenSubscriberReturns(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := NewMemory()
+	defer m.Close()
+
+	subCtx, stop := context.WithCancel(ctx)
+	started := make(chan struct{})
+	returned := make(chan error, 1)
+	go func() {
+		returned <- m.Subscribe(subCtx, "events", "a", func(context.Context, Message) error {
+			close(started)
+			return nil
+		})
+	}()
+	if err := m.Publish(ctx, Message{Topic: "events"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	<-started
+	stop()
+	<-returned
+
+	// With the group still registered, publishing past its queue size would block
+	for i := 0; i < memoryQueueSize+1; i++ {
+		if err := m.Publish(ctx, Message{Topic: "events"}); err != nil {
+			t.Fatalf("Publish() #%d error = %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package natsbus implements the bus interfaces on NATS JetStream.
+//
+// All topics are stored in a single stream whose subjects are "<prefix>.<topic>".
+// Every subscriber group gets a durable consumer per topic, so messages survive
+// restarts and are redelivered until they are acknowledged.
+package natsbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+)
+
+const (
+	// headerKey carries the message key, which has no native JetStream equivalent
+	headerKey = "Hcaas-Key"
+	// redeliverDelay is how long a message the handler failed on waits before redelivery
+	redeliverDelay = time.Second
+)
+
+// Bus is a JetStream backed bus.Publisher and bus.Subscriber.
+type Bus struct {
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	stream string
+	prefix string
+}
+
+// Connect connects to the NATS server at url and makes sure the stream exists.
+func Connect(ctx context.Context, url, stream, prefix string) (*Bus, error) {
+	nc, err := nats.Connect(url, nats.Name("hcaas"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+	}
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     stream,
+		Subjects: []string{prefix + ".>"},
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to create stream %s: %w", stream, err)
+	}
+	return &Bus{nc: nc, js: js, stream: stream, prefix: prefix}, nil
+}
+
+// Publish stores msg in the stream and waits for the JetStream acknowledgement.
+func (b *Bus) Publish(ctx context.Context, msg bus.Message) error {
+	m := nats.NewMsg(b.subject(msg.Topic))
+	m.Data = msg.Value
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+	if msg.Key != "" {
+		m.Header.Set(headerKey, msg.Key)
+	}
+	if _, err := b.js.PublishMsg(ctx, m); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", m.Subject, err)
+	}
+	return nil
+}
+
+// Subscribe consumes topic through the durable consumer of group until ctx is cancelled.
+// Messages are acknowledged when h succeeds and negatively acknowledged otherwise.
+func (b *Bus) Subscribe(ctx context.Context, topic, group string, h bus.Handler) error {
+	cons, err := b.js.CreateOrUpdateConsumer(ctx, b.stream, jetstream.ConsumerConfig{
+		Durable:       durableName(group, topic),
+		FilterSubject: b.subject(topic),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer for %s: %w", topic, err)
+	}
+
+	cc, err := cons.Consume(func(m jetstream.Msg) {
+		msg := bus.Message{
+			Topic:   topic,
+			Key:     m.Headers().Get(headerKey),
+			Value:   m.Data(),
+			Headers: map[string]string{},
+		}
+		for k := range m.Headers() {
+			if k != headerKey {
+				msg.Headers[k] = m.Headers().Get(k)
+			}
+		}
+		if meta, err := m.Metadata(); err == nil {
+			msg.ID = fmt.Sprintf("nats:%s:%d", meta.Stream, meta.Sequence.Stream)
+		}
+
+		if err := h(ctx, msg); err != nil {
+			_ = m.NakWithDelay(redeliverDelay)
+			return
+		}
+		_ = m.Ack()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %w", topic, err)
+	}
+	defer cc.Stop()
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Close drains the connection.
+func (b *Bus) Close() error {
+	return b.nc.Drain()
+}
+
+func (b *Bus) subject(topic string) string {
+	return b.prefix + "." + topic
+}
+
+// durableName derives a consumer name; JetStream names may not contain '.', '*', '>' or spaces.
+func durableName(group, topic string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(group + "_" + topic)
+}
+
+var _ bus.Bus = (*Bus)(nil)
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// TestBackendOf tests backend selection by DSN scheme.
+// Table Driven Test Pattern used
+func TestBackendOf(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		want    Backend
+		wantErr bool
+	}{
+		{dsn: "postgres://u:p@localhost:5432/db", want: Postgres},
+		{dsn: "postgresql://localhost/db", want: Postgres},
+		{dsn: "sqlite://hcaas.db", want: SQLite},
+		{dsn: "sqlite::memory:", want: SQLite},
+		{dsn: "file:hcaas.db?mode=rwc", want: SQLite},
+		{dsn: "mysql://localhost/db", wantErr: true},
+		{dsn: "hcaas.db", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			got, err := BackendOf(tt.dsn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BackendOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BackendOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hcaas.db")
+	db, err := OpenSQLite("sqlite://" + path)
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	defer db.Close()
+
+	var foreignKeys int
+	if err := db.QueryRowContext(context.Background(), "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		t.Fatalf("PRAGMA foreign_keys: %v", err)
+	}
+	if foreignKeys != 1 {
+		t.Errorf("foreign_keys = %d, want 1", foreignKeys)
+	}
+	var journal string
+	if err := db.QueryRowContext(context.Background(), "PRAGMA journal_mode").Scan(&journal); err != nil {
+		t.Fatalf("PRAGMA journal_mode: %v", err)
+	}
+	if journal != "wal" {
+		t.Errorf("journal_mode = %q, want wal", journal)
+	}
+}
+
+func TestIsSQLiteUniqueViolation(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenSQLite("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE t (id TEXT PRIMARY KEY, email TEXT UNIQUE)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES ('1', 'a@example.com')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO t VALUES ('2', 'a@example.com')")
+	if !IsSQLiteUniqueViolation(err) {
+		t.Errorf("IsSQLiteUniqueViolation(%v) = false, want true", err)
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO t VALUES ('1', 'b@example.com')")
+	if !IsSQLiteUniqueViolation(err) {
+		t.Errorf("IsSQLiteUniqueViolation(%v) = false, want true for primary key", err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO missing VALUES (1)"); IsSQLiteUniqueViolation(err) {
+		t.Errorf("IsSQLiteUniqueViolation(%v) = true, want false", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Package events defines the event contract shared by the URL service, which
+// produces notification events, and the notification service, which consumes them.
+//
+// The contract is versioned. Additive changes (new optional fields) keep the
+// version; anything that breaks existing producers or consumers (removing or
+// renaming a field, adding a required field, narrowing an enum) needs a new
+// SchemaVersion. The compatibility tests replay the golden payloads of every
+// released version to catch accidental breaking changes.
+package events
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion is the version of the notification event schema produced by this package.
+const SchemaVersion = 1
+
+// HeaderSchemaVersion is the Kafka header carrying the schema version of an event.
+const HeaderSchemaVersion = "schema_version"
+
+// Notification types.
+const (
+	TypeURLUnhealthy = "url_unhealthy"
+	TypeURLRecovered = "url_recovered"
+)
+
+// Notification severities.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+var (
+	// ErrInvalidEvent is returned for events that violate the schema.
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrUnsupportedVersion is returned for events newer than this package understands.
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+)
+
+// NotificationSchema is the JSON Schema of the Notification event.
+//
+//go:embed schema/notification.v1.schema.json
+var NotificationSchema []byte
+
+// Notification is published by the URL service when the health of a URL changes.
+type Notification struct {
+	// EventID uniquely identifies the event; consumers use it to drop redelivered messages.
+	EventID string `json:"event_id"`
+	URLID   string `json:"url_id"`
+	UserID  string `json:"user_id,omitempty"`
+	Type    string `json:"type"`
+	// Severity is used by routing rules of the notification service.
+	Severity string `json:"severity,omitempty"`
+	// IncidentKey stays the same for the trigger and the recovery of a URL,
+	// so alerting tools can deduplicate and auto-resolve incidents.
+	IncidentKey string            `json:"incident_key,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// IncidentKey returns the stable incident/dedup key for a monitored URL.
+func IncidentKey(urlID string) string {
+	return "hcaas-url-" + urlID
+}
+
+// Validate checks n against the schema.
+func (n *Notification) Validate() error {
+	switch {
+	case n.EventID == "":
+		return fmt.Errorf("event_id is required: %w", ErrInvalidEvent)
+	case n.URLID == "":
+		return fmt.Errorf("url_id is required: %w", ErrInvalidEvent)
+	case !slices.Contains([]string{TypeURLUnhealthy, TypeURLRecovered}, n.Type):
+		return fmt.Errorf("unknown type %q: %w", n.Type, ErrInvalidEvent)
+	case n.Severity != "" && !slices.Contains([]string{SeverityCritical, SeverityWarning, SeverityInfo}, n.Severity):
+		return fmt.Errorf("unknown severity %q: %w", n.Severity, ErrInvalidEvent)
+	case n.CreatedAt.IsZero():
+		return fmt.Errorf("created_at is required: %w", ErrInvalidEvent)
+	}
+	return nil
+}
+
+// CheckSchemaVersion verifies that an event with the given schema_version header can be
+// consumed. Events without the header predate versioning and are treated as version 1.
+func CheckSchemaVersion(header string) error {
+	if header == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(header)
+	if err != nil || v < 1 {
+		return fmt.Errorf("malformed schema version %q: %w", header, ErrInvalidEvent)
+	}
+	if v > SchemaVersion {
+		return fmt.Errorf("version %d, latest supported is %d: %w", v, SchemaVersion, ErrUnsupportedVersion)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCompatibility_GoldenPayloads decodes the payloads of every released schema version.
+// They must still decode, validate and keep all of their fields when re-encoded; a failure
+// here means the change breaks existing producers or consumers and needs a new SchemaVersion.
+func TestCompatibility_GoldenPayloads(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "v*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden payloads found")
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var n Notification
+			if err := json.Unmarshal(raw, &n); err != nil {
+				t.Fatalf("golden payload no longer decodes: %v", err)
+			}
+			if err := n.Validate(); err != nil {
+				t.Fatalf("golden payload no longer validates: %v", err)
+			}
+
+			encoded, err := json.Marshal(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, got map[string]any
+			if err := json.Unmarshal(raw, &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(encoded, &got); err != nil {
+				t.Fatal(err)
+			}
+			for field, v := range want {
+				if !reflect.DeepEqual(got[field], v) {
+					t.Errorf("field %q changed on round trip: got %v, want %v", field, got[field], v)
+				}
+			}
+		})
+	}
+}
+
+// TestCompatibility_SchemaMatchesStruct keeps the JSON Schema and the Go struct in sync.
+func TestCompatibility_SchemaMatchesStruct(t *testing.T) {
+	var schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(NotificationSchema, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+
+	fields := map[string]bool{}
+	typ := reflect.TypeFor[Notification]()
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("field %q is missing from the schema", name)
+		}
+	}
+	for name := range schema.Properties {
+		if !fields[name] {
+			t.Errorf("schema property %q has no struct field", name)
+		}
+	}
+
+	// Required properties must exist on the struct
+	for _, name := range schema.Required {
+		if !fields[name] {
+			t.Errorf("required property %q has no struct field", name)
+		}
+	}
+	if err := (&Notification{}).Validate(); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Validate() of an empty event = %v, want ErrInvalidEvent", err)
+	}
+}
+
+// TestCompatibility_SchemaAgreesWithValidate checks the golden payloads and variants of them
+// against both the embedded JSON Schema and Validate, so the two cannot drift apart.
+// Table Driven Test Pattern used
+func TestCompatibility_SchemaAgreesWithValidate(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal(NotificationSchema, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "v1", "full.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant := func(mutate func(doc map[string]any)) []byte {
+		var doc map[string]any
+		if err := json.Unmarshal(golden, &doc); err != nil {
+			t.Fatal(err)
+		}
+		mutate(doc)
+		raw, _ := json.Marshal(doc)
+		return raw
+	}
+
+	files, _ := filepath.Glob(filepath.Join("testdata", "v*", "*.json"))
+	tests := []struct {
+		name      string
+		payload   []byte
+		wantValid bool
+	}{
+		{name: "unknown property", payload: variant(func(d map[string]any) { d["region"] = "eu" }), wantValid: true},
+		{name: "missing event_id", payload: variant(func(d map[string]any) { delete(d, "event_id") })},
+		{name: "empty url_id", payload: variant(func(d map[string]any) { d["url_id"] = "" })},
+		{name: "unknown type", payload: variant(func(d map[string]any) { d["type"] = "url_exploded" })},
+		{name: "unknown severity", payload: variant(func(d map[string]any) { d["severity"] = "meh" })},
+		{name: "missing created_at", payload: variant(func(d map[string]any) { delete(d, "created_at") })},
+		{name: "created_at not a date-time", payload: variant(func(d map[string]any) { d["created_at"] = "yesterday" })},
+		{name: "label not a string", payload: variant(func(d map[string]any) { d["labels"] = map[string]any{"env": 1} })},
+		{name: "event_id not a string", payload: variant(func(d map[string]any) { d["event_id"] = 42 })},
+	}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, struct {
+			name      string
+			payload   []byte
+			wantValid bool
+		}{name: file, payload: raw, wantValid: true})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc any
+			if err := json.Unmarshal(tt.payload, &doc); err != nil {
+				t.Fatal(err)
+			}
+			violations := schemaViolations(schema, doc, "$")
+			if schemaValid := len(violations) == 0; schemaValid != tt.wantValid {
+				t.Errorf("schema valid = %v, want %v (violations: %v)", schemaValid, tt.wantValid, violations)
+			}
+
+			var n Notification
+			err := json.Unmarshal(tt.payload, &n)
+			if err == nil {
+				err = n.Validate()
+			}
+			if (err == nil) != tt.wantValid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.wantValid)
+			}
+		})
+	}
+}
+
+// schemaViolations checks doc against the subset of JSON Schema used by NotificationSchema:
+// type, required, properties, additionalProperties, enum, minLength and the date-time format.
+func schemaViolations(schema map[string]any, doc any, path string) []string {
+	var violations []string
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, doc) {
+		violations = append(violations, path+": not one of the enum values")
+	}
+	switch schema["type"] {
+	case "string":
+		s, ok := doc.(string)
+		if !ok {
+			return append(violations, path+": not a string")
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len(s)) < minLength {
+			violations = append(violations, path+": shorter than minLength")
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				violations = append(violations, path+": not a date-time")
+			}
+		}
+	case "object":
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return append(violations, path+": not an object")
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				violations = append(violations, path+": missing "+name.(string))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, v := range obj {
+			sub, ok := properties[name].(map[string]any)
+			if !ok {
+				sub, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if ok {
+				violations = append(violations, schemaViolations(sub, v, path+"."+name)...)
+			}
+		}
+	}
+	return violations
+}
+
+// TestNotification_Validate tests the schema rules enforced on producers and consumers.
+// Table Driven Test Pattern used
+func TestNotification_Validate(t *testing.T) {
+	valid := func() Notification {
+		return Notification{
+			EventID:   "evt-1",
+			URLID:     "url-1",
+			Type:      TypeURLUnhealthy,
+			Severity:  SeverityCritical,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(n *Notification)
+		wantErr bool
+	}{
+		{name: "valid", mutate: func(n *Notification) {}},
+		{name: "severity is optional", mutate: func(n *Notification) { n.Severity = "" }},
+		{name: "missing event id", mutate: func(n *Notification) { n.EventID = "" }, wantErr: true},
+		{name: "missing url id", mutate: func(n *Notification) { n.URLID = "" }, wantErr: true},
+		{name: "unknown type", mutate: func(n *Notification) { n.Type = "url_exploded" }, wantErr: true},
+		{name: "unknown severity", mutate: func(n *Notification) { n.Severity = "meh" }, wantErr: true},
+		{name: "missing created_at", mutate: func(n *Notification) { n.CreatedAt = time.Time{} }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := valid()
+			tt.mutate(&n)
+			err := n.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestCheckSchemaVersion tests which schema_version headers can be consumed.
+// Table Driven Test Pattern used
+func TestCheckSchemaVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		wantErr error
+	}{
+		{header: "", wantErr: nil},
+		{header: "1", wantErr: nil},
+		{header: "2", wantErr: ErrUnsupportedVersion},
+		{header: "0", wantErr: ErrInvalidEvent},
+		{header: "v1", wantErr: ErrInvalidEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if err := CheckSchemaVersion(tt.header); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckSchemaVersion(%q) = %v, want %v", tt.header, err, tt.wantErr)
+			}
+		})
+	}
+}
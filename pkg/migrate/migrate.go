@@ -0,0 +1,258 @@
+// Package migrate applies versioned SQL migrations embedded in a service and records the
+// applied versions in a schema table of the database.
+//
+// Migrations are files named <version>_<name>.up.sql with an optional
+// <version>_<name>.down.sql reverting them, e.g. 0001_init.up.sql. Each migration runs in
+// its own transaction together with the update of the schema table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+)
+
+// ErrNoDown is returned when a migration to be reverted has no down script.
+var ErrNoDown = errors.New("migration has no down script")
+
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied. AppliedAt is nil for pending migrations.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the migrations of one service to a database.
+type Migrator struct {
+	db         *sql.DB
+	backend    database.Backend
+	table      string
+	migrations []Migration
+}
+
+// New loads the migrations in the root of fsys and adds shared, the migrations of schemas
+// kept by shared packages, at the versions the service gives them. Applied versions are
+// recorded in table, which must be unique per service when services share a database.
+func New(db *sql.DB, backend database.Backend, fsys fs.FS, table string, shared ...Migration) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range shared {
+		if i := slices.IndexFunc(migrations, func(m Migration) bool { return m.Version == mig.Version }); i >= 0 {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", mig.Version, migrations[i].Name, mig.Name)
+		}
+		migrations = append(migrations, mig)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return &Migrator{db: db, backend: backend, table: table, migrations: migrations}, nil
+}
+
+// load reads the migrations of fsys in version order
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := fileRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+// Up applies all pending migrations in version order and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, mig := range m.migrations {
+		done, err := m.inTx(ctx, func(tx *sql.Tx) (bool, error) {
+			if ok, err := m.isApplied(ctx, tx, mig.Version); err != nil || ok {
+				return false, err
+			}
+			if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+				return false, err
+			}
+			insert := fmt.Sprintf(`INSERT INTO %s (version, name, applied_at) VALUES ($1, $2, $3)`, m.table)
+			_, err := tx.ExecContext(ctx, insert, mig.Version, mig.Name, time.Now().UTC())
+			return err == nil, err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		if done {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// Down reverts the last n applied migrations in reverse version order and returns how many
+// were reverted.
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(statuses) - 1; i >= 0 && reverted < n; i-- {
+		mig := statuses[i].Migration
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		if mig.Down == "" {
+			return reverted, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, ErrNoDown)
+		}
+		_, err := m.inTx(ctx, func(tx *sql.Tx) (bool, error) {
+			if ok, err := m.isApplied(ctx, tx, mig.Version); err != nil || !ok {
+				return false, err
+			}
+			if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+				return false, err
+			}
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, m.table), mig.Version)
+			return err == nil, err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// Status returns the known migrations in version order with the time they were applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`SELECT version, applied_at FROM %s`, m.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i].Migration = mig
+		if at, ok := appliedAt[mig.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// ensureTable creates the schema table when it does not exist yet
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	timestamp := "TIMESTAMPTZ"
+	if m.backend == database.SQLite {
+		timestamp = "TIMESTAMP"
+	}
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at %s NOT NULL
+	)`, m.table, timestamp)
+	if _, err := m.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema table %s: %w", m.table, err)
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction that is committed when fn succeeds. On Postgres the
+// transaction holds an advisory lock of the schema table, so replicas starting together
+// apply each migration once; SQLite serializes writers anyway.
+func (m *Migrator) inTx(ctx context.Context, fn func(tx *sql.Tx) (bool, error)) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if m.backend == database.Postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, m.table); err != nil {
+			return false, fmt.Errorf("failed to lock schema table: %w", err)
+		}
+	}
+	done, err := fn(tx)
+	if err != nil {
+		return false, err
+	}
+	return done, tx.Commit()
+}
+
+// isApplied reports whether version is recorded in the schema table
+func (m *Migrator) isApplied(ctx context.Context, tx *sql.Tx, version int) (bool, error) {
+	var n int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE version = $1`, m.table)
+	if err := tx.QueryRowContext(ctx, query, version).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to read schema table: %w", err)
+	}
+	return n > 0, nil
+}
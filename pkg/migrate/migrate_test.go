@@ -0,0 +1,154 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+)
+
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	db, err := database.OpenSQLite("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := New(db, database.SQLite, fsys, "schema_migrations")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return m
+}
+
+var testMigrations = fstest.MapFS{
+	"0001_users.up.sql":   {Data: []byte("CREATE TABLE users (id TEXT PRIMARY KEY);")},
+	"0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"0002_email.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT; CREATE INDEX idx_email ON users (email);")},
+	"0002_email.down.sql": {Data: []byte("DROP INDEX idx_email; ALTER TABLE users DROP COLUMN email;")},
+	"0003_seed.up.sql":    {Data: []byte("INSERT INTO users (id, email) VALUES ('1', 'a@example.com');")},
+	"README.md":           {Data: []byte("not a migration")},
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, testMigrations)
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name        string
+		run         func() (int, error)
+		want        int
+		wantErr     error
+		wantApplied []bool
+	}{
+		{name: "up applies all", run: func() (int, error) { return m.Up(ctx) }, want: 3, wantApplied: []bool{true, true, true}},
+		{name: "up is idempotent", run: func() (int, error) { return m.Up(ctx) }, want: 0, wantApplied: []bool{true, true, true}},
+		{name: "down without script", run: func() (int, error) { return m.Down(ctx, 1) }, wantErr: ErrNoDown, wantApplied: []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d migrations, want %d", got, tt.want)
+			}
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			for i, s := range statuses {
+				if (s.AppliedAt != nil) != tt.wantApplied[i] {
+					t.Errorf("migration %d applied = %v, want %v", s.Version, s.AppliedAt != nil, tt.wantApplied[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDownReverts(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{}
+	for name, f := range testMigrations {
+		if !strings.HasPrefix(name, "0003") {
+			fsys[name] = f
+		}
+	}
+	m := newTestMigrator(t, fsys)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	if n, err := m.Down(ctx, 5); err != nil || n != 2 {
+		t.Fatalf("Down(5) = %d, %v, want 2 reverted", n, err)
+	}
+	if _, err := m.db.ExecContext(ctx, "SELECT 1 FROM users"); err == nil {
+		t.Error("users table exists after reverting all migrations")
+	}
+	if n, err := m.Up(ctx); err != nil || n != 2 {
+		t.Errorf("Up() after Down() = %d, %v, want 2 applied", n, err)
+	}
+}
+
+func TestNewRejectsInvalidMigrations(t *testing.T) {
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name   string
+		fsys   fstest.MapFS
+		shared []Migration
+	}{
+		{name: "down without up", fsys: fstest.MapFS{"0001_a.down.sql": {Data: []byte("SELECT 1")}}},
+		{name: "conflicting names", fsys: fstest.MapFS{
+			"0001_a.up.sql": {Data: []byte("SELECT 1")},
+			"0001_b.up.sql": {Data: []byte("SELECT 1")},
+		}},
+		{
+			name:   "shared migration at a taken version",
+			fsys:   fstest.MapFS{"0001_a.up.sql": {Data: []byte("SELECT 1")}},
+			shared: []Migration{{Version: 1, Name: "shared", Up: "SELECT 1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(nil, database.SQLite, tt.fsys, "schema_migrations", tt.shared...); err == nil {
+				t.Error("New() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, testMigrations)
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: []string{"status"}, want: "0001_users\tpending"},
+		{args: []string{"up"}, want: "applied 3 migration(s)"},
+		{args: []string{"status"}, want: "0003_seed\tapplied"},
+		{args: []string{"down", "x"}, wantErr: true},
+		{args: []string{"sideways"}, wantErr: true},
+		{args: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var out strings.Builder
+			err := Run(ctx, m, tt.args, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("Run() output = %q, want it to contain %q", out.String(), tt.want)
+			}
+		})
+	}
+}
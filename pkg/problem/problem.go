@@ -0,0 +1,132 @@
+// Package problem is the error model of the HTTP APIs. Errors carry a Code, which selects the
+// HTTP status, and are written as RFC 7807 problem details (application/problem+json).
+//
+// Services declare their errors as sentinels with New and return them, or instances of them
+// with a more specific message or a cause, made with Errorf and Wrap. errors.Is matches an
+// instance with its sentinel, and handlers write any of them with Write.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code classifies an error. It is part of the response, so clients can tell problems apart
+// without parsing messages.
+type Code string
+
+// Codes of the APIs.
+const (
+	CodeInvalidInput    Code = "invalid_input"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeTooManyRequests Code = "too_many_requests"
+	CodeInternal        Code = "internal"
+	CodeUnavailable     Code = "unavailable"
+)
+
+var statuses = map[Code]int{
+	CodeInvalidInput:    http.StatusBadRequest,
+	CodeUnauthorized:    http.StatusUnauthorized,
+	CodeForbidden:       http.StatusForbidden,
+	CodeNotFound:        http.StatusNotFound,
+	CodeConflict:        http.StatusConflict,
+	CodeTooManyRequests: http.StatusTooManyRequests,
+	CodeInternal:        http.StatusInternalServerError,
+	CodeUnavailable:     http.StatusServiceUnavailable,
+}
+
+// Status returns the HTTP status of c, 500 for unknown codes.
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error with a Code.
+type Error struct {
+	Code Code
+	// Message describes the problem to clients, so it must not reveal internals
+	Message string
+	// Err is the cause, which is logged but not shown to clients
+	Err error
+	// kind is the sentinel the error is an instance of, nil for sentinels
+	kind *Error
+}
+
+// New returns a sentinel error of code.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf returns an error of the kind of sentinel with a more specific message.
+func Errorf(kind *Error, format string, args ...any) error {
+	return &Error{Code: kind.Code, Message: fmt.Sprintf(format, args...), kind: kind}
+}
+
+// Wrap returns an error of the kind of sentinel with message, caused by err.
+func Wrap(kind *Error, err error, message string) error {
+	return &Error{Code: kind.Code, Message: message, Err: err, kind: kind}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the sentinel and the cause of e.
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.kind != nil {
+		errs = append(errs, e.kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Details are the problem details of RFC 7807 with the code as an extension member. Type is
+// always about:blank, so Title is the HTTP status text.
+type Details struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   Code   `json:"code"`
+}
+
+// Write writes err as problem details. Errors without a Code are internal; their messages
+// are not shown to clients, as they may reveal internals.
+func Write(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = New(CodeInternal, "internal server error")
+	}
+	Respond(w, e.Code, e.Message)
+}
+
+// Respond writes problem details of code with detail.
+func Respond(w http.ResponseWriter, code Code, detail string) {
+	status := code.Status()
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	})
+}
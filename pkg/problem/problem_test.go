@@ -0,0 +1,114 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestWrite tests the problem details written for errors and that instances match their
+// sentinels.
+// Table Driven Test Pattern used
+func TestWrite(t *testing.T) {
+	errNotFound := New(CodeNotFound, "not found")
+	errInternal := New(CodeInternal, "internal error")
+	cause := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantIs     error
+		wantStatus int
+		wantDetail string
+		wantCode   Code
+	}{
+		{
+			name:       "sentinel",
+			err:        errNotFound,
+			wantIs:     errNotFound,
+			wantStatus: http.StatusNotFound,
+			wantDetail: "not found",
+			wantCode:   CodeNotFound,
+		},
+		{
+			name:       "instance",
+			err:        Errorf(errNotFound, "URL with ID %s not found", "u1"),
+			wantIs:     errNotFound,
+			wantStatus: http.StatusNotFound,
+			wantDetail: "URL with ID u1 not found",
+			wantCode:   CodeNotFound,
+		},
+		{
+			name:       "wrapped instance",
+			err:        fmt.Errorf("lookup: %w", Errorf(errNotFound, "URL with ID %s not found", "u1")),
+			wantIs:     errNotFound,
+			wantStatus: http.StatusNotFound,
+			wantDetail: "URL with ID u1 not found",
+			wantCode:   CodeNotFound,
+		},
+		{
+			name:       "cause not shown",
+			err:        Wrap(errInternal, cause, "failed to add URL"),
+			wantIs:     cause,
+			wantStatus: http.StatusInternalServerError,
+			wantDetail: "failed to add URL",
+			wantCode:   CodeInternal,
+		},
+		{
+			name:       "error without code",
+			err:        cause,
+			wantIs:     cause,
+			wantStatus: http.StatusInternalServerError,
+			wantDetail: "internal server error",
+			wantCode:   CodeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.wantIs) {
+				t.Errorf("errors.Is(%v, %v) = false", tt.err, tt.wantIs)
+			}
+
+			w := httptest.NewRecorder()
+			Write(w, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+			}
+			var got Details
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			want := Details{
+				Type:   "about:blank",
+				Title:  http.StatusText(tt.wantStatus),
+				Status: tt.wantStatus,
+				Detail: tt.wantDetail,
+				Code:   tt.wantCode,
+			}
+			if got != want {
+				t.Errorf("details = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestErrorIs tests that instances of different sentinels of a code are told apart.
+func TestErrorIs(t *testing.T) {
+	errInvalidEmail := New(CodeInvalidInput, "invalid email")
+	errInvalidInput := New(CodeInvalidInput, "invalid input")
+	err := Errorf(errInvalidEmail, "%q is not an email", "alice")
+
+	if !errors.Is(err, errInvalidEmail) {
+		t.Errorf("errors.Is(err, errInvalidEmail) = false, want true")
+	}
+	if errors.Is(err, errInvalidInput) {
+		t.Errorf("errors.Is(err, errInvalidInput) = true, want false")
+	}
+}
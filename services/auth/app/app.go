@@ -0,0 +1,268 @@
+// Package app wires the auth service: its storage, token service and HTTP routes.
+// It is used by cmd/auth and embedded by the all-in-one binary.
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+	"github.com/kernelshard/hcaas/services/auth/internal/config"
+	"github.com/kernelshard/hcaas/services/auth/internal/handler"
+	"github.com/kernelshard/hcaas/services/auth/internal/mailer"
+	customMiddleware "github.com/kernelshard/hcaas/services/auth/internal/middleware"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// ServiceName identifies the auth service in traces.
+const ServiceName = "auth-service"
+
+// Config holds the settings of the auth service.
+type Config = config.Config
+
+// LoadConfig reads the auth service settings from environment variables.
+func LoadConfig() (*Config, error) {
+	return config.LoadConfig()
+}
+
+// UserDataDeleter deletes the data other services keep for a user whose account is deleted.
+type UserDataDeleter = service.UserDataDeleter
+
+// UserDataDeleterFunc adapts a function to UserDataDeleter.
+type UserDataDeleterFunc = service.UserDataDeleterFunc
+
+// Options replace the remote dependencies of the service, e.g. with in-process ones.
+type Options struct {
+	// UserData deletes the monitors of deleted accounts. Defaults to the URL service at
+	// URL_SVC_URL.
+	UserData UserDataDeleter
+}
+
+// App is a wired auth service.
+type App struct {
+	handler   http.Handler
+	tokenSvc  service.TokenService
+	apiKeySvc service.APIKeyService
+	stores    *storage.Stores
+}
+
+// New connects to the database and wires the service.
+func New(ctx context.Context, cfg *Config, opts Options, l *slog.Logger) (*App, error) {
+	tracer := otelkit.New(ServiceName)
+
+	// Tokens are signed with HS256 and the secret key unless asymmetric keys are configured
+	var keys *service.KeySet
+	if len(cfg.SigningKeyFiles) > 0 {
+		var err error
+		if keys, err = service.LoadKeySet(cfg.SigningKeyFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	// The database backend is selected by the scheme of the DSN
+	stores, err := storage.Open(ctx, cfg.DBConfig.URL, tracer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if cfg.DBConfig.MigrateOnStart {
+		n, err := stores.Migrator.Up(ctx)
+		if err != nil {
+			stores.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		l.Info("Database schema migrated", "applied", n)
+	}
+
+	userStorage := stores.Users
+	recorder := audit.NewRecorder(stores.Audit, l)
+
+	tokenSvc := service.NewJWTService(cfg.SecretKey, keys, cfg.AuthExpiry, stores.Tokens, l, tracer)
+	limiter := service.NewLoginLimiter(stores.LoginLimits, service.LoginLimiterConfig{
+		MaxEmailFailures: cfg.LoginLimit.MaxFailures,
+		MaxIPFailures:    cfg.LoginLimit.MaxIPFailures,
+		Window:           cfg.LoginLimit.Window,
+		LockoutDuration:  cfg.LoginLimit.LockoutDuration,
+	}, recorder, l, tracer)
+	mfaSvc := service.NewMFAService(stores.MFA, service.MFAConfig{
+		Issuer:          cfg.MFAIssuer,
+		ChallengeExpiry: cfg.MFAChallengeExpiry,
+	}, l, tracer)
+	authSvc := service.NewAuthService(userStorage, stores.Tokens, limiter, mfaSvc, recorder, l, tokenSvc, cfg.RefreshExpiry, cfg.Account.RequireVerifiedEmail, tracer)
+	accountSvc := service.NewAccountService(userStorage, stores.EmailTokens, stores.Tokens, limiter, newMailer(cfg, l), service.AccountConfig{
+		PublicURL:          cfg.Account.PublicURL,
+		VerificationExpiry: cfg.Account.VerificationExpiry,
+		ResetExpiry:        cfg.Account.ResetExpiry,
+	}, l, tracer)
+	apiKeySvc := service.NewAPIKeyService(stores.APIKeys, userStorage, recorder, l, tracer)
+	userData := opts.UserData
+	if userData == nil {
+		userData = service.NewRemoteUserDataDeleter(cfg.AppCfg.URLServiceURL, &http.Client{Timeout: 10 * time.Second})
+	}
+	userSvc := service.NewUserService(userStorage, stores.Tokens, tokenSvc, limiter, accountSvc, userData, recorder, l, tracer)
+	healthSvc := service.NewHealthService(userStorage, l)
+
+	authHandler := handler.NewAuthHandler(authSvc, apiKeySvc, accountSvc, l, tracer)
+	accountHandler := handler.NewAccountHandler(accountSvc, l, tracer)
+	mfaHandler := handler.NewMFAHandler(mfaSvc, l, tracer)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeySvc, l, tracer)
+	userHandler := handler.NewUserHandler(userSvc, l, tracer)
+	adminHandler := handler.NewAdminHandler(limiter, userSvc, stores.Audit, l, tracer)
+	healthHandler := handler.NewHealthHandler(healthSvc, l)
+	jwksHandler := handler.NewJWKSHandler(keys)
+
+	// Single sign-on is enabled by configuring a provider
+	var oidcHandler *handler.OIDCHandler
+	if cfg.OIDC.Issuer != "" {
+		oidcSvc := service.NewOIDCService(userStorage, stores.OIDC, service.OIDCConfig{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+			StateExpiry:  cfg.OIDC.StateExpiry,
+		}, &http.Client{Timeout: 10 * time.Second}, l, tracer)
+		if oidcHandler, err = handler.NewOIDCHandler(oidcSvc, authSvc, cfg.OIDC.RedirectURL, cfg.OIDC.StateExpiry, l, tracer); err != nil {
+			stores.Close()
+			return nil, err
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Use(otelkit.NewHttpMiddleware(tracer).Middleware)
+	r.Use(customMiddleware.MetricsMiddleware)
+
+	// Middleware
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.Timeout(30 * time.Second))
+	r.Use(audit.Middleware(cfg.AppCfg.TrustProxyHeaders))
+
+	// public
+	r.Route("/auth", func(r chi.Router) {
+		r.Post("/register", authHandler.Register)
+		r.Post("/login", authHandler.Login)
+		r.Post("/login/mfa", authHandler.LoginMFA)
+		r.Post("/refresh", authHandler.Refresh)
+		r.Get("/validate", authHandler.Validate)
+		r.Post("/verify", accountHandler.Verify)
+		r.Post("/verify/resend", accountHandler.ResendVerification)
+		r.Post("/password/forgot", accountHandler.ForgotPassword)
+		r.Post("/password/reset", accountHandler.ResetPassword)
+
+		if oidcHandler != nil {
+			r.Get("/oidc/login", oidcHandler.Login)
+			r.Get("/oidc/callback", oidcHandler.Callback)
+		}
+	})
+
+	// protected
+	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.AuthMiddleware(tokenSvc))
+		r.Route("/me", func(r chi.Router) {
+			r.Get("/", userHandler.GetMe)
+			r.Patch("/", userHandler.UpdateMe)
+			r.Delete("/", userHandler.DeleteMe)
+			r.Post("/password", userHandler.ChangePassword)
+		})
+		r.Post("/auth/logout", authHandler.Logout)
+
+		// API keys are managed with user tokens only; the middleware does not accept keys
+		r.Route("/auth/api-keys", func(r chi.Router) {
+			r.Post("/", apiKeyHandler.Create)
+			r.Get("/", apiKeyHandler.List)
+			r.Delete("/{id}", apiKeyHandler.Revoke)
+		})
+
+		r.Route("/auth/mfa/totp", func(r chi.Router) {
+			r.Post("/enroll", mfaHandler.Enroll)
+			r.Post("/confirm", mfaHandler.Confirm)
+			r.Post("/disable", mfaHandler.Disable)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(customMiddleware.RequireAdmin(cfg.AdminUserIDs))
+			r.Post("/unlock", adminHandler.Unlock)
+			r.Get("/users", adminHandler.ListUsers)
+			r.Post("/users/{id}/disable", adminHandler.DisableUser)
+			r.Post("/users/{id}/enable", adminHandler.EnableUser)
+			r.Get("/audit", adminHandler.Audit)
+		})
+	})
+
+	r.Get("/.well-known/jwks.json", jwksHandler.JWKS)
+
+	r.Get("/readyz", healthHandler.Readiness)
+	r.Get("/healthz", healthHandler.Liveness)
+
+	r.Handle("/metrics", promhttp.Handler())
+
+	return &App{handler: r, tokenSvc: tokenSvc, apiKeySvc: apiKeySvc, stores: stores}, nil
+}
+
+// newMailer returns the mailer selected by cfg
+func newMailer(cfg *Config, l *slog.Logger) mailer.Mailer {
+	if cfg.Account.Mailer == "smtp" {
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Addr:     cfg.Account.SMTPAddr,
+			Username: cfg.Account.SMTPUser,
+			Password: cfg.Account.SMTPPass,
+			From:     cfg.Account.MailFrom,
+		})
+	}
+	return mailer.NewLogMailer(l)
+}
+
+// Migrate runs the migrate subcommand args, e.g. ["up"], against the database of cfg and
+// writes its report to w. See migrate.Run.
+func Migrate(ctx context.Context, cfg *Config, args []string, w io.Writer) error {
+	stores, err := storage.Open(ctx, cfg.DBConfig.URL, otelkit.New(ServiceName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer stores.Close()
+	return migrate.Run(ctx, stores.Migrator, args, w)
+}
+
+// Handler returns the HTTP routes of the service.
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// Validator validates tokens and API keys issued by this service in process, without an
+// HTTP round trip.
+func (a *App) Validator() authn.Validator {
+	tokens := authn.ValidatorFunc(func(ctx context.Context, token string) (authn.Identity, error) {
+		userID, email, err := a.tokenSvc.ValidateToken(ctx, token)
+		if err != nil {
+			return authn.Identity{}, fmt.Errorf("%w: %v", authn.ErrUnauthenticated, err)
+		}
+		return authn.Identity{UserID: userID, Email: email}, nil
+	})
+	apiKeys := authn.ValidatorFunc(func(ctx context.Context, key string) (authn.Identity, error) {
+		identity, err := a.apiKeySvc.Validate(ctx, key)
+		if err != nil {
+			return authn.Identity{}, fmt.Errorf("%w: %v", authn.ErrUnauthenticated, err)
+		}
+		return identity, nil
+	})
+	return authn.WithAPIKeys(tokens, apiKeys)
+}
+
+// Close closes the database.
+func (a *App) Close() {
+	a.stores.Close()
+}
@@ -8,17 +8,10 @@ import (
 	"os/signal"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/samims/otelkit"
 
-	"github.com/kernelshard/hcaas/services/auth/internal/config"
-	"github.com/kernelshard/hcaas/services/auth/internal/handler"
+	"github.com/kernelshard/hcaas/services/auth/app"
 	"github.com/kernelshard/hcaas/services/auth/internal/logger"
-	customMiddleware "github.com/kernelshard/hcaas/services/auth/internal/middleware"
-	"github.com/kernelshard/hcaas/services/auth/internal/service"
-	"github.com/kernelshard/hcaas/services/auth/internal/storage"
 
 	"github.com/joho/godotenv"
 )
@@ -34,15 +27,24 @@ func main() {
 	}
 
 	// Load configuration from environment variables
-	cfg, err := config.LoadConfig()
+	cfg, err := app.LoadConfig()
 	if err != nil {
 		l.Error("Failed to load configuration", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
+	// "auth migrate up|down [N]|status" manages the database schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(ctx, cfg, os.Args[2:], os.Stdout); err != nil {
+			l.Error("Migration failed", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup OpenTelemetry tracing with custom provider configuration
 	// Use OTLP configuration from environment variables via config
-	tracingConfig := otelkit.NewProviderConfig("auth-service", "v1.0.0").
+	tracingConfig := otelkit.NewProviderConfig(app.ServiceName, "v1.0.0").
 		WithOTLPExporter(cfg.OTLPConfig.Endpoint, cfg.OTLPConfig.Protocol, cfg.OTLPConfig.Insecure).
 		WithSampling("probabilistic", 0.1).                        // 10% sampling rate
 		WithBatchOptions(2*time.Second, 10*time.Second, 512, 2048) // Optimized batch settings
@@ -51,7 +53,7 @@ func main() {
 	if err != nil {
 		l.Error("Failed to initialize OpenTelemetry tracing provider",
 			slog.String("error", err.Error()),
-			slog.String("service", "auth-service"))
+			slog.String("service", app.ServiceName))
 		os.Exit(1)
 	}
 
@@ -68,51 +70,14 @@ func main() {
 		}
 	}()
 
-	tracer := otelkit.New("auth-service")
-
-	dbPool, err := storage.NewPostgresPool(ctx, cfg.DBConfig.URL)
+	authApp, err := app.New(ctx, cfg, app.Options{}, l)
 	if err != nil {
-		l.Error("Failed to connect to database", slog.String("error", err.Error()))
+		l.Error("Failed to initialize auth service", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
-	defer dbPool.Close()
-
-	userStorage := storage.NewUserStorage(dbPool, tracer)
-
-	tokenSvc := service.NewJWTService(cfg.SecretKey, cfg.AuthExpiry, l, tracer)
-	authSvc := service.NewAuthService(userStorage, l, tokenSvc, tracer)
-	healthSvc := service.NewHealthService(userStorage, l)
-
-	authHandler := handler.NewAuthHandler(authSvc, l, tracer)
-	healthHandler := handler.NewHealthHandler(healthSvc, l)
-
-	r := chi.NewRouter()
-	r.Use(otelkit.NewHttpMiddleware(tracer).Middleware)
-	r.Use(customMiddleware.MetricsMiddleware)
-
-	// Middleware
-	r.Use(middleware.RequestID)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
-
-	// public
-	r.Route("/auth", func(r chi.Router) {
-		r.Post("/register", authHandler.Register)
-		r.Post("/login", authHandler.Login)
-		r.Get("/validate", authHandler.Validate)
-	})
-
-	// protected
-	r.Group(func(r chi.Router) {
-		r.Use(customMiddleware.AuthMiddleware(tokenSvc))
-		r.Get("/me", authHandler.GetUser)
-	})
-
-	r.Get("/readyz", healthHandler.Readiness)
-	r.Get("/healthz", healthHandler.Liveness)
+	defer authApp.Close()
 
-	r.Handle("/metrics", promhttp.Handler())
+	r := authApp.Handler()
 
 	port := ":8081"
 
@@ -4,18 +4,48 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds the application settings loaded from environment variables.
 type Config struct {
-	SecretKey  string
+	// SecretKey signs HS256 tokens when there are no SigningKeyFiles
+	SecretKey string
+	// SigningKeyFiles are PEM files of the RSA or Ed25519 keys tokens are signed with.
+	// The first one signs new tokens, the others verify tokens issued before a rotation.
+	SigningKeyFiles []string
+	// AuthExpiry is the lifetime of access tokens
 	AuthExpiry time.Duration
+	// RefreshExpiry is the lifetime of refresh tokens
+	RefreshExpiry time.Duration
+	// LoginLimit holds the thresholds of the login lockout
+	LoginLimit LoginLimitConfig
+	// AdminUserIDs are the users allowed to use the admin endpoints
+	AdminUserIDs []string
+	// Account holds the settings of email verification and password reset
+	Account AccountConfig
+	// MFAIssuer names the service in authenticator apps
+	MFAIssuer string
+	// MFAChallengeExpiry is how long the second step of a login may take
+	MFAChallengeExpiry time.Duration
+	// OIDC holds the settings of single sign-on with an OIDC provider
+	OIDC       OIDCConfig
 	DBConfig   DBConfig
 	AppCfg     AppConfig
 	OTLPConfig OTLPConfig
 }
 
+// LoginLimitConfig holds the thresholds of the login lockout.
+type LoginLimitConfig struct {
+	// MaxFailures failed logins of an email within Window lock it out
+	MaxFailures int
+	// MaxIPFailures failed logins from a client IP within Window lock it out
+	MaxIPFailures   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+}
+
 // OTLPConfig holds OpenTelemetry tracing configuration.
 type OTLPConfig struct {
 	Endpoint string
@@ -23,16 +53,52 @@ type OTLPConfig struct {
 	Insecure bool
 }
 
+// AccountConfig holds the settings of email verification and password reset.
+type AccountConfig struct {
+	// PublicURL is the base of the links in mails
+	PublicURL string
+	// RequireVerifiedEmail rejects logins of users who have not verified their email
+	RequireVerifiedEmail bool
+	VerificationExpiry   time.Duration
+	ResetExpiry          time.Duration
+	// Mailer is "log", which logs mails instead of sending them, or "smtp"
+	Mailer   string
+	SMTPAddr string
+	SMTPUser string
+	SMTPPass string
+	MailFrom string
+}
+
+// OIDCConfig holds the settings of single sign-on with an OIDC provider. It is disabled
+// without an Issuer.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered at the provider
+	RedirectURL string
+	Scopes      []string
+	// StateExpiry is how long a login may take at the provider
+	StateExpiry time.Duration
+}
+
 // AppConfig holds the application configuration.
 type AppConfig struct {
 	Port string
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For, which is only safe behind
+	// a proxy that sets it
+	TrustProxyHeaders bool
+	// URLServiceURL is the URL service the monitors of deleted accounts are deleted from
+	URLServiceURL string
 }
 
-// DBConfig holds the Postgres connection settings.
+// DBConfig holds the database connection settings.
 type DBConfig struct {
 	URL         string
 	MaxOpenConn int
 	ConnMaxIdle time.Duration
+	// MigrateOnStart applies pending schema migrations when the service starts
+	MigrateOnStart bool
 }
 
 // LoadConfig reads environment variables and returns a Config or an error.
@@ -78,13 +144,83 @@ func LoadConfig() (*Config, error) {
 
 	// Auth settings
 	cfg.SecretKey = os.Getenv("SECRET_KEY")
-	if cfg.SecretKey == "" {
-		return nil, fmt.Errorf("SECRET_KEY is required")
+	for _, path := range strings.Split(os.Getenv("JWT_SIGNING_KEYS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			cfg.SigningKeyFiles = append(cfg.SigningKeyFiles, path)
+		}
+	}
+	if cfg.SecretKey == "" && len(cfg.SigningKeyFiles) == 0 {
+		return nil, fmt.Errorf("SECRET_KEY or JWT_SIGNING_KEYS is required")
+	}
+
+	if cfg.AuthExpiry, err = getDuration("AUTH_EXPIRY", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshExpiry, err = getDuration("REFRESH_TOKEN_EXPIRY", 30*24*time.Hour); err != nil {
+		return nil, err
 	}
 
-	if cfg.AuthExpiry, err = getDuration("AUTH_EXPIRY", 24*time.Hour); err != nil {
+	// Login lockout settings
+	if cfg.LoginLimit.MaxFailures, err = getInt("LOGIN_MAX_FAILURES", 5); err != nil {
 		return nil, err
 	}
+	if cfg.LoginLimit.MaxIPFailures, err = getInt("LOGIN_MAX_IP_FAILURES", 50); err != nil {
+		return nil, err
+	}
+	if cfg.LoginLimit.Window, err = getDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.LoginLimit.LockoutDuration, err = getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			cfg.AdminUserIDs = append(cfg.AdminUserIDs, id)
+		}
+	}
+
+	// Account mail settings
+	cfg.Account.PublicURL = strings.TrimSuffix(getString("PUBLIC_URL", "http://localhost:8081"), "/")
+	cfg.Account.RequireVerifiedEmail = getString("REQUIRE_EMAIL_VERIFICATION", "false") == "true"
+	if cfg.Account.VerificationExpiry, err = getDuration("EMAIL_VERIFICATION_EXPIRY", 48*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Account.ResetExpiry, err = getDuration("PASSWORD_RESET_EXPIRY", time.Hour); err != nil {
+		return nil, err
+	}
+	cfg.Account.Mailer = getString("MAILER", "log")
+	cfg.Account.SMTPAddr = os.Getenv("SMTP_ADDR")
+	cfg.Account.SMTPUser = os.Getenv("SMTP_USERNAME")
+	cfg.Account.SMTPPass = os.Getenv("SMTP_PASSWORD")
+	cfg.Account.MailFrom = getString("MAIL_FROM", "no-reply@hcaas.local")
+	switch cfg.Account.Mailer {
+	case "log":
+	case "smtp":
+		if cfg.Account.SMTPAddr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR is required with MAILER=smtp")
+		}
+	default:
+		return nil, fmt.Errorf("invalid MAILER: %q", cfg.Account.Mailer)
+	}
+
+	// MFA settings
+	cfg.MFAIssuer = getString("MFA_ISSUER", "HCaaS")
+	if cfg.MFAChallengeExpiry, err = getDuration("MFA_CHALLENGE_EXPIRY", 5*time.Minute); err != nil {
+		return nil, err
+	}
+
+	// OIDC settings
+	cfg.OIDC.Issuer = os.Getenv("OIDC_ISSUER")
+	cfg.OIDC.ClientID = os.Getenv("OIDC_CLIENT_ID")
+	cfg.OIDC.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	cfg.OIDC.RedirectURL = getString("OIDC_REDIRECT_URL", cfg.Account.PublicURL+"/auth/oidc/callback")
+	cfg.OIDC.Scopes = strings.Fields(getString("OIDC_SCOPES", "openid email profile"))
+	if cfg.OIDC.StateExpiry, err = getDuration("OIDC_STATE_EXPIRY", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.OIDC.Issuer != "" && cfg.OIDC.ClientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+	}
 
 	// DB settings
 	cfg.DBConfig.URL = os.Getenv("DB_URL")
@@ -97,6 +233,7 @@ func LoadConfig() (*Config, error) {
 	if cfg.DBConfig.ConnMaxIdle, err = getDuration("DB_CONN_MAX_IDLE", 5*time.Minute); err != nil {
 		return nil, err
 	}
+	cfg.DBConfig.MigrateOnStart = getString("DB_MIGRATE_ON_START", "true") == "true"
 
 	// App settings
 	port, err := getInt("PORT", 8081)
@@ -104,6 +241,8 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 	cfg.AppCfg.Port = strconv.Itoa(port)
+	cfg.AppCfg.TrustProxyHeaders = getString("TRUST_PROXY_HEADERS", "false") == "true"
+	cfg.AppCfg.URLServiceURL = getString("URL_SVC_URL", "http://hcaas_web:8080/")
 
 	// OTLP tracing configuration - use standard OpenTelemetry environment variables
 	cfg.OTLPConfig.Endpoint = getString("OTEL_EXPORTER_OTLP_ENDPOINT", "hcaas_jaeger_all_in_one:4317")
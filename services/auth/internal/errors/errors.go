@@ -1,15 +1,20 @@
+// Package errors holds the errors of the auth service. They carry problem codes, so handlers
+// write them with problem.Write.
 package errors
 
-import "errors"
+import "github.com/kernelshard/hcaas/pkg/problem"
 
 var (
-	ErrInvalidEmail    = errors.New("invalid email")
-	ErrInvalidInput    = errors.New("invalid input")
-	ErrInvalidToken    = errors.New("invalid token")
-	ErrConflict        = errors.New("conflict")
-	ErrInternal        = errors.New("internal error")
-	ErrUnauthorized    = errors.New("unauthorized")
-	ErrTokenGeneration = errors.New("token generation failed")
-	ErrTooManyAttempts = errors.New("too many login attempts, account locked temporarily")
-	ErrNotFound        = errors.New("not found")
+	ErrInvalidEmail     = problem.New(problem.CodeInvalidInput, "invalid email")
+	ErrInvalidInput     = problem.New(problem.CodeInvalidInput, "invalid input")
+	ErrInvalidToken     = problem.New(problem.CodeUnauthorized, "invalid token")
+	ErrConflict         = problem.New(problem.CodeConflict, "conflict")
+	ErrInternal         = problem.New(problem.CodeInternal, "internal error")
+	ErrUnauthorized     = problem.New(problem.CodeUnauthorized, "unauthorized")
+	ErrTokenGeneration  = problem.New(problem.CodeInternal, "token generation failed")
+	ErrTooManyAttempts  = problem.New(problem.CodeTooManyRequests, "too many login attempts, account locked temporarily")
+	ErrNotFound         = problem.New(problem.CodeNotFound, "not found")
+	ErrEmailNotVerified = problem.New(problem.CodeForbidden, "email not verified")
+	ErrInvalidMFACode   = problem.New(problem.CodeUnauthorized, "invalid two-factor code")
+	ErrAccountDisabled  = problem.New(problem.CodeForbidden, "account disabled")
 )
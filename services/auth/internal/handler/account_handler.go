@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// AccountHandler handles email verification and password reset
+type AccountHandler struct {
+	accountSvc service.AccountService
+	logger     *slog.Logger
+	tracer     *otelkit.Tracer
+}
+
+// NewAccountHandler creates a new instance of AccountHandler
+func NewAccountHandler(accountSvc service.AccountService, logger *slog.Logger, tracer *otelkit.Tracer) *AccountHandler {
+	return &AccountHandler{accountSvc: accountSvc, logger: logger, tracer: tracer}
+}
+
+// Verify verifies an email address with the token of a verification mail
+func (h *AccountHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "account_handler.Verify")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "verify_email"),
+		attribute.String("handler.component", "account_handler"),
+	)
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+
+	if err := h.accountSvc.VerifyEmail(ctx, req.Token); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrInvalidToken) {
+			problem.Respond(w, problem.CodeInvalidInput, "invalid or expired token")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification mails a new verification link. It answers 202 for any email, so it does
+// not reveal who is registered.
+func (h *AccountHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "account_handler.ResendVerification")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "resend_verification"),
+		attribute.String("handler.component", "account_handler"),
+	)
+	email, ok := decodeEmail(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.accountSvc.ResendVerification(ctx, email); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForgotPassword mails a password reset link. It answers 202 for any email, so it does not
+// reveal who is registered.
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "account_handler.ForgotPassword")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "forgot_password"),
+		attribute.String("handler.component", "account_handler"),
+	)
+	email, ok := decodeEmail(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.accountSvc.ForgotPassword(ctx, email); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with the token of a password reset mail
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "account_handler.ResetPassword")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "reset_password"),
+		attribute.String("handler.component", "account_handler"),
+	)
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+
+	if err := h.accountSvc.ResetPassword(ctx, req.Token, req.Password); err != nil {
+		otelkit.RecordError(span, err)
+		switch {
+		case errors.Is(err, appErr.ErrInvalidToken):
+			problem.Respond(w, problem.CodeInvalidInput, "invalid or expired token")
+		case errors.Is(err, appErr.ErrInvalidInput):
+			problem.Respond(w, problem.CodeInvalidInput, "password does not meet the requirements")
+		default:
+			problem.Write(w, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeEmail decodes a {"email": ...} body, answering 400 when it is invalid
+func decodeEmail(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return "", false
+	}
+	return req.Email, true
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/problem"
+	"github.com/kernelshard/hcaas/services/auth/internal/middleware"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// AdminHandler handles the operations reserved for administrators
+type AdminHandler struct {
+	limiter  service.LoginLimiter
+	userSvc  service.UserService
+	auditLog audit.Store
+	logger   *slog.Logger
+	tracer   *otelkit.Tracer
+}
+
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 200
+)
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(limiter service.LoginLimiter, userSvc service.UserService, auditLog audit.Store, logger *slog.Logger, tracer *otelkit.Tracer) *AdminHandler {
+	return &AdminHandler{limiter: limiter, userSvc: userSvc, auditLog: auditLog, logger: logger, tracer: tracer}
+}
+
+// Unlock lifts the login lockout of an email, a client IP or both
+func (h *AdminHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "admin_handler.Unlock")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "unlock_login"),
+		attribute.String("handler.component", "admin_handler"),
+	)
+
+	var req struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+	req.Email, req.IP = strings.TrimSpace(req.Email), strings.TrimSpace(req.IP)
+	if req.Email == "" && req.IP == "" {
+		problem.Respond(w, problem.CodeInvalidInput, "email or ip is required")
+		return
+	}
+
+	if err := h.limiter.Unlock(ctx, req.Email, req.IP); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Write(w, err)
+		return
+	}
+
+	admin, _ := middleware.EmailFromContext(ctx)
+	h.logger.Info("Login lockout lifted by admin",
+		slog.String("admin", admin),
+		slog.String("email", req.Email),
+		slog.String("ip", req.IP))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUsers returns a page of users, oldest first, selected by the limit and offset query
+// parameters
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "admin_handler.ListUsers")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "list_users"),
+		attribute.String("handler.component", "admin_handler"),
+	)
+
+	limit, offset := defaultUsersLimit, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUsersLimit {
+			problem.Respond(w, problem.CodeInvalidInput, "limit must be between 1 and "+strconv.Itoa(maxUsersLimit))
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			problem.Respond(w, problem.CodeInvalidInput, "offset must not be negative")
+			return
+		}
+		offset = n
+	}
+
+	users, err := h.userSvc.ListUsers(ctx, limit, offset)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		problem.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// DisableUser disables the account of a user and signs them out
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// EnableUser enables a disabled account again
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "admin_handler.SetDisabled")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "set_user_disabled"),
+		attribute.String("handler.component", "admin_handler"),
+		attribute.Bool("user.disabled", disabled),
+	)
+	id := chi.URLParam(r, "id")
+
+	// An admin locking themselves out could leave nobody to undo it
+	if self, _ := middleware.UserIDFromContext(ctx); disabled && id == self {
+		problem.Respond(w, problem.CodeInvalidInput, "cannot disable your own account")
+		return
+	}
+
+	user, err := h.userSvc.SetDisabled(ctx, id, disabled)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		respondUserError(w, err)
+		return
+	}
+
+	admin, _ := middleware.EmailFromContext(ctx)
+	h.logger.Info("User disabled state changed by admin",
+		slog.String("admin", admin),
+		slog.String("user.id", id),
+		slog.Bool("disabled", disabled))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// Audit returns events of the audit log, newest first, selected by the actor, action, since,
+// until, limit and offset query parameters, see audit.ParseFilter
+func (h *AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "admin_handler.Audit")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "query_audit_log"),
+		attribute.String("handler.component", "admin_handler"),
+	)
+
+	filter, err := audit.ParseFilter(r.URL.Query())
+	if err != nil {
+		problem.Respond(w, problem.CodeInvalidInput, err.Error())
+		return
+	}
+
+	events, err := h.auditLog.Query(ctx, filter)
+	if err != nil {
+		h.logger.Error("Failed to query audit log", slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInternal, "failed to query audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
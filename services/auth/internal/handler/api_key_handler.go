@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/middleware"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// APIKeyHandler handles the API keys of the logged in user
+type APIKeyHandler struct {
+	apiKeySvc service.APIKeyService
+	logger    *slog.Logger
+	tracer    *otelkit.Tracer
+}
+
+// NewAPIKeyHandler creates a new instance of APIKeyHandler
+func NewAPIKeyHandler(apiKeySvc service.APIKeyService, logger *slog.Logger, tracer *otelkit.Tracer) *APIKeyHandler {
+	return &APIKeyHandler{apiKeySvc: apiKeySvc, logger: logger, tracer: tracer}
+}
+
+// Create issues an API key. The response is the only one containing the key.
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "api_key_handler.Create")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "create_api_key"),
+		attribute.String("handler.component", "api_key_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+
+	k, key, err := h.apiKeySvc.Create(ctx, userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrInvalidInput) {
+			problem.Respond(w, problem.CodeInvalidInput, "name, scopes (urls:read, urls:write) and a future expires_at are expected")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*model.APIKey
+		Key string `json:"key"`
+	}{k, key})
+}
+
+// List lists the API keys of the user
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "api_key_handler.List")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "list_api_keys"),
+		attribute.String("handler.component", "api_key_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+
+	keys, err := h.apiKeySvc.List(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		problem.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// Revoke revokes an API key of the user
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "api_key_handler.Revoke")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "revoke_api_key"),
+		attribute.String("handler.component", "api_key_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+
+	if err := h.apiKeySvc.Revoke(ctx, userID, chi.URLParam(r, "id")); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrNotFound) {
+			problem.Respond(w, problem.CodeNotFound, "API key not found")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
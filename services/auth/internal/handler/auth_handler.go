@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -9,30 +10,25 @@ import (
 	"github.com/samims/otelkit"
 	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/kernelshard/hcaas/pkg/authn"
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/middleware"
 	"github.com/kernelshard/hcaas/services/auth/internal/service"
 )
 
-const (
-	KeyError = "error"
-)
-
 // AuthHandler handles authentication-related HTTP requests.
 type AuthHandler struct {
-	authSvc service.AuthService
-	logger  *slog.Logger
-	tracer  *otelkit.Tracer
+	authSvc    service.AuthService
+	apiKeySvc  service.APIKeyService
+	accountSvc service.AccountService
+	logger     *slog.Logger
+	tracer     *otelkit.Tracer
 }
 
 // NewAuthHandler creates a new instance of AuthHandler
-func NewAuthHandler(authSvc service.AuthService, logger *slog.Logger, tracer *otelkit.Tracer) *AuthHandler {
-	return &AuthHandler{authSvc: authSvc, logger: logger, tracer: tracer}
-}
-
-// inline error responder
-func respondError(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{KeyError: message})
+func NewAuthHandler(authSvc service.AuthService, apiKeySvc service.APIKeyService, accountSvc service.AccountService, logger *slog.Logger, tracer *otelkit.Tracer) *AuthHandler {
+	return &AuthHandler{authSvc: authSvc, apiKeySvc: apiKeySvc, accountSvc: accountSvc, logger: logger, tracer: tracer}
 }
 
 // Register handles User Registration/Signup
@@ -49,17 +45,23 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		otelkit.RecordError(span, err)
 		h.logger.Warn("Invalid register payload", slog.String("error", err.Error()))
-		respondError(w, http.StatusBadRequest, "invalid payload")
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
 		return
 	}
 
 	user, err := h.authSvc.Register(ctx, req.Email, req.Password)
 	if err != nil {
 		otelkit.RecordError(span, err)
-		respondError(w, http.StatusInternalServerError, err.Error())
+		problem.Write(w, err)
 		return
 	}
 
+	// The user is registered either way and can ask for the mail again
+	if err := h.accountSvc.SendVerification(ctx, user); err != nil {
+		otelkit.RecordError(span, err)
+		h.logger.Warn("Failed to send verification mail", slog.String("user.id", user.ID), slog.String("error", err.Error()))
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
@@ -78,44 +80,124 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		otelkit.RecordError(span, err)
-		respondError(w, http.StatusBadRequest, "invalid payload")
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
 		return
 	}
 
-	_, token, err := h.authSvc.Login(ctx, req.Email, req.Password)
+	_, result, err := h.authSvc.Login(ctx, req.Email, req.Password, middleware.ClientIPFromContext(ctx))
 	if err != nil {
 		otelkit.RecordError(span, err)
-		respondError(w, http.StatusUnauthorized, err.Error())
+		problem.Write(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(result)
 }
 
-func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	ctx, span := h.tracer.StartServerSpan(r.Context(), "auth_handler.GetUser")
+// LoginMFA completes a login of a user with MFA enabled
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "auth_handler.LoginMFA")
 	defer span.End()
 	span.SetAttributes(
-		attribute.String("operation", "get_user"),
+		attribute.String("operation", "user_login_mfa"),
 		attribute.String("handler.component", "auth_handler"),
 	)
-	h.logger.Info("Get User handler")
-	email := r.URL.Query().Get("email")
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
 
-	if email == "" {
-		http.Error(w, "missing email query param", http.StatusBadRequest)
+	_, pair, err := h.authSvc.LoginMFA(ctx, req.MFAToken, req.Code, middleware.ClientIPFromContext(ctx))
+	if err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrInvalidToken) {
+			problem.Respond(w, problem.CodeUnauthorized, "invalid or expired mfa token")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "auth_handler.Refresh")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "refresh_token"),
+		attribute.String("handler.component", "auth_handler"),
+	)
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
 		return
 	}
-	user, err := h.authSvc.GetUserByEmail(ctx, email)
 
+	pair, err := h.authSvc.Refresh(ctx, req.RefreshToken)
 	if err != nil {
 		otelkit.RecordError(span, err)
-		http.Error(w, "user not found", http.StatusNotFound)
+		if errors.Is(err, appErr.ErrInvalidToken) {
+			problem.Respond(w, problem.CodeUnauthorized, "invalid refresh token")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// Logout revokes the bearer token of the request and the refresh token in the body, if any
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "auth_handler.Logout")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "logout"),
+		attribute.String("handler.component", "auth_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
 		return
 	}
-	json.NewEncoder(w).Encode(user)
 
+	// The body is optional: without a refresh token only the access token is revoked
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			otelkit.RecordError(span, err)
+			problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+			return
+		}
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := h.authSvc.Logout(ctx, userID, token, req.RefreshToken); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrInvalidToken) {
+			problem.Respond(w, problem.CodeForbidden, "refresh token belongs to another user")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *AuthHandler) Validate(w http.ResponseWriter, r *http.Request) {
@@ -127,23 +209,25 @@ func (h *AuthHandler) Validate(w http.ResponseWriter, r *http.Request) {
 	)
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		respondError(w, http.StatusUnauthorized, "missing token")
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
 		return
 	}
 
+	// API keys are validated as well, so services need a single endpoint for both
 	token := strings.TrimPrefix(authHeader, "Bearer ")
-	userID, email, err := h.authSvc.ValidateToken(r.Context(), token)
+	var (
+		resp authn.Identity
+		err  error
+	)
+	if authn.IsAPIKey(token) {
+		resp, err = h.apiKeySvc.Validate(r.Context(), token)
+	} else {
+		resp.UserID, resp.Email, err = h.authSvc.ValidateToken(r.Context(), token)
+	}
 	if err != nil {
 		otelkit.RecordError(span, err)
-		respondError(w, http.StatusUnauthorized, "invalid token")
-	}
-
-	resp := struct {
-		UserID string `json:"user_id"`
-		Email  string `json:"email"` // Alternative field name
-	}{
-		UserID: userID,
-		Email:  email, // Set both fields for backward compatibility
+		problem.Respond(w, problem.CodeUnauthorized, "invalid token")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -151,6 +235,6 @@ func (h *AuthHandler) Validate(w http.ResponseWriter, r *http.Request) {
 		otelkit.RecordError(span, err)
 		h.logger.Error("Failed to encode validation response",
 			slog.String("error", err.Error()))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		problem.Respond(w, problem.CodeInternal, "failed to encode response")
 	}
 }
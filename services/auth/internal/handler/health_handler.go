@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/kernelshard/hcaas/pkg/problem"
 	"github.com/kernelshard/hcaas/services/auth/internal/service"
 )
 
@@ -24,7 +25,7 @@ func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
 func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 	err := h.service.Readiness(r.Context())
 	if err != nil {
-		http.Error(w, "unhealthy", http.StatusInternalServerError)
+		problem.Respond(w, problem.CodeUnavailable, "not ready")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// JWKSHandler publishes the public keys tokens are signed with, so other services can
+// verify tokens without calling the auth service.
+type JWKSHandler struct {
+	keys *service.KeySet
+}
+
+// NewJWKSHandler creates a new instance of JWKSHandler. A nil KeySet publishes no keys.
+func NewJWKSHandler(keys *service.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS serves the key set as /.well-known/jwks.json
+func (h *JWKSHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	// Verifiers refetch the set on unknown key IDs, so a short cache lifetime is enough
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.keys.JWKS())
+}
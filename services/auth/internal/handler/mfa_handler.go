@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/middleware"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// MFAHandler handles the two-factor authentication of the logged in user
+type MFAHandler struct {
+	mfaSvc service.MFAService
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+}
+
+// NewMFAHandler creates a new instance of MFAHandler
+func NewMFAHandler(mfaSvc service.MFAService, logger *slog.Logger, tracer *otelkit.Tracer) *MFAHandler {
+	return &MFAHandler{mfaSvc: mfaSvc, logger: logger, tracer: tracer}
+}
+
+// Enroll starts the TOTP enrollment and returns the secret for the authenticator app
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "mfa_handler.Enroll")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "enroll_totp"),
+		attribute.String("handler.component", "mfa_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+	email, _ := middleware.EmailFromContext(ctx)
+
+	enrollment, err := h.mfaSvc.Enroll(ctx, userID, email)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrConflict) {
+			problem.Respond(w, problem.CodeConflict, "mfa already enabled")
+			return
+		}
+		problem.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// Confirm enables MFA with a code of the enrolled secret and returns the recovery codes
+func (h *MFAHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "mfa_handler.Confirm")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "confirm_totp"),
+		attribute.String("handler.component", "mfa_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.mfaSvc.Confirm(ctx, userID, code)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		switch {
+		case errors.Is(err, appErr.ErrInvalidMFACode):
+			problem.Respond(w, problem.CodeInvalidInput, err.Error())
+		case errors.Is(err, appErr.ErrConflict):
+			problem.Respond(w, problem.CodeConflict, "no pending enrollment")
+		default:
+			problem.Write(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": recoveryCodes})
+}
+
+// Disable disables MFA with a code or a recovery code
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "mfa_handler.Disable")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "disable_mfa"),
+		attribute.String("handler.component", "mfa_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaSvc.Disable(ctx, userID, code); err != nil {
+		otelkit.RecordError(span, err)
+		switch {
+		case errors.Is(err, appErr.ErrInvalidMFACode):
+			problem.Respond(w, problem.CodeInvalidInput, err.Error())
+		case errors.Is(err, appErr.ErrNotFound):
+			problem.Respond(w, problem.CodeNotFound, "mfa not enabled")
+		default:
+			problem.Write(w, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeCode decodes a {"code": ...} body, answering 400 when it is invalid
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return "", false
+	}
+	return req.Code, true
+}
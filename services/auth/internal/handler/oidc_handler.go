@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// oidcStateCookie binds a login at the OIDC provider to the browser that started it, so a
+// callback URL of someone else's login cannot be planted on a user
+const oidcStateCookie = "hcaas_oidc_state"
+
+// OIDCHandler handles logins with an OIDC provider
+type OIDCHandler struct {
+	oidcSvc service.OIDCService
+	authSvc service.AuthService
+	// cookiePath and secureCookie scope the state cookie to the callback URL, which may be
+	// served under a prefix, e.g. by the all-in-one binary
+	cookiePath   string
+	secureCookie bool
+	stateExpiry  time.Duration
+	logger       *slog.Logger
+	tracer       *otelkit.Tracer
+}
+
+// NewOIDCHandler creates a new instance of OIDCHandler for the callback at redirectURL
+func NewOIDCHandler(oidcSvc service.OIDCService, authSvc service.AuthService, redirectURL string, stateExpiry time.Duration,
+	logger *slog.Logger, tracer *otelkit.Tracer) (*OIDCHandler, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OIDC redirect URL %q", redirectURL)
+	}
+	return &OIDCHandler{
+		oidcSvc:      oidcSvc,
+		authSvc:      authSvc,
+		cookiePath:   path.Dir(u.Path),
+		secureCookie: u.Scheme == "https",
+		stateExpiry:  stateExpiry,
+		logger:       logger,
+		tracer:       tracer,
+	}, nil
+}
+
+// Login redirects to the provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "oidc_handler.Login")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "oidc_login"),
+		attribute.String("handler.component", "oidc_handler"),
+	)
+
+	authURL, state, err := h.oidcSvc.AuthURL(ctx)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeUnavailable, "identity provider unavailable")
+		return
+	}
+	h.setStateCookie(w, state, int(h.stateExpiry.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes a login the provider redirected back and responds like POST /auth/login
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "oidc_handler.Callback")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "oidc_callback"),
+		attribute.String("handler.component", "oidc_handler"),
+	)
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		h.logger.Warn("OIDC login failed at the provider", slog.String("error", e), slog.String("error_description", q.Get("error_description")))
+		problem.Respond(w, problem.CodeUnauthorized, "login failed at the identity provider: "+e)
+		return
+	}
+	state, code := q.Get("state"), q.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || code == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		problem.Respond(w, problem.CodeInvalidInput, "invalid login state")
+		return
+	}
+	// The state works once, whatever the outcome
+	h.setStateCookie(w, "", -1)
+
+	user, err := h.oidcSvc.Callback(ctx, state, code)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		switch {
+		case errors.Is(err, appErr.ErrInvalidToken):
+			problem.Respond(w, problem.CodeInvalidInput, "invalid or expired login state")
+		case errors.Is(err, appErr.ErrUnauthorized):
+			problem.Respond(w, problem.CodeUnauthorized, "identity provider login rejected")
+		case errors.Is(err, appErr.ErrEmailNotVerified):
+			problem.Respond(w, problem.CodeForbidden, "identity provider did not verify the email")
+		case errors.Is(err, appErr.ErrConflict):
+			problem.Respond(w, problem.CodeConflict, "email registered to an unverified account; verify it first")
+		default:
+			problem.Write(w, err)
+		}
+		return
+	}
+
+	result, err := h.authSvc.LoginExternal(ctx, user)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		problem.Write(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
+
+// setStateCookie sets the state cookie; a negative maxAge deletes it
+func (h *OIDCHandler) setStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     h.cookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.secureCookie,
+		// Lax sends the cookie on the top-level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
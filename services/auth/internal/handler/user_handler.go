@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/middleware"
+	"github.com/kernelshard/hcaas/services/auth/internal/service"
+)
+
+// UserHandler handles the account of the logged in user
+type UserHandler struct {
+	userSvc service.UserService
+	logger  *slog.Logger
+	tracer  *otelkit.Tracer
+}
+
+// NewUserHandler creates a new instance of UserHandler
+func NewUserHandler(userSvc service.UserService, logger *slog.Logger, tracer *otelkit.Tracer) *UserHandler {
+	return &UserHandler{userSvc: userSvc, logger: logger, tracer: tracer}
+}
+
+// GetMe returns the profile of the logged in user
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "user_handler.GetMe")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "get_profile"),
+		attribute.String("handler.component", "user_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+
+	user, err := h.userSvc.GetProfile(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		respondUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateMe changes the name or email of the logged in user. A new email needs the current
+// password and is verified again.
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "user_handler.UpdateMe")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "update_profile"),
+		attribute.String("handler.component", "user_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+	var req struct {
+		Name            *string `json:"name"`
+		Email           *string `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Name == nil && req.Email == nil) {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+
+	user, err := h.userSvc.UpdateProfile(ctx, userID, service.ProfileUpdate{
+		Name:            req.Name,
+		Email:           req.Email,
+		CurrentPassword: req.CurrentPassword,
+	})
+	if err != nil {
+		otelkit.RecordError(span, err)
+		respondUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ChangePassword sets a new password of the logged in user after checking the current one
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "user_handler.ChangePassword")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "change_password"),
+		attribute.String("handler.component", "user_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewPassword == "" {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+
+	if err := h.userSvc.ChangePassword(ctx, userID, req.CurrentPassword, req.NewPassword); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrInvalidInput) {
+			problem.Respond(w, problem.CodeInvalidInput, "password does not meet the requirements")
+			return
+		}
+		respondUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteMe deletes the account of the logged in user together with their monitors
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "user_handler.DeleteMe")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("operation", "delete_account"),
+		attribute.String("handler.component", "user_handler"),
+	)
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		problem.Respond(w, problem.CodeUnauthorized, "missing token")
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := h.userSvc.DeleteAccount(ctx, userID, req.Password, token); err != nil {
+		otelkit.RecordError(span, err)
+		respondUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondUserError writes the response of an error of UserService
+func respondUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, appErr.ErrUnauthorized):
+		problem.Respond(w, problem.CodeUnauthorized, "wrong password")
+	case errors.Is(err, appErr.ErrConflict):
+		problem.Respond(w, problem.CodeConflict, "email already in use")
+	case errors.Is(err, appErr.ErrNotFound):
+		problem.Respond(w, problem.CodeNotFound, "user not found")
+	default:
+		problem.Write(w, err)
+	}
+}
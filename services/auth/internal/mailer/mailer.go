@@ -0,0 +1,97 @@
+// Package mailer sends the mails of the auth service, such as verification and password
+// reset links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a plain text mail
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// logMailer writes mails to the log instead of sending them
+type logMailer struct {
+	logger *slog.Logger
+}
+
+// NewLogMailer creates a Mailer that logs mails, for development and tests. Anyone with
+// access to the log can use the links in them.
+func NewLogMailer(logger *slog.Logger) Mailer {
+	return &logMailer{logger: logger.With("component", "logMailer")}
+}
+
+func (m *logMailer) Send(_ context.Context, msg Message) error {
+	m.logger.Info("Mail not sent, logged instead",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body))
+	return nil
+}
+
+// SMTPConfig holds the settings of an SMTP server
+type SMTPConfig struct {
+	// Addr is the host:port of the server
+	Addr     string
+	Username string
+	Password string
+	// From is the sender address of the mails
+	From string
+}
+
+// smtpMailer sends mails through an SMTP server
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer creates a Mailer sending through the SMTP server of cfg. It authenticates
+// with PLAIN auth when a username is set, which net/smtp only allows over TLS or to localhost.
+func NewSMTPMailer(cfg SMTPConfig) Mailer {
+	return &smtpMailer{cfg: cfg}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	// net/smtp has no context support; the deadline is the best that can be honoured
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= 0 {
+		return ctx.Err()
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		host, _, err := net.SplitHostPort(m.cfg.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %q: %w", m.cfg.Addr, err)
+		}
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(m.cfg.Addr, auth, m.cfg.From, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
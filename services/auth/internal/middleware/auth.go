@@ -3,8 +3,11 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/problem"
 	"github.com/kernelshard/hcaas/services/auth/internal/service"
 )
 
@@ -12,7 +15,7 @@ type key string
 
 const (
 	contextUserIDKey key = "user_id"
-	contextEmailKey
+	contextEmailKey  key = "email"
 )
 
 func UserIDFromContext(ctx context.Context) (string, bool) {
@@ -20,26 +23,53 @@ func UserIDFromContext(ctx context.Context) (string, bool) {
 	return uid, ok
 }
 
+func EmailFromContext(ctx context.Context) (string, bool) {
+	email, ok := ctx.Value(contextEmailKey).(string)
+	return email, ok
+}
+
+// ClientIPFromContext returns the client IP set by audit.Middleware
+func ClientIPFromContext(ctx context.Context) string {
+	return audit.ClientFrom(ctx).IP
+}
+
 func AuthMiddleware(tokenService service.TokenService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				http.Error(w, "missing or malformed token", http.StatusUnauthorized)
+				problem.Respond(w, problem.CodeUnauthorized, "missing or malformed token")
 				return
 			}
 
 			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 			userID, email, err := tokenService.ValidateToken(r.Context(), tokenStr)
 			if err != nil {
-				http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+				problem.Respond(w, problem.CodeUnauthorized, "invalid or expired token")
 				return
 			}
 
 			ctx := context.WithValue(r.Context(), contextUserIDKey, userID)
 			ctx = context.WithValue(ctx, contextEmailKey, email)
+			ctx = audit.WithActor(ctx, userID, email)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireAdmin allows only the users with one of adminUserIDs. Users are matched by ID
+// rather than email, which they can change to any unverified address. It must run after
+// AuthMiddleware.
+func RequireAdmin(adminUserIDs []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok || userID == "" || !slices.Contains(adminUserIDs, userID) {
+				problem.Respond(w, problem.CodeForbidden, "admin access required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Purposes of email tokens
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// EmailToken is a single-use token mailed to a user to verify the email address or reset
+// the password. Only a hash of the token is stored.
+type EmailToken struct {
+	TokenHash string
+	UserID    string
+	// Email is the address the token was mailed to. The token is only valid while the user
+	// still has it.
+	Email     string
+	Purpose   string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
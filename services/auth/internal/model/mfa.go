@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// MFA is the TOTP two-factor authentication of a user
+type MFA struct {
+	UserID string
+	// Secret is the base32 encoded TOTP key shared with the authenticator app
+	Secret string
+	// EnabledAt is nil until the user confirms the enrollment with a code
+	EnabledAt *time.Time
+	// LastUsedStep is the time step of the last accepted code; older and equal steps are
+	// rejected so a code cannot be replayed
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// MFAChallenge is the pending second step of a login of a user with MFA enabled. Only a hash
+// of the challenge token is stored.
+type MFAChallenge struct {
+	TokenHash string
+	UserID    string
+	// Attempts counts the wrong codes entered for the challenge
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// TOTPEnrollment is what an authenticator app needs to generate codes
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI, usually shown as a QR code
+	URI string `json:"otpauth_uri"`
+}
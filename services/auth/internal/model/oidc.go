@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// OIDCState is a login in progress at the OIDC provider. Only a hash of the state parameter
+// is stored; the nonce and the PKCE code verifier are checked when the provider redirects back.
+type OIDCState struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// Identity is an external identity linked to a user, identified by the issuer and subject
+// of the ID tokens of the provider
+type Identity struct {
+	Issuer  string
+	Subject string
+	UserID  string
+	// Email is the email the provider reported when the identity was linked
+	Email     string
+	CreatedAt time.Time
+}
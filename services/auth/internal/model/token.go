@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// RefreshToken is the server-side record of an issued refresh token. Only a hash of the
+// token is stored. Every refresh rotates the token: the presented one is marked used and a
+// new one of the same family is issued, so a used token presented again reveals theft.
+type RefreshToken struct {
+	ID     string
+	UserID string
+	// FamilyID is shared by all tokens rotated from the same login
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// TokenPair is the result of a login or a refresh.
+type TokenPair struct {
+	// AccessToken is the short-lived JWT sent as bearer token
+	AccessToken string `json:"token"`
+	// RefreshToken is exchanged for a new pair at POST /auth/refresh
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// LoginResult is the result of the password step of a login: the token pair, or a challenge
+// for the second factor when the user has MFA enabled.
+type LoginResult struct {
+	*TokenPair
+	MFARequired bool `json:"mfa_required,omitempty"`
+	// MFAToken is exchanged with a code for the token pair at POST /auth/login/mfa
+	MFAToken string `json:"mfa_token,omitempty"`
+}
@@ -4,8 +4,14 @@ import "time"
 
 // User model for auth service
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// Name is the display name the user chose; it may be empty
+	Name      string    `json:"name"`
 	Password  string    `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
+	// EmailVerifiedAt is nil until the user follows the verification link
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// DisabledAt is set while an admin has disabled the account
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
 }
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/mailer"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// AccountConfig holds the settings of the mails of AccountService
+type AccountConfig struct {
+	// PublicURL is the base of the links in mails, e.g. https://hcaas.example.com. The
+	// pages at /verify-email and /reset-password post the token of the link to the API.
+	PublicURL          string
+	VerificationExpiry time.Duration
+	ResetExpiry        time.Duration
+}
+
+// AccountService verifies email addresses and resets forgotten passwords with single-use
+// tokens sent by mail
+type AccountService interface {
+	// SendVerification mails a verification link to a user
+	SendVerification(ctx context.Context, user *model.User) error
+	// ResendVerification mails a new verification link to the unverified user with the
+	// email. Other emails are ignored, so the result does not reveal who is registered.
+	ResendVerification(ctx context.Context, email string) error
+	// VerifyEmail returns ErrInvalidToken when the token is unknown, used or expired, or was
+	// mailed to an email the user no longer has
+	VerifyEmail(ctx context.Context, token string) error
+	// ForgotPassword mails a password reset link to the user with the email. Unknown emails
+	// are ignored, so the result does not reveal who is registered.
+	ForgotPassword(ctx context.Context, email string) error
+	// ResetPassword sets a new password and signs the user out everywhere. It returns
+	// ErrInvalidToken when the token is unknown, used or expired, or was mailed to an email
+	// the user no longer has, and ErrInvalidInput when the password is too weak.
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+// accountService is the implementation of the AccountService interface
+type accountService struct {
+	users       storage.UserStorage
+	emailTokens storage.EmailTokenStorage
+	tokens      storage.TokenStorage
+	limiter     LoginLimiter
+	mailer      mailer.Mailer
+	cfg         AccountConfig
+	logger      *slog.Logger
+	tracer      *otelkit.Tracer
+}
+
+// NewAccountService creates a new instance of AccountService
+func NewAccountService(users storage.UserStorage, emailTokens storage.EmailTokenStorage, tokens storage.TokenStorage,
+	limiter LoginLimiter, m mailer.Mailer, cfg AccountConfig, logger *slog.Logger, tracer *otelkit.Tracer) AccountService {
+	l := logger.With("layer", "service", "component", "accountService")
+	return &accountService{
+		users:       users,
+		emailTokens: emailTokens,
+		tokens:      tokens,
+		limiter:     limiter,
+		mailer:      m,
+		cfg:         cfg,
+		logger:      l,
+		tracer:      tracer,
+	}
+}
+
+// SendVerification mails a verification link
+func (s *accountService) SendVerification(ctx context.Context, user *model.User) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "accountService.SendVerification")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", user.ID))
+	link, err := s.issue(ctx, user, model.PurposeVerifyEmail, s.cfg.VerificationExpiry, "/verify-email")
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to issue verification token")
+		return appErr.ErrInternal
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Welcome to HCaaS!\n\nVerify your email address by opening this link within %s:\n\n%s\n",
+			s.cfg.VerificationExpiry, link),
+	}
+	if err := s.send(ctx, msg); err != nil {
+		span.SetStatus(codes.Error, "Failed to send mail")
+		return err
+	}
+	return nil
+}
+
+// ResendVerification mails a new verification link
+func (s *accountService) ResendVerification(ctx context.Context, email string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "accountService.ResendVerification")
+	defer span.End()
+
+	user, err := s.lookup(ctx, email)
+	if err != nil || user == nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		span.AddEvent("email_already_verified")
+		return nil
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// VerifyEmail marks the email of the user of a verification token verified
+func (s *accountService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "accountService.VerifyEmail")
+	defer span.End()
+
+	now := time.Now()
+	t, _, err := s.consume(ctx, token, model.PurposeVerifyEmail, now)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	span.SetAttributes(attribute.String("user.id", t.UserID))
+
+	// Only the address the link was mailed to is verified, even if the email changes meanwhile
+	if err := s.users.MarkEmailVerified(ctx, t.UserID, t.Email, now); err != nil {
+		s.logger.Error("Failed to mark email verified", slog.String("user.id", t.UserID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to mark email verified")
+		if errors.Is(err, appErr.ErrNotFound) {
+			return appErr.ErrInvalidToken
+		}
+		return appErr.ErrInternal
+	}
+
+	s.logger.Info("Email verified", slog.String("user.id", t.UserID))
+	return nil
+}
+
+// ForgotPassword mails a password reset link
+func (s *accountService) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "accountService.ForgotPassword")
+	defer span.End()
+
+	user, err := s.lookup(ctx, email)
+	if err != nil || user == nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("user.id", user.ID))
+
+	link, err := s.issue(ctx, user, model.PurposeResetPassword, s.cfg.ResetExpiry, "/reset-password")
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to issue reset token")
+		return appErr.ErrInternal
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your HCaaS account.\n\n"+
+			"Choose a new password by opening this link within %s:\n\n%s\n\n"+
+			"If it was not you, ignore this mail; your password stays unchanged.\n",
+			s.cfg.ResetExpiry, link),
+	}
+	if err := s.send(ctx, msg); err != nil {
+		span.SetStatus(codes.Error, "Failed to send mail")
+		return err
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token
+func (s *accountService) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "accountService.ResetPassword")
+	defer span.End()
+
+	// The password is checked first, so a weak one does not use up the token
+	if err := checkPasswordStrength(password); err != nil {
+		span.SetStatus(codes.Error, "Password does not meet the requirements")
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Password hashing failed")
+		return appErr.ErrInternal
+	}
+
+	now := time.Now()
+	t, user, err := s.consume(ctx, token, model.PurposeResetPassword, now)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	span.SetAttributes(attribute.String("user.id", t.UserID))
+
+	if err := s.users.UpdatePassword(ctx, t.UserID, string(hashed)); err != nil {
+		s.logger.Error("Failed to update password", slog.String("user.id", t.UserID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to update password")
+		if errors.Is(err, appErr.ErrNotFound) {
+			return appErr.ErrInvalidToken
+		}
+		return appErr.ErrInternal
+	}
+
+	// Whoever knew the old password must not stay signed in, and the owner may have been
+	// locked out by their own attempts
+	if err := s.tokens.RevokeUserTokens(ctx, t.UserID, now); err != nil {
+		s.logger.Error("Failed to revoke refresh tokens", slog.String("user.id", t.UserID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		return appErr.ErrInternal
+	}
+	if err := s.limiter.Unlock(ctx, user.Email, ""); err != nil {
+		s.logger.Warn("Failed to lift login lockout", slog.String("user.id", t.UserID), slog.String("error", err.Error()))
+	}
+
+	s.logger.Info("Password reset", slog.String("user.id", t.UserID))
+	return nil
+}
+
+// lookup returns the user with the email, or nil if there is none
+func (s *accountService) lookup(ctx context.Context, email string) (*model.User, error) {
+	user, err := s.users.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			s.logger.Info("Account mail requested for an unknown email", slog.String("email", email))
+			return nil, nil
+		}
+		s.logger.Error("Failed to fetch user by email", slog.String("email", email), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+	return user, nil
+}
+
+// issue stores a new token of purpose for user and returns the link at path carrying it
+func (s *accountService) issue(ctx context.Context, user *model.User, purpose string, expiry time.Duration, path string) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	t := &model.EmailToken{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(expiry),
+		CreatedAt: now,
+	}
+	if err := s.emailTokens.CreateEmailToken(ctx, t); err != nil {
+		s.logger.Error("Failed to store email token", slog.String("user.id", user.ID), slog.String("error", err.Error()))
+		return "", err
+	}
+	return s.cfg.PublicURL + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// consume uses up a token of purpose and returns it with its user, who must still have the
+// email the token was mailed to
+func (s *accountService) consume(ctx context.Context, token, purpose string, at time.Time) (*model.EmailToken, *model.User, error) {
+	if token == "" {
+		return nil, nil, appErr.ErrInvalidToken
+	}
+	t, err := s.emailTokens.ConsumeEmailToken(ctx, hashToken(token), purpose, at)
+	if err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			s.logger.Warn("Unknown, used or expired email token", slog.String("purpose", purpose))
+			return nil, nil, appErr.ErrInvalidToken
+		}
+		s.logger.Error("Failed to consume email token", slog.String("error", err.Error()))
+		return nil, nil, appErr.ErrInternal
+	}
+
+	user, err := s.users.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			return nil, nil, appErr.ErrInvalidToken
+		}
+		s.logger.Error("Failed to fetch user of email token", slog.String("user.id", t.UserID), slog.String("error", err.Error()))
+		return nil, nil, appErr.ErrInternal
+	}
+	if !strings.EqualFold(user.Email, t.Email) {
+		s.logger.Warn("Email token mailed to a previous email", slog.String("user.id", t.UserID), slog.String("purpose", purpose))
+		return nil, nil, appErr.ErrInvalidToken
+	}
+	return t, user, nil
+}
+
+// send sends msg
+func (s *accountService) send(ctx context.Context, msg mailer.Message) error {
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.logger.Error("Failed to send mail", slog.String("subject", msg.Subject), slog.String("error", err.Error()))
+		return appErr.ErrInternal
+	}
+	return nil
+}
+
+// isValidEmail reports whether email looks like an address mail can be sent to, as required
+// at registration
+func isValidEmail(email string) bool {
+	return regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`).MatchString(email)
+}
+
+// checkPasswordStrength requires at least eight characters with an uppercase and a lowercase
+// letter, a digit and a special character, as at registration. It returns ErrInvalidInput
+// telling the client which rule the password breaks.
+func checkPasswordStrength(password string) error {
+	if len(password) < 8 {
+		return problem.Errorf(appErr.ErrInvalidInput, "password must have at least 8 characters")
+	}
+	if !regexp.MustCompile(`[A-Z]`).MatchString(password) ||
+		!regexp.MustCompile(`[a-z]`).MatchString(password) ||
+		!regexp.MustCompile(`[0-9]`).MatchString(password) ||
+		!regexp.MustCompile(`[\W_]`).MatchString(password) {
+		return problem.Errorf(appErr.ErrInvalidInput, "password needs an uppercase and a lowercase letter, a digit and a special character")
+	}
+	return nil
+}
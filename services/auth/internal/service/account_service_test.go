@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/mailer"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// recordingMailer keeps the mails it is asked to send
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// token returns the token of the link in the last mail
+func (m *recordingMailer) token(t *testing.T) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	link := regexp.MustCompile(`https?://\S+`).FindString(m.sent[len(m.sent)-1].Body)
+	u, err := url.Parse(link)
+	if err != nil || u.Query().Get("token") == "" {
+		t.Fatalf("mail without a token link: %q", m.sent[len(m.sent)-1].Body)
+	}
+	return u.Query().Get("token")
+}
+
+// Test_accountService tests email verification and password reset.
+// Table Driven Test Pattern used
+func Test_accountService(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	users := storage.NewSQLiteUserStorage(db, tracer)
+	tokens := storage.NewSQLiteTokenStorage(db, tracer)
+	limiter := NewLoginLimiter(storage.NewSQLiteLoginLimitStorage(db, tracer), testLoginLimits, audit.Discard, slog.Default(), tracer)
+	tokenSvc := NewJWTService("secret", nil, time.Minute, tokens, slog.Default(), tracer)
+	authSvc := NewAuthService(users, tokens, limiter, newTestMFAService(db, tracer), audit.Discard, slog.Default(), tokenSvc, time.Hour, true, tracer)
+	mails := &recordingMailer{}
+	accountSvc := NewAccountService(users, storage.NewSQLiteEmailTokenStorage(db, tracer), tokens, limiter, mails, AccountConfig{
+		PublicURL:          "https://hcaas.example.com",
+		VerificationExpiry: time.Hour,
+		ResetExpiry:        time.Hour,
+	}, slog.Default(), tracer)
+
+	user, err := authSvc.Register(ctx, "alice@example.com", "Password@123")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	var verifyToken, resetToken, refreshToken string
+
+	tests := []struct {
+		name      string
+		call      func() error
+		wantErr   error
+		wantMails int
+	}{
+		{
+			name:      "login before verification",
+			call:      func() error { _, _, err := authSvc.Login(ctx, user.Email, "Password@123", ""); return err },
+			wantErr:   appErr.ErrEmailNotVerified,
+			wantMails: 0,
+		},
+		{
+			name: "verification mail",
+			call: func() error {
+				err := accountSvc.SendVerification(ctx, user)
+				verifyToken = mails.token(t)
+				return err
+			},
+			wantMails: 1,
+		},
+		{name: "unknown verification token", call: func() error { return accountSvc.VerifyEmail(ctx, "unknown") }, wantErr: appErr.ErrInvalidToken, wantMails: 1},
+		{name: "verify", call: func() error { return accountSvc.VerifyEmail(ctx, verifyToken) }, wantMails: 1},
+		{name: "verification token reused", call: func() error { return accountSvc.VerifyEmail(ctx, verifyToken) }, wantErr: appErr.ErrInvalidToken, wantMails: 1},
+		{name: "no resend once verified", call: func() error { return accountSvc.ResendVerification(ctx, user.Email) }, wantMails: 1},
+		{
+			name: "login after verification",
+			call: func() error {
+				_, pair, err := authSvc.Login(ctx, user.Email, "Password@123", "")
+				if pair != nil {
+					refreshToken = pair.RefreshToken
+				}
+				return err
+			},
+			wantMails: 1,
+		},
+		{name: "forgot password of an unknown email", call: func() error { return accountSvc.ForgotPassword(ctx, "nobody@example.com") }, wantMails: 1},
+		{
+			name: "forgot password",
+			call: func() error {
+				err := accountSvc.ForgotPassword(ctx, user.Email)
+				resetToken = mails.token(t)
+				return err
+			},
+			wantMails: 2,
+		},
+		{name: "verification token for a reset", call: func() error { return accountSvc.ResetPassword(ctx, verifyToken, "NewPassword@456") }, wantErr: appErr.ErrInvalidToken, wantMails: 2},
+		{name: "weak password keeps the token", call: func() error { return accountSvc.ResetPassword(ctx, resetToken, "weak") }, wantErr: appErr.ErrInvalidInput, wantMails: 2},
+		{name: "reset", call: func() error { return accountSvc.ResetPassword(ctx, resetToken, "NewPassword@456") }, wantMails: 2},
+		{name: "reset token reused", call: func() error { return accountSvc.ResetPassword(ctx, resetToken, "Other@789xyz") }, wantErr: appErr.ErrInvalidToken, wantMails: 2},
+		{name: "sessions revoked by the reset", call: func() error { _, err := authSvc.Refresh(ctx, refreshToken); return err }, wantErr: appErr.ErrInvalidToken, wantMails: 2},
+		{
+			name:      "old password",
+			call:      func() error { _, _, err := authSvc.Login(ctx, user.Email, "Password@123", ""); return err },
+			wantErr:   appErr.ErrUnauthorized,
+			wantMails: 2,
+		},
+		{
+			name:      "new password",
+			call:      func() error { _, _, err := authSvc.Login(ctx, user.Email, "NewPassword@456", ""); return err },
+			wantMails: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if len(mails.sent) != tt.wantMails {
+				t.Errorf("%d mails sent, want %d", len(mails.sent), tt.wantMails)
+			}
+		})
+	}
+}
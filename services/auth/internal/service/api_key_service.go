@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// apiKeyPrefixLen is the length of the start of a key kept in clear text to identify it
+const apiKeyPrefixLen = len(authn.APIKeyPrefix) + 8
+
+// APIKeyService manages the API keys users issue for machine-to-machine access
+type APIKeyService interface {
+	// Create issues a key with a subset of authn.Scopes. The key itself is returned only
+	// here; afterwards only its hash is known.
+	Create(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (*model.APIKey, string, error)
+	List(ctx context.Context, userID string) ([]model.APIKey, error)
+	// Revoke returns ErrNotFound when the user has no unrevoked key with the ID
+	Revoke(ctx context.Context, userID, id string) error
+	// Validate returns the identity of the owner of a valid key, with the scopes of the key
+	Validate(ctx context.Context, key string) (authn.Identity, error)
+}
+
+// apiKeyService is the implementation of the APIKeyService interface
+type apiKeyService struct {
+	keys   storage.APIKeyStorage
+	users  storage.UserStorage
+	audit  audit.Recorder
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService. Created and revoked keys are
+// recorded to rec.
+func NewAPIKeyService(keys storage.APIKeyStorage, users storage.UserStorage, rec audit.Recorder, logger *slog.Logger, tracer *otelkit.Tracer) APIKeyService {
+	l := logger.With("layer", "service", "component", "apiKeyService")
+	return &apiKeyService{keys: keys, users: users, audit: rec, logger: l, tracer: tracer}
+}
+
+// Create issues a new API key
+func (s *apiKeyService) Create(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (*model.APIKey, string, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "apiKeyService.Create")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", userID),
+		attribute.StringSlice("api_key.scopes", scopes),
+	)
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		span.SetStatus(codes.Error, "Invalid API key name")
+		return nil, "", appErr.ErrInvalidInput
+	}
+	if len(scopes) == 0 {
+		span.SetStatus(codes.Error, "API key without scopes")
+		return nil, "", appErr.ErrInvalidInput
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(authn.Scopes, scope) {
+			s.logger.Warn("Unknown API key scope", slog.String("scope", scope))
+			span.SetStatus(codes.Error, "Unknown API key scope")
+			return nil, "", appErr.ErrInvalidInput
+		}
+	}
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		span.SetStatus(codes.Error, "API key expiry in the past")
+		return nil, "", appErr.ErrInvalidInput
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, "", appErr.ErrInternal
+	}
+	key := authn.APIKeyPrefix + secret
+	sorted := slices.Clone(scopes)
+	slices.Sort(sorted)
+	k := &model.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyPrefixLen],
+		KeyHash:   hashToken(key),
+		Scopes:    slices.Compact(sorted),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if err := s.keys.CreateAPIKey(ctx, k); err != nil {
+		s.logger.Error("Failed to create API key", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to create API key")
+		return nil, "", appErr.ErrInternal
+	}
+
+	s.logger.Info("API key created", slog.String("user.id", userID), slog.String("api_key.id", k.ID))
+	span.SetAttributes(attribute.String("api_key.id", k.ID))
+	recordChange(ctx, s.audit, s.logger, audit.Event{Action: audit.ActionAPIKeyCreated, TargetType: "api_key", TargetID: k.ID}, nil, k)
+	return k, key, nil
+}
+
+// List lists the API keys of a user
+func (s *apiKeyService) List(ctx context.Context, userID string) ([]model.APIKey, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "apiKeyService.List")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	keys, err := s.keys.ListAPIKeys(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to list API keys", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to list API keys")
+		return nil, appErr.ErrInternal
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key of a user
+func (s *apiKeyService) Revoke(ctx context.Context, userID, id string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "apiKeyService.Revoke")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID), attribute.String("api_key.id", id))
+	if err := s.keys.RevokeAPIKey(ctx, userID, id, time.Now()); err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			span.SetStatus(codes.Error, "API key not found")
+			return appErr.ErrNotFound
+		}
+		s.logger.Error("Failed to revoke API key", slog.String("api_key.id", id), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to revoke API key")
+		return appErr.ErrInternal
+	}
+
+	s.logger.Info("API key revoked", slog.String("user.id", userID), slog.String("api_key.id", id))
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionAPIKeyRevoked, TargetType: "api_key", TargetID: id})
+	return nil
+}
+
+// Validate validates an API key
+func (s *apiKeyService) Validate(ctx context.Context, key string) (authn.Identity, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "apiKeyService.Validate")
+	defer span.End()
+
+	k, err := s.keys.GetAPIKeyByHash(ctx, hashToken(key))
+	if err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			span.SetStatus(codes.Error, "Unknown API key")
+			return authn.Identity{}, appErr.ErrInvalidToken
+		}
+		s.logger.Error("Failed to fetch API key", slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to fetch API key")
+		return authn.Identity{}, appErr.ErrInternal
+	}
+	span.SetAttributes(attribute.String("api_key.id", k.ID), attribute.String("user.id", k.UserID))
+
+	now := time.Now()
+	if k.RevokedAt != nil || k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		s.logger.Warn("Revoked or expired API key used", slog.String("api_key.id", k.ID))
+		span.SetStatus(codes.Error, "Revoked or expired API key")
+		return authn.Identity{}, appErr.ErrInvalidToken
+	}
+
+	user, err := s.users.GetUserByID(ctx, k.UserID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to fetch owner of API key")
+		if errors.Is(err, appErr.ErrNotFound) {
+			return authn.Identity{}, appErr.ErrInvalidToken
+		}
+		return authn.Identity{}, appErr.ErrInternal
+	}
+	if user.DisabledAt != nil {
+		span.SetStatus(codes.Error, "Owner of API key disabled")
+		return authn.Identity{}, appErr.ErrInvalidToken
+	}
+
+	// A failure to record the use must not fail the request
+	if err := s.keys.TouchAPIKey(ctx, k.ID, now); err != nil {
+		s.logger.Warn("Failed to record API key use", slog.String("api_key.id", k.ID), slog.String("error", err.Error()))
+	}
+	return authn.Identity{UserID: user.ID, Email: user.Email, Scope: strings.Join(k.Scopes, " ")}, nil
+}
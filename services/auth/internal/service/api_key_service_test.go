@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// Test_apiKeyService tests issuing, validating and revoking API keys.
+// Table Driven Test Pattern used
+func Test_apiKeyService(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	users := storage.NewSQLiteUserStorage(db, tracer)
+	svc := NewAPIKeyService(storage.NewSQLiteAPIKeyStorage(db, tracer), users, audit.Discard, slog.Default(), tracer)
+
+	user, err := users.CreateUser(ctx, "ci@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	createTests := []struct {
+		name      string
+		keyName   string
+		scopes    []string
+		expiresAt *time.Time
+		wantErr   error
+	}{
+		{name: "without name", keyName: " ", scopes: []string{authn.ScopeURLsRead}, wantErr: appErr.ErrInvalidInput},
+		{name: "without scopes", keyName: "ci", wantErr: appErr.ErrInvalidInput},
+		{name: "unknown scope", keyName: "ci", scopes: []string{"admin"}, wantErr: appErr.ErrInvalidInput},
+		{name: "expired", keyName: "ci", scopes: []string{authn.ScopeURLsRead}, expiresAt: &past, wantErr: appErr.ErrInvalidInput},
+		{name: "valid", keyName: "ci", scopes: []string{authn.ScopeURLsWrite, authn.ScopeURLsRead, authn.ScopeURLsWrite}, expiresAt: &future},
+	}
+	var key, id string
+	for _, tt := range createTests {
+		k, got, err := svc.Create(ctx, user.ID, tt.keyName, tt.scopes, tt.expiresAt)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: Create() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil {
+			key, id = got, k.ID
+			if !strings.HasPrefix(key, k.Prefix) || len(k.Scopes) != 2 {
+				t.Errorf("%s: Create() = %+v, %s, want a prefix of the key and deduplicated scopes", tt.name, *k, key)
+			}
+		}
+	}
+
+	identity, err := svc.Validate(ctx, key)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	want := authn.Identity{UserID: user.ID, Email: user.Email, Scope: "urls:read urls:write"}
+	if identity != want {
+		t.Errorf("Validate() = %+v, want %+v", identity, want)
+	}
+	if keys, err := svc.List(ctx, user.ID); err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("List() = %+v, %v, want the used key", keys, err)
+	}
+
+	if err := svc.Revoke(ctx, "someone-else", id); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("Revoke() by another user error = %v, want ErrNotFound", err)
+	}
+	if err := svc.Revoke(ctx, user.ID, id); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := svc.Validate(ctx, key); !errors.Is(err, appErr.ErrInvalidToken) {
+		t.Errorf("Validate() of a revoked key error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := svc.Validate(ctx, authn.APIKeyPrefix+"unknown"); !errors.Is(err, appErr.ErrInvalidToken) {
+		t.Errorf("Validate() of an unknown key error = %v, want ErrInvalidToken", err)
+	}
+}
@@ -2,18 +2,25 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"log/slog"
 	"regexp"
 	"time"
 
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/samims/otelkit"
 
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/problem"
 	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
 	"github.com/kernelshard/hcaas/services/auth/internal/model"
 	"github.com/kernelshard/hcaas/services/auth/internal/storage"
@@ -22,36 +29,56 @@ import (
 // AuthService defines the interface for authentication-related operations
 type AuthService interface {
 	Register(ctx context.Context, email, password string) (*model.User, error)
-	Login(ctx context.Context, email, password string) (*model.User, string, error)
-	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// Login checks the credentials of a login from clientIP, which may be empty when unknown.
+	// For users with MFA enabled the result holds a challenge for LoginMFA instead of tokens.
+	// Disabled users get ErrAccountDisabled after their password is checked.
+	Login(ctx context.Context, email, password, clientIP string) (*model.User, *model.LoginResult, error)
+	// LoginMFA completes a login with its challenge and a TOTP or recovery code. It returns
+	// ErrInvalidToken for an unknown or expired challenge and ErrInvalidMFACode for a wrong code.
+	LoginMFA(ctx context.Context, challenge, code, clientIP string) (*model.User, *model.TokenPair, error)
+	// LoginExternal logs in a user authenticated by an external identity provider, such as
+	// an OIDC login. Like Login, it returns a challenge for users with MFA enabled.
+	LoginExternal(ctx context.Context, user *model.User) (*model.LoginResult, error)
+	// Refresh exchanges a refresh token for a new token pair. Every refresh token can be
+	// used once; presenting a used one revokes all tokens descended from the same login.
+	Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error)
+	// Logout revokes the access token and, when given, the refresh token family of the user
+	Logout(ctx context.Context, userID, accessToken, refreshToken string) error
 	ValidateToken(ctx context.Context, token string) (string, string, error)
 }
 
 // authService is the implementation of the AuthService interface
 type authService struct {
-	store    storage.UserStorage
-	logger   *slog.Logger
-	tokenSvc TokenService
-	tracer   *otelkit.Tracer
-	// Add rate limiting map or store here if needed
-	loginAttempts   map[string]int
-	lockoutTime     map[string]time.Time
-	lockoutDuration time.Duration
-	maxAttempts     int
+	store         storage.UserStorage
+	tokens        storage.TokenStorage
+	limiter       LoginLimiter
+	mfa           MFAService
+	audit         audit.Recorder
+	logger        *slog.Logger
+	tokenSvc      TokenService
+	refreshExpiry time.Duration
+	// requireVerifiedEmail rejects logins of users who have not verified their email
+	requireVerifiedEmail bool
+	tracer               *otelkit.Tracer
 }
 
-// NewAuthService creates a new instance of AuthService
-func NewAuthService(store storage.UserStorage, logger *slog.Logger, tokenSvc TokenService, tracer *otelkit.Tracer) AuthService {
+// NewAuthService creates a new instance of AuthService. Refresh tokens are valid for
+// refreshExpiry. With requireVerifiedEmail, Login returns ErrEmailNotVerified for users who
+// have not verified their email. Logins, failed logins and issued tokens are recorded to rec.
+func NewAuthService(store storage.UserStorage, tokens storage.TokenStorage, limiter LoginLimiter, mfa MFAService, rec audit.Recorder, logger *slog.Logger, tokenSvc TokenService,
+	refreshExpiry time.Duration, requireVerifiedEmail bool, tracer *otelkit.Tracer) AuthService {
 	l := logger.With("layer", "service", "component", "authService")
 	return &authService{
-		store:           store,
-		logger:          l,
-		tokenSvc:        tokenSvc,
-		tracer:          tracer,
-		loginAttempts:   make(map[string]int),
-		lockoutTime:     make(map[string]time.Time),
-		lockoutDuration: 15 * time.Minute,
-		maxAttempts:     5,
+		store:                store,
+		tokens:               tokens,
+		limiter:              limiter,
+		mfa:                  mfa,
+		audit:                rec,
+		logger:               l,
+		tokenSvc:             tokenSvc,
+		refreshExpiry:        refreshExpiry,
+		tracer:               tracer,
+		requireVerifiedEmail: requireVerifiedEmail,
 	}
 }
 
@@ -66,7 +93,7 @@ func (s *authService) Register(ctx context.Context, email, password string) (*mo
 		attribute.String("operation", "user_registration"),
 	)
 
-	if !regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`).MatchString(email) {
+	if !isValidEmail(email) {
 		s.logger.Error("Invalid email format", slog.String("email", email))
 		span.SetStatus(codes.Error, "Invalid email format")
 		span.SetAttributes(attribute.String("error.type", "invalid_email_format"))
@@ -81,7 +108,7 @@ func (s *authService) Register(ctx context.Context, email, password string) (*mo
 			attribute.String("error.type", "password_too_short"),
 			attribute.Int("password.length", len(password)),
 		)
-		return nil, appErr.ErrInvalidInput
+		return nil, problem.Errorf(appErr.ErrInvalidInput, "password must have at least 8 characters")
 	}
 
 	// Enforce password complexity: at least one uppercase, one lowercase, one digit, one special char
@@ -110,7 +137,7 @@ func (s *authService) Register(ctx context.Context, email, password string) (*mo
 			attribute.Bool("complexity.has_digit", hasDigit(password)),
 			attribute.Bool("complexity.has_special", hasSpecial(password)),
 		)
-		return nil, appErr.ErrInvalidInput
+		return nil, problem.Errorf(appErr.ErrInvalidInput, "password needs an uppercase and a lowercase letter, a digit and a special character")
 	}
 
 	// Hash the password
@@ -133,7 +160,7 @@ func (s *authService) Register(ctx context.Context, email, password string) (*mo
 			otelkit.RecordError(span, err)
 			span.SetStatus(codes.Error, "User already exists")
 			span.SetAttributes(attribute.String("error.type", "user_already_exists"))
-			return nil, appErr.ErrConflict
+			return nil, problem.Errorf(appErr.ErrConflict, "email already registered")
 		}
 
 		// Log and record the error
@@ -156,11 +183,13 @@ func (s *authService) Register(ctx context.Context, email, password string) (*mo
 	return createdUser, nil
 }
 
-// Login logs in a user by email and password & generates a token
-func (s *authService) Login(ctx context.Context, email, password string) (*model.User, string, error) {
+// Login logs in a user by email and password & generates a token pair
+func (s *authService) Login(ctx context.Context, email, password, clientIP string) (*model.User, *model.LoginResult, error) {
 	ctx, span := s.tracer.StartServerSpan(ctx, "authService.Login")
 	defer span.End()
 
+	// Normalized like storage does, so variants of one address share a lockout
+	email = storage.NormalizeEmail(email)
 	s.logger.Info("Login called", slog.String("email", email))
 	span.SetAttributes(
 		attribute.String("user.email", email),
@@ -168,42 +197,31 @@ func (s *authService) Login(ctx context.Context, email, password string) (*model
 		attribute.String("service.component", "auth_service"),
 	)
 
-	// Check if user is locked out
-	if lockoutUntil, locked := s.lockoutTime[email]; locked {
-		if time.Now().Before(lockoutUntil) {
-			remainingLockout := time.Until(lockoutUntil)
-
-			s.logger.Warn("User account locked due to too many failed login attempts",
-				slog.String("email", email),
-				slog.Duration("remaining_lockout", remainingLockout))
-			otelkit.RecordError(span, appErr.ErrTooManyAttempts)
-			span.SetStatus(codes.Error, "Account locked due to too many failed attempts")
-			span.SetAttributes(
-				attribute.String("error.type", "account_locked"),
-				attribute.Int64("lockout.remaining_seconds", int64(remainingLockout.Seconds())),
-			)
-
-			return nil, "", appErr.ErrTooManyAttempts
-		} else {
-			// Lockout period has expired, reset attempts
-			delete(s.lockoutTime, email)
-			s.loginAttempts[email] = 0
-			span.AddEvent("lockout_expired_reset")
-		}
+	// Check if the email or the client is locked out
+	if err := s.limiter.Check(ctx, email, clientIP); err != nil {
+		s.audit.Record(ctx, audit.Event{Action: audit.ActionLoginFailed, ActorEmail: email})
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Locked out due to too many failed attempts")
+		span.SetAttributes(attribute.String("error.type", "account_locked"))
+		return nil, nil, err
 	}
 
 	// Fetch the user by email to validate credentials
 	user, err := s.store.GetUserByEmail(ctx, email)
 	if err != nil {
 		// when there is no user found by email
-		if errors.Is(err, pgx.ErrNoRows) {
+		if errors.Is(err, appErr.ErrNotFound) {
 			s.logger.Warn("User not found", slog.String("email", email))
 
 			otelkit.RecordError(span, err)
 			span.SetStatus(codes.Error, "User not found")
 			span.SetAttributes(attribute.String("error.type", "user_not_found"))
 
-			return nil, "", appErr.ErrUnauthorized
+			// Unknown emails count too, so guessing emails from one client gets it locked out
+			if err := s.fail(ctx, &model.User{Email: email}, clientIP); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, appErr.ErrUnauthorized
 		}
 		// for other database errors
 		s.logger.Error("Failed to fetch user by email", slog.String("email", email), slog.Any("error", err))
@@ -211,7 +229,7 @@ func (s *authService) Login(ctx context.Context, email, password string) (*model
 		span.SetStatus(codes.Error, "Failed to fetch user by email")
 		span.SetAttributes(attribute.String("error.type", "database_error"))
 
-		return nil, "", appErr.ErrInternal
+		return nil, nil, appErr.ErrInternal
 	}
 	s.logger.Info("Log in user found", slog.String("email", email), slog.String("user.id", user.ID))
 	span.SetAttributes(
@@ -222,110 +240,395 @@ func (s *authService) Login(ctx context.Context, email, password string) (*model
 	// Compare the provided password with the stored hashed password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		// Password mismatch
-		s.loginAttempts[email]++
-		currentAttempts := s.loginAttempts[email]
+		s.logger.Warn("Invalid password", slog.String("email", email))
+		span.SetStatus(codes.Error, "Invalid password")
+		span.SetAttributes(attribute.String("error.type", "invalid_password"))
 
-		span.SetAttributes(
-			attribute.Int("login.attempts", currentAttempts),
-			attribute.Int("login.max_attempts", s.maxAttempts),
-		)
-		// Check if the user has reached the maximum number of login attempts
-		if currentAttempts >= s.maxAttempts {
-			s.lockoutTime[email] = time.Now().Add(s.lockoutDuration)
-			s.logger.Warn("User account locked due to too many failed login attempts",
-				slog.String("email", email),
-				slog.Int("attempts", currentAttempts))
-			span.SetStatus(codes.Error, "Account locked due to too many failed attempts")
-			span.SetAttributes(
-				attribute.String("error.type", "account_locked"),
-				attribute.Int("login.failed_attempts", currentAttempts),
-			)
-			return nil, "", appErr.ErrTooManyAttempts
+		// The failure that reaches the limit is reported as a lockout
+		if err := s.fail(ctx, user, clientIP); err != nil {
+			return nil, nil, err
 		}
+		return nil, nil, appErr.ErrUnauthorized
+	}
 
-		s.logger.Warn("Invalid password", slog.String("email", email), slog.Int("attempt", currentAttempts))
+	// Checked after the password, so it does not reveal whether an email is registered
+	if s.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		s.logger.Warn("Login with unverified email", slog.String("email", email))
+		span.SetStatus(codes.Error, "Email not verified")
+		span.SetAttributes(attribute.String("error.type", "email_not_verified"))
+		return nil, nil, appErr.ErrEmailNotVerified
+	}
 
-		span.SetStatus(codes.Error, "Invalid password")
-		span.SetAttributes(
-			attribute.String("error.type", "invalid_password"),
-			attribute.Int("login.failed_attempts", currentAttempts),
-		)
+	result, err := s.secondFactor(ctx, span, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, result, nil
+}
+
+// LoginExternal logs in a user authenticated by an external identity provider
+func (s *authService) LoginExternal(ctx context.Context, user *model.User) (*model.LoginResult, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "authService.LoginExternal")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", user.ID),
+		attribute.String("operation", "user_login_external"),
+		attribute.String("service.component", "auth_service"),
+	)
+	s.logger.Info("External login", slog.String("email", user.Email), slog.String("user.id", user.ID))
+	return s.secondFactor(ctx, span, user)
+}
+
+// secondFactor returns a challenge for users with MFA enabled and a token pair for others
+func (s *authService) secondFactor(ctx context.Context, span trace.Span, user *model.User) (*model.LoginResult, error) {
+	if user.DisabledAt != nil {
+		s.logger.Warn("Login of a disabled user", slog.String("email", user.Email), slog.String("user.id", user.ID))
+		span.SetStatus(codes.Error, "Account disabled")
+		span.SetAttributes(attribute.String("error.type", "account_disabled"))
+		return nil, appErr.ErrAccountDisabled
+	}
 
-		return nil, "", appErr.ErrUnauthorized
+	// With MFA the first step is only half of the login. Failed logins are reset when the
+	// second one succeeds, so wrong codes count against the limits as well.
+	mfaEnabled, err := s.mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to check MFA")
+		return nil, appErr.ErrInternal
+	}
+	if mfaEnabled {
+		challenge, err := s.mfa.Challenge(ctx, user.ID)
+		if err != nil {
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, "Failed to create MFA challenge")
+			return nil, appErr.ErrInternal
+		}
+		s.logger.Info("Login awaits second factor", slog.String("email", user.Email), slog.String("user.id", user.ID))
+		span.AddEvent("mfa.challenge.issued")
+		return &model.LoginResult{MFARequired: true, MFAToken: challenge}, nil
 	}
 
-	// Reset login attempts on successful login
-	s.loginAttempts[email] = 0
+	pair, err := s.completeLogin(ctx, span, user)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{TokenPair: pair}, nil
+}
+
+// LoginMFA completes a login with the challenge returned by Login and a TOTP or recovery code
+func (s *authService) LoginMFA(ctx context.Context, challenge, code, clientIP string) (*model.User, *model.TokenPair, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "authService.LoginMFA")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("operation", "user_login_mfa"),
+		attribute.String("service.component", "auth_service"),
+	)
+
+	// The email is unknown until the challenge is looked up
+	if err := s.limiter.Check(ctx, "", clientIP); err != nil {
+		otelkit.RecordError(span, err)
+		return nil, nil, err
+	}
+
+	userID, err := s.mfa.Complete(ctx, challenge, code)
+	if err != nil && !errors.Is(err, appErr.ErrInvalidMFACode) {
+		otelkit.RecordError(span, err)
+		return nil, nil, err
+	}
+	span.SetAttributes(attribute.String("user.id", userID))
+
+	user, uerr := s.store.GetUserByID(ctx, userID)
+	if uerr != nil {
+		otelkit.RecordError(span, uerr)
+		if errors.Is(uerr, appErr.ErrNotFound) {
+			return nil, nil, appErr.ErrInvalidToken
+		}
+		return nil, nil, appErr.ErrInternal
+	}
+
+	if errors.Is(err, appErr.ErrInvalidMFACode) {
+		s.logger.Warn("Invalid second factor", slog.String("email", user.Email))
+		span.SetStatus(codes.Error, "Invalid second factor")
+		span.SetAttributes(attribute.String("error.type", "invalid_mfa_code"))
+		if err := s.fail(ctx, user, clientIP); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, appErr.ErrInvalidMFACode
+	}
+
+	// An email locked out while the code was typed, e.g. by someone else guessing codes,
+	// stays locked out
+	if err := s.limiter.Check(ctx, user.Email, clientIP); err != nil {
+		otelkit.RecordError(span, err)
+		return nil, nil, err
+	}
+	if user.DisabledAt != nil {
+		span.SetStatus(codes.Error, "Account disabled")
+		return nil, nil, appErr.ErrAccountDisabled
+	}
+
+	pair, err := s.completeLogin(ctx, span, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, pair, nil
+}
+
+// fail records a failed login of user, who has no ID when the email is unknown, and counts
+// it against the limits of the email and clientIP
+func (s *authService) fail(ctx context.Context, user *model.User, clientIP string) error {
+	e := audit.Event{Action: audit.ActionLoginFailed, ActorID: user.ID, ActorEmail: user.Email}
+	if user.ID != "" {
+		e.TargetType, e.TargetID = "user", user.ID
+	}
+	s.audit.Record(ctx, e)
+	return s.limiter.Fail(ctx, user.Email, clientIP)
+}
+
+// completeLogin resets the failed logins of user and issues a token pair of a new family
+func (s *authService) completeLogin(ctx context.Context, span trace.Span, user *model.User) (*model.TokenPair, error) {
+	// Reset failed logins on successful login; the IP keeps its count so a client cannot
+	// reset it by logging into an account of its own between guesses
+	if err := s.limiter.Succeed(ctx, user.Email); err != nil {
+		s.logger.Warn("Failed to reset login attempts", slog.String("email", user.Email), slog.Any("error", err))
+	}
 	span.AddEvent("login_attempts_reset")
 
-	// Generate a token for the user
-	token, err := s.tokenSvc.GenerateToken(ctx, user)
+	// Generate a token pair for the user, starting a new refresh token family
+	pair, err := s.issueTokens(ctx, user, uuid.NewString())
 	if err != nil {
 		// Token generation failed
-		s.logger.Error("Token generation failed", slog.String("email", email), slog.Any("error", err))
+		s.logger.Error("Token generation failed", slog.String("email", user.Email), slog.Any("error", err))
 
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, "Token generation failed")
 		span.SetAttributes(attribute.String("error.type", "token_generation_error"))
 
-		return nil, "", appErr.ErrTokenGeneration
+		return nil, appErr.ErrTokenGeneration
 	}
 
-	s.logger.Info("Token Generated successfully", slog.String("email", email), slog.String("user.id", user.ID))
+	s.logger.Info("Token Generated successfully", slog.String("email", user.Email), slog.String("user.id", user.ID))
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionLogin,
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
 	span.SetAttributes(
 		attribute.String("token.generated", "true"),
 		attribute.String("result", "success"),
 	)
 	span.AddEvent("operation.completed")
 
-	return user, token, nil
+	return pair, nil
 }
 
-// GetUserByEmail gets a user by email and returns the user object
-func (s *authService) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	ctx, span := s.tracer.StartServerSpan(ctx, "authService.GetUserByEmail")
+// Refresh exchanges a refresh token for a new token pair of the same family
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "authService.Refresh")
 	defer span.End()
 
 	span.SetAttributes(
-		attribute.String("user.email", email),
-		attribute.String("operation", "get_user_by_email"),
+		attribute.String("operation", "refresh_token"),
 		attribute.String("service.component", "auth_service"),
 	)
 
-	// Fetch the user by email from the storage
-	user, err := s.store.GetUserByEmail(ctx, email)
+	stored, err := s.tokens.GetRefreshToken(ctx, hashToken(refreshToken))
 	if err != nil {
-		// User not found
-		if errors.Is(err, pgx.ErrNoRows) {
-			s.logger.Warn("User not found by email", slog.String("email", email))
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, "User not found by email")
-			span.SetAttributes(attribute.String("error.type", "user_not_found"))
-
-			return nil, appErr.ErrNotFound
+		if errors.Is(err, appErr.ErrNotFound) {
+			s.logger.Warn("Unknown refresh token")
+			span.SetStatus(codes.Error, "Unknown refresh token")
+			span.SetAttributes(attribute.String("error.type", "invalid_refresh_token"))
+			return nil, appErr.ErrInvalidToken
 		}
-		// Failed to fetch user by email
-		s.logger.Error(
-			"Failed to fetch user by email",
-			slog.String("email", email),
-			slog.String("error", err.Error()),
-		)
+		s.logger.Error("Failed to fetch refresh token", slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to fetch refresh token")
+		span.SetAttributes(attribute.String("error.type", "database_error"))
+		return nil, appErr.ErrInternal
+	}
+	span.SetAttributes(
+		attribute.String("user.id", stored.UserID),
+		attribute.String("token.family_id", stored.FamilyID),
+	)
 
+	now := time.Now()
+	if stored.RevokedAt != nil || !now.Before(stored.ExpiresAt) {
+		s.logger.Warn("Revoked or expired refresh token", slog.String("user.id", stored.UserID))
+		span.SetStatus(codes.Error, "Revoked or expired refresh token")
+		span.SetAttributes(attribute.String("error.type", "invalid_refresh_token"))
+		return nil, appErr.ErrInvalidToken
+	}
+
+	// A used token presented again means it leaked, whoever holds it: revoke its family
+	// so that neither the thief nor the user can refresh any more
+	err = s.tokens.UseRefreshToken(ctx, stored.ID, now)
+	if stored.UsedAt != nil || errors.Is(err, appErr.ErrConflict) {
+		s.logger.Warn("Refresh token reuse detected, revoking token family",
+			slog.String("user.id", stored.UserID),
+			slog.String("token.family_id", stored.FamilyID))
+		span.SetStatus(codes.Error, "Refresh token reuse detected")
+		span.SetAttributes(attribute.String("error.type", "refresh_token_reuse"))
+		if err := s.tokens.RevokeTokenFamily(ctx, stored.FamilyID, now); err != nil {
+			s.logger.Error("Failed to revoke token family", slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			return nil, appErr.ErrInternal
+		}
+		return nil, appErr.ErrInvalidToken
+	}
+	if err != nil {
+		s.logger.Error("Failed to use refresh token", slog.String("error", err.Error()))
 		otelkit.RecordError(span, err)
-		span.SetStatus(codes.Error, "Failed to fetch user by email")
+		span.SetStatus(codes.Error, "Failed to use refresh token")
 		span.SetAttributes(attribute.String("error.type", "database_error"))
+		return nil, appErr.ErrInternal
+	}
 
+	user, err := s.store.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		s.logger.Error("Failed to fetch user of refresh token", slog.String("user.id", stored.UserID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to fetch user")
+		if errors.Is(err, appErr.ErrNotFound) {
+			return nil, appErr.ErrInvalidToken
+		}
 		return nil, appErr.ErrInternal
 	}
+	if user.DisabledAt != nil {
+		s.logger.Warn("Refresh by a disabled user", slog.String("user.id", user.ID))
+		span.SetStatus(codes.Error, "Account disabled")
+		return nil, appErr.ErrInvalidToken
+	}
+
+	pair, err := s.issueTokens(ctx, user, stored.FamilyID)
+	if err != nil {
+		s.logger.Error("Token generation failed", slog.String("user.id", user.ID), slog.Any("error", err))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Token generation failed")
+		span.SetAttributes(attribute.String("error.type", "token_generation_error"))
+		return nil, appErr.ErrTokenGeneration
+	}
+
+	s.logger.Info("Token refreshed", slog.String("user.id", user.ID))
+	span.SetAttributes(attribute.String("result", "success"))
+	span.AddEvent("operation.completed")
+	return pair, nil
+}
+
+// Logout revokes the access token and the refresh token family of a user
+func (s *authService) Logout(ctx context.Context, userID, accessToken, refreshToken string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "authService.Logout")
+	defer span.End()
 
-	s.logger.Info("User found by email", slog.String("email", email), slog.String("user.id", user.ID))
 	span.SetAttributes(
-		attribute.String("user.id", user.ID),
-		attribute.String("result", "success"),
+		attribute.String("user.id", userID),
+		attribute.String("operation", "logout"),
+		attribute.String("service.component", "auth_service"),
 	)
+
+	if err := s.tokenSvc.RevokeToken(ctx, accessToken); err != nil {
+		s.logger.Error("Failed to revoke access token", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to revoke access token")
+		return appErr.ErrInternal
+	}
+
+	if refreshToken != "" {
+		stored, err := s.tokens.GetRefreshToken(ctx, hashToken(refreshToken))
+		switch {
+		case errors.Is(err, appErr.ErrNotFound):
+			// Nothing to revoke
+		case err != nil:
+			s.logger.Error("Failed to fetch refresh token", slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, "Failed to fetch refresh token")
+			return appErr.ErrInternal
+		case stored.UserID != userID:
+			// Never let a user log out another one
+			s.logger.Warn("Refresh token of another user presented at logout", slog.String("user.id", userID))
+			span.SetStatus(codes.Error, "Refresh token of another user")
+			return appErr.ErrInvalidToken
+		default:
+			if err := s.tokens.RevokeTokenFamily(ctx, stored.FamilyID, time.Now()); err != nil {
+				s.logger.Error("Failed to revoke token family", slog.String("error", err.Error()))
+				otelkit.RecordError(span, err)
+				span.SetStatus(codes.Error, "Failed to revoke token family")
+				return appErr.ErrInternal
+			}
+		}
+	}
+
+	s.logger.Info("Logout succeeded", slog.String("user.id", userID))
+	span.SetAttributes(attribute.String("result", "success"))
 	span.AddEvent("operation.completed")
+	return nil
+}
+
+// issueTokens generates an access token and a refresh token of familyID for user
+func (s *authService) issueTokens(ctx context.Context, user *model.User, familyID string) (*model.TokenPair, error) {
+	accessToken, err := s.tokenSvc.GenerateToken(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := s.tokens.CreateRefreshToken(ctx, &model.RefreshToken{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(s.refreshExpiry),
+		CreatedAt: now,
+	}); err != nil {
+		return nil, err
+	}
+	// Tokens are identified by their family, which lives as long as the login
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionTokenIssued,
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		TargetType: "token_family",
+		TargetID:   familyID,
+	})
+
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.tokenSvc.Expiry().Seconds()),
+	}, nil
+}
+
+// recordChange records e with the fields that differ between before and after, either of
+// which is nil for creations and deletions
+func recordChange(ctx context.Context, rec audit.Recorder, logger *slog.Logger, e audit.Event, before, after any) {
+	var err error
+	if e.Before, e.After, err = audit.Diff(before, after); err != nil {
+		logger.Warn("Failed to diff audited change", slog.String("action", e.Action), slog.String("error", err.Error()))
+	}
+	rec.Record(ctx, e)
+}
+
+// newOpaqueToken returns a random opaque token, such as a refresh token
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	return user, nil
+// hashToken returns the hash opaque tokens are stored by, so a leaked table does not leak
+// usable tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // ValidateToken validates a token and returns the user ID and email from the token
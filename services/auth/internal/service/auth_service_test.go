@@ -2,14 +2,20 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/database"
 	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
 	"github.com/kernelshard/hcaas/services/auth/internal/model"
 	"github.com/kernelshard/hcaas/services/auth/internal/storage"
 
+	"github.com/samims/otelkit"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -40,7 +46,7 @@ func Test_authService_Register(t *testing.T) {
 			fields: fields{
 				store: func() storage.UserStorage {
 					sut := storage.NewMockUserStorage(t)
-					sut.On("CreateUser", context.Background(), "test1@example.com", mock.Anything).
+					sut.On("CreateUser", mock.Anything, "test1@example.com", mock.Anything).
 						Return(&model.User{
 							Email: "test1@example.com",
 						}, nil)
@@ -64,7 +70,7 @@ func Test_authService_Register(t *testing.T) {
 			fields: fields{
 				store: func() storage.UserStorage {
 					sut := storage.NewMockUserStorage(t)
-					sut.On("CreateUser", context.Background(), "test1@example.com", mock.Anything).
+					sut.On("CreateUser", mock.Anything, "test1@example.com", mock.Anything).
 						Return(nil, appErr.ErrConflict)
 					return sut
 				}(),
@@ -140,6 +146,7 @@ func Test_authService_Register(t *testing.T) {
 				store:    tt.fields.store,
 				logger:   tt.fields.logger,
 				tokenSvc: tt.fields.tokenSvc,
+				tracer:   otelkit.New("test"),
 			}
 			got, err := s.Register(tt.args.ctx, tt.args.email, tt.args.password)
 			if (err != nil) != tt.wantErr {
@@ -152,3 +159,118 @@ func Test_authService_Register(t *testing.T) {
 		})
 	}
 }
+
+// newSQLiteDB returns a migrated in-memory SQLite database
+func newSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.OpenSQLite("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := storage.NewMigrator(db, database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newSQLiteAuthService returns an AuthService over a migrated in-memory SQLite database
+// with one registered user.
+func newSQLiteAuthService(t *testing.T) (AuthService, TokenService) {
+	t.Helper()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	tokens := storage.NewSQLiteTokenStorage(db, tracer)
+	tokenSvc := NewJWTService("secret", nil, time.Minute, tokens, slog.Default(), tracer)
+	limiter := NewLoginLimiter(storage.NewSQLiteLoginLimitStorage(db, tracer), testLoginLimits, audit.Discard, slog.Default(), tracer)
+	authSvc := NewAuthService(storage.NewSQLiteUserStorage(db, tracer), tokens, limiter, newTestMFAService(db, tracer), audit.Discard, slog.Default(), tokenSvc, time.Hour, false, tracer)
+	if _, err := authSvc.Register(context.Background(), "alice@example.com", "Password@123"); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	return authSvc, tokenSvc
+}
+
+// Test_authService_Refresh tests refresh token rotation and reuse detection.
+// Table Driven Test Pattern used
+func Test_authService_Refresh(t *testing.T) {
+	ctx := context.Background()
+	authSvc, _ := newSQLiteAuthService(t)
+
+	_, first, err := authSvc.Login(ctx, "alice@example.com", "Password@123", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if first.AccessToken == "" || first.RefreshToken == "" || first.ExpiresIn != 60 {
+		t.Fatalf("Login() = %+v, want a token pair expiring in 60s", *first)
+	}
+	_, other, err := authSvc.Login(ctx, "alice@example.com", "Password@123", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	var second *model.TokenPair
+	tests := []struct {
+		name         string
+		refreshToken func() string
+		wantErr      error
+	}{
+		{name: "rotates", refreshToken: func() string { return first.RefreshToken }},
+		{name: "reuse of a rotated token", refreshToken: func() string { return first.RefreshToken }, wantErr: appErr.ErrInvalidToken},
+		{name: "successor revoked by the reuse", refreshToken: func() string { return second.RefreshToken }, wantErr: appErr.ErrInvalidToken},
+		{name: "other login unaffected", refreshToken: func() string { return other.RefreshToken }},
+		{name: "unknown token", refreshToken: func() string { return "unknown" }, wantErr: appErr.ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		pair, err := authSvc.Refresh(ctx, tt.refreshToken())
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: Refresh() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && second == nil {
+			second = pair
+			if pair.RefreshToken == first.RefreshToken {
+				t.Errorf("%s: Refresh() returned the same refresh token", tt.name)
+			}
+		}
+	}
+}
+
+// Test_authService_Logout tests that logout revokes the access token and the refresh token family.
+// Table Driven Test Pattern used
+func Test_authService_Logout(t *testing.T) {
+	ctx := context.Background()
+	authSvc, tokenSvc := newSQLiteAuthService(t)
+
+	user, pair, err := authSvc.Login(ctx, "alice@example.com", "Password@123", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if _, _, err := tokenSvc.ValidateToken(ctx, pair.AccessToken); err != nil {
+		t.Fatalf("ValidateToken() before logout error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		userID       string
+		refreshToken string
+		wantErr      error
+	}{
+		{name: "refresh token of another user", userID: "someone-else", refreshToken: pair.RefreshToken, wantErr: appErr.ErrInvalidToken},
+		{name: "logout", userID: user.ID, refreshToken: pair.RefreshToken},
+	}
+	for _, tt := range tests {
+		if err := authSvc.Logout(ctx, tt.userID, pair.AccessToken, tt.refreshToken); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: Logout() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if _, _, err := tokenSvc.ValidateToken(ctx, pair.AccessToken); !errors.Is(err, appErr.ErrInvalidToken) {
+		t.Errorf("ValidateToken() after logout error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := authSvc.Refresh(ctx, pair.RefreshToken); !errors.Is(err, appErr.ErrInvalidToken) {
+		t.Errorf("Refresh() after logout error = %v, want ErrInvalidToken", err)
+	}
+}
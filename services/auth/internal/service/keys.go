@@ -0,0 +1,117 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/kernelshard/hcaas/pkg/authn"
+)
+
+// signingKey is an asymmetric key with the JWK of its public half
+type signingKey struct {
+	private crypto.Signer
+	method  jwt.SigningMethod
+	jwk     authn.JWK
+}
+
+// KeySet holds the asymmetric keys tokens are signed with. The first key signs new tokens;
+// the others only verify tokens signed before a rotation, until those have expired.
+type KeySet struct {
+	keys []signingKey
+}
+
+// NewKeySet creates a KeySet of RSA and Ed25519 private keys, the signing key first.
+// Keys are identified by the JWK thumbprint of their public key.
+func NewKeySet(keys ...crypto.Signer) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	ks := &KeySet{}
+	for _, private := range keys {
+		var method jwt.SigningMethod
+		switch private.(type) {
+		case *rsa.PrivateKey:
+			method = jwt.SigningMethodRS256
+		case ed25519.PrivateKey:
+			method = jwt.SigningMethodEdDSA
+		default:
+			return nil, fmt.Errorf("unsupported signing key type %T", private)
+		}
+		jwk, err := authn.NewJWK("", private.Public())
+		if err != nil {
+			return nil, err
+		}
+		ks.keys = append(ks.keys, signingKey{private: private, method: method, jwk: jwk})
+	}
+	return ks, nil
+}
+
+// LoadKeySet reads PEM encoded PKCS #8 or PKCS #1 private keys from files, the signing key
+// first.
+func LoadKeySet(paths []string) (*KeySet, error) {
+	var keys []crypto.Signer
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+		}
+		var key any
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		default:
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("signing key %s is not a private key", path)
+		}
+		keys = append(keys, signer)
+	}
+	return NewKeySet(keys...)
+}
+
+// JWKS returns the public keys of the set. A nil KeySet has no keys.
+func (ks *KeySet) JWKS() authn.JWKS {
+	set := authn.JWKS{Keys: []authn.JWK{}}
+	if ks == nil {
+		return set
+	}
+	for _, k := range ks.keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	return set
+}
+
+// signer returns the key new tokens are signed with
+func (ks *KeySet) signer() signingKey {
+	return ks.keys[0]
+}
+
+// verifier returns the public key with ID kid if it is meant for tokens signed with method
+func (ks *KeySet) verifier(kid string, method jwt.SigningMethod) (crypto.PublicKey, bool) {
+	if ks == nil {
+		return nil, false
+	}
+	for _, k := range ks.keys {
+		if k.jwk.KeyID == kid && k.method.Alg() == method.Alg() {
+			return k.private.Public(), true
+		}
+	}
+	return nil, false
+}
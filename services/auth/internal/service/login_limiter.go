@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// LoginLimiterConfig holds the thresholds of the brute-force protection of logins
+type LoginLimiterConfig struct {
+	// MaxEmailFailures failed logins of one email within Window lock the email out
+	MaxEmailFailures int
+	// MaxIPFailures failed logins from one client IP within Window lock the IP out, which
+	// catches one client trying many emails
+	MaxIPFailures   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+}
+
+// LoginLimiter locks emails and client IPs out after too many failed logins
+type LoginLimiter interface {
+	// Check returns ErrTooManyAttempts while email or ip is locked out
+	Check(ctx context.Context, email, ip string) error
+	// Fail records a failed login. It returns ErrTooManyAttempts when the failure locked
+	// email or ip out.
+	Fail(ctx context.Context, email, ip string) error
+	// Succeed clears the failed logins of email
+	Succeed(ctx context.Context, email string) error
+	// Unlock lifts the lockout of email and ip; empty ones are skipped
+	Unlock(ctx context.Context, email, ip string) error
+}
+
+// loginLimiter is a LoginLimiter keeping its sliding windows in storage, so lockouts
+// survive restarts and are shared by replicas
+type loginLimiter struct {
+	store  storage.LoginLimitStorage
+	cfg    LoginLimiterConfig
+	audit  audit.Recorder
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+	now    func() time.Time
+}
+
+// NewLoginLimiter creates a new instance of LoginLimiter. Lockouts are recorded to rec.
+func NewLoginLimiter(store storage.LoginLimitStorage, cfg LoginLimiterConfig, rec audit.Recorder, logger *slog.Logger, tracer *otelkit.Tracer) LoginLimiter {
+	l := logger.With("layer", "service", "component", "loginLimiter")
+	return &loginLimiter{store: store, cfg: cfg, audit: rec, logger: l, tracer: tracer, now: time.Now}
+}
+
+// limitKey is a key of the limiter and its threshold
+type limitKey struct {
+	key string
+	max int
+}
+
+// keys returns the keys of email and ip, skipping empty ones
+func (l *loginLimiter) keys(email, ip string) []limitKey {
+	var keys []limitKey
+	if email != "" {
+		keys = append(keys, limitKey{key: "email:" + storage.NormalizeEmail(email), max: l.cfg.MaxEmailFailures})
+	}
+	if ip != "" {
+		keys = append(keys, limitKey{key: "ip:" + ip, max: l.cfg.MaxIPFailures})
+	}
+	return keys
+}
+
+// Check checks whether email or ip is locked out
+func (l *loginLimiter) Check(ctx context.Context, email, ip string) error {
+	ctx, span := l.tracer.StartServerSpan(ctx, "loginLimiter.Check")
+	defer span.End()
+
+	now := l.now()
+	for _, k := range l.keys(email, ip) {
+		until, err := l.store.LockedUntil(ctx, k.key)
+		if err != nil {
+			l.logger.Error("Failed to check lockout", slog.String("key", k.key), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, "Failed to check lockout")
+			return appErr.ErrInternal
+		}
+		if now.Before(until) {
+			l.logger.Warn("Login attempt while locked out",
+				slog.String("key", k.key),
+				slog.Duration("remaining_lockout", until.Sub(now)))
+			span.SetStatus(codes.Error, "Locked out")
+			span.SetAttributes(
+				attribute.String("login_limit.key", k.key),
+				attribute.Int64("lockout.remaining_seconds", int64(until.Sub(now).Seconds())),
+			)
+			return appErr.ErrTooManyAttempts
+		}
+	}
+	return nil
+}
+
+// Fail records a failed login of email from ip
+func (l *loginLimiter) Fail(ctx context.Context, email, ip string) error {
+	ctx, span := l.tracer.StartServerSpan(ctx, "loginLimiter.Fail")
+	defer span.End()
+
+	now := l.now()
+	var locked bool
+	for _, k := range l.keys(email, ip) {
+		n, err := l.store.RecordFailure(ctx, k.key, now, l.cfg.Window)
+		if err != nil {
+			l.logger.Error("Failed to record login failure", slog.String("key", k.key), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, "Failed to record login failure")
+			return appErr.ErrInternal
+		}
+		kind, value, _ := strings.Cut(k.key, ":")
+		span.SetAttributes(attribute.Int("login.failed_attempts."+kind, n))
+		if n < k.max {
+			continue
+		}
+
+		if err := l.store.Lock(ctx, k.key, now.Add(l.cfg.LockoutDuration)); err != nil {
+			l.logger.Error("Failed to lock out", slog.String("key", k.key), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, "Failed to lock out")
+			return appErr.ErrInternal
+		}
+		l.logger.Warn("Locked out due to too many failed login attempts",
+			slog.String("key", k.key),
+			slog.Int("attempts", n),
+			slog.Duration("lockout", l.cfg.LockoutDuration))
+		l.audit.Record(ctx, audit.Event{Action: audit.ActionLockout, ActorEmail: email, TargetType: kind, TargetID: value})
+		locked = true
+	}
+
+	if locked {
+		span.SetStatus(codes.Error, "Locked out due to too many failed attempts")
+		return appErr.ErrTooManyAttempts
+	}
+	return nil
+}
+
+// Succeed clears the failed logins of email
+func (l *loginLimiter) Succeed(ctx context.Context, email string) error {
+	ctx, span := l.tracer.StartServerSpan(ctx, "loginLimiter.Succeed")
+	defer span.End()
+
+	for _, k := range l.keys(email, "") {
+		if err := l.store.ClearFailures(ctx, k.key); err != nil {
+			l.logger.Error("Failed to clear login failures", slog.String("key", k.key), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			return appErr.ErrInternal
+		}
+	}
+	return nil
+}
+
+// Unlock lifts the lockout of email and ip
+func (l *loginLimiter) Unlock(ctx context.Context, email, ip string) error {
+	ctx, span := l.tracer.StartServerSpan(ctx, "loginLimiter.Unlock")
+	defer span.End()
+
+	for _, k := range l.keys(email, ip) {
+		if err := l.store.Unlock(ctx, k.key); err != nil {
+			l.logger.Error("Failed to unlock", slog.String("key", k.key), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			return appErr.ErrInternal
+		}
+		l.logger.Info("Lockout lifted", slog.String("key", k.key))
+	}
+	return nil
+}
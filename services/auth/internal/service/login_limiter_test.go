@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// testLoginLimits are low thresholds for the tests
+var testLoginLimits = LoginLimiterConfig{
+	MaxEmailFailures: 3,
+	MaxIPFailures:    5,
+	Window:           time.Minute,
+	LockoutDuration:  10 * time.Minute,
+}
+
+// Test_authService_LoginLockout tests the lockout of emails and client IPs after failed logins.
+// Table Driven Test Pattern used
+func Test_authService_LoginLockout(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	tokens := storage.NewSQLiteTokenStorage(db, tracer)
+	tokenSvc := NewJWTService("secret", nil, time.Minute, tokens, slog.Default(), tracer)
+	auditLog := audit.NewMemoryStore()
+	rec := audit.NewRecorder(auditLog, slog.Default())
+	limiter := NewLoginLimiter(storage.NewSQLiteLoginLimitStorage(db, tracer), testLoginLimits, rec, slog.Default(), tracer)
+	authSvc := NewAuthService(storage.NewSQLiteUserStorage(db, tracer), tokens, limiter, newTestMFAService(db, tracer), rec, slog.Default(), tokenSvc, time.Hour, false, tracer)
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		if _, err := authSvc.Register(ctx, email, "Password@123"); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+	now := time.Now()
+	limiter.(*loginLimiter).now = func() time.Time { return now }
+
+	failed := []string{audit.ActionLoginFailed}
+	lockout := []string{audit.ActionLoginFailed, audit.ActionLockout}
+	login := []string{audit.ActionTokenIssued, audit.ActionLogin}
+
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		ip        string
+		before    func()
+		wantErr   error
+		wantAudit []string
+	}{
+		{name: "wrong password", email: "alice@example.com", password: "wrong", ip: "192.0.2.1", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "failures reset by a login", email: "alice@example.com", password: "Password@123", ip: "192.0.2.1", wantAudit: login},
+		{name: "first failure", email: "alice@example.com", password: "wrong", ip: "192.0.2.2", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "second failure", email: "ALICE@example.com", password: "wrong", ip: "192.0.2.3", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "third failure locks the email", email: "alice@example.com", password: "wrong", ip: "192.0.2.4", wantErr: appErr.ErrTooManyAttempts, wantAudit: lockout},
+		{name: "locked email from another ip", email: "alice@example.com", password: "Password@123", ip: "192.0.2.5", wantErr: appErr.ErrTooManyAttempts, wantAudit: failed},
+		{name: "other email unaffected", email: "bob@example.com", password: "Password@123", ip: "192.0.2.5", wantAudit: login},
+		{
+			name: "lockout expired", email: "alice@example.com", password: "Password@123", ip: "192.0.2.5",
+			before:    func() { now = now.Add(testLoginLimits.LockoutDuration) },
+			wantAudit: login,
+		},
+		{name: "unknown emails count for the ip", email: "x1@example.com", password: "wrong", ip: "198.51.100.1", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "second guess", email: "x2@example.com", password: "wrong", ip: "198.51.100.1", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "third guess", email: "x3@example.com", password: "wrong", ip: "198.51.100.1", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "fourth guess", email: "x4@example.com", password: "wrong", ip: "198.51.100.1", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "fifth guess locks the ip", email: "x5@example.com", password: "wrong", ip: "198.51.100.1", wantErr: appErr.ErrTooManyAttempts, wantAudit: lockout},
+		{name: "locked ip", email: "bob@example.com", password: "Password@123", ip: "198.51.100.1", wantErr: appErr.ErrTooManyAttempts, wantAudit: failed},
+		{
+			name: "unlocked by an admin", email: "bob@example.com", password: "Password@123", ip: "198.51.100.1",
+			before: func() {
+				if err := limiter.Unlock(ctx, "", "198.51.100.1"); err != nil {
+					t.Fatalf("Unlock() error = %v", err)
+				}
+			},
+			wantAudit: login,
+		},
+		{name: "failure with a leading space", email: " bob@example.com", password: "wrong", ip: "203.0.113.1", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "failure with a trailing space", email: "bob@example.com ", password: "wrong", ip: "203.0.113.2", wantErr: appErr.ErrUnauthorized, wantAudit: failed},
+		{name: "whitespace variants lock the email", email: "\tBOB@example.com\n", password: "wrong", ip: "203.0.113.3", wantErr: appErr.ErrTooManyAttempts, wantAudit: lockout},
+		{name: "locked email with spaces", email: "  bob@example.com  ", password: "Password@123", ip: "203.0.113.4", wantErr: appErr.ErrTooManyAttempts, wantAudit: failed},
+	}
+	var seen int
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before()
+			}
+			if _, _, err := authSvc.Login(ctx, tt.email, tt.password, tt.ip); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Login() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// The events of the login, oldest first
+			events, _ := auditLog.Query(ctx, audit.Filter{})
+			var got []string
+			for _, e := range slices.Backward(events[:len(events)-seen]) {
+				got = append(got, e.Action)
+			}
+			seen = len(events)
+			if !slices.Equal(got, tt.wantAudit) {
+				t.Errorf("audit events = %v, want %v", got, tt.wantAudit)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/samims/otelkit"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued when MFA is enabled
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is the number of wrong codes after which a login challenge is
+	// dropped and the password has to be entered again
+	maxChallengeAttempts = 5
+)
+
+// MFAConfig holds the settings of MFAService
+type MFAConfig struct {
+	// Issuer names the service in authenticator apps
+	Issuer string
+	// ChallengeExpiry is how long the second step of a login may take
+	ChallengeExpiry time.Duration
+}
+
+// MFAService manages TOTP two-factor authentication and the second step of logins
+type MFAService interface {
+	// Enroll starts the enrollment of a user, replacing an unconfirmed one. It returns
+	// ErrConflict when the user already has MFA enabled.
+	Enroll(ctx context.Context, userID, email string) (*model.TOTPEnrollment, error)
+	// Confirm enables MFA with a code of the enrolled secret and returns the recovery codes,
+	// which are shown only here. It returns ErrInvalidMFACode for a wrong code and ErrConflict
+	// when there is no unconfirmed enrollment.
+	Confirm(ctx context.Context, userID, code string) ([]string, error)
+	// Disable disables MFA with a code or a recovery code
+	Disable(ctx context.Context, userID, code string) error
+	// Enabled reports whether a user has MFA enabled
+	Enabled(ctx context.Context, userID string) (bool, error)
+	// Challenge starts the second step of a login and returns its token
+	Challenge(ctx context.Context, userID string) (string, error)
+	// Complete checks a code or a recovery code for a challenge and returns the ID of the
+	// user logging in. It returns ErrInvalidToken for an unknown, expired or exhausted
+	// challenge and ErrInvalidMFACode, with the user ID, for a wrong code.
+	Complete(ctx context.Context, challenge, code string) (string, error)
+}
+
+// mfaService is the implementation of the MFAService interface
+type mfaService struct {
+	store  storage.MFAStorage
+	cfg    MFAConfig
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+	now    func() time.Time
+}
+
+// NewMFAService creates a new instance of MFAService
+func NewMFAService(store storage.MFAStorage, cfg MFAConfig, logger *slog.Logger, tracer *otelkit.Tracer) MFAService {
+	l := logger.With("layer", "service", "component", "mfaService")
+	return &mfaService{store: store, cfg: cfg, logger: l, tracer: tracer, now: time.Now}
+}
+
+// Enroll starts the enrollment of a user
+func (s *mfaService) Enroll(ctx context.Context, userID, email string) (*model.TOTPEnrollment, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "mfaService.Enroll")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	secret, err := newTOTPSecret()
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, appErr.ErrInternal
+	}
+	if err := s.store.SaveTOTPSecret(ctx, userID, secret, s.now()); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrConflict) {
+			span.SetStatus(codes.Error, "MFA already enabled")
+			return nil, appErr.ErrConflict
+		}
+		s.logger.Error("Failed to save TOTP secret", slog.String("user.id", userID), slog.String("error", err.Error()))
+		span.SetStatus(codes.Error, "Failed to save TOTP secret")
+		return nil, appErr.ErrInternal
+	}
+
+	s.logger.Info("MFA enrollment started", slog.String("user.id", userID))
+	return &model.TOTPEnrollment{Secret: secret, URI: totpURI(s.cfg.Issuer, email, secret)}, nil
+}
+
+// Confirm enables MFA of a user
+func (s *mfaService) Confirm(ctx context.Context, userID, code string) ([]string, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "mfaService.Confirm")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	m, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, err
+	}
+	if m == nil || m.EnabledAt != nil {
+		span.SetStatus(codes.Error, "No unconfirmed enrollment")
+		return nil, appErr.ErrConflict
+	}
+	// Recovery codes do not exist yet, so only a TOTP code confirms
+	if err := s.verifyTOTP(ctx, m, code); err != nil {
+		otelkit.RecordError(span, err)
+		return nil, err
+	}
+
+	recoveryCodes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range recoveryCodes {
+		if recoveryCodes[i], err = newRecoveryCode(); err != nil {
+			otelkit.RecordError(span, err)
+			return nil, appErr.ErrInternal
+		}
+		hashes[i] = hashRecoveryCode(recoveryCodes[i])
+	}
+	if err := s.store.EnableMFA(ctx, userID, hashes, s.now()); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrConflict) {
+			return nil, appErr.ErrConflict
+		}
+		s.logger.Error("Failed to enable MFA", slog.String("user.id", userID), slog.String("error", err.Error()))
+		span.SetStatus(codes.Error, "Failed to enable MFA")
+		return nil, appErr.ErrInternal
+	}
+
+	s.logger.Info("MFA enabled", slog.String("user.id", userID))
+	return recoveryCodes, nil
+}
+
+// Disable disables MFA of a user
+func (s *mfaService) Disable(ctx context.Context, userID, code string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "mfaService.Disable")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	m, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	if m == nil || m.EnabledAt == nil {
+		span.SetStatus(codes.Error, "MFA not enabled")
+		return appErr.ErrNotFound
+	}
+	if err := s.verify(ctx, m, code); err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	if err := s.store.DeleteMFA(ctx, userID); err != nil {
+		s.logger.Error("Failed to disable MFA", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to disable MFA")
+		return appErr.ErrInternal
+	}
+
+	s.logger.Info("MFA disabled", slog.String("user.id", userID))
+	return nil
+}
+
+// Enabled reports whether a user has MFA enabled
+func (s *mfaService) Enabled(ctx context.Context, userID string) (bool, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "mfaService.Enabled")
+	defer span.End()
+
+	m, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return false, err
+	}
+	return m != nil && m.EnabledAt != nil, nil
+}
+
+// Challenge starts the second step of a login
+func (s *mfaService) Challenge(ctx context.Context, userID string) (string, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "mfaService.Challenge")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	token, err := newOpaqueToken()
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return "", appErr.ErrInternal
+	}
+	c := &model.MFAChallenge{TokenHash: hashToken(token), UserID: userID, ExpiresAt: s.now().Add(s.cfg.ChallengeExpiry)}
+	if err := s.store.CreateMFAChallenge(ctx, c); err != nil {
+		s.logger.Error("Failed to create MFA challenge", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to create MFA challenge")
+		return "", appErr.ErrInternal
+	}
+	return token, nil
+}
+
+// Complete checks a code for a challenge
+func (s *mfaService) Complete(ctx context.Context, challenge, code string) (string, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "mfaService.Complete")
+	defer span.End()
+
+	hash := hashToken(challenge)
+	c, err := s.store.GetMFAChallenge(ctx, hash)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrNotFound) {
+			span.SetStatus(codes.Error, "Unknown MFA challenge")
+			return "", appErr.ErrInvalidToken
+		}
+		s.logger.Error("Failed to fetch MFA challenge", slog.String("error", err.Error()))
+		return "", appErr.ErrInternal
+	}
+	span.SetAttributes(attribute.String("user.id", c.UserID))
+	if !s.now().Before(c.ExpiresAt) || c.Attempts >= maxChallengeAttempts {
+		span.SetStatus(codes.Error, "Expired MFA challenge")
+		s.drop(ctx, hash)
+		return "", appErr.ErrInvalidToken
+	}
+
+	m, err := s.get(ctx, c.UserID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return "", err
+	}
+	if m == nil || m.EnabledAt == nil {
+		// MFA was disabled since the password step
+		s.drop(ctx, hash)
+		return "", appErr.ErrInvalidToken
+	}
+
+	if err := s.verify(ctx, m, code); err != nil {
+		otelkit.RecordError(span, err)
+		if !errors.Is(err, appErr.ErrInvalidMFACode) {
+			return "", err
+		}
+		if n, err := s.store.AddMFAChallengeAttempt(ctx, hash); err == nil && n >= maxChallengeAttempts {
+			s.logger.Warn("MFA challenge dropped after too many wrong codes", slog.String("user.id", c.UserID))
+			s.drop(ctx, hash)
+		}
+		return c.UserID, appErr.ErrInvalidMFACode
+	}
+
+	// The challenge is single-use
+	s.drop(ctx, hash)
+	return c.UserID, nil
+}
+
+// get returns the MFA of a user, or nil if there is none
+func (s *mfaService) get(ctx context.Context, userID string) (*model.MFA, error) {
+	m, err := s.store.GetMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			return nil, nil
+		}
+		s.logger.Error("Failed to fetch MFA", slog.String("user.id", userID), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+	return m, nil
+}
+
+// drop deletes a challenge; a failure only leaves it to expire
+func (s *mfaService) drop(ctx context.Context, hash string) {
+	if err := s.store.DeleteMFAChallenge(ctx, hash); err != nil {
+		s.logger.Warn("Failed to delete MFA challenge", slog.String("error", err.Error()))
+	}
+}
+
+// verify checks a TOTP code or, for anything that does not look like one, a recovery code
+func (s *mfaService) verify(ctx context.Context, m *model.MFA, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.verifyTOTP(ctx, m, code)
+	}
+	if err := s.store.UseRecoveryCode(ctx, m.UserID, hashRecoveryCode(code), s.now()); err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			s.logger.Warn("Wrong recovery code", slog.String("user.id", m.UserID))
+			return appErr.ErrInvalidMFACode
+		}
+		s.logger.Error("Failed to use recovery code", slog.String("user.id", m.UserID), slog.String("error", err.Error()))
+		return appErr.ErrInternal
+	}
+	s.logger.Info("Recovery code used", slog.String("user.id", m.UserID))
+	return nil
+}
+
+// verifyTOTP checks a TOTP code, accepting every time step once
+func (s *mfaService) verifyTOTP(ctx context.Context, m *model.MFA, code string) error {
+	step, ok, err := matchTOTP(m.Secret, strings.TrimSpace(code), s.now())
+	if err != nil {
+		s.logger.Error("Invalid TOTP secret", slog.String("user.id", m.UserID), slog.String("error", err.Error()))
+		return appErr.ErrInternal
+	}
+	if !ok {
+		s.logger.Warn("Wrong TOTP code", slog.String("user.id", m.UserID))
+		return appErr.ErrInvalidMFACode
+	}
+	if err := s.store.UseTOTPStep(ctx, m.UserID, step); err != nil {
+		if errors.Is(err, appErr.ErrConflict) {
+			s.logger.Warn("Replayed TOTP code", slog.String("user.id", m.UserID))
+			return appErr.ErrInvalidMFACode
+		}
+		s.logger.Error("Failed to record TOTP step", slog.String("user.id", m.UserID), slog.String("error", err.Error()))
+		return appErr.ErrInternal
+	}
+	return nil
+}
+
+// newRecoveryCode returns a random recovery code such as "k3x9q-7mz2p"
+func newRecoveryCode() (string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secret[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case, spaces and dashes, which users
+// tend to get wrong when typing it
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
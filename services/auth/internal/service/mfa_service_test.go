@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// newTestMFAService returns an MFAService over db
+func newTestMFAService(db *sql.DB, tracer *otelkit.Tracer) MFAService {
+	return NewMFAService(storage.NewSQLiteMFAStorage(db, tracer), MFAConfig{Issuer: "HCaaS", ChallengeExpiry: time.Minute}, slog.Default(), tracer)
+}
+
+// Test_totpCode tests the codes against the SHA-1 vectors of RFC 6238, truncated to six digits.
+// Table Driven Test Pattern used
+func Test_totpCode(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(secret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil || got != tt.want {
+			t.Errorf("totpCode(%d) = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+}
+
+// Test_authService_LoginMFA tests enrollment, the login challenge, recovery codes and disabling.
+// Table Driven Test Pattern used
+func Test_authService_LoginMFA(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	tokens := storage.NewSQLiteTokenStorage(db, tracer)
+	tokenSvc := NewJWTService("secret", nil, time.Minute, tokens, slog.Default(), tracer)
+	limiter := NewLoginLimiter(storage.NewSQLiteLoginLimitStorage(db, tracer), testLoginLimits, audit.Discard, slog.Default(), tracer)
+	mfaSvc := newTestMFAService(db, tracer)
+	now := time.Now()
+	mfaSvc.(*mfaService).now = func() time.Time { return now }
+	authSvc := NewAuthService(storage.NewSQLiteUserStorage(db, tracer), tokens, limiter, mfaSvc, audit.Discard, slog.Default(), tokenSvc, time.Hour, false, tracer)
+
+	user, err := authSvc.Register(ctx, "alice@example.com", "Password@123")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	enrollment, err := mfaSvc.Enroll(ctx, user.ID, user.Email)
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	// code returns the TOTP code of the current step, moving the clock one step on so every
+	// call gets a fresh one
+	code := func() string {
+		now = now.Add(totpPeriod * time.Second)
+		c, err := totpCode(enrollment.Secret, totpStep(now))
+		if err != nil {
+			t.Fatalf("totpCode() error = %v", err)
+		}
+		return c
+	}
+	if _, err := mfaSvc.Confirm(ctx, user.ID, "000000"); !errors.Is(err, appErr.ErrInvalidMFACode) {
+		t.Fatalf("Confirm() with a wrong code error = %v, want %v", err, appErr.ErrInvalidMFACode)
+	}
+	recoveryCodes, err := mfaSvc.Confirm(ctx, user.ID, code())
+	if err != nil || len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Confirm() = %d codes, %v", len(recoveryCodes), err)
+	}
+	if _, err := mfaSvc.Enroll(ctx, user.ID, user.Email); !errors.Is(err, appErr.ErrConflict) {
+		t.Fatalf("Enroll() when enabled error = %v, want %v", err, appErr.ErrConflict)
+	}
+
+	// challenge logs in with the password and returns the MFA token
+	challenge := func() string {
+		_, result, err := authSvc.Login(ctx, user.Email, "Password@123", "192.0.2.1")
+		if err != nil {
+			t.Fatalf("Login() error = %v", err)
+		}
+		if !result.MFARequired || result.MFAToken == "" || result.TokenPair != nil {
+			t.Fatalf("Login() = %+v, want an MFA challenge", *result)
+		}
+		return result.MFAToken
+	}
+	var replayed, used string
+
+	tests := []struct {
+		name    string
+		token   func() string
+		code    func() string
+		wantErr error
+	}{
+		{
+			name:    "wrong code",
+			token:   challenge,
+			code:    func() string { return "000000" },
+			wantErr: appErr.ErrInvalidMFACode,
+		},
+		{
+			name:  "totp code",
+			token: challenge,
+			code:  func() string { replayed = code(); return replayed },
+		},
+		{
+			name:    "replayed totp code",
+			token:   challenge,
+			code:    func() string { return replayed },
+			wantErr: appErr.ErrInvalidMFACode,
+		},
+		{
+			name:  "recovery code",
+			token: challenge,
+			code:  func() string { used = recoveryCodes[0]; return used },
+		},
+		{
+			name:    "used recovery code",
+			token:   challenge,
+			code:    func() string { return used },
+			wantErr: appErr.ErrInvalidMFACode,
+		},
+		{
+			name:    "unknown challenge",
+			token:   func() string { return "unknown" },
+			code:    code,
+			wantErr: appErr.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, pair, err := authSvc.LoginMFA(ctx, tt.token(), tt.code(), "192.0.2.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoginMFA() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (pair == nil || pair.AccessToken == "") {
+				t.Fatalf("LoginMFA() = %+v, want a token pair", pair)
+			}
+		})
+	}
+
+	token := challenge()
+	if err := mfaSvc.Disable(ctx, user.ID, code()); err != nil {
+		t.Fatalf("Disable() error = %v", err)
+	}
+	if _, _, err := authSvc.LoginMFA(ctx, token, code(), "192.0.2.1"); !errors.Is(err, appErr.ErrInvalidToken) {
+		t.Fatalf("LoginMFA() after Disable() error = %v, want %v", err, appErr.ErrInvalidToken)
+	}
+	_, result, err := authSvc.Login(ctx, user.Email, "Password@123", "192.0.2.1")
+	if err != nil || result.MFARequired || result.TokenPair == nil {
+		t.Fatalf("Login() after Disable() = %+v, %v, want a token pair", result, err)
+	}
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/authn"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// oidcKeysMinRefetch limits refetches of the provider keys for ID tokens with unknown key IDs
+const oidcKeysMinRefetch = 10 * time.Second
+
+// OIDCConfig holds the settings of the OIDC relying party
+type OIDCConfig struct {
+	// Issuer is the issuer URL of the provider; its configuration is discovered at
+	// Issuer/.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered at the provider
+	RedirectURL string
+	Scopes      []string
+	// StateExpiry is how long a login may take at the provider
+	StateExpiry time.Duration
+}
+
+// OIDCService logs users in with an OpenID Connect provider using the authorization code flow
+// with PKCE
+type OIDCService interface {
+	// AuthURL starts a login and returns the URL of the provider to send the user to and the
+	// state of the login, which the provider passes back to the callback
+	AuthURL(ctx context.Context) (authURL, state string, err error)
+	// Callback completes a login with the state and the authorization code the provider
+	// redirected back with and returns the user of the identity. Users are provisioned on
+	// their first login, and identities are linked to existing users by verified email.
+	//
+	// It returns ErrInvalidToken for an unknown or expired state, ErrUnauthorized when the
+	// provider rejects the code or its ID token is invalid, ErrEmailNotVerified when the
+	// provider does not vouch for the email, and ErrConflict when the email belongs to a user
+	// who has not verified it.
+	Callback(ctx context.Context, state, code string) (*model.User, error)
+}
+
+// oidcDiscovery is the part of the provider configuration the relying party uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// idTokenClaims are the claims of ID tokens the relying party uses
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+	Email string `json:"email"`
+	// EmailVerified is a boolean, though some providers send it as a string
+	EmailVerified   any    `json:"email_verified"`
+	AuthorizedParty string `json:"azp"`
+}
+
+// emailVerified reports whether the provider vouches for the email
+func (c *idTokenClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// oidcService is the implementation of the OIDCService interface
+type oidcService struct {
+	users  storage.UserStorage
+	store  storage.OIDCStorage
+	cfg    OIDCConfig
+	client *http.Client
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+	now    func() time.Time
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        authn.JWKS
+	keysFetched time.Time
+}
+
+// NewOIDCService creates a new instance of OIDCService. The provider configuration is
+// discovered on the first login, so the service starts while the provider is unavailable.
+func NewOIDCService(users storage.UserStorage, store storage.OIDCStorage, cfg OIDCConfig, client *http.Client, logger *slog.Logger, tracer *otelkit.Tracer) OIDCService {
+	l := logger.With("layer", "service", "component", "oidcService")
+	return &oidcService{users: users, store: store, cfg: cfg, client: client, logger: l, tracer: tracer, now: time.Now}
+}
+
+// AuthURL starts a login at the provider
+func (s *oidcService) AuthURL(ctx context.Context) (string, string, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "oidcService.AuthURL")
+	defer span.End()
+
+	d, err := s.discover(ctx)
+	if err != nil {
+		s.logger.Error("OIDC discovery failed", slog.String("issuer", s.cfg.Issuer), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "OIDC discovery failed")
+		return "", "", appErr.ErrInternal
+	}
+
+	var state, nonce, verifier string
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		if *v, err = newOpaqueToken(); err != nil {
+			otelkit.RecordError(span, err)
+			return "", "", appErr.ErrInternal
+		}
+	}
+	if err := s.store.CreateOIDCState(ctx, &model.OIDCState{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    s.now().Add(s.cfg.StateExpiry),
+	}); err != nil {
+		s.logger.Error("Failed to store OIDC state", slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to store OIDC state")
+		return "", "", appErr.ErrInternal
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.cfg.ClientID},
+		"redirect_uri":          {s.cfg.RedirectURL},
+		"scope":                 {strings.Join(s.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// Callback completes a login at the provider
+func (s *oidcService) Callback(ctx context.Context, state, code string) (*model.User, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "oidcService.Callback")
+	defer span.End()
+
+	st, err := s.store.ConsumeOIDCState(ctx, hashToken(state), s.now())
+	if err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrNotFound) {
+			span.SetStatus(codes.Error, "Unknown OIDC state")
+			return nil, appErr.ErrInvalidToken
+		}
+		s.logger.Error("Failed to fetch OIDC state", slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+
+	d, err := s.discover(ctx)
+	if err != nil {
+		s.logger.Error("OIDC discovery failed", slog.String("issuer", s.cfg.Issuer), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		return nil, appErr.ErrInternal
+	}
+	rawIDToken, err := s.exchange(ctx, d, code, st.CodeVerifier)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Code exchange failed")
+		return nil, err
+	}
+	claims, err := s.verifyIDToken(ctx, d, rawIDToken, st.Nonce)
+	if err != nil {
+		s.logger.Warn("Invalid ID token", slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Invalid ID token")
+		return nil, appErr.ErrUnauthorized
+	}
+	span.SetAttributes(attribute.String("identity.subject", claims.Subject))
+
+	user, err := s.resolveUser(ctx, claims)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to resolve user")
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("user.id", user.ID))
+	return user, nil
+}
+
+// resolveUser returns the user linked to the identity of claims, linking or provisioning one
+// by email on the first login
+func (s *oidcService) resolveUser(ctx context.Context, claims *idTokenClaims) (*model.User, error) {
+	identity, err := s.store.GetIdentity(ctx, s.cfg.Issuer, claims.Subject)
+	if err == nil {
+		user, err := s.users.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			s.logger.Error("Failed to fetch linked user", slog.String("user.id", identity.UserID), slog.String("error", err.Error()))
+			return nil, appErr.ErrInternal
+		}
+		return user, nil
+	}
+	if !errors.Is(err, appErr.ErrNotFound) {
+		s.logger.Error("Failed to fetch identity", slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+
+	// Identities are linked by email only when the provider vouches for it, or anyone able
+	// to set an email at the provider could take over the account of that email
+	if claims.Email == "" || !claims.emailVerified() {
+		s.logger.Warn("OIDC login without a verified email", slog.String("subject", claims.Subject))
+		return nil, appErr.ErrEmailNotVerified
+	}
+
+	user, err := s.users.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Someone may have registered the email with a password of their own, so only users
+		// who proved they own it are linked
+		if user.EmailVerifiedAt == nil {
+			s.logger.Warn("OIDC login for an unverified user", slog.String("email", claims.Email))
+			return nil, appErr.ErrConflict
+		}
+	case errors.Is(err, appErr.ErrNotFound):
+		if user, err = s.provision(ctx, claims.Email); err != nil {
+			return nil, err
+		}
+	default:
+		s.logger.Error("Failed to fetch user by email", slog.String("email", claims.Email), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+
+	if err := s.store.CreateIdentity(ctx, &model.Identity{
+		Issuer:    s.cfg.Issuer,
+		Subject:   claims.Subject,
+		UserID:    user.ID,
+		Email:     claims.Email,
+		CreatedAt: s.now(),
+	}); err != nil && !errors.Is(err, appErr.ErrConflict) {
+		// A conflict is a concurrent first login of the same identity, which linked it already
+		s.logger.Error("Failed to link identity", slog.String("user.id", user.ID), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+	s.logger.Info("Identity linked", slog.String("user.id", user.ID), slog.String("issuer", s.cfg.Issuer))
+	return user, nil
+}
+
+// provision creates a verified user for email. The user gets a random password nobody knows;
+// a password reset sets one.
+func (s *oidcService) provision(ctx context.Context, email string) (*model.User, error) {
+	password, err := newOpaqueToken()
+	if err != nil {
+		return nil, appErr.ErrInternal
+	}
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, appErr.ErrInternal
+	}
+	user, err := s.users.CreateUser(ctx, email, string(hashedPass))
+	if err != nil {
+		s.logger.Error("Failed to provision user", slog.String("email", email), slog.String("error", err.Error()))
+		if errors.Is(err, appErr.ErrConflict) {
+			return nil, appErr.ErrConflict
+		}
+		return nil, appErr.ErrInternal
+	}
+	now := s.now()
+	if err := s.users.MarkEmailVerified(ctx, user.ID, user.Email, now); err != nil {
+		s.logger.Error("Failed to mark email verified", slog.String("user.id", user.ID), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+	user.EmailVerifiedAt = &now
+	s.logger.Info("User provisioned", slog.String("email", email), slog.String("user.id", user.ID))
+	return user, nil
+}
+
+// exchange exchanges an authorization code for the ID token
+func (s *oidcService) exchange(ctx context.Context, d *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.cfg.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {s.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", appErr.ErrInternal
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.ClientSecret != "" {
+		// client_secret_basic, with the credentials form encoded as RFC 6749 requires
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Error("Token request failed", slog.String("error", err.Error()))
+		return "", appErr.ErrInternal
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		s.logger.Error("Invalid token response", slog.String("error", err.Error()))
+		return "", appErr.ErrInternal
+	}
+	if resp.StatusCode != http.StatusOK {
+		s.logger.Warn("Provider rejected the authorization code",
+			slog.Int("status", resp.StatusCode),
+			slog.String("error", body.Error),
+			slog.String("error_description", body.ErrorDescription))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return "", appErr.ErrInternal
+		}
+		return "", appErr.ErrUnauthorized
+	}
+	if body.IDToken == "" {
+		s.logger.Warn("Token response without an ID token")
+		return "", appErr.ErrUnauthorized
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken verifies the signature and the claims of an ID token
+func (s *oidcService) verifyIDToken(ctx context.Context, d *oidcDiscovery, raw, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.key(ctx, d, kid, t.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithAudience(s.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != s.cfg.ClientID {
+		return nil, errors.New("ID token authorized party mismatch")
+	}
+	return claims, nil
+}
+
+// key returns the provider key with ID kid for alg, fetching the key set when needed
+func (s *oidcService) key(ctx context.Context, d *oidcDiscovery, kid, alg string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys.Key(kid)
+	if !ok && s.now().Sub(s.keysFetched) > oidcKeysMinRefetch {
+		var keys authn.JWKS
+		if err := s.getJSON(ctx, d.JWKSURI, &keys); err != nil {
+			return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+		}
+		s.keys, s.keysFetched = keys, s.now()
+		k, ok = s.keys.Key(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if k.Algorithm != "" && k.Algorithm != alg {
+		return nil, fmt.Errorf("key %s is not meant for %s", kid, alg)
+	}
+	return k.PublicKey()
+}
+
+// discover returns the provider configuration, fetching it on first use
+func (s *oidcService) discover(ctx context.Context) (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := s.getJSON(ctx, strings.TrimSuffix(s.cfg.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != s.cfg.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", d.Issuer, s.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("incomplete provider configuration")
+	}
+	s.discovery = &d
+	return s.discovery, nil
+}
+
+// getJSON decodes the JSON document at u into v
+func (s *oidcService) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/authn"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// mockIdP is an OIDC provider issuing RS256 ID tokens for the codes handed out by authorize
+type mockIdP struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is an authorization code waiting to be exchanged
+type mockGrant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	idp := &mockIdP{t: t, key: key, codes: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := authn.NewJWK("idp-key", &key.PublicKey)
+		json.NewEncoder(w).Encode(authn.JWKS{Keys: []authn.JWK{jwk}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize plays the user logging in at authURL and returns the code the provider redirects
+// back with. claims are added to the standard claims of the ID token.
+func (idp *mockIdP) authorize(authURL string, claims jwt.MapClaims) (state, code string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatalf("invalid auth URL %q", authURL)
+	}
+	q := u.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != "hcaas" || q.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("unexpected authorization request %q", authURL)
+	}
+	all := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   "hcaas",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	code = rand.Text()
+	idp.mu.Lock()
+	idp.codes[code] = mockGrant{challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: all}
+	idp.mu.Unlock()
+	return q.Get("state"), code
+}
+
+// token exchanges a code, checking the client credentials and the PKCE code verifier
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.FormValue("code")]
+	delete(idp.codes, r.FormValue("code"))
+	idp.mu.Unlock()
+
+	id, secret, _ := r.BasicAuth()
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || id != "hcaas" || secret != "s3cret" || r.FormValue("redirect_uri") != grant.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "idp-key"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Errorf("SignedString() error = %v", err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+// Test_oidcService tests the login flow, provisioning and linking against a mock provider.
+// Table Driven Test Pattern used
+func Test_oidcService(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	users := storage.NewSQLiteUserStorage(db, tracer)
+	idp := newMockIdP(t)
+	oidcSvc := NewOIDCService(users, storage.NewSQLiteOIDCStorage(db, tracer), OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "hcaas",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://hcaas.example.com/auth/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+		StateExpiry:  time.Minute,
+	}, idp.Client(), slog.Default(), tracer)
+
+	verified, err := users.CreateUser(ctx, "bob@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := users.MarkEmailVerified(ctx, verified.ID, verified.Email, time.Now()); err != nil {
+		t.Fatalf("MarkEmailVerified() error = %v", err)
+	}
+	if _, err := users.CreateUser(ctx, "carol@example.com", "hashed"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	var provisionedID string
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		// tamper changes the state and code the callback gets
+		tamper    func(state, code string) (string, string)
+		wantErr   error
+		wantEmail string
+		check     func(t *testing.T, userID string)
+	}{
+		{
+			name:      "provision new user",
+			claims:    jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true},
+			wantEmail: "alice@example.com",
+			check: func(t *testing.T, userID string) {
+				provisionedID = userID
+				if u, err := users.GetUserByID(ctx, userID); err != nil || u.EmailVerifiedAt == nil {
+					t.Errorf("GetUserByID() = %+v, %v, want a verified user", u, err)
+				}
+			},
+		},
+		{
+			name:      "returning identity with a changed email",
+			claims:    jwt.MapClaims{"sub": "alice", "email": "alice@new.example.com", "email_verified": false},
+			wantEmail: "alice@example.com",
+			check: func(t *testing.T, userID string) {
+				if userID != provisionedID {
+					t.Errorf("user ID = %s, want the provisioned %s", userID, provisionedID)
+				}
+			},
+		},
+		{
+			name:      "link verified user",
+			claims:    jwt.MapClaims{"sub": "bob", "email": "bob@example.com", "email_verified": "true"},
+			wantEmail: "bob@example.com",
+			check: func(t *testing.T, userID string) {
+				if userID != verified.ID {
+					t.Errorf("user ID = %s, want the existing %s", userID, verified.ID)
+				}
+			},
+		},
+		{
+			name:    "unverified local user",
+			claims:  jwt.MapClaims{"sub": "carol", "email": "carol@example.com", "email_verified": true},
+			wantErr: appErr.ErrConflict,
+		},
+		{
+			name:    "unverified provider email",
+			claims:  jwt.MapClaims{"sub": "dave", "email": "dave@example.com"},
+			wantErr: appErr.ErrEmailNotVerified,
+		},
+		{
+			name:    "wrong nonce",
+			claims:  jwt.MapClaims{"sub": "dave", "email": "dave@example.com", "email_verified": true, "nonce": "replayed"},
+			wantErr: appErr.ErrUnauthorized,
+		},
+		{
+			name:    "wrong audience",
+			claims:  jwt.MapClaims{"sub": "dave", "email": "dave@example.com", "email_verified": true, "aud": "other"},
+			wantErr: appErr.ErrUnauthorized,
+		},
+		{
+			name:    "expired ID token",
+			claims:  jwt.MapClaims{"sub": "dave", "email": "dave@example.com", "email_verified": true, "exp": time.Now().Add(-time.Hour).Unix()},
+			wantErr: appErr.ErrUnauthorized,
+		},
+		{
+			name:   "code of another login",
+			claims: jwt.MapClaims{"sub": "dave", "email": "dave@example.com", "email_verified": true},
+			tamper: func(state, code string) (string, string) {
+				// The code verifier of the other login does not match the code
+				other, _, err := oidcSvc.AuthURL(ctx)
+				if err != nil {
+					t.Fatalf("AuthURL() error = %v", err)
+				}
+				otherState, _ := idp.authorize(other, nil)
+				return otherState, code
+			},
+			wantErr: appErr.ErrUnauthorized,
+		},
+		{
+			name:    "unknown state",
+			claims:  jwt.MapClaims{"sub": "dave", "email": "dave@example.com", "email_verified": true},
+			tamper:  func(_, code string) (string, string) { return "forged", code },
+			wantErr: appErr.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, state, err := oidcSvc.AuthURL(ctx)
+			if err != nil {
+				t.Fatalf("AuthURL() error = %v", err)
+			}
+			gotState, code := idp.authorize(authURL, tt.claims)
+			if gotState != state {
+				t.Fatalf("provider got state %q, want %q", gotState, state)
+			}
+			if tt.tamper != nil {
+				state, code = tt.tamper(state, code)
+			}
+
+			user, err := oidcSvc.Callback(ctx, state, code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Callback() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if user.Email != tt.wantEmail {
+				t.Errorf("Callback() email = %s, want %s", user.Email, tt.wantEmail)
+			}
+			if tt.check != nil {
+				tt.check(t, user.ID)
+			}
+			// Every state works once
+			if _, err := oidcSvc.Callback(ctx, state, code); !errors.Is(err, appErr.ErrInvalidToken) {
+				t.Errorf("second Callback() error = %v, want %v", err, appErr.ErrInvalidToken)
+			}
+		})
+	}
+}
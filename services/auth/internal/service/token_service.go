@@ -7,11 +7,14 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
 	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
 	"github.com/samims/otelkit"
 )
 
@@ -19,19 +22,33 @@ import (
 type TokenService interface {
 	GenerateToken(ctx context.Context, user *model.User) (string, error)
 	ValidateToken(ctx context.Context, tokenStr string) (string, string, error)
+	// RevokeToken puts a valid token on the revocation list until it expires
+	RevokeToken(ctx context.Context, tokenStr string) error
+	// Expiry returns how long generated tokens are valid
+	Expiry() time.Duration
 }
 
 // jwtService is the implementation of the TokenService interface
 type jwtService struct {
-	secret     string
-	expiryTime time.Duration
-	logger     *slog.Logger
-	tracer     *otelkit.Tracer
+	secret      string
+	keys        *KeySet
+	expiryTime  time.Duration
+	revocations storage.TokenStorage
+	logger      *slog.Logger
+	tracer      *otelkit.Tracer
 }
 
-// NewJWTService creates a new instance of TokenService
-func NewJWTService(secret string, expiry time.Duration, logger *slog.Logger, tracer *otelkit.Tracer) TokenService {
-	return &jwtService{secret: secret, expiryTime: expiry, logger: logger, tracer: tracer}
+// NewJWTService creates a new instance of TokenService. Tokens are signed with the first
+// key of keys, or with HS256 and secret when keys is nil; HS256 tokens are only accepted
+// while secret is set. Tokens are checked against the revocation list of revocations by
+// their jti claim.
+func NewJWTService(secret string, keys *KeySet, expiry time.Duration, revocations storage.TokenStorage, logger *slog.Logger, tracer *otelkit.Tracer) TokenService {
+	return &jwtService{secret: secret, keys: keys, expiryTime: expiry, revocations: revocations, logger: logger, tracer: tracer}
+}
+
+// Expiry returns how long generated tokens are valid
+func (s *jwtService) Expiry() time.Duration {
+	return s.expiryTime
 }
 
 // GenerateToken generates a new JWT token for a user
@@ -51,13 +68,20 @@ func (s *jwtService) GenerateToken(ctx context.Context, user *model.User) (strin
 	s.logger.Info("token expiry time", slog.Duration("time", s.expiryTime))
 
 	claims := jwt.MapClaims{
+		"jti":   uuid.NewString(), // Identifies the token on the revocation list
 		"sub":   user.ID,
 		"email": user.Email,
 		"exp":   time.Now().Add(s.expiryTime).Unix(),
 		"iat":   time.Now().Unix(),
 		"nbf":   time.Now().Unix(), // Not valid before now
 	}
-	// Create the token
+	// Create the token, signed with the current asymmetric key if there is one
+	if s.keys != nil {
+		key := s.keys.signer()
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.jwk.KeyID
+		return token.SignedString(key.private)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.secret))
 }
@@ -68,55 +92,131 @@ func (s *jwtService) ValidateToken(ctx context.Context, tokenStr string) (string
 	ctx, span := s.tracer.Start(ctx, "auth.service.ValidateToken")
 	defer span.End()
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
-		// Validate the signing method to prevent algorithm confuses attack
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			s.logger.Error("Unexpected signing method", slog.String("method", token.Header["alg"].(string)))
-			otelkit.RecordError(span, jwt.ErrSignatureInvalid)
-			span.SetStatus(codes.Error, jwt.ErrSignatureInvalid.Error())
-
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(s.secret), nil
-	})
+	claims, err := s.parse(span, tokenStr)
+	if err != nil {
+		return "", "", err
+	}
 
-	// Check if the token is valid
-	if err != nil || !token.Valid {
-		s.logger.Error("Invalid token ")
+	userID, ok := claims["sub"].(string)
 
-		otelkit.RecordError(span, err)
-		span.SetStatus(codes.Error, err.Error())
+	if !ok {
+		s.logger.Error("token verification failed malformed!")
+		otelkit.RecordError(span, jwt.ErrTokenMalformed)
+		span.SetStatus(codes.Error, jwt.ErrTokenMalformed.Error())
 
-		return "", "", err
+		return "", "", jwt.ErrTokenMalformed
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
+	email, ok := claims["email"].(string)
+
 	if !ok {
-		s.logger.Error("token verification failed malformed")
 		otelkit.RecordError(span, jwt.ErrTokenMalformed)
 		span.SetStatus(codes.Error, jwt.ErrTokenMalformed.Error())
-
+		s.logger.Error("Invalid email claim", slog.String("email", email))
 		return "", "", jwt.ErrTokenMalformed
 	}
 
-	userID, ok := claims["sub"].(string)
+	// Tokens issued before the jti claim was introduced cannot be revoked
+	if jti, ok := claims["jti"].(string); ok {
+		revoked, err := s.revocations.IsAccessTokenRevoked(ctx, jti)
+		if err != nil {
+			s.logger.Error("Failed to check token revocation", slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, err.Error())
+			return "", "", err
+		}
+		if revoked {
+			s.logger.Warn("Token revoked", slog.String("jti", jti), slog.String("user_id", userID))
+			otelkit.RecordError(span, appErr.ErrInvalidToken)
+			span.SetStatus(codes.Error, "token revoked")
+			return "", "", appErr.ErrInvalidToken
+		}
+	}
 
+	// add event
+	span.AddEvent("Token validated", trace.WithAttributes(
+		attribute.String("user_id", userID),
+		attribute.String("email", email),
+	))
+	return userID, email, nil
+}
+
+// RevokeToken puts the jti of a valid token on the revocation list until the token expires
+func (s *jwtService) RevokeToken(ctx context.Context, tokenStr string) error {
+	ctx, span := s.tracer.Start(ctx, "auth.service.RevokeToken")
+	defer span.End()
+
+	claims, err := s.parse(span, tokenStr)
+	if err != nil {
+		return err
+	}
+
+	jti, ok := claims["jti"].(string)
 	if !ok {
-		s.logger.Error("token verification failed malformed!")
+		// The token expires on its own; there is nothing to put on the list
+		span.AddEvent("Token without jti not revoked")
+		return nil
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
 		otelkit.RecordError(span, jwt.ErrTokenMalformed)
 		span.SetStatus(codes.Error, jwt.ErrTokenMalformed.Error())
+		return jwt.ErrTokenMalformed
+	}
 
-		return "", "", jwt.ErrTokenMalformed
+	if err := s.revocations.RevokeAccessToken(ctx, jti, exp.Time); err != nil {
+		s.logger.Error("Failed to revoke token", slog.String("jti", jti), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
 	}
+	span.AddEvent("Token revoked", trace.WithAttributes(attribute.String("jti", jti)))
+	return nil
+}
 
-	email, ok := claims["email"].(string)
+// parse verifies the signature and time based claims of a token and returns its claims
+func (s *jwtService) parse(span trace.Span, tokenStr string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
+		// Validate the signing method to prevent algorithm confuses attack: HMAC tokens are
+		// verified with the secret, others with the public key of their kid and algorithm
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if s.secret != "" {
+				return []byte(s.secret), nil
+			}
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+			kid, _ := token.Header["kid"].(string)
+			if key, ok := s.keys.verifier(kid, token.Method); ok {
+				return key, nil
+			}
+		}
+		s.logger.Error("Unexpected signing method or key",
+			slog.String("method", token.Method.Alg()),
+			slog.Any("kid", token.Header["kid"]))
+		otelkit.RecordError(span, jwt.ErrSignatureInvalid)
+		span.SetStatus(codes.Error, jwt.ErrSignatureInvalid.Error())
+
+		return nil, jwt.ErrSignatureInvalid
+	})
+
+	// Check if the token is valid
+	if err != nil || !token.Valid {
+		s.logger.Error("Invalid token ")
+
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
 
+		return nil, err
+	}
+
+	// Extract claims
+	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
+		s.logger.Error("token verification failed malformed")
 		otelkit.RecordError(span, jwt.ErrTokenMalformed)
 		span.SetStatus(codes.Error, jwt.ErrTokenMalformed.Error())
-		s.logger.Error("Invalid email claim", slog.String("email", email))
-		return "", "", jwt.ErrTokenMalformed
+
+		return nil, jwt.ErrTokenMalformed
 	}
 
 	// validate time based claims
@@ -128,7 +228,7 @@ func (s *jwtService) ValidateToken(ctx context.Context, tokenStr string) (string
 			s.logger.Error("Token expired", slog.Int64("exp", int64(exp)), slog.Int64("now", now))
 			otelkit.RecordError(span, jwt.ErrTokenExpired)
 			span.SetStatus(codes.Error, jwt.ErrTokenExpired.Error())
-			return "", "", jwt.ErrTokenExpired
+			return nil, jwt.ErrTokenExpired
 		}
 	}
 
@@ -138,14 +238,9 @@ func (s *jwtService) ValidateToken(ctx context.Context, tokenStr string) (string
 			s.logger.Error("Token not valid yet", slog.Int64("nbf", int64(nbf)), slog.Int64("now", now))
 			otelkit.RecordError(span, jwt.ErrTokenNotValidYet)
 			span.SetStatus(codes.Error, jwt.ErrTokenNotValidYet.Error())
-			return "", "", jwt.ErrTokenNotValidYet
+			return nil, jwt.ErrTokenNotValidYet
 		}
 	}
 
-	// add event
-	span.AddEvent("Token validated", trace.WithAttributes(
-		attribute.String("user_id", userID),
-		attribute.String("email", email),
-	))
-	return userID, email, nil
+	return claims, nil
 }
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// writeKey writes key as a PEM encoded PKCS #8 file and returns its path
+func writeKey(t *testing.T, key any) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Test_jwtService_KeyRotation tests asymmetric signing and verification across a key rotation.
+// Table Driven Test Pattern used
+func Test_jwtService_KeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeys, err := LoadKeySet([]string{writeKey(t, rsaKey)})
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	rotated, err := NewKeySet(edKey, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKeys, err := NewKeySet(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := otelkit.New("test")
+	revocations := storage.NewSQLiteTokenStorage(newSQLiteDB(t), tracer)
+	newService := func(secret string, keys *KeySet) TokenService {
+		return NewJWTService(secret, keys, time.Minute, revocations, slog.Default(), tracer)
+	}
+	user := &model.User{ID: "u1", Email: "alice@example.com"}
+
+	tests := []struct {
+		name     string
+		issuer   TokenService
+		verifier TokenService
+		wantAlg  string
+		wantErr  bool
+	}{
+		{name: "rsa", issuer: newService("", oldKeys), verifier: newService("", oldKeys), wantAlg: "RS256"},
+		{name: "ed25519 after rotation", issuer: newService("", rotated), verifier: newService("", rotated), wantAlg: "EdDSA"},
+		{name: "old key kept after rotation", issuer: newService("", oldKeys), verifier: newService("", rotated), wantAlg: "RS256"},
+		{name: "old key dropped", issuer: newService("", oldKeys), verifier: newService("", newKeys), wantAlg: "RS256", wantErr: true},
+		{name: "hs256 while the secret is set", issuer: newService("secret", nil), verifier: newService("secret", newKeys), wantAlg: "HS256"},
+		{name: "hs256 without secret", issuer: newService("secret", nil), verifier: newService("", newKeys), wantAlg: "HS256", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			token, err := tt.issuer.GenerateToken(ctx, user)
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			if err != nil || parsed.Method.Alg() != tt.wantAlg {
+				t.Fatalf("GenerateToken() signed with %v (%v), want %s", parsed.Header["alg"], err, tt.wantAlg)
+			}
+
+			userID, email, err := tt.verifier.ValidateToken(ctx, token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (userID != user.ID || email != user.Email) {
+				t.Errorf("ValidateToken() = %s, %s, want %s, %s", userID, email, user.ID, user.Email)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// remoteUserDataDeleter deletes the monitors of a user through the HTTP API of the URL
+// service, authenticated as the user
+type remoteUserDataDeleter struct {
+	deleteURL string
+	client    *http.Client
+}
+
+// NewRemoteUserDataDeleter creates a UserDataDeleter calling DELETE /urls/me of the URL
+// service at urlServiceURL
+func NewRemoteUserDataDeleter(urlServiceURL string, client *http.Client) UserDataDeleter {
+	return &remoteUserDataDeleter{
+		deleteURL: strings.TrimSuffix(urlServiceURL, "/") + "/urls/me",
+		client:    client,
+	}
+}
+
+func (d *remoteUserDataDeleter) DeleteUserData(ctx context.Context, _, accessToken string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, d.deleteURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request to URL service: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call URL service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("URL service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// UserDataDeleter deletes the data other services keep for a user, such as the monitors of
+// the URL service, before the account is deleted
+type UserDataDeleter interface {
+	// DeleteUserData deletes the data of the user; accessToken is a valid token of the user
+	DeleteUserData(ctx context.Context, userID, accessToken string) error
+}
+
+// UserDataDeleterFunc adapts a function to UserDataDeleter
+type UserDataDeleterFunc func(ctx context.Context, userID, accessToken string) error
+
+// DeleteUserData calls f
+func (f UserDataDeleterFunc) DeleteUserData(ctx context.Context, userID, accessToken string) error {
+	return f(ctx, userID, accessToken)
+}
+
+// ProfileUpdate holds the changes to a profile; nil fields stay unchanged
+type ProfileUpdate struct {
+	Name  *string
+	Email *string
+	// CurrentPassword is required to change the email
+	CurrentPassword string
+}
+
+// UserService lets users manage their own account and admins manage all accounts
+type UserService interface {
+	// GetProfile returns ErrNotFound when no user has the ID
+	GetProfile(ctx context.Context, userID string) (*model.User, error)
+	// UpdateProfile changes the name and email of a user and returns the updated user. A
+	// new email needs the current password and has to be verified again. It returns
+	// ErrUnauthorized for a wrong password, ErrInvalidEmail and ErrConflict when another
+	// user has the email.
+	UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*model.User, error)
+	// ChangePassword sets a new password and signs the user out of other sessions. It
+	// returns ErrUnauthorized for a wrong current password and ErrInvalidInput when the new
+	// one is too weak.
+	ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) error
+	// DeleteAccount deletes a user with the data other services keep for them and revokes
+	// accessToken. It returns ErrUnauthorized for a wrong password.
+	DeleteAccount(ctx context.Context, userID, password, accessToken string) error
+	// ListUsers returns up to limit users after skipping offset, oldest first
+	ListUsers(ctx context.Context, limit, offset int) ([]*model.User, error)
+	// SetDisabled disables or enables a user and returns the updated user. Disabled users
+	// are signed out and cannot log in or use their API keys. It returns ErrNotFound when no
+	// user has the ID.
+	SetDisabled(ctx context.Context, userID string, disabled bool) (*model.User, error)
+}
+
+// userService is the implementation of the UserService interface
+type userService struct {
+	users      storage.UserStorage
+	tokens     storage.TokenStorage
+	tokenSvc   TokenService
+	limiter    LoginLimiter
+	accountSvc AccountService
+	userData   UserDataDeleter
+	audit      audit.Recorder
+	logger     *slog.Logger
+	tracer     *otelkit.Tracer
+}
+
+// NewUserService creates a new instance of UserService. Verification mails of changed
+// emails are sent by accountSvc; userData may be nil when no other service keeps user data.
+// Changes of accounts are recorded to rec.
+func NewUserService(users storage.UserStorage, tokens storage.TokenStorage, tokenSvc TokenService, limiter LoginLimiter,
+	accountSvc AccountService, userData UserDataDeleter, rec audit.Recorder, logger *slog.Logger, tracer *otelkit.Tracer) UserService {
+	l := logger.With("layer", "service", "component", "userService")
+	return &userService{
+		users:      users,
+		tokens:     tokens,
+		tokenSvc:   tokenSvc,
+		limiter:    limiter,
+		accountSvc: accountSvc,
+		userData:   userData,
+		audit:      rec,
+		logger:     l,
+		tracer:     tracer,
+	}
+}
+
+// GetProfile returns a user by ID
+func (s *userService) GetProfile(ctx context.Context, userID string) (*model.User, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "userService.GetProfile")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	user, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile changes the name and email of a user
+func (s *userService) UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*model.User, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "userService.UpdateProfile")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	user, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, err
+	}
+
+	name, email := user.Name, user.Email
+	if update.Name != nil {
+		name = strings.TrimSpace(*update.Name)
+		if len(name) > 100 {
+			span.SetStatus(codes.Error, "Name too long")
+			return nil, appErr.ErrInvalidInput
+		}
+	}
+	emailChanged := update.Email != nil && !strings.EqualFold(*update.Email, user.Email)
+	if emailChanged {
+		email = strings.TrimSpace(*update.Email)
+		if !isValidEmail(email) {
+			span.SetStatus(codes.Error, "Invalid email format")
+			return nil, appErr.ErrInvalidEmail
+		}
+		// A stolen token alone must not be enough to take over the account
+		if err := s.checkPassword(ctx, user, update.CurrentPassword); err != nil {
+			otelkit.RecordError(span, err)
+			return nil, err
+		}
+	}
+
+	if err := s.users.UpdateProfile(ctx, userID, name, email); err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to update profile")
+		switch {
+		case errors.Is(err, appErr.ErrConflict):
+			s.logger.Warn("Email of profile update taken", slog.String("user.id", userID))
+			return nil, appErr.ErrConflict
+		case errors.Is(err, appErr.ErrNotFound):
+			return nil, appErr.ErrNotFound
+		}
+		s.logger.Error("Failed to update profile", slog.String("user.id", userID), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+
+	updated, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, err
+	}
+	if emailChanged {
+		// The profile is updated either way and the user can ask for the mail again
+		if err := s.accountSvc.SendVerification(ctx, updated); err != nil {
+			s.logger.Warn("Failed to send verification mail", slog.String("user.id", userID), slog.String("error", err.Error()))
+		}
+	}
+
+	s.logger.Info("Profile updated", slog.String("user.id", userID), slog.Bool("email_changed", emailChanged))
+	recordChange(ctx, s.audit, s.logger, userEvent(audit.ActionProfileUpdated, userID), user, updated)
+	return updated, nil
+}
+
+// ChangePassword sets a new password after checking the current one
+func (s *userService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "userService.ChangePassword")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	user, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	if err := s.checkPassword(ctx, user, currentPassword); err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	if err := checkPasswordStrength(newPassword); err != nil {
+		span.SetStatus(codes.Error, "Password does not meet the requirements")
+		return err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Password hashing failed")
+		return appErr.ErrInternal
+	}
+	if err := s.users.UpdatePassword(ctx, userID, string(hashed)); err != nil {
+		s.logger.Error("Failed to update password", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to update password")
+		return appErr.ErrInternal
+	}
+
+	// Sessions started with the old password end; the current access token expires soon
+	if err := s.tokens.RevokeUserTokens(ctx, userID, time.Now()); err != nil {
+		s.logger.Error("Failed to revoke refresh tokens", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		return appErr.ErrInternal
+	}
+
+	s.logger.Info("Password changed", slog.String("user.id", userID))
+	s.audit.Record(ctx, userEvent(audit.ActionPasswordChanged, userID))
+	return nil
+}
+
+// DeleteAccount deletes a user after checking the password
+func (s *userService) DeleteAccount(ctx context.Context, userID, password, accessToken string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "userService.DeleteAccount")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	user, err := s.get(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	if err := s.checkPassword(ctx, user, password); err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+
+	// The monitors go first: an account whose data could not be deleted is kept, so the
+	// user can try again instead of leaving orphaned monitors behind
+	if s.userData != nil {
+		if err := s.userData.DeleteUserData(ctx, userID, accessToken); err != nil {
+			s.logger.Error("Failed to delete user data", slog.String("user.id", userID), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			span.SetStatus(codes.Error, "Failed to delete user data")
+			return appErr.ErrInternal
+		}
+	}
+
+	if err := s.users.DeleteUser(ctx, userID); err != nil && !errors.Is(err, appErr.ErrNotFound) {
+		s.logger.Error("Failed to delete user", slog.String("user.id", userID), slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to delete user")
+		return appErr.ErrInternal
+	}
+	if err := s.tokenSvc.RevokeToken(ctx, accessToken); err != nil {
+		s.logger.Warn("Failed to revoke access token of deleted user", slog.String("user.id", userID), slog.String("error", err.Error()))
+	}
+
+	s.logger.Info("Account deleted", slog.String("user.id", userID))
+	recordChange(ctx, s.audit, s.logger, userEvent(audit.ActionUserDeleted, userID), user, nil)
+	return nil
+}
+
+// ListUsers returns a page of users
+func (s *userService) ListUsers(ctx context.Context, limit, offset int) ([]*model.User, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "userService.ListUsers")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("page.limit", limit), attribute.Int("page.offset", offset))
+	users, err := s.users.ListUsers(ctx, limit, offset)
+	if err != nil {
+		s.logger.Error("Failed to list users", slog.String("error", err.Error()))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to list users")
+		return nil, appErr.ErrInternal
+	}
+	span.SetAttributes(attribute.Int("user.count", len(users)))
+	return users, nil
+}
+
+// SetDisabled disables or enables a user
+func (s *userService) SetDisabled(ctx context.Context, userID string, disabled bool) (*model.User, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "userService.SetDisabled")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID), attribute.Bool("user.disabled", disabled))
+	var at *time.Time
+	if disabled {
+		now := time.Now()
+		at = &now
+	}
+	if err := s.users.SetDisabled(ctx, userID, at); err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, "Failed to update user")
+		if errors.Is(err, appErr.ErrNotFound) {
+			return nil, appErr.ErrNotFound
+		}
+		s.logger.Error("Failed to update user", slog.String("user.id", userID), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+
+	// Refreshing fails from now on; access tokens already issued expire on their own
+	if disabled {
+		if err := s.tokens.RevokeUserTokens(ctx, userID, *at); err != nil {
+			s.logger.Error("Failed to revoke refresh tokens", slog.String("user.id", userID), slog.String("error", err.Error()))
+			otelkit.RecordError(span, err)
+			return nil, appErr.ErrInternal
+		}
+	}
+
+	s.logger.Info("User disabled state changed", slog.String("user.id", userID), slog.Bool("disabled", disabled))
+	action := audit.ActionUserEnabled
+	if disabled {
+		action = audit.ActionUserDisabled
+	}
+	s.audit.Record(ctx, userEvent(action, userID))
+	return s.get(ctx, userID)
+}
+
+// userEvent returns an audit event of action on the user with the ID
+func userEvent(action, userID string) audit.Event {
+	return audit.Event{Action: action, TargetType: "user", TargetID: userID}
+}
+
+// get returns a user by ID
+func (s *userService) get(ctx context.Context, userID string) (*model.User, error) {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, appErr.ErrNotFound) {
+			s.logger.Warn("User not found", slog.String("user.id", userID))
+			return nil, appErr.ErrNotFound
+		}
+		s.logger.Error("Failed to fetch user", slog.String("user.id", userID), slog.String("error", err.Error()))
+		return nil, appErr.ErrInternal
+	}
+	return user, nil
+}
+
+// checkPassword confirms the password of a signed-in user. Wrong passwords count as failed
+// logins, so a stolen token cannot be used to guess it.
+func (s *userService) checkPassword(ctx context.Context, user *model.User, password string) error {
+	if err := s.limiter.Check(ctx, user.Email, ""); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		s.logger.Warn("Wrong current password", slog.String("user.id", user.ID))
+		if err := s.limiter.Fail(ctx, user.Email, ""); err != nil {
+			return err
+		}
+		return appErr.ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// Test_userService tests profile changes, password changes, disabling and deleting accounts.
+// Table Driven Test Pattern used
+func Test_userService(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	users := storage.NewSQLiteUserStorage(db, tracer)
+	tokens := storage.NewSQLiteTokenStorage(db, tracer)
+	limiter := NewLoginLimiter(storage.NewSQLiteLoginLimitStorage(db, tracer), testLoginLimits, audit.Discard, slog.Default(), tracer)
+	tokenSvc := NewJWTService("secret", nil, time.Minute, tokens, slog.Default(), tracer)
+	authSvc := NewAuthService(users, tokens, limiter, newTestMFAService(db, tracer), audit.Discard, slog.Default(), tokenSvc, time.Hour, false, tracer)
+	apiKeySvc := NewAPIKeyService(storage.NewSQLiteAPIKeyStorage(db, tracer), users, audit.Discard, slog.Default(), tracer)
+	mails := &recordingMailer{}
+	accountSvc := NewAccountService(users, storage.NewSQLiteEmailTokenStorage(db, tracer), tokens, limiter, mails, AccountConfig{
+		PublicURL:          "https://hcaas.example.com",
+		VerificationExpiry: time.Hour,
+		ResetExpiry:        time.Hour,
+	}, slog.Default(), tracer)
+	var deleted []string
+	userData := UserDataDeleterFunc(func(_ context.Context, userID, _ string) error {
+		deleted = append(deleted, userID)
+		return nil
+	})
+	svc := NewUserService(users, tokens, tokenSvc, limiter, accountSvc, userData, audit.Discard, slog.Default(), tracer)
+
+	user, err := authSvc.Register(ctx, "alice@example.com", "Password@123")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := authSvc.Register(ctx, "bob@example.com", "Password@123"); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	_, apiKey, err := apiKeySvc.Create(ctx, user.ID, "ci", []string{authn.ScopeURLsRead}, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	login := func(password string) (string, error) {
+		_, result, err := authSvc.Login(ctx, "alice@new.example.com", password, "")
+		if err != nil {
+			return "", err
+		}
+		return result.RefreshToken, nil
+	}
+	str := func(s string) *string { return &s }
+	var refreshToken string
+
+	tests := []struct {
+		name      string
+		call      func() error
+		wantErr   error
+		wantMails int
+	}{
+		{
+			name: "rename",
+			call: func() error {
+				u, err := svc.UpdateProfile(ctx, user.ID, ProfileUpdate{Name: str(" Alice ")})
+				if err == nil && u.Name != "Alice" {
+					t.Errorf("UpdateProfile() name = %q, want Alice", u.Name)
+				}
+				return err
+			},
+		},
+		{
+			name: "email change without password",
+			call: func() error {
+				_, err := svc.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: str("alice@new.example.com")})
+				return err
+			},
+			wantErr: appErr.ErrUnauthorized,
+		},
+		{
+			name: "email of another user",
+			call: func() error {
+				_, err := svc.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: str("bob@example.com"), CurrentPassword: "Password@123"})
+				return err
+			},
+			wantErr: appErr.ErrConflict,
+		},
+		{
+			name: "invalid email",
+			call: func() error {
+				_, err := svc.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: str("alice"), CurrentPassword: "Password@123"})
+				return err
+			},
+			wantErr: appErr.ErrInvalidEmail,
+		},
+		{
+			name: "email change",
+			call: func() error {
+				u, err := svc.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: str("alice@new.example.com"), CurrentPassword: "Password@123"})
+				if err == nil && (u.Email != "alice@new.example.com" || u.Name != "Alice" || u.EmailVerifiedAt != nil) {
+					t.Errorf("UpdateProfile() = %+v, want the new unverified email and the name kept", *u)
+				}
+				return err
+			},
+			wantMails: 1,
+		},
+		{
+			name: "login",
+			call: func() error {
+				var err error
+				refreshToken, err = login("Password@123")
+				return err
+			},
+			wantMails: 1,
+		},
+		{name: "wrong current password", call: func() error { return svc.ChangePassword(ctx, user.ID, "Wrong@123", "NewPassword@456") }, wantErr: appErr.ErrUnauthorized, wantMails: 1},
+		{
+			name: "short new password",
+			call: func() error {
+				err := svc.ChangePassword(ctx, user.ID, "Password@123", "Ab1@")
+				if want := "password must have at least 8 characters"; err == nil || err.Error() != want {
+					t.Errorf("ChangePassword() error = %v, want %q", err, want)
+				}
+				return err
+			},
+			wantErr: appErr.ErrInvalidInput, wantMails: 1,
+		},
+		{
+			name: "weak new password",
+			call: func() error {
+				err := svc.ChangePassword(ctx, user.ID, "Password@123", "weakpassword")
+				if want := "password needs an uppercase and a lowercase letter, a digit and a special character"; err == nil || err.Error() != want {
+					t.Errorf("ChangePassword() error = %v, want %q", err, want)
+				}
+				return err
+			},
+			wantErr: appErr.ErrInvalidInput, wantMails: 1,
+		},
+		{name: "password change", call: func() error { return svc.ChangePassword(ctx, user.ID, "Password@123", "NewPassword@456") }, wantMails: 1},
+		{name: "sessions revoked by the change", call: func() error { _, err := authSvc.Refresh(ctx, refreshToken); return err }, wantErr: appErr.ErrInvalidToken, wantMails: 1},
+		{
+			name: "disable",
+			call: func() error {
+				var err error
+				if refreshToken, err = login("NewPassword@456"); err != nil {
+					return err
+				}
+				u, err := svc.SetDisabled(ctx, user.ID, true)
+				if err == nil && u.DisabledAt == nil {
+					t.Errorf("SetDisabled() = %+v, want a disabled user", *u)
+				}
+				return err
+			},
+			wantMails: 1,
+		},
+		{name: "login while disabled", call: func() error { _, err := login("NewPassword@456"); return err }, wantErr: appErr.ErrAccountDisabled, wantMails: 1},
+		{name: "refresh while disabled", call: func() error { _, err := authSvc.Refresh(ctx, refreshToken); return err }, wantErr: appErr.ErrInvalidToken, wantMails: 1},
+		{name: "api key while disabled", call: func() error { _, err := apiKeySvc.Validate(ctx, apiKey); return err }, wantErr: appErr.ErrInvalidToken, wantMails: 1},
+		{name: "enable", call: func() error { _, err := svc.SetDisabled(ctx, user.ID, false); return err }, wantMails: 1},
+		{name: "login after enabling", call: func() error { _, err := login("NewPassword@456"); return err }, wantMails: 1},
+		{name: "disable unknown user", call: func() error { _, err := svc.SetDisabled(ctx, "missing", true); return err }, wantErr: appErr.ErrNotFound, wantMails: 1},
+		{
+			name: "list",
+			call: func() error {
+				list, err := svc.ListUsers(ctx, 10, 0)
+				if err == nil && len(list) != 2 {
+					t.Errorf("ListUsers() returned %d users, want 2", len(list))
+				}
+				return err
+			},
+			wantMails: 1,
+		},
+		{name: "delete with wrong password", call: func() error { return svc.DeleteAccount(ctx, user.ID, "Password@123", "") }, wantErr: appErr.ErrUnauthorized, wantMails: 1},
+		{
+			name: "delete",
+			call: func() error {
+				err := svc.DeleteAccount(ctx, user.ID, "NewPassword@456", "")
+				if err == nil && (len(deleted) != 1 || deleted[0] != user.ID) {
+					t.Errorf("user data deleted for %v, want %s", deleted, user.ID)
+				}
+				return err
+			},
+			wantMails: 1,
+		},
+		{name: "profile of deleted user", call: func() error { _, err := svc.GetProfile(ctx, user.ID); return err }, wantErr: appErr.ErrNotFound, wantMails: 1},
+		{name: "api key of deleted user", call: func() error { _, err := apiKeySvc.Validate(ctx, apiKey); return err }, wantErr: appErr.ErrInvalidToken, wantMails: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if len(mails.sent) != tt.wantMails {
+				t.Errorf("%d mails sent, want %d", len(mails.sent), tt.wantMails)
+			}
+		})
+	}
+}
+
+// Test_userService_emailChangeInvalidatesTokens tests that links mailed to an email stop
+// working once the user changes it.
+// Table Driven Test Pattern used
+func Test_userService_emailChangeInvalidatesTokens(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	tracer := otelkit.New("test")
+	users := storage.NewSQLiteUserStorage(db, tracer)
+	tokens := storage.NewSQLiteTokenStorage(db, tracer)
+	limiter := NewLoginLimiter(storage.NewSQLiteLoginLimitStorage(db, tracer), testLoginLimits, audit.Discard, slog.Default(), tracer)
+	tokenSvc := NewJWTService("secret", nil, time.Minute, tokens, slog.Default(), tracer)
+	authSvc := NewAuthService(users, tokens, limiter, newTestMFAService(db, tracer), audit.Discard, slog.Default(), tokenSvc, time.Hour, false, tracer)
+	mails := &recordingMailer{}
+	accountSvc := NewAccountService(users, storage.NewSQLiteEmailTokenStorage(db, tracer), tokens, limiter, mails, AccountConfig{
+		PublicURL:          "https://hcaas.example.com",
+		VerificationExpiry: time.Hour,
+		ResetExpiry:        time.Hour,
+	}, slog.Default(), tracer)
+	svc := NewUserService(users, tokens, tokenSvc, limiter, accountSvc, nil, audit.Discard, slog.Default(), tracer)
+
+	user, err := authSvc.Register(ctx, "alice@example.com", "Password@123")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := accountSvc.SendVerification(ctx, user); err != nil {
+		t.Fatalf("SendVerification() error = %v", err)
+	}
+	oldVerifyToken := mails.token(t)
+	if err := accountSvc.ForgotPassword(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("ForgotPassword() error = %v", err)
+	}
+	oldResetToken := mails.token(t)
+
+	email := "alice@new.example.com"
+	if _, err := svc.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: &email, CurrentPassword: "Password@123"}); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+	newVerifyToken := mails.token(t)
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{name: "verification of the old email", call: func() error { return accountSvc.VerifyEmail(ctx, oldVerifyToken) }, wantErr: appErr.ErrInvalidToken},
+		{name: "reset mailed to the old email", call: func() error { return accountSvc.ResetPassword(ctx, oldResetToken, "NewPassword@456") }, wantErr: appErr.ErrInvalidToken},
+		{name: "verification of the new email", call: func() error { return accountSvc.VerifyEmail(ctx, newVerifyToken) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	got, err := users.GetUserByID(ctx, user.ID)
+	if err != nil || got.Email != email || got.EmailVerifiedAt == nil {
+		t.Errorf("GetUserByID() = %+v, %v, want the new email verified", got, err)
+	}
+	if _, _, err := authSvc.Login(ctx, email, "Password@123", ""); err != nil {
+		t.Errorf("Login() with the unchanged password error = %v", err)
+	}
+}
@@ -6,6 +6,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/kernelshard/hcaas/services/auth/internal/model"
 	mock "github.com/stretchr/testify/mock"
@@ -112,6 +113,63 @@ func (_c *MockUserStorage_CreateUser_Call) RunAndReturn(run func(ctx context.Con
 	return _c
 }
 
+// DeleteUser provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) DeleteUser(ctx context.Context, id string) error {
+	ret := _mock.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteUser")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = returnFunc(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockUserStorage_DeleteUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteUser'
+type MockUserStorage_DeleteUser_Call struct {
+	*mock.Call
+}
+
+// DeleteUser is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+func (_e *MockUserStorage_Expecter) DeleteUser(ctx interface{}, id interface{}) *MockUserStorage_DeleteUser_Call {
+	return &MockUserStorage_DeleteUser_Call{Call: _e.mock.On("DeleteUser", ctx, id)}
+}
+
+func (_c *MockUserStorage_DeleteUser_Call) Run(run func(ctx context.Context, id string)) *MockUserStorage_DeleteUser_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_DeleteUser_Call) Return(err error) *MockUserStorage_DeleteUser_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockUserStorage_DeleteUser_Call) RunAndReturn(run func(ctx context.Context, id string) error) *MockUserStorage_DeleteUser_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetUserByEmail provides a mock function for the type MockUserStorage
 func (_mock *MockUserStorage) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	ret := _mock.Called(ctx, email)
@@ -180,6 +238,217 @@ func (_c *MockUserStorage_GetUserByEmail_Call) RunAndReturn(run func(ctx context
 	return _c
 }
 
+// GetUserByID provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	ret := _mock.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserByID")
+	}
+
+	var r0 *model.User
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) (*model.User, error)); ok {
+		return returnFunc(ctx, id)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = returnFunc(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = returnFunc(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockUserStorage_GetUserByID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUserByID'
+type MockUserStorage_GetUserByID_Call struct {
+	*mock.Call
+}
+
+// GetUserByID is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+func (_e *MockUserStorage_Expecter) GetUserByID(ctx interface{}, id interface{}) *MockUserStorage_GetUserByID_Call {
+	return &MockUserStorage_GetUserByID_Call{Call: _e.mock.On("GetUserByID", ctx, id)}
+}
+
+func (_c *MockUserStorage_GetUserByID_Call) Run(run func(ctx context.Context, id string)) *MockUserStorage_GetUserByID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_GetUserByID_Call) Return(user *model.User, err error) *MockUserStorage_GetUserByID_Call {
+	_c.Call.Return(user, err)
+	return _c
+}
+
+func (_c *MockUserStorage_GetUserByID_Call) RunAndReturn(run func(ctx context.Context, id string) (*model.User, error)) *MockUserStorage_GetUserByID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListUsers provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) ListUsers(ctx context.Context, limit int, offset int) ([]*model.User, error) {
+	ret := _mock.Called(ctx, limit, offset)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListUsers")
+	}
+
+	var r0 []*model.User
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int, int) ([]*model.User, error)); ok {
+		return returnFunc(ctx, limit, offset)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int, int) []*model.User); ok {
+		r0 = returnFunc(ctx, limit, offset)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = returnFunc(ctx, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockUserStorage_ListUsers_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListUsers'
+type MockUserStorage_ListUsers_Call struct {
+	*mock.Call
+}
+
+// ListUsers is a helper method to define mock.On call
+//   - ctx context.Context
+//   - limit int
+//   - offset int
+func (_e *MockUserStorage_Expecter) ListUsers(ctx interface{}, limit interface{}, offset interface{}) *MockUserStorage_ListUsers_Call {
+	return &MockUserStorage_ListUsers_Call{Call: _e.mock.On("ListUsers", ctx, limit, offset)}
+}
+
+func (_c *MockUserStorage_ListUsers_Call) Run(run func(ctx context.Context, limit int, offset int)) *MockUserStorage_ListUsers_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 int
+		if args[1] != nil {
+			arg1 = args[1].(int)
+		}
+		var arg2 int
+		if args[2] != nil {
+			arg2 = args[2].(int)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_ListUsers_Call) Return(users []*model.User, err error) *MockUserStorage_ListUsers_Call {
+	_c.Call.Return(users, err)
+	return _c
+}
+
+func (_c *MockUserStorage_ListUsers_Call) RunAndReturn(run func(ctx context.Context, limit int, offset int) ([]*model.User, error)) *MockUserStorage_ListUsers_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// MarkEmailVerified provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) MarkEmailVerified(ctx context.Context, id string, email string, at time.Time) error {
+	ret := _mock.Called(ctx, id, email, at)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MarkEmailVerified")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = returnFunc(ctx, id, email, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockUserStorage_MarkEmailVerified_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'MarkEmailVerified'
+type MockUserStorage_MarkEmailVerified_Call struct {
+	*mock.Call
+}
+
+// MarkEmailVerified is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - email string
+//   - at time.Time
+func (_e *MockUserStorage_Expecter) MarkEmailVerified(ctx interface{}, id interface{}, email interface{}, at interface{}) *MockUserStorage_MarkEmailVerified_Call {
+	return &MockUserStorage_MarkEmailVerified_Call{Call: _e.mock.On("MarkEmailVerified", ctx, id, email, at)}
+}
+
+func (_c *MockUserStorage_MarkEmailVerified_Call) Run(run func(ctx context.Context, id string, email string, at time.Time)) *MockUserStorage_MarkEmailVerified_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		var arg2 string
+		if args[2] != nil {
+			arg2 = args[2].(string)
+		}
+		var arg3 time.Time
+		if args[3] != nil {
+			arg3 = args[3].(time.Time)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+			arg3,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_MarkEmailVerified_Call) Return(err error) *MockUserStorage_MarkEmailVerified_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockUserStorage_MarkEmailVerified_Call) RunAndReturn(run func(ctx context.Context, id string, email string, at time.Time) error) *MockUserStorage_MarkEmailVerified_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Ping provides a mock function for the type MockUserStorage
 func (_mock *MockUserStorage) Ping(ctx context.Context) error {
 	ret := _mock.Called(ctx)
@@ -230,3 +499,198 @@ func (_c *MockUserStorage_Ping_Call) RunAndReturn(run func(ctx context.Context)
 	_c.Call.Return(run)
 	return _c
 }
+
+// SetDisabled provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) SetDisabled(ctx context.Context, id string, at *time.Time) error {
+	ret := _mock.Called(ctx, id, at)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetDisabled")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string, *time.Time) error); ok {
+		r0 = returnFunc(ctx, id, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockUserStorage_SetDisabled_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetDisabled'
+type MockUserStorage_SetDisabled_Call struct {
+	*mock.Call
+}
+
+// SetDisabled is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - at *time.Time
+func (_e *MockUserStorage_Expecter) SetDisabled(ctx interface{}, id interface{}, at interface{}) *MockUserStorage_SetDisabled_Call {
+	return &MockUserStorage_SetDisabled_Call{Call: _e.mock.On("SetDisabled", ctx, id, at)}
+}
+
+func (_c *MockUserStorage_SetDisabled_Call) Run(run func(ctx context.Context, id string, at *time.Time)) *MockUserStorage_SetDisabled_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		var arg2 *time.Time
+		if args[2] != nil {
+			arg2 = args[2].(*time.Time)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_SetDisabled_Call) Return(err error) *MockUserStorage_SetDisabled_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockUserStorage_SetDisabled_Call) RunAndReturn(run func(ctx context.Context, id string, at *time.Time) error) *MockUserStorage_SetDisabled_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdatePassword provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) UpdatePassword(ctx context.Context, id string, hashedPass string) error {
+	ret := _mock.Called(ctx, id, hashedPass)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdatePassword")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = returnFunc(ctx, id, hashedPass)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockUserStorage_UpdatePassword_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdatePassword'
+type MockUserStorage_UpdatePassword_Call struct {
+	*mock.Call
+}
+
+// UpdatePassword is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - hashedPass string
+func (_e *MockUserStorage_Expecter) UpdatePassword(ctx interface{}, id interface{}, hashedPass interface{}) *MockUserStorage_UpdatePassword_Call {
+	return &MockUserStorage_UpdatePassword_Call{Call: _e.mock.On("UpdatePassword", ctx, id, hashedPass)}
+}
+
+func (_c *MockUserStorage_UpdatePassword_Call) Run(run func(ctx context.Context, id string, hashedPass string)) *MockUserStorage_UpdatePassword_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		var arg2 string
+		if args[2] != nil {
+			arg2 = args[2].(string)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_UpdatePassword_Call) Return(err error) *MockUserStorage_UpdatePassword_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockUserStorage_UpdatePassword_Call) RunAndReturn(run func(ctx context.Context, id string, hashedPass string) error) *MockUserStorage_UpdatePassword_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateProfile provides a mock function for the type MockUserStorage
+func (_mock *MockUserStorage) UpdateProfile(ctx context.Context, id string, name string, email string) error {
+	ret := _mock.Called(ctx, id, name, email)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateProfile")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = returnFunc(ctx, id, name, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockUserStorage_UpdateProfile_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateProfile'
+type MockUserStorage_UpdateProfile_Call struct {
+	*mock.Call
+}
+
+// UpdateProfile is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - name string
+//   - email string
+func (_e *MockUserStorage_Expecter) UpdateProfile(ctx interface{}, id interface{}, name interface{}, email interface{}) *MockUserStorage_UpdateProfile_Call {
+	return &MockUserStorage_UpdateProfile_Call{Call: _e.mock.On("UpdateProfile", ctx, id, name, email)}
+}
+
+func (_c *MockUserStorage_UpdateProfile_Call) Run(run func(ctx context.Context, id string, name string, email string)) *MockUserStorage_UpdateProfile_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		var arg2 string
+		if args[2] != nil {
+			arg2 = args[2].(string)
+		}
+		var arg3 string
+		if args[3] != nil {
+			arg3 = args[3].(string)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+			arg3,
+		)
+	})
+	return _c
+}
+
+func (_c *MockUserStorage_UpdateProfile_Call) Return(err error) *MockUserStorage_UpdateProfile_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockUserStorage_UpdateProfile_Call) RunAndReturn(run func(ctx context.Context, id string, name string, email string) error) *MockUserStorage_UpdateProfile_Call {
+	_c.Call.Return(run)
+	return _c
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// apiKeyTouchInterval is how stale last_used_at may get before TouchAPIKey writes it
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyStorage stores the API keys of users
+type APIKeyStorage interface {
+	CreateAPIKey(ctx context.Context, k *model.APIKey) error
+	// ListAPIKeys returns the keys of a user, newest first, revoked ones included
+	ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error)
+	// GetAPIKeyByHash returns ErrNotFound when no key has the hash
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	// RevokeAPIKey returns ErrNotFound when the user has no unrevoked key with the ID
+	RevokeAPIKey(ctx context.Context, userID, id string, at time.Time) error
+	// TouchAPIKey records that a key was used. To spare a write on every request, the
+	// timestamp is only updated once it is older than a minute.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// apiKeyStorage is an APIKeyStorage backed by Postgres
+type apiKeyStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewAPIKeyStorage creates a new APIKeyStorage backed by Postgres
+func NewAPIKeyStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) APIKeyStorage {
+	return &apiKeyStorage{db: dbPool, tracer: tracer}
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+// scanAPIKey scans a row of apiKeyColumns
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*model.APIKey, error) {
+	var (
+		k      model.APIKey
+		scopes string
+	)
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, &scopes,
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	return &k, nil
+}
+
+// CreateAPIKey stores a new API key
+func (s *apiKeyStorage) CreateAPIKey(ctx context.Context, k *model.APIKey) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.CreateAPIKey")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", k.UserID))
+	const query = `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	if _, err := s.db.Exec(ctx, query, k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash,
+		strings.Join(k.Scopes, " "), k.ExpiresAt, k.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys lists the API keys of a user
+func (s *apiKeyStorage) ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.ListAPIKeys")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	rows, err := s.db.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash gets an API key by the hash of its value
+func (s *apiKeyStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.GetAPIKeyByHash")
+	defer span.End()
+
+	k, err := scanAPIKey(s.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("API key: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("api_key.id", k.ID))
+	return k, nil
+}
+
+// RevokeAPIKey revokes an API key of a user
+func (s *apiKeyStorage) RevokeAPIKey(ctx context.Context, userID, id string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.RevokeAPIKey")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID), attribute.String("api_key.id", id))
+	const query = `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	tag, err := s.db.Exec(ctx, query, at, id, userID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("API key %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// TouchAPIKey updates the last use of an API key
+func (s *apiKeyStorage) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.TouchAPIKey")
+	defer span.End()
+
+	const query = `UPDATE api_keys SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`
+	if _, err := s.db.Exec(ctx, query, at, id, at.Add(-apiKeyTouchInterval)); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage/storagetest"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	tracer := otelkit.New("test")
+	storagetest.Run(t, func(t *testing.T) *storage.Stores {
+		ctx := context.Background()
+		stores, err := storage.Open(ctx, "sqlite::memory:", tracer)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		t.Cleanup(stores.Close)
+		if _, err := stores.Migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return stores
+	})
+}
+
+// TestPostgresConformance runs against the database of TEST_POSTGRES_URL, which must be
+// migrated. Its tables are truncated.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	tracer := otelkit.New("test")
+	storagetest.Run(t, func(t *testing.T) *storage.Stores {
+		ctx := context.Background()
+		pool, err := pgxpool.New(ctx, dsn)
+		if err != nil {
+			t.Fatalf("pgxpool.New() error = %v", err)
+		}
+		t.Cleanup(pool.Close)
+		if _, err := pool.Exec(ctx, "TRUNCATE users, refresh_tokens, revoked_tokens, api_keys, login_failures, login_lockouts, email_tokens, user_mfa, mfa_recovery_codes, mfa_challenges, oidc_states, user_identities, audit_events RESTART IDENTITY"); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return &storage.Stores{
+			Users:       storage.NewUserStorage(pool, tracer),
+			Tokens:      storage.NewTokenStorage(pool, tracer),
+			APIKeys:     storage.NewAPIKeyStorage(pool, tracer),
+			LoginLimits: storage.NewLoginLimitStorage(pool, tracer),
+			EmailTokens: storage.NewEmailTokenStorage(pool, tracer),
+			MFA:         storage.NewMFAStorage(pool, tracer),
+			OIDC:        storage.NewOIDCStorage(pool, tracer),
+			Audit:       audit.NewPostgresStore(pool, tracer),
+		}
+	})
+}
@@ -5,6 +5,12 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
 )
 
 // NewPostgresPool creates a new Postgres connection pool
@@ -19,3 +25,94 @@ func NewPostgresPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	}
 	return pool, nil
 }
+
+// Stores are the stores of the auth service sharing one database
+type Stores struct {
+	Users UserStorage
+	// Tokens holds refresh tokens and revoked access tokens
+	Tokens TokenStorage
+	// APIKeys holds the API keys of users
+	APIKeys APIKeyStorage
+	// LoginLimits holds failed logins and lockouts
+	LoginLimits LoginLimitStorage
+	// EmailTokens holds the tokens of verification and password reset mails
+	EmailTokens EmailTokenStorage
+	// MFA holds TOTP secrets, recovery codes and login challenges
+	MFA MFAStorage
+	// OIDC holds OIDC logins in progress and linked external identities
+	OIDC OIDCStorage
+	// Audit holds the audit log
+	Audit audit.Store
+	// Migrator manages the schema of the database
+	Migrator *migrate.Migrator
+	close    func()
+}
+
+// Close closes the database of the stores
+func (s *Stores) Close() {
+	s.close()
+}
+
+// Open connects to the database of dsn. The backend is selected by the DSN scheme, see
+// package database. The schema is not migrated; see Stores.Migrator.
+func Open(ctx context.Context, dsn string, tracer *otelkit.Tracer) (*Stores, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("database DSN not provided")
+	}
+	backend, err := database.BackendOf(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == database.SQLite {
+		db, err := database.OpenSQLite(dsn)
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := NewMigrator(db, backend)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &Stores{
+			Users:       NewSQLiteUserStorage(db, tracer),
+			Tokens:      NewSQLiteTokenStorage(db, tracer),
+			APIKeys:     NewSQLiteAPIKeyStorage(db, tracer),
+			LoginLimits: NewSQLiteLoginLimitStorage(db, tracer),
+			EmailTokens: NewSQLiteEmailTokenStorage(db, tracer),
+			MFA:         NewSQLiteMFAStorage(db, tracer),
+			OIDC:        NewSQLiteOIDCStorage(db, tracer),
+			Audit:       audit.NewSQLiteStore(db, tracer),
+			Migrator:    migrator,
+			close:       func() { db.Close() },
+		}, nil
+	}
+
+	pool, err := NewPostgresPool(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Migrations run through database/sql on connections of the pool
+	db := stdlib.OpenDBFromPool(pool)
+	migrator, err := NewMigrator(db, backend)
+	if err != nil {
+		db.Close()
+		pool.Close()
+		return nil, err
+	}
+	return &Stores{
+		Users:       NewUserStorage(pool, tracer),
+		Tokens:      NewTokenStorage(pool, tracer),
+		APIKeys:     NewAPIKeyStorage(pool, tracer),
+		LoginLimits: NewLoginLimitStorage(pool, tracer),
+		EmailTokens: NewEmailTokenStorage(pool, tracer),
+		MFA:         NewMFAStorage(pool, tracer),
+		OIDC:        NewOIDCStorage(pool, tracer),
+		Audit:       audit.NewPostgresStore(pool, tracer),
+		Migrator:    migrator,
+		close: func() {
+			db.Close()
+			pool.Close()
+		},
+	}, nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// EmailTokenStorage stores the single-use tokens mailed to users
+type EmailTokenStorage interface {
+	// CreateEmailToken stores a new token. Unused tokens of the same user and purpose are
+	// invalidated, so only the latest mail works, and expired tokens of the user are deleted.
+	CreateEmailToken(ctx context.Context, t *model.EmailToken) error
+	// ConsumeEmailToken marks the token with the hash and purpose used at at. It returns
+	// ErrNotFound when there is no such token or it was used or expired, so of two
+	// concurrent uses only one succeeds.
+	ConsumeEmailToken(ctx context.Context, tokenHash, purpose string, at time.Time) (*model.EmailToken, error)
+}
+
+// emailTokenColumns are the columns scanned by scanEmailToken
+const emailTokenColumns = `token_hash, user_id, email, purpose, expires_at, used_at, created_at`
+
+// scanEmailToken scans a row of emailTokenColumns
+func scanEmailToken(row interface{ Scan(dest ...any) error }) (*model.EmailToken, error) {
+	var t model.EmailToken
+	if err := row.Scan(&t.TokenHash, &t.UserID, &t.Email, &t.Purpose, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// emailTokenStorage is an EmailTokenStorage backed by Postgres
+type emailTokenStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewEmailTokenStorage creates a new EmailTokenStorage backed by Postgres
+func NewEmailTokenStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) EmailTokenStorage {
+	return &emailTokenStorage{db: dbPool, tracer: tracer}
+}
+
+// CreateEmailToken stores a new email token
+func (s *emailTokenStorage) CreateEmailToken(ctx context.Context, t *model.EmailToken) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "emailTokenStorage.CreateEmailToken")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", t.UserID), attribute.String("email_token.purpose", t.Purpose))
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM email_tokens WHERE user_id = $1 AND expires_at < $2`, t.UserID, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired email tokens: %w", err)
+	}
+	const invalidate = `UPDATE email_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, invalidate, t.CreatedAt, t.UserID, t.Purpose); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to invalidate email tokens: %w", err)
+	}
+	const query = `
+		INSERT INTO email_tokens (token_hash, user_id, email, purpose, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.Exec(ctx, query, t.TokenHash, t.UserID, NormalizeEmail(t.Email), t.Purpose, t.ExpiresAt, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert email token: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// ConsumeEmailToken marks an email token used
+func (s *emailTokenStorage) ConsumeEmailToken(ctx context.Context, tokenHash, purpose string, at time.Time) (*model.EmailToken, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "emailTokenStorage.ConsumeEmailToken")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("email_token.purpose", purpose))
+	query := `
+		UPDATE email_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING ` + emailTokenColumns
+	t, err := scanEmailToken(s.db.QueryRow(ctx, query, at, tokenHash, purpose))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("email token: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	return t, nil
+}
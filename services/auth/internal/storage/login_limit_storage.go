@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// LoginLimitStorage stores failed logins and lockouts by key, such as an email address or a
+// client IP, so that brute-force protection survives restarts and spans replicas
+type LoginLimitStorage interface {
+	// RecordFailure records a failed login of key at at and returns the number of failures
+	// of key within the window ending at at. Older failures are deleted on the way.
+	RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (int, error)
+	// ClearFailures deletes the failures of key
+	ClearFailures(ctx context.Context, key string) error
+	// Lock locks key out until until
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns the end of the lockout of key, or the zero time if it is not
+	// locked out. Lockouts that have ended may be returned as well.
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	// Unlock lifts the lockout of key and deletes its failures
+	Unlock(ctx context.Context, key string) error
+}
+
+// loginLimitStorage is a LoginLimitStorage backed by Postgres
+type loginLimitStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewLoginLimitStorage creates a new LoginLimitStorage backed by Postgres
+func NewLoginLimitStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) LoginLimitStorage {
+	return &loginLimitStorage{db: dbPool, tracer: tracer}
+}
+
+// RecordFailure records a failed login
+func (s *loginLimitStorage) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (int, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.RecordFailure")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("login_limit.key", key))
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM login_failures WHERE key = $1 AND failed_at <= $2`, key, at.Add(-window)); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete old login failures: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO login_failures (key, failed_at) VALUES ($1, $2)`, key, at); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	var n int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM login_failures WHERE key = $1`, key).Scan(&n); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to count login failures: %w", err)
+	}
+	return n, tx.Commit(ctx)
+}
+
+// ClearFailures deletes the failed logins of a key
+func (s *loginLimitStorage) ClearFailures(ctx context.Context, key string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.ClearFailures")
+	defer span.End()
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM login_failures WHERE key = $1`, key); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// Lock locks a key out
+func (s *loginLimitStorage) Lock(ctx context.Context, key string, until time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.Lock")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("login_limit.key", key))
+	const query = `
+		INSERT INTO login_lockouts (key, locked_until) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET locked_until = EXCLUDED.locked_until
+	`
+	if _, err := s.db.Exec(ctx, query, key, until); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// LockedUntil returns the end of the lockout of a key
+func (s *loginLimitStorage) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.LockedUntil")
+	defer span.End()
+
+	var until time.Time
+	err := s.db.QueryRow(ctx, `SELECT locked_until FROM login_lockouts WHERE key = $1`, key).Scan(&until)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		span.RecordError(err)
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// Unlock lifts the lockout of a key
+func (s *loginLimitStorage) Unlock(ctx context.Context, key string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.Unlock")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("login_limit.key", key))
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM login_lockouts WHERE key = $1`, key); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM login_failures WHERE key = $1`, key); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// MFAStorage stores the TOTP secrets and recovery codes of users and the pending second
+// steps of logins
+type MFAStorage interface {
+	// SaveTOTPSecret starts or restarts the enrollment of a user. It returns ErrConflict
+	// when the user already has MFA enabled.
+	SaveTOTPSecret(ctx context.Context, userID, secret string, at time.Time) error
+	// GetMFA returns ErrNotFound when the user has not started an enrollment
+	GetMFA(ctx context.Context, userID string) (*model.MFA, error)
+	// EnableMFA confirms the enrollment and replaces the recovery codes of the user. It
+	// returns ErrConflict when there is no unconfirmed enrollment.
+	EnableMFA(ctx context.Context, userID string, recoveryCodeHashes []string, at time.Time) error
+	// UseTOTPStep records the time step of an accepted code. It returns ErrConflict when a
+	// code of the same or a later step was accepted before.
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode marks a recovery code used. It returns ErrNotFound when the user has
+	// no unused code with the hash.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) error
+	// DeleteMFA disables MFA of a user and deletes the recovery codes
+	DeleteMFA(ctx context.Context, userID string) error
+
+	// CreateMFAChallenge stores a challenge. Expired challenges are deleted on the way.
+	CreateMFAChallenge(ctx context.Context, c *model.MFAChallenge) error
+	// GetMFAChallenge returns ErrNotFound when no challenge has the hash
+	GetMFAChallenge(ctx context.Context, tokenHash string) (*model.MFAChallenge, error)
+	// AddMFAChallengeAttempt counts a wrong code and returns the attempts so far
+	AddMFAChallengeAttempt(ctx context.Context, tokenHash string) (int, error)
+	// DeleteMFAChallenge deletes a challenge; deleting a missing one is not an error
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+}
+
+// mfaStorage is an MFAStorage backed by Postgres
+type mfaStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewMFAStorage creates a new MFAStorage backed by Postgres
+func NewMFAStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) MFAStorage {
+	return &mfaStorage{db: dbPool, tracer: tracer}
+}
+
+// SaveTOTPSecret starts the enrollment of a user
+func (s *mfaStorage) SaveTOTPSecret(ctx context.Context, userID, secret string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.SaveTOTPSecret")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	const query = `
+		INSERT INTO user_mfa (user_id, secret, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = 0
+		WHERE user_mfa.enabled_at IS NULL
+	`
+	tag, err := s.db.Exec(ctx, query, userID, secret, at)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("mfa of user %s already enabled: %w", userID, appErr.ErrConflict)
+	}
+	return nil
+}
+
+// GetMFA gets the MFA of a user
+func (s *mfaStorage) GetMFA(ctx context.Context, userID string) (*model.MFA, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.GetMFA")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	const query = `SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_mfa WHERE user_id = $1`
+	var m model.MFA
+	if err := s.db.QueryRow(ctx, query, userID).Scan(&m.UserID, &m.Secret, &m.EnabledAt, &m.LastUsedStep, &m.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("mfa of user %s: %w", userID, appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	return &m, nil
+}
+
+// EnableMFA confirms the enrollment of a user
+func (s *mfaStorage) EnableMFA(ctx context.Context, userID string, recoveryCodeHashes []string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.EnableMFA")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE user_mfa SET enabled_at = $1 WHERE user_id = $2 AND enabled_at IS NULL`, at, userID)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("no unconfirmed mfa of user %s: %w", userID, appErr.ErrConflict)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep records the time step of an accepted code
+func (s *mfaStorage) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.UseTOTPStep")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	const query = `UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+	tag, err := s.db.Exec(ctx, query, step, userID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("totp step %d of user %s already used: %w", step, userID, appErr.ErrConflict)
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code used
+func (s *mfaStorage) UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.UseRecoveryCode")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	const query = `UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	tag, err := s.db.Exec(ctx, query, at, userID, codeHash)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("recovery code of user %s: %w", userID, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteMFA disables MFA of a user
+func (s *mfaStorage) DeleteMFA(ctx context.Context, userID string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.DeleteMFA")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, query := range []string{
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM mfa_challenges WHERE user_id = $1`,
+		`DELETE FROM user_mfa WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(ctx, query, userID); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to delete mfa: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateMFAChallenge stores a challenge
+func (s *mfaStorage) CreateMFAChallenge(ctx context.Context, c *model.MFAChallenge) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.CreateMFAChallenge")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", c.UserID))
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < $1`, time.Now()); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired challenges: %w", err)
+	}
+	const query = `INSERT INTO mfa_challenges (token_hash, user_id, attempts, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, query, c.TokenHash, c.UserID, c.Attempts, c.ExpiresAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert challenge: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// GetMFAChallenge gets a challenge
+func (s *mfaStorage) GetMFAChallenge(ctx context.Context, tokenHash string) (*model.MFAChallenge, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.GetMFAChallenge")
+	defer span.End()
+
+	const query = `SELECT token_hash, user_id, attempts, expires_at FROM mfa_challenges WHERE token_hash = $1`
+	var c model.MFAChallenge
+	if err := s.db.QueryRow(ctx, query, tokenHash).Scan(&c.TokenHash, &c.UserID, &c.Attempts, &c.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("mfa challenge: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	return &c, nil
+}
+
+// AddMFAChallengeAttempt counts a wrong code
+func (s *mfaStorage) AddMFAChallengeAttempt(ctx context.Context, tokenHash string) (int, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.AddMFAChallengeAttempt")
+	defer span.End()
+
+	const query = `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1 RETURNING attempts`
+	var attempts int
+	if err := s.db.QueryRow(ctx, query, tokenHash).Scan(&attempts); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("mfa challenge: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// DeleteMFAChallenge deletes a challenge
+func (s *mfaStorage) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "mfaStorage.DeleteMFAChallenge")
+	defer span.End()
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE token_hash = $1`, tokenHash); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
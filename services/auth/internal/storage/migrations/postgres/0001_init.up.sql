@@ -0,0 +1,7 @@
+-- Initial schema of the auth service. IF NOT EXISTS adopts databases created before migrations.
+CREATE TABLE IF NOT EXISTS users (
+    id         TEXT PRIMARY KEY,
+    email      TEXT        NOT NULL UNIQUE,
+    password   TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
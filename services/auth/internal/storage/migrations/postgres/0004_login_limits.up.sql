@@ -0,0 +1,13 @@
+-- Failed logins and lockouts by key, e.g. "email:alice@example.com" or "ip:192.0.2.1",
+-- shared by all replicas of the auth service
+CREATE TABLE login_failures (
+    key       TEXT        NOT NULL,
+    failed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_login_failures_key_failed_at ON login_failures (key, failed_at);
+
+CREATE TABLE login_lockouts (
+    key          TEXT PRIMARY KEY,
+    locked_until TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,19 @@
+-- Logins in progress at the OIDC provider, keyed by the hash of their state parameter
+CREATE TABLE oidc_states (
+    state_hash    TEXT PRIMARY KEY,
+    nonce         TEXT        NOT NULL,
+    code_verifier TEXT        NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+
+-- External identities linked to users, by the issuer and subject of their ID tokens
+CREATE TABLE user_identities (
+    issuer     TEXT        NOT NULL,
+    subject    TEXT        NOT NULL,
+    user_id    TEXT        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,3 @@
+-- Profile of users and the admin switch that disables an account
+ALTER TABLE users ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+-- Emails are stored lower-cased. The index rejects addresses differing only in case, which
+-- the UPDATE fails on if such users already exist; merge or rename them first.
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(email));
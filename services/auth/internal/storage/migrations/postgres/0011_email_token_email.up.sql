@@ -0,0 +1,3 @@
+-- The address a token was mailed to. Tokens are rejected once the user has another email;
+-- tokens issued before this migration have none and must be requested again.
+ALTER TABLE email_tokens ADD COLUMN email TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- SQLite counterpart of the Postgres migration of the same version
+CREATE TABLE login_failures (
+    key       TEXT      NOT NULL,
+    failed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_login_failures_key_failed_at ON login_failures (key, failed_at);
+
+CREATE TABLE login_lockouts (
+    key          TEXT PRIMARY KEY,
+    locked_until TIMESTAMP NOT NULL
+);
@@ -0,0 +1,18 @@
+-- SQLite counterpart of the Postgres migration of the same version
+CREATE TABLE oidc_states (
+    state_hash    TEXT PRIMARY KEY,
+    nonce         TEXT      NOT NULL,
+    code_verifier TEXT      NOT NULL,
+    expires_at    TIMESTAMP NOT NULL
+);
+
+CREATE TABLE user_identities (
+    issuer     TEXT      NOT NULL,
+    subject    TEXT      NOT NULL,
+    user_id    TEXT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
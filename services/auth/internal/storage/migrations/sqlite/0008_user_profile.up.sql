@@ -0,0 +1,3 @@
+-- SQLite counterpart of the Postgres migration of the same version
+ALTER TABLE users ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
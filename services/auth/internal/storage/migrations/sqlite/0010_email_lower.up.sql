@@ -0,0 +1,4 @@
+-- SQLite counterpart of the Postgres migration of the same version
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(email));
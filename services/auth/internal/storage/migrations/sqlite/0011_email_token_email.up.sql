@@ -0,0 +1,2 @@
+-- SQLite counterpart of the Postgres migration of the same version
+ALTER TABLE email_tokens ADD COLUMN email TEXT NOT NULL DEFAULT '';
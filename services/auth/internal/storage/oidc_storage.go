@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// OIDCStorage stores OIDC logins in progress and the external identities linked to users
+type OIDCStorage interface {
+	// CreateOIDCState stores a login in progress and deletes expired ones
+	CreateOIDCState(ctx context.Context, s *model.OIDCState) error
+	// ConsumeOIDCState deletes and returns the login with the state hash. It returns
+	// ErrNotFound when there is none or it expired before at, so every state works once.
+	ConsumeOIDCState(ctx context.Context, stateHash string, at time.Time) (*model.OIDCState, error)
+	// GetIdentity returns ErrNotFound when no user is linked to the identity
+	GetIdentity(ctx context.Context, issuer, subject string) (*model.Identity, error)
+	// CreateIdentity links an identity to a user. It returns ErrConflict when the identity
+	// is already linked.
+	CreateIdentity(ctx context.Context, i *model.Identity) error
+}
+
+// oidcStorage is an OIDCStorage backed by Postgres
+type oidcStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewOIDCStorage creates a new OIDCStorage backed by Postgres
+func NewOIDCStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) OIDCStorage {
+	return &oidcStorage{db: dbPool, tracer: tracer}
+}
+
+// CreateOIDCState stores a login in progress
+func (s *oidcStorage) CreateOIDCState(ctx context.Context, st *model.OIDCState) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.CreateOIDCState")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM oidc_states WHERE expires_at < NOW()`); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired oidc states: %w", err)
+	}
+	const query = `INSERT INTO oidc_states (state_hash, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, query, st.StateHash, st.Nonce, st.CodeVerifier, st.ExpiresAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert oidc state: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// ConsumeOIDCState deletes and returns a login in progress
+func (s *oidcStorage) ConsumeOIDCState(ctx context.Context, stateHash string, at time.Time) (*model.OIDCState, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.ConsumeOIDCState")
+	defer span.End()
+
+	const query = `
+		DELETE FROM oidc_states WHERE state_hash = $1
+		RETURNING state_hash, nonce, code_verifier, expires_at
+	`
+	var st model.OIDCState
+	if err := s.db.QueryRow(ctx, query, stateHash).Scan(&st.StateHash, &st.Nonce, &st.CodeVerifier, &st.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("oidc state: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	if !at.Before(st.ExpiresAt) {
+		return nil, fmt.Errorf("oidc state expired: %w", appErr.ErrNotFound)
+	}
+	return &st, nil
+}
+
+// GetIdentity gets an external identity
+func (s *oidcStorage) GetIdentity(ctx context.Context, issuer, subject string) (*model.Identity, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.GetIdentity")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("identity.issuer", issuer))
+	const query = `
+		SELECT issuer, subject, user_id, email, created_at
+		FROM user_identities WHERE issuer = $1 AND subject = $2
+	`
+	var i model.Identity
+	if err := s.db.QueryRow(ctx, query, issuer, subject).Scan(&i.Issuer, &i.Subject, &i.UserID, &i.Email, &i.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("identity %s of %s: %w", subject, issuer, appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	return &i, nil
+}
+
+// CreateIdentity links an external identity to a user
+func (s *oidcStorage) CreateIdentity(ctx context.Context, i *model.Identity) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.CreateIdentity")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", i.UserID), attribute.String("identity.issuer", i.Issuer))
+	const query = `
+		INSERT INTO user_identities (issuer, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := s.db.Exec(ctx, query, i.Issuer, i.Subject, i.UserID, i.Email, i.CreatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return fmt.Errorf("identity %s of %s: %w", i.Subject, i.Issuer, appErr.ErrConflict)
+		}
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// sqliteAPIKeyStorage is an APIKeyStorage backed by SQLite
+type sqliteAPIKeyStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteAPIKeyStorage creates a new APIKeyStorage backed by SQLite
+func NewSQLiteAPIKeyStorage(db *sql.DB, tracer *otelkit.Tracer) APIKeyStorage {
+	return &sqliteAPIKeyStorage{db: db, tracer: tracer}
+}
+
+// CreateAPIKey stores a new API key
+func (s *sqliteAPIKeyStorage) CreateAPIKey(ctx context.Context, k *model.APIKey) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.CreateAPIKey")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", k.UserID))
+	const query = `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	if _, err := s.db.ExecContext(ctx, query, k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash,
+		strings.Join(k.Scopes, " "), k.ExpiresAt, k.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys lists the API keys of a user
+func (s *sqliteAPIKeyStorage) ListAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.ListAPIKeys")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY julianday(created_at) DESC`, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash gets an API key by the hash of its value
+func (s *sqliteAPIKeyStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.GetAPIKeyByHash")
+	defer span.End()
+
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("API key: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("api_key.id", k.ID))
+	return k, nil
+}
+
+// RevokeAPIKey revokes an API key of a user
+func (s *sqliteAPIKeyStorage) RevokeAPIKey(ctx context.Context, userID, id string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.RevokeAPIKey")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID), attribute.String("api_key.id", id))
+	const query = `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, at, id, userID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("API key %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// TouchAPIKey updates the last use of an API key
+func (s *sqliteAPIKeyStorage) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "apiKeyStorage.TouchAPIKey")
+	defer span.End()
+
+	const query = `
+		UPDATE api_keys SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR julianday(last_used_at) < julianday($3))
+	`
+	if _, err := s.db.ExecContext(ctx, query, at, id, at.Add(-apiKeyTouchInterval)); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// sqliteEmailTokenStorage is an EmailTokenStorage backed by SQLite
+type sqliteEmailTokenStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteEmailTokenStorage creates a new EmailTokenStorage backed by SQLite
+func NewSQLiteEmailTokenStorage(db *sql.DB, tracer *otelkit.Tracer) EmailTokenStorage {
+	return &sqliteEmailTokenStorage{db: db, tracer: tracer}
+}
+
+// CreateEmailToken stores a new email token
+func (s *sqliteEmailTokenStorage) CreateEmailToken(ctx context.Context, t *model.EmailToken) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "emailTokenStorage.CreateEmailToken")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", t.UserID), attribute.String("email_token.purpose", t.Purpose))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const cleanup = `DELETE FROM email_tokens WHERE user_id = $1 AND julianday(expires_at) < julianday($2)`
+	if _, err := tx.ExecContext(ctx, cleanup, t.UserID, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired email tokens: %w", err)
+	}
+	const invalidate = `UPDATE email_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, invalidate, t.CreatedAt, t.UserID, t.Purpose); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to invalidate email tokens: %w", err)
+	}
+	const query = `
+		INSERT INTO email_tokens (token_hash, user_id, email, purpose, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.ExecContext(ctx, query, t.TokenHash, t.UserID, NormalizeEmail(t.Email), t.Purpose, t.ExpiresAt, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert email token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ConsumeEmailToken marks an email token used
+func (s *sqliteEmailTokenStorage) ConsumeEmailToken(ctx context.Context, tokenHash, purpose string, at time.Time) (*model.EmailToken, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "emailTokenStorage.ConsumeEmailToken")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("email_token.purpose", purpose))
+	query := `
+		UPDATE email_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND julianday(expires_at) > julianday($1)
+		RETURNING ` + emailTokenColumns
+	t, err := scanEmailToken(s.db.QueryRowContext(ctx, query, at, tokenHash, purpose))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("email token: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sqliteLoginLimitStorage is a LoginLimitStorage backed by SQLite
+type sqliteLoginLimitStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteLoginLimitStorage creates a new LoginLimitStorage backed by SQLite
+func NewSQLiteLoginLimitStorage(db *sql.DB, tracer *otelkit.Tracer) LoginLimitStorage {
+	return &sqliteLoginLimitStorage{db: db, tracer: tracer}
+}
+
+// RecordFailure records a failed login
+func (s *sqliteLoginLimitStorage) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (int, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.RecordFailure")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("login_limit.key", key))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const cleanup = `DELETE FROM login_failures WHERE key = $1 AND julianday(failed_at) <= julianday($2)`
+	if _, err := tx.ExecContext(ctx, cleanup, key, at.Add(-window)); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete old login failures: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO login_failures (key, failed_at) VALUES ($1, $2)`, key, at); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM login_failures WHERE key = $1`, key).Scan(&n); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to count login failures: %w", err)
+	}
+	return n, tx.Commit()
+}
+
+// ClearFailures deletes the failed logins of a key
+func (s *sqliteLoginLimitStorage) ClearFailures(ctx context.Context, key string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.ClearFailures")
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM login_failures WHERE key = $1`, key); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// Lock locks a key out
+func (s *sqliteLoginLimitStorage) Lock(ctx context.Context, key string, until time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.Lock")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("login_limit.key", key))
+	const query = `
+		INSERT INTO login_lockouts (key, locked_until) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET locked_until = excluded.locked_until
+	`
+	if _, err := s.db.ExecContext(ctx, query, key, until); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// LockedUntil returns the end of the lockout of a key
+func (s *sqliteLoginLimitStorage) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.LockedUntil")
+	defer span.End()
+
+	var until time.Time
+	err := s.db.QueryRowContext(ctx, `SELECT locked_until FROM login_lockouts WHERE key = $1`, key).Scan(&until)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		span.RecordError(err)
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// Unlock lifts the lockout of a key
+func (s *sqliteLoginLimitStorage) Unlock(ctx context.Context, key string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "loginLimitStorage.Unlock")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("login_limit.key", key))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_lockouts WHERE key = $1`, key); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_failures WHERE key = $1`, key); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// sqliteOIDCStorage is an OIDCStorage backed by SQLite
+type sqliteOIDCStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteOIDCStorage creates a new OIDCStorage backed by SQLite
+func NewSQLiteOIDCStorage(db *sql.DB, tracer *otelkit.Tracer) OIDCStorage {
+	return &sqliteOIDCStorage{db: db, tracer: tracer}
+}
+
+// CreateOIDCState stores a login in progress
+func (s *sqliteOIDCStorage) CreateOIDCState(ctx context.Context, st *model.OIDCState) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.CreateOIDCState")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_states WHERE julianday(expires_at) < julianday($1)`, time.Now()); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired oidc states: %w", err)
+	}
+	const query = `INSERT INTO oidc_states (state_hash, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, st.StateHash, st.Nonce, st.CodeVerifier, st.ExpiresAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert oidc state: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ConsumeOIDCState deletes and returns a login in progress
+func (s *sqliteOIDCStorage) ConsumeOIDCState(ctx context.Context, stateHash string, at time.Time) (*model.OIDCState, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.ConsumeOIDCState")
+	defer span.End()
+
+	const query = `
+		DELETE FROM oidc_states WHERE state_hash = $1
+		RETURNING state_hash, nonce, code_verifier, expires_at
+	`
+	var st model.OIDCState
+	if err := s.db.QueryRowContext(ctx, query, stateHash).Scan(&st.StateHash, &st.Nonce, &st.CodeVerifier, &st.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("oidc state: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	if !at.Before(st.ExpiresAt) {
+		return nil, fmt.Errorf("oidc state expired: %w", appErr.ErrNotFound)
+	}
+	return &st, nil
+}
+
+// GetIdentity gets an external identity
+func (s *sqliteOIDCStorage) GetIdentity(ctx context.Context, issuer, subject string) (*model.Identity, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.GetIdentity")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("identity.issuer", issuer))
+	const query = `
+		SELECT issuer, subject, user_id, email, created_at
+		FROM user_identities WHERE issuer = $1 AND subject = $2
+	`
+	var i model.Identity
+	if err := s.db.QueryRowContext(ctx, query, issuer, subject).Scan(&i.Issuer, &i.Subject, &i.UserID, &i.Email, &i.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("identity %s of %s: %w", subject, issuer, appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	return &i, nil
+}
+
+// CreateIdentity links an external identity to a user
+func (s *sqliteOIDCStorage) CreateIdentity(ctx context.Context, i *model.Identity) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "oidcStorage.CreateIdentity")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", i.UserID), attribute.String("identity.issuer", i.Issuer))
+	const query = `
+		INSERT INTO user_identities (issuer, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := s.db.ExecContext(ctx, query, i.Issuer, i.Subject, i.UserID, i.Email, i.CreatedAt); err != nil {
+		if database.IsSQLiteUniqueViolation(err) {
+			return fmt.Errorf("identity %s of %s: %w", i.Subject, i.Issuer, appErr.ErrConflict)
+		}
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
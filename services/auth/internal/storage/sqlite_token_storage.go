@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// sqliteTokenStorage is a TokenStorage backed by SQLite
+type sqliteTokenStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteTokenStorage creates a new TokenStorage backed by SQLite
+func NewSQLiteTokenStorage(db *sql.DB, tracer *otelkit.Tracer) TokenStorage {
+	return &sqliteTokenStorage{db: db, tracer: tracer}
+}
+
+// CreateRefreshToken stores a new refresh token
+func (s *sqliteTokenStorage) CreateRefreshToken(ctx context.Context, t *model.RefreshToken) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.CreateRefreshToken")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", t.UserID),
+		attribute.String("token.family_id", t.FamilyID),
+	)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const cleanup = `DELETE FROM refresh_tokens WHERE user_id = $1 AND julianday(expires_at) < julianday($2)`
+	if _, err := tx.ExecContext(ctx, cleanup, t.UserID, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+
+	const query = `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.ExecContext(ctx, query, t.ID, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetRefreshToken gets a refresh token by the hash of its value
+func (s *sqliteTokenStorage) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.GetRefreshToken")
+	defer span.End()
+
+	const query = `
+		SELECT id, user_id, family_id, token_hash, expires_at, created_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	var t model.RefreshToken
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.UsedAt, &t.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("refresh token: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("token.family_id", t.FamilyID))
+	return &t, nil
+}
+
+// UseRefreshToken marks a refresh token used
+func (s *sqliteTokenStorage) UseRefreshToken(ctx context.Context, id string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.UseRefreshToken")
+	defer span.End()
+
+	const query = `UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, at, id)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("refresh token %s already used: %w", id, appErr.ErrConflict)
+	}
+	return nil
+}
+
+// RevokeTokenFamily revokes all tokens of a family
+func (s *sqliteTokenStorage) RevokeTokenFamily(ctx context.Context, familyID string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.RevokeTokenFamily")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("token.family_id", familyID))
+	const query = `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	if _, err := s.db.ExecContext(ctx, query, at, familyID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// RevokeUserTokens revokes all refresh tokens of a user
+func (s *sqliteTokenStorage) RevokeUserTokens(ctx context.Context, userID string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.RevokeUserTokens")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	const query = `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	if _, err := s.db.ExecContext(ctx, query, at, userID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// RevokeAccessToken puts jti on the revocation list until expiresAt
+func (s *sqliteTokenStorage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.RevokeAccessToken")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const cleanup = `DELETE FROM revoked_tokens WHERE julianday(expires_at) < julianday($1)`
+	if _, err := tx.ExecContext(ctx, cleanup, time.Now()); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired revocations: %w", err)
+	}
+	const query = `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, jti, expiresAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// IsAccessTokenRevoked reports whether jti is on the revocation list
+func (s *sqliteTokenStorage) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.IsAccessTokenRevoked")
+	defer span.End()
+
+	var revoked bool
+	const query = `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	if err := s.db.QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		span.RecordError(err)
+		return false, err
+	}
+	return revoked, nil
+}
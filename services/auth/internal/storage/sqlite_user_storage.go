@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// sqliteUserStorage is a UserStorage backed by SQLite
+type sqliteUserStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteUserStorage creates a new UserStorage backed by SQLite
+func NewSQLiteUserStorage(db *sql.DB, tracer *otelkit.Tracer) UserStorage {
+	return &sqliteUserStorage{db: db, tracer: tracer}
+}
+
+// CreateUser creates a new user
+func (s *sqliteUserStorage) CreateUser(ctx context.Context, email, hashedPass string) (*model.User, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.CreateUser")
+	defer span.End()
+	email = NormalizeEmail(email)
+
+	id := uuid.New().String()
+	now := time.Now()
+	query := `
+		INSERT INTO users (id, email, password, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	span.SetAttributes(
+		attribute.String("user.email", email),
+		attribute.String("operation", "create_user"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	if _, err := s.db.ExecContext(ctx, query, id, email, hashedPass, now); err != nil {
+		if database.IsSQLiteUniqueViolation(err) {
+			return nil, fmt.Errorf("user %s: %w", email, appErr.ErrConflict)
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_insert_error"))
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("user.id", id))
+	span.AddEvent("user.created.success")
+	return &model.User{
+		ID:        id,
+		Email:     email,
+		Password:  hashedPass,
+		CreatedAt: now,
+	}, nil
+}
+
+// GetUserByEmail gets a user by email
+func (s *sqliteUserStorage) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.GetUserByEmail")
+	defer span.End()
+	email = NormalizeEmail(email)
+
+	span.SetAttributes(
+		attribute.String("user.email", email),
+		attribute.String("operation", "get_user_by_email"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE email = $1
+	`
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %s: %w", email, appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_query_error"))
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("user.id", user.ID))
+	span.AddEvent("user.retrieved.success")
+	return user, nil
+}
+
+// GetUserByID gets a user by ID
+func (s *sqliteUserStorage) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.GetUserByID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "get_user_by_id"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1
+	`
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_query_error"))
+		return nil, err
+	}
+
+	span.AddEvent("user.retrieved.success")
+	return user, nil
+}
+
+// MarkEmailVerified marks the email of a user verified
+func (s *sqliteUserStorage) MarkEmailVerified(ctx context.Context, id, email string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.MarkEmailVerified")
+	defer span.End()
+	email = NormalizeEmail(email)
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "mark_email_verified"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	const query = `UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email = $3`
+	res, err := s.db.ExecContext(ctx, query, at, id, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdatePassword replaces the password hash of a user
+func (s *sqliteUserStorage) UpdatePassword(ctx context.Context, id, hashedPass string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.UpdatePassword")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "update_password"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	const query = `UPDATE users SET password = $1 WHERE id = $2`
+	res, err := s.db.ExecContext(ctx, query, hashedPass, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateProfile sets the name and email of a user
+func (s *sqliteUserStorage) UpdateProfile(ctx context.Context, id, name, email string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.UpdateProfile")
+	defer span.End()
+	email = NormalizeEmail(email)
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "update_profile"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const query = `
+		UPDATE users
+		SET name = $1, email = $2,
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
+		WHERE id = $3
+	`
+	res, err := tx.ExecContext(ctx, query, name, email, id)
+	if err != nil {
+		if database.IsSQLiteUniqueViolation(err) {
+			return fmt.Errorf("user %s: %w", email, appErr.ErrConflict)
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if err := s.affectedOne(res, id); err != nil {
+		return err
+	}
+
+	// Links mailed to the old address must not verify the new one or reset the password
+	const invalidate = `UPDATE email_tokens SET used_at = $1 WHERE user_id = $2 AND email <> $3 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, invalidate, time.Now().UTC(), id, email); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to invalidate email tokens: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SetDisabled disables or enables a user
+func (s *sqliteUserStorage) SetDisabled(ctx context.Context, id string, at *time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.SetDisabled")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "set_disabled"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET disabled_at = $1 WHERE id = $2`, at, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	return s.affectedOne(res, id)
+}
+
+// DeleteUser deletes a user; the rows referencing it are deleted by the database
+func (s *sqliteUserStorage) DeleteUser(ctx context.Context, id string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.DeleteUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "delete_user"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_delete_error"))
+		return err
+	}
+	return s.affectedOne(res, id)
+}
+
+// ListUsers lists users, oldest first
+func (s *sqliteUserStorage) ListUsers(ctx context.Context, limit, offset int) ([]*model.User, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.ListUsers")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("operation", "list_users"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY julianday(created_at), id LIMIT $1 OFFSET $2`
+	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_query_error"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*model.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// affectedOne returns ErrNotFound when res affected no user
+func (s *sqliteUserStorage) affectedOne(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// Ping checks if the database is connected
+func (s *sqliteUserStorage) Ping(ctx context.Context) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.Ping")
+	defer span.End()
+
+	if err := s.db.PingContext(ctx); err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_connection_error"))
+		return err
+	}
+	span.AddEvent("database.connection.healthy")
+	return nil
+}
@@ -0,0 +1,659 @@
+// Package storagetest is the conformance suite every backend of the auth service stores must pass.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/audit/audittest"
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+	"github.com/kernelshard/hcaas/services/auth/internal/storage"
+)
+
+// Factory returns the stores of an empty, migrated database.
+type Factory func(t *testing.T) *storage.Stores
+
+// Run runs the conformance suite against the stores returned by newStorage.
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, newStorage) })
+	t.Run("Errors", func(t *testing.T) { testErrors(t, newStorage) })
+	t.Run("Ping", func(t *testing.T) {
+		if err := newStorage(t).Users.Ping(context.Background()); err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	})
+	t.Run("RefreshTokens", func(t *testing.T) { testRefreshTokens(t, newStorage) })
+	t.Run("RevokedAccessTokens", func(t *testing.T) { testRevokedAccessTokens(t, newStorage) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, newStorage) })
+	t.Run("LoginLimits", func(t *testing.T) { testLoginLimits(t, newStorage) })
+	t.Run("EmailTokens", func(t *testing.T) { testEmailTokens(t, newStorage) })
+	t.Run("MFA", func(t *testing.T) { testMFA(t, newStorage) })
+	t.Run("OIDC", func(t *testing.T) { testOIDC(t, newStorage) })
+	t.Run("UserManagement", func(t *testing.T) { testUserManagement(t, newStorage) })
+	t.Run("Audit", func(t *testing.T) {
+		audittest.Run(t, func(t *testing.T) audit.Store { return newStorage(t).Audit })
+	})
+}
+
+func testCreateAndGet(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	s := newStorage(t).Users
+
+	created, err := s.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if created.ID == "" {
+		t.Error("CreateUser() returned a user without ID")
+	}
+
+	// Emails are matched regardless of case
+	got, err := s.GetUserByEmail(ctx, "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error = %v", err)
+	}
+	if got.ID != created.ID || got.Email != created.Email || got.Password != "hashed" {
+		t.Errorf("GetUserByEmail() = %+v, want %+v", *got, *created)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("GetUserByEmail() returned a zero CreatedAt")
+	}
+
+	byID, err := s.GetUserByID(ctx, created.ID)
+	if err != nil || byID.Email != created.Email {
+		t.Errorf("GetUserByID() = %+v, %v, want %+v", byID, err, *created)
+	}
+}
+
+func testErrors(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	s := newStorage(t).Users
+	if _, err := s.CreateUser(ctx, "alice@example.com", "hashed"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{
+			name: "duplicate email",
+			call: func() error {
+				_, err := s.CreateUser(ctx, "alice@example.com", "other")
+				return err
+			},
+			wantErr: appErr.ErrConflict,
+		},
+		{
+			name: "duplicate email in another case",
+			call: func() error {
+				_, err := s.CreateUser(ctx, " ALICE@example.com", "other")
+				return err
+			},
+			wantErr: appErr.ErrConflict,
+		},
+		{
+			name: "unknown email",
+			call: func() error {
+				_, err := s.GetUserByEmail(ctx, "bob@example.com")
+				return err
+			},
+			wantErr: appErr.ErrNotFound,
+		},
+		{
+			name: "unknown id",
+			call: func() error {
+				_, err := s.GetUserByID(ctx, "missing")
+				return err
+			},
+			wantErr: appErr.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newRefreshToken(userID, familyID, hash string, expiresAt time.Time) *model.RefreshToken {
+	return &model.RefreshToken{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt.UTC().Truncate(time.Microsecond),
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func testRefreshTokens(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	stores := newStorage(t)
+	users, tokens := stores.Users, stores.Tokens
+	user, err := users.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	first := newRefreshToken(user.ID, "family-1", "hash-1", expiresAt)
+	second := newRefreshToken(user.ID, "family-1", "hash-2", expiresAt)
+	other := newRefreshToken(user.ID, "family-2", "hash-3", expiresAt)
+	for _, rt := range []*model.RefreshToken{first, second, other} {
+		if err := tokens.CreateRefreshToken(ctx, rt); err != nil {
+			t.Fatalf("CreateRefreshToken() error = %v", err)
+		}
+	}
+
+	got, err := tokens.GetRefreshToken(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("GetRefreshToken() error = %v", err)
+	}
+	if got.ID != first.ID || got.UserID != user.ID || got.FamilyID != "family-1" || !got.ExpiresAt.Equal(first.ExpiresAt) {
+		t.Errorf("GetRefreshToken() = %+v, want %+v", *got, *first)
+	}
+	if got.UsedAt != nil || got.RevokedAt != nil {
+		t.Errorf("GetRefreshToken() of a new token = used %v, revoked %v", got.UsedAt, got.RevokedAt)
+	}
+	if _, err := tokens.GetRefreshToken(ctx, "missing"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetRefreshToken() of an unknown hash error = %v, want ErrNotFound", err)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{name: "first use", call: func() error { return tokens.UseRefreshToken(ctx, first.ID, time.Now()) }},
+		{name: "second use", call: func() error { return tokens.UseRefreshToken(ctx, first.ID, time.Now()) }, wantErr: appErr.ErrConflict},
+		{name: "revoke family", call: func() error { return tokens.RevokeTokenFamily(ctx, "family-1", time.Now()) }},
+		{name: "use of a revoked token", call: func() error { return tokens.UseRefreshToken(ctx, second.ID, time.Now()) }, wantErr: appErr.ErrConflict},
+		{name: "use in another family", call: func() error { return tokens.UseRefreshToken(ctx, other.ID, time.Now()) }},
+		{name: "revoke all of the user", call: func() error { return tokens.RevokeUserTokens(ctx, user.ID, time.Now()) }},
+		{name: "use after revoking all", call: func() error { return tokens.UseRefreshToken(ctx, other.ID, time.Now()) }, wantErr: appErr.ErrConflict},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if got, _ := tokens.GetRefreshToken(ctx, "hash-1"); got == nil || got.UsedAt == nil || got.RevokedAt == nil {
+		t.Errorf("GetRefreshToken() after use and revocation = %+v, want used and revoked", got)
+	}
+
+	// Expired tokens of the user are deleted when a new one is created
+	expired := newRefreshToken(user.ID, "family-3", "hash-expired", time.Now().Add(-time.Hour))
+	if err := tokens.CreateRefreshToken(ctx, expired); err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	if err := tokens.CreateRefreshToken(ctx, newRefreshToken(user.ID, "family-4", "hash-4", expiresAt)); err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	if _, err := tokens.GetRefreshToken(ctx, "hash-expired"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetRefreshToken() of an expired token error = %v, want ErrNotFound", err)
+	}
+}
+
+func testRevokedAccessTokens(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	tokens := newStorage(t).Tokens
+
+	if err := tokens.RevokeAccessToken(ctx, "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeAccessToken() error = %v", err)
+	}
+	if err := tokens.RevokeAccessToken(ctx, "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("RevokeAccessToken() twice error = %v", err)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		jti  string
+		want bool
+	}{
+		{jti: "jti-1", want: true},
+		{jti: "jti-2", want: false},
+	}
+	for _, tt := range tests {
+		revoked, err := tokens.IsAccessTokenRevoked(ctx, tt.jti)
+		if err != nil || revoked != tt.want {
+			t.Errorf("IsAccessTokenRevoked(%s) = %v, %v, want %v", tt.jti, revoked, err, tt.want)
+		}
+	}
+}
+
+func testAPIKeys(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	stores := newStorage(t)
+	user, err := stores.Users.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	expiresAt := now.Add(time.Hour)
+	older := &model.APIKey{
+		ID: uuid.NewString(), UserID: user.ID, Name: "ci", Prefix: "hcaas_ab", KeyHash: "hash-1",
+		Scopes: []string{"urls:read", "urls:write"}, ExpiresAt: &expiresAt, CreatedAt: now.Add(-time.Minute),
+	}
+	newer := &model.APIKey{
+		ID: uuid.NewString(), UserID: user.ID, Name: "dashboard", Prefix: "hcaas_cd", KeyHash: "hash-2",
+		Scopes: []string{"urls:read"}, CreatedAt: now,
+	}
+	for _, k := range []*model.APIKey{older, newer} {
+		if err := stores.APIKeys.CreateAPIKey(ctx, k); err != nil {
+			t.Fatalf("CreateAPIKey() error = %v", err)
+		}
+	}
+
+	got, err := stores.APIKeys.GetAPIKeyByHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash() error = %v", err)
+	}
+	if got.ID != older.ID || got.Name != "ci" || len(got.Scopes) != 2 || got.Scopes[1] != "urls:write" ||
+		got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) || got.LastUsedAt != nil || got.RevokedAt != nil {
+		t.Errorf("GetAPIKeyByHash() = %+v, want %+v", *got, *older)
+	}
+
+	keys, err := stores.APIKeys.ListAPIKeys(ctx, user.ID)
+	if err != nil || len(keys) != 2 || keys[0].ID != newer.ID || keys[0].ExpiresAt != nil {
+		t.Errorf("ListAPIKeys() = %+v, %v, want the two keys, newest first", keys, err)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{name: "unknown hash", call: func() error { _, err := stores.APIKeys.GetAPIKeyByHash(ctx, "missing"); return err }, wantErr: appErr.ErrNotFound},
+		{name: "touch", call: func() error { return stores.APIKeys.TouchAPIKey(ctx, older.ID, now) }},
+		{name: "revoke key of another user", call: func() error { return stores.APIKeys.RevokeAPIKey(ctx, "someone-else", older.ID, now) }, wantErr: appErr.ErrNotFound},
+		{name: "revoke", call: func() error { return stores.APIKeys.RevokeAPIKey(ctx, user.ID, older.ID, now) }},
+		{name: "revoke twice", call: func() error { return stores.APIKeys.RevokeAPIKey(ctx, user.ID, older.ID, now) }, wantErr: appErr.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// A touch within a minute of the last one is skipped
+	if err := stores.APIKeys.TouchAPIKey(ctx, older.ID, now.Add(time.Second)); err != nil {
+		t.Fatalf("TouchAPIKey() error = %v", err)
+	}
+	got, err = stores.APIKeys.GetAPIKeyByHash(ctx, "hash-1")
+	if err != nil || got.LastUsedAt == nil || !got.LastUsedAt.Equal(now) || got.RevokedAt == nil {
+		t.Errorf("GetAPIKeyByHash() after use and revocation = %+v, %v, want used at %v and revoked", got, err, now)
+	}
+}
+
+func testLoginLimits(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	limits := newStorage(t).LoginLimits
+	start := time.Now().UTC().Truncate(time.Microsecond)
+	window := 10 * time.Minute
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name string
+		key  string
+		at   time.Time
+		want int
+	}{
+		{name: "first failure", key: "email:a", at: start, want: 1},
+		{name: "second failure", key: "email:a", at: start.Add(time.Minute), want: 2},
+		{name: "other key", key: "ip:192.0.2.1", at: start.Add(time.Minute), want: 1},
+		{name: "first failure left the window", key: "email:a", at: start.Add(window + time.Second), want: 2},
+		{name: "all failures left the window", key: "email:a", at: start.Add(3 * window), want: 1},
+	}
+	for _, tt := range tests {
+		n, err := limits.RecordFailure(ctx, tt.key, tt.at, window)
+		if err != nil || n != tt.want {
+			t.Errorf("%s: RecordFailure() = %d, %v, want %d", tt.name, n, err, tt.want)
+		}
+	}
+
+	if err := limits.ClearFailures(ctx, "email:a"); err != nil {
+		t.Fatalf("ClearFailures() error = %v", err)
+	}
+	if n, err := limits.RecordFailure(ctx, "email:a", start.Add(3*window), window); err != nil || n != 1 {
+		t.Errorf("RecordFailure() after ClearFailures() = %d, %v, want 1", n, err)
+	}
+
+	until := start.Add(time.Hour)
+	if got, err := limits.LockedUntil(ctx, "email:a"); err != nil || !got.IsZero() {
+		t.Errorf("LockedUntil() before Lock() = %v, %v, want the zero time", got, err)
+	}
+	for _, u := range []time.Time{start, until} {
+		if err := limits.Lock(ctx, "email:a", u); err != nil {
+			t.Fatalf("Lock() error = %v", err)
+		}
+	}
+	if got, err := limits.LockedUntil(ctx, "email:a"); err != nil || !got.Equal(until) {
+		t.Errorf("LockedUntil() = %v, %v, want %v", got, err, until)
+	}
+	if err := limits.Unlock(ctx, "email:a"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if got, err := limits.LockedUntil(ctx, "email:a"); err != nil || !got.IsZero() {
+		t.Errorf("LockedUntil() after Unlock() = %v, %v, want the zero time", got, err)
+	}
+	if n, err := limits.RecordFailure(ctx, "email:a", start.Add(3*window), window); err != nil || n != 1 {
+		t.Errorf("RecordFailure() after Unlock() = %d, %v, want 1", n, err)
+	}
+}
+
+func testEmailTokens(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	stores := newStorage(t)
+	users, tokens := stores.Users, stores.EmailTokens
+	user, err := users.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	newToken := func(hash, purpose string, expiresAt time.Time) *model.EmailToken {
+		return &model.EmailToken{TokenHash: hash, UserID: user.ID, Email: user.Email, Purpose: purpose, ExpiresAt: expiresAt, CreatedAt: now}
+	}
+	for _, et := range []*model.EmailToken{
+		newToken("expired", model.PurposeVerifyEmail, now.Add(-time.Minute)),
+		newToken("replaced", model.PurposeResetPassword, now.Add(time.Hour)),
+		newToken("reset", model.PurposeResetPassword, now.Add(time.Hour)),
+		newToken("verify", model.PurposeVerifyEmail, now.Add(time.Hour)),
+	} {
+		if err := tokens.CreateEmailToken(ctx, et); err != nil {
+			t.Fatalf("CreateEmailToken() error = %v", err)
+		}
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		hash    string
+		purpose string
+		wantErr error
+	}{
+		{name: "expired", hash: "expired", purpose: model.PurposeVerifyEmail, wantErr: appErr.ErrNotFound},
+		{name: "replaced by a newer token", hash: "replaced", purpose: model.PurposeResetPassword, wantErr: appErr.ErrNotFound},
+		{name: "other purpose", hash: "reset", purpose: model.PurposeVerifyEmail, wantErr: appErr.ErrNotFound},
+		{name: "first use", hash: "reset", purpose: model.PurposeResetPassword},
+		{name: "second use", hash: "reset", purpose: model.PurposeResetPassword, wantErr: appErr.ErrNotFound},
+		{name: "token of the other purpose kept", hash: "verify", purpose: model.PurposeVerifyEmail},
+		{name: "unknown", hash: "missing", purpose: model.PurposeVerifyEmail, wantErr: appErr.ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := tokens.ConsumeEmailToken(ctx, tt.hash, tt.purpose, now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ConsumeEmailToken() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got.UserID != user.ID || got.Email != user.Email || got.UsedAt == nil) {
+			t.Errorf("%s: ConsumeEmailToken() = %+v, want a used token of the user", tt.name, *got)
+		}
+	}
+
+	if err := users.MarkEmailVerified(ctx, user.ID, "bob@example.com", now); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("MarkEmailVerified() of another email error = %v, want ErrNotFound", err)
+	}
+	if err := users.MarkEmailVerified(ctx, user.ID, user.Email, now); err != nil {
+		t.Fatalf("MarkEmailVerified() error = %v", err)
+	}
+	if err := users.UpdatePassword(ctx, user.ID, "rehashed"); err != nil {
+		t.Fatalf("UpdatePassword() error = %v", err)
+	}
+	got, err := users.GetUserByID(ctx, user.ID)
+	if err != nil || got.EmailVerifiedAt == nil || !got.EmailVerifiedAt.Equal(now) || got.Password != "rehashed" {
+		t.Errorf("GetUserByID() = %+v, %v, want a verified user with the new password", got, err)
+	}
+	if err := users.UpdatePassword(ctx, "missing", "x"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("UpdatePassword() of an unknown user error = %v, want ErrNotFound", err)
+	}
+
+	// Changing the email invalidates the tokens mailed to the old one
+	if err := tokens.CreateEmailToken(ctx, newToken("old-email", model.PurposeResetPassword, now.Add(time.Hour))); err != nil {
+		t.Fatalf("CreateEmailToken() error = %v", err)
+	}
+	if err := users.UpdateProfile(ctx, user.ID, "", "alice@new.example.com"); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+	if _, err := tokens.ConsumeEmailToken(ctx, "old-email", model.PurposeResetPassword, now); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("ConsumeEmailToken() after an email change error = %v, want ErrNotFound", err)
+	}
+}
+
+func testMFA(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	stores := newStorage(t)
+	mfa := stores.MFA
+	user, err := stores.Users.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{name: "enable without enrollment", call: func() error { return mfa.EnableMFA(ctx, user.ID, nil, now) }, wantErr: appErr.ErrConflict},
+		{name: "enroll", call: func() error { return mfa.SaveTOTPSecret(ctx, user.ID, "FIRST", now) }},
+		{name: "enroll again", call: func() error { return mfa.SaveTOTPSecret(ctx, user.ID, "SECRET", now) }},
+		{name: "enable", call: func() error { return mfa.EnableMFA(ctx, user.ID, []string{"code-1", "code-2"}, now) }},
+		{name: "enable twice", call: func() error { return mfa.EnableMFA(ctx, user.ID, nil, now) }, wantErr: appErr.ErrConflict},
+		{name: "enroll while enabled", call: func() error { return mfa.SaveTOTPSecret(ctx, user.ID, "OTHER", now) }, wantErr: appErr.ErrConflict},
+		{name: "use step", call: func() error { return mfa.UseTOTPStep(ctx, user.ID, 100) }},
+		{name: "replay step", call: func() error { return mfa.UseTOTPStep(ctx, user.ID, 100) }, wantErr: appErr.ErrConflict},
+		{name: "earlier step", call: func() error { return mfa.UseTOTPStep(ctx, user.ID, 99) }, wantErr: appErr.ErrConflict},
+		{name: "later step", call: func() error { return mfa.UseTOTPStep(ctx, user.ID, 101) }},
+		{name: "use recovery code", call: func() error { return mfa.UseRecoveryCode(ctx, user.ID, "code-1", now) }},
+		{name: "reuse recovery code", call: func() error { return mfa.UseRecoveryCode(ctx, user.ID, "code-1", now) }, wantErr: appErr.ErrNotFound},
+		{name: "unknown recovery code", call: func() error { return mfa.UseRecoveryCode(ctx, user.ID, "code-3", now) }, wantErr: appErr.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	got, err := mfa.GetMFA(ctx, user.ID)
+	if err != nil || got.Secret != "SECRET" || got.EnabledAt == nil || !got.EnabledAt.Equal(now) || got.LastUsedStep != 101 {
+		t.Errorf("GetMFA() = %+v, %v, want the enabled secret at step 101", got, err)
+	}
+
+	challenge := &model.MFAChallenge{TokenHash: "challenge", UserID: user.ID, ExpiresAt: now.Add(time.Minute)}
+	if err := mfa.CreateMFAChallenge(ctx, challenge); err != nil {
+		t.Fatalf("CreateMFAChallenge() error = %v", err)
+	}
+	for want := 1; want <= 2; want++ {
+		if n, err := mfa.AddMFAChallengeAttempt(ctx, "challenge"); err != nil || n != want {
+			t.Errorf("AddMFAChallengeAttempt() = %d, %v, want %d", n, err, want)
+		}
+	}
+	if c, err := mfa.GetMFAChallenge(ctx, "challenge"); err != nil || c.UserID != user.ID || c.Attempts != 2 || !c.ExpiresAt.Equal(challenge.ExpiresAt) {
+		t.Errorf("GetMFAChallenge() = %+v, %v, want the challenge with 2 attempts", c, err)
+	}
+	if err := mfa.DeleteMFAChallenge(ctx, "challenge"); err != nil {
+		t.Fatalf("DeleteMFAChallenge() error = %v", err)
+	}
+	if _, err := mfa.GetMFAChallenge(ctx, "challenge"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetMFAChallenge() after delete error = %v, want ErrNotFound", err)
+	}
+
+	if err := mfa.DeleteMFA(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteMFA() error = %v", err)
+	}
+	if _, err := mfa.GetMFA(ctx, user.ID); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetMFA() after delete error = %v, want ErrNotFound", err)
+	}
+	if err := mfa.UseRecoveryCode(ctx, user.ID, "code-2", now); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("UseRecoveryCode() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testOIDC(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	stores := newStorage(t)
+	oidc := stores.OIDC
+	user, err := stores.Users.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	for _, st := range []*model.OIDCState{
+		{StateHash: "live", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: now.Add(time.Minute)},
+		{StateHash: "expired", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: now.Add(-time.Minute)},
+	} {
+		if err := oidc.CreateOIDCState(ctx, st); err != nil {
+			t.Fatalf("CreateOIDCState() error = %v", err)
+		}
+	}
+	identity := &model.Identity{Issuer: "https://idp.example.com", Subject: "sub-1", UserID: user.ID, Email: user.Email, CreatedAt: now}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{
+			name: "consume state",
+			call: func() error {
+				st, err := oidc.ConsumeOIDCState(ctx, "live", now)
+				if err == nil && (st.Nonce != "nonce" || st.CodeVerifier != "verifier") {
+					t.Errorf("ConsumeOIDCState() = %+v, want the stored state", st)
+				}
+				return err
+			},
+		},
+		{name: "consume state twice", call: func() error { _, err := oidc.ConsumeOIDCState(ctx, "live", now); return err }, wantErr: appErr.ErrNotFound},
+		{name: "consume expired state", call: func() error { _, err := oidc.ConsumeOIDCState(ctx, "expired", now); return err }, wantErr: appErr.ErrNotFound},
+		{name: "unknown identity", call: func() error { _, err := oidc.GetIdentity(ctx, identity.Issuer, identity.Subject); return err }, wantErr: appErr.ErrNotFound},
+		{name: "link identity", call: func() error { return oidc.CreateIdentity(ctx, identity) }},
+		{name: "link identity twice", call: func() error { return oidc.CreateIdentity(ctx, identity) }, wantErr: appErr.ErrConflict},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	got, err := oidc.GetIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil || got.UserID != user.ID || got.Email != user.Email || !got.CreatedAt.Equal(now) {
+		t.Errorf("GetIdentity() = %+v, %v, want the linked identity", got, err)
+	}
+}
+
+func testUserManagement(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	stores := newStorage(t)
+	users := stores.Users
+	alice, err := users.CreateUser(ctx, "alice@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	bob, err := users.CreateUser(ctx, "bob@example.com", "hashed")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if err := users.MarkEmailVerified(ctx, alice.ID, alice.Email, now); err != nil {
+		t.Fatalf("MarkEmailVerified() error = %v", err)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+		check   func(u *model.User) bool
+	}{
+		{
+			name:  "rename keeps verification",
+			call:  func() error { return users.UpdateProfile(ctx, alice.ID, "Alice", "alice@example.com") },
+			check: func(u *model.User) bool { return u.Name == "Alice" && u.EmailVerifiedAt != nil },
+		},
+		{
+			name:  "same email in another case stays verified",
+			call:  func() error { return users.UpdateProfile(ctx, alice.ID, "Alice", "Alice@Example.com") },
+			check: func(u *model.User) bool { return u.Email == "alice@example.com" && u.EmailVerifiedAt != nil },
+		},
+		{
+			name:  "new email drops verification",
+			call:  func() error { return users.UpdateProfile(ctx, alice.ID, "Alice", "alice@new.example.com") },
+			check: func(u *model.User) bool { return u.Email == "alice@new.example.com" && u.EmailVerifiedAt == nil },
+		},
+		{name: "email of another user", call: func() error { return users.UpdateProfile(ctx, alice.ID, "", bob.Email) }, wantErr: appErr.ErrConflict},
+		{name: "email of another user in another case", call: func() error { return users.UpdateProfile(ctx, alice.ID, "", "BOB@example.com") }, wantErr: appErr.ErrConflict},
+		{name: "update unknown user", call: func() error { return users.UpdateProfile(ctx, "missing", "", "x@example.com") }, wantErr: appErr.ErrNotFound},
+		{
+			name:  "disable",
+			call:  func() error { return users.SetDisabled(ctx, alice.ID, &now) },
+			check: func(u *model.User) bool { return u.DisabledAt != nil && u.DisabledAt.Equal(now) },
+		},
+		{
+			name:  "enable",
+			call:  func() error { return users.SetDisabled(ctx, alice.ID, nil) },
+			check: func(u *model.User) bool { return u.DisabledAt == nil },
+		},
+		{name: "disable unknown user", call: func() error { return users.SetDisabled(ctx, "missing", &now) }, wantErr: appErr.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.check == nil {
+				return
+			}
+			if u, err := users.GetUserByID(ctx, alice.ID); err != nil || !tt.check(u) {
+				t.Errorf("GetUserByID() = %+v, %v", u, err)
+			}
+		})
+	}
+
+	// Both users may have been created within the same instant, so only the set is certain
+	list, err := users.ListUsers(ctx, 10, 0)
+	if err != nil || len(list) != 2 || list[0].ID == list[1].ID || (list[0].ID != alice.ID && list[0].ID != bob.ID) ||
+		(list[1].ID != alice.ID && list[1].ID != bob.ID) {
+		t.Fatalf("ListUsers() = %v, %v, want alice and bob", list, err)
+	}
+	if page, err := users.ListUsers(ctx, 1, 1); err != nil || len(page) != 1 || page[0].ID != list[1].ID {
+		t.Errorf("ListUsers(1, 1) = %v, %v, want the second user", page, err)
+	}
+
+	// Deleting a user deletes what references it
+	if err := stores.APIKeys.CreateAPIKey(ctx, &model.APIKey{
+		ID: "key", UserID: alice.ID, Name: "ci", Prefix: "hcaas_ab", KeyHash: "hash", CreatedAt: now,
+	}); err != nil {
+		t.Fatalf("CreateAPIKey() error = %v", err)
+	}
+	if err := users.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if _, err := users.GetUserByID(ctx, alice.ID); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetUserByID() after delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := stores.APIKeys.GetAPIKeyByHash(ctx, "hash"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetAPIKeyByHash() after delete error = %v, want ErrNotFound", err)
+	}
+	if err := users.DeleteUser(ctx, alice.ID); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("DeleteUser() twice error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
+	"github.com/kernelshard/hcaas/services/auth/internal/model"
+)
+
+// TokenStorage stores refresh tokens and the revocation list of access tokens
+type TokenStorage interface {
+	// CreateRefreshToken stores a new refresh token. Expired tokens of the same user are
+	// deleted on the way, so the table does not grow with every login.
+	CreateRefreshToken(ctx context.Context, t *model.RefreshToken) error
+	// GetRefreshToken returns ErrNotFound when no token has the hash
+	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	// UseRefreshToken marks a token used. It returns ErrConflict when the token was already
+	// used or revoked, so of two concurrent refreshes with the same token only one succeeds.
+	UseRefreshToken(ctx context.Context, id string, at time.Time) error
+	// RevokeTokenFamily revokes all tokens of a family
+	RevokeTokenFamily(ctx context.Context, familyID string, at time.Time) error
+	// RevokeUserTokens revokes all refresh tokens of a user, e.g. when the password changes
+	RevokeUserTokens(ctx context.Context, userID string, at time.Time) error
+	// RevokeAccessToken puts jti on the revocation list until expiresAt. Revoking a token
+	// twice is not an error; entries of expired tokens are deleted on the way.
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsAccessTokenRevoked reports whether jti is on the revocation list
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// tokenStorage is a TokenStorage backed by Postgres
+type tokenStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+// NewTokenStorage creates a new TokenStorage backed by Postgres
+func NewTokenStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) TokenStorage {
+	return &tokenStorage{db: dbPool, tracer: tracer}
+}
+
+// CreateRefreshToken stores a new refresh token
+func (s *tokenStorage) CreateRefreshToken(ctx context.Context, t *model.RefreshToken) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.CreateRefreshToken")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", t.UserID),
+		attribute.String("token.family_id", t.FamilyID),
+	)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const cleanup = `DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < $2`
+	if _, err := tx.Exec(ctx, cleanup, t.UserID, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+
+	const query = `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.Exec(ctx, query, t.ID, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt, t.CreatedAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// GetRefreshToken gets a refresh token by the hash of its value
+func (s *tokenStorage) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.GetRefreshToken")
+	defer span.End()
+
+	const query = `
+		SELECT id, user_id, family_id, token_hash, expires_at, created_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	var t model.RefreshToken
+	err := s.db.QueryRow(ctx, query, tokenHash).Scan(
+		&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.UsedAt, &t.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("refresh token: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("token.family_id", t.FamilyID))
+	return &t, nil
+}
+
+// UseRefreshToken marks a refresh token used
+func (s *tokenStorage) UseRefreshToken(ctx context.Context, id string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.UseRefreshToken")
+	defer span.End()
+
+	const query = `UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`
+	tag, err := s.db.Exec(ctx, query, at, id)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("refresh token %s already used: %w", id, appErr.ErrConflict)
+	}
+	return nil
+}
+
+// RevokeTokenFamily revokes all tokens of a family
+func (s *tokenStorage) RevokeTokenFamily(ctx context.Context, familyID string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.RevokeTokenFamily")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("token.family_id", familyID))
+	const query = `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	if _, err := s.db.Exec(ctx, query, at, familyID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// RevokeUserTokens revokes all refresh tokens of a user
+func (s *tokenStorage) RevokeUserTokens(ctx context.Context, userID string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.RevokeUserTokens")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID))
+	const query = `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	if _, err := s.db.Exec(ctx, query, at, userID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// RevokeAccessToken puts jti on the revocation list until expiresAt
+func (s *tokenStorage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.RevokeAccessToken")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, time.Now()); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete expired revocations: %w", err)
+	}
+	const query = `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+	if _, err := tx.Exec(ctx, query, jti, expiresAt); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// IsAccessTokenRevoked reports whether jti is on the revocation list
+func (s *tokenStorage) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "tokenStorage.IsAccessTokenRevoked")
+	defer span.End()
+
+	var revoked bool
+	const query = `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	if err := s.db.QueryRow(ctx, query, jti).Scan(&revoked); err != nil {
+		span.RecordError(err)
+		return false, err
+	}
+	return revoked, nil
+}
@@ -2,24 +2,69 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/samims/otelkit"
 	"go.opentelemetry.io/otel/attribute"
 
+	appErr "github.com/kernelshard/hcaas/services/auth/internal/errors"
 	"github.com/kernelshard/hcaas/services/auth/internal/model"
 
 	"github.com/google/uuid"
 )
 
-// UserStorage interface for user storage
+// UserStorage interface for user storage. Emails are stored and looked up lower-cased.
 type UserStorage interface {
+	// CreateUser returns ErrConflict when the email is already registered
 	CreateUser(ctx context.Context, email, hashedPass string) (*model.User, error)
+	// GetUserByEmail returns ErrNotFound when no user has the email
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// GetUserByID returns ErrNotFound when no user has the ID
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
+	// MarkEmailVerified marks email verified if the user still has it. It returns ErrNotFound
+	// when no user has the ID and email.
+	MarkEmailVerified(ctx context.Context, id, email string, at time.Time) error
+	// UpdatePassword returns ErrNotFound when no user has the ID
+	UpdatePassword(ctx context.Context, id, hashedPass string) error
+	// UpdateProfile sets the name and email of a user. A changed email is no longer verified
+	// and the unused email tokens mailed to the old one are invalidated. It returns
+	// ErrNotFound when no user has the ID and ErrConflict when another user has the email.
+	UpdateProfile(ctx context.Context, id, name, email string) error
+	// SetDisabled disables a user at at, or enables it when at is nil. It returns ErrNotFound
+	// when no user has the ID.
+	SetDisabled(ctx context.Context, id string, at *time.Time) error
+	// DeleteUser deletes a user with its tokens, keys and identities. It returns ErrNotFound
+	// when no user has the ID.
+	DeleteUser(ctx context.Context, id string) error
+	// ListUsers returns up to limit users after skipping offset, oldest first
+	ListUsers(ctx context.Context, limit, offset int) ([]*model.User, error)
 	Ping(ctx context.Context) error
 }
 
+// NormalizeEmail trims and lower-cases email, so addresses differing only in case or
+// surrounding spaces belong to the same user. Everything keyed by email uses it.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, email, password, created_at, email_verified_at, name, disabled_at`
+
+// scanUser scans a row of userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (*model.User, error) {
+	var u model.User
+	if err := row.Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt, &u.EmailVerifiedAt, &u.Name, &u.DisabledAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
 // userStorage struct for user storage
 type userStorage struct {
 	db     *pgxpool.Pool
@@ -35,6 +80,7 @@ func NewUserStorage(dbPool *pgxpool.Pool, tracer *otelkit.Tracer) UserStorage {
 func (s *userStorage) CreateUser(ctx context.Context, email, hashedPass string) (*model.User, error) {
 	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.CreateUser")
 	defer span.End()
+	email = NormalizeEmail(email)
 
 	id := uuid.New().String()
 	now := time.Now()
@@ -51,6 +97,10 @@ func (s *userStorage) CreateUser(ctx context.Context, email, hashedPass string)
 	_, err := s.db.Exec(ctx, query, id, email, hashedPass, now)
 
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return nil, fmt.Errorf("user %s: %w", email, appErr.ErrConflict)
+		}
 		span.RecordError(err)
 		span.SetAttributes(attribute.String("error.type", "database_insert_error"))
 		return nil, err
@@ -70,6 +120,7 @@ func (s *userStorage) CreateUser(ctx context.Context, email, hashedPass string)
 func (s *userStorage) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.GetUserByEmail")
 	defer span.End()
+	email = NormalizeEmail(email)
 
 	span.SetAttributes(
 		attribute.String("user.email", email),
@@ -78,14 +129,15 @@ func (s *userStorage) GetUserByEmail(ctx context.Context, email string) (*model.
 	)
 
 	query := `
-		SELECT id, email, password, created_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1
 	`
-	row := s.db.QueryRow(ctx, query, email)
-
-	var user model.User
-	if err := row.Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt); err != nil {
+	user, err := scanUser(s.db.QueryRow(ctx, query, email))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user %s: %w", email, appErr.ErrNotFound)
+		}
 		span.RecordError(err)
 		span.SetAttributes(attribute.String("error.type", "database_query_error"))
 		return nil, err
@@ -93,7 +145,211 @@ func (s *userStorage) GetUserByEmail(ctx context.Context, email string) (*model.
 
 	span.SetAttributes(attribute.String("user.id", user.ID))
 	span.AddEvent("user.retrieved.success")
-	return &user, nil
+	return user, nil
+}
+
+// GetUserByID gets a user by ID
+func (s *userStorage) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.GetUserByID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "get_user_by_id"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1
+	`
+	user, err := scanUser(s.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_query_error"))
+		return nil, err
+	}
+
+	span.AddEvent("user.retrieved.success")
+	return user, nil
+}
+
+// MarkEmailVerified marks the email of a user verified
+func (s *userStorage) MarkEmailVerified(ctx context.Context, id, email string, at time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.MarkEmailVerified")
+	defer span.End()
+	email = NormalizeEmail(email)
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "mark_email_verified"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	const query = `UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email = $3`
+	tag, err := s.db.Exec(ctx, query, at, id, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdatePassword replaces the password hash of a user
+func (s *userStorage) UpdatePassword(ctx context.Context, id, hashedPass string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.UpdatePassword")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "update_password"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	const query = `UPDATE users SET password = $1 WHERE id = $2`
+	tag, err := s.db.Exec(ctx, query, hashedPass, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateProfile sets the name and email of a user
+func (s *userStorage) UpdateProfile(ctx context.Context, id, name, email string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.UpdateProfile")
+	defer span.End()
+	email = NormalizeEmail(email)
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "update_profile"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const query = `
+		UPDATE users
+		SET name = $1, email = $2,
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
+		WHERE id = $3
+	`
+	tag, err := tx.Exec(ctx, query, name, email, id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return fmt.Errorf("user %s: %w", email, appErr.ErrConflict)
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+
+	// Links mailed to the old address must not verify the new one or reset the password
+	const invalidate = `UPDATE email_tokens SET used_at = $1 WHERE user_id = $2 AND email <> $3 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, invalidate, time.Now(), id, email); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to invalidate email tokens: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// SetDisabled disables or enables a user
+func (s *userStorage) SetDisabled(ctx context.Context, id string, at *time.Time) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.SetDisabled")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "set_disabled"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	tag, err := s.db.Exec(ctx, `UPDATE users SET disabled_at = $1 WHERE id = $2`, at, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_update_error"))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteUser deletes a user; the rows referencing it are deleted by the database
+func (s *userStorage) DeleteUser(ctx context.Context, id string) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.DeleteUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id),
+		attribute.String("operation", "delete_user"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_delete_error"))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// ListUsers lists users, oldest first
+func (s *userStorage) ListUsers(ctx context.Context, limit, offset int) ([]*model.User, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "userStorage.ListUsers")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("operation", "list_users"),
+		attribute.String("storage.component", "user_storage"),
+	)
+
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY created_at, id LIMIT $1 OFFSET $2`
+	rows, err := s.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "database_query_error"))
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*model.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
 }
 
 // Ping checks if the database is connected
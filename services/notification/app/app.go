@@ -0,0 +1,191 @@
+// Package app wires the notification service: its storage, HTTP routes, delivery worker and
+// event consumer. It is used by cmd/notification and embedded by the all-in-one binary.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/authn"
+	"github.com/kernelshard/hcaas/pkg/bus"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/handler"
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
+	"github.com/kernelshard/hcaas/services/notification/internal/middleware"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/service"
+	"github.com/kernelshard/hcaas/services/notification/internal/store"
+)
+
+// ServiceName identifies the notification service in traces.
+const ServiceName = "notification-service"
+
+// Config holds the settings of the notification service.
+type Config = config.Config
+
+// LoadConfig reads the notification service settings from environment variables.
+func LoadConfig() (*Config, error) {
+	return config.LoadConfig()
+}
+
+// Options replace the remote dependencies of the service, e.g. with in-process ones.
+type Options struct {
+	// Validator validates bearer tokens. Defaults to the auth service at AUTH_SVC_URL.
+	Validator authn.Validator
+	// Bus delivers notification events and receives dead letters. Defaults to the bus
+	// selected by BUS_DRIVER.
+	Bus bus.Bus
+}
+
+// App is a wired notification service.
+type App struct {
+	handler       http.Handler
+	notifSvc      service.NotificationService
+	consumer      messaging.Consumer
+	closeConsumer func()
+	stores        *store.Stores
+	logger        *slog.Logger
+}
+
+// New connects to the database and the message bus and wires the service.
+func New(ctx context.Context, cfg *Config, opts Options, logr *slog.Logger) (*App, error) {
+	tracer := otelkit.New(ServiceName)
+	a := &App{logger: logr}
+
+	// A single, shared database connection pool is injected into the stores. The backend
+	// is selected by the scheme of DB_URL.
+	stores, err := store.Open(cfg.DBConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notification storage: %w", err)
+	}
+	a.stores = stores
+
+	if cfg.DBConfig.MigrateOnStart {
+		n, err := stores.Migrator.Up(ctx)
+		if err != nil {
+			stores.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		logr.Info("Database schema migrated", "applied", n)
+	}
+	dbStore := stores.Notifications
+
+	// Inject the store into the services that need it.
+	healthSvc := service.NewHealthService(dbStore)
+	channelStore := stores.Channels
+
+	// Deliveries are dispatched by channel type; the channel configured by ALERT_CHANNEL
+	// is used for notifications that no routing rule matches.
+	alertClient := &http.Client{Timeout: cfg.AlertConfig.Timeout}
+	delivery := service.NewDispatcher(map[string]service.DeliveryService{
+		model.ChannelTypeLog:       service.NewDeliveryService(logr),
+		model.ChannelTypeWebhook:   service.NewWebhookDelivery(alertClient, logr),
+		model.ChannelTypePagerDuty: service.NewPagerDutyDelivery(cfg.AlertConfig.PagerDuty, alertClient, logr),
+		model.ChannelTypeOpsgenie:  service.NewOpsgenieDelivery(cfg.AlertConfig.Opsgenie, alertClient, logr),
+	})
+	defaultChannel := model.Channel{
+		ID:      model.DefaultChannelID,
+		Name:    "default",
+		Type:    cfg.AlertConfig.Channel,
+		Enabled: true,
+	}
+	channelSvc := service.NewChannelService(channelStore, defaultChannel, logr)
+
+	a.notifSvc = service.NewNotificationService(
+		dbStore,
+		channelSvc,
+		delivery,
+		cfg.WorkerLimit,
+		cfg.WorkerInterval,
+		cfg.RetryConfig,
+		cfg.QueueConfig,
+		logr,
+		tracer,
+	)
+
+	// Create the event consumer of the configured bus, injecting the notification service
+	// through the processor.
+	processor := messaging.NewProcessor(
+		a.notifSvc,
+		cfg.ConsumerConfig.MaxRetries,
+		cfg.ConsumerConfig.RetryBackoff,
+		logr,
+	)
+	if opts.Bus != nil {
+		cc := cfg.ConsumerConfig
+		dlq := messaging.NewBusDeadLetterQueue(opts.Bus, cc.DLQTopic, logr)
+		a.consumer = messaging.NewBusConsumer(opts.Bus, cc.KafkaTopic, cc.KafkaConsumerGroup, processor, dlq, logr)
+		a.closeConsumer = func() {}
+	} else if a.consumer, a.closeConsumer, err = newConsumer(ctx, cfg, processor, logr); err != nil {
+		stores.Close()
+		return nil, fmt.Errorf("failed to create event consumer: %w", err)
+	}
+
+	validator := opts.Validator
+	if validator == nil {
+		validator = authn.NewRemoteValidator(cfg.AppCfg.AuthServiceURL, &http.Client{Timeout: 5 * time.Second})
+	}
+
+	// HTTP health handler, channel API and admin API
+	hHandler := handler.NewHealthHandler(healthSvc)
+	channelHandler := handler.NewChannelHandler(channelSvc, logr, tracer)
+	adminHandler := handler.NewAdminHandler(a.notifSvc, logr, tracer)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", hHandler.HealthCheck)
+	channelHandler.Register(mux, middleware.AuthMiddleware(validator, logr))
+	adminHandler.Register(mux, middleware.AdminMiddleware(cfg.AdminAPIToken, logr))
+	a.handler = mux
+
+	return a, nil
+}
+
+// Migrate runs the migrate subcommand args, e.g. ["up"], against the database of cfg and
+// writes its report to w. See migrate.Run.
+func Migrate(ctx context.Context, cfg *Config, args []string, w io.Writer) error {
+	stores, err := store.Open(cfg.DBConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open notification storage: %w", err)
+	}
+	defer stores.Close()
+	return migrate.Run(ctx, stores.Migrator, args, w)
+}
+
+// Handler returns the HTTP routes of the service.
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// Run starts the notification worker and the event consumer and blocks until ctx is cancelled.
+func (a *App) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := a.notifSvc.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			a.logger.Error("notification worker stopped with error", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := a.consumer.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			a.logger.Error("Event consumer stopped with error", "error", err)
+		}
+	}()
+	wg.Wait()
+}
+
+// Close releases the bus connections and the database. Run must have returned.
+func (a *App) Close() {
+	a.closeConsumer()
+	a.stores.Close()
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/IBM/sarama"
+
+	"github.com/kernelshard/hcaas/pkg/bus/natsbus"
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/kafka"
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
+)
+
+// newConsumer creates the consumer of notification events for the configured bus driver.
+// The returned function releases the connections of the consumer and its dead-letter queue.
+func newConsumer(ctx context.Context, cfg *config.Config, processor *messaging.Processor, logr *slog.Logger) (messaging.Consumer, func(), error) {
+	cc := cfg.ConsumerConfig
+	switch cfg.BusConfig.Driver {
+	case config.BusDriverNATS:
+		b, err := natsbus.Connect(ctx, cfg.BusConfig.NATS.URL, cfg.BusConfig.NATS.Stream, cfg.BusConfig.NATS.SubjectPrefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		dlq := messaging.NewBusDeadLetterQueue(b, cc.DLQTopic, logr)
+		consumer := messaging.NewBusConsumer(b, cc.KafkaTopic, cc.KafkaConsumerGroup, processor, dlq, logr)
+		return consumer, func() { b.Close() }, nil
+	}
+
+	// Setup Kafka consumer group with a shared configuration.
+	saramaCfg := sarama.NewConfig()
+	saramaCfg.Version = sarama.V2_1_0_0
+	saramaCfg.Consumer.Return.Errors = true
+	consumerGroup, err := sarama.NewConsumerGroup(cc.KafkaBrokers, cc.KafkaConsumerGroup, saramaCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Kafka consumer group: %w", err)
+	}
+
+	// Dead letters are published synchronously so an offset is only committed once the
+	// message is stored in the DLQ topic.
+	dlqCfg := sarama.NewConfig()
+	dlqCfg.Version = saramaCfg.Version
+	dlqCfg.Producer.RequiredAcks = sarama.WaitForAll
+	dlqCfg.Producer.Return.Successes = true
+	dlqProducer, err := sarama.NewSyncProducer(cc.KafkaBrokers, dlqCfg)
+	if err != nil {
+		consumerGroup.Close()
+		return nil, nil, fmt.Errorf("failed to create Kafka dead-letter producer: %w", err)
+	}
+	dlq := kafka.NewDeadLetterQueue(dlqProducer, cc.DLQTopic, logr)
+
+	// The consumer closes its consumer group when it stops
+	consumer := kafka.NewKafkaConsumer(cc.KafkaTopic, consumerGroup, processor, dlq, logr)
+	return consumer, func() { dlqProducer.Close() }, nil
+}
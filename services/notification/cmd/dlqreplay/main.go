@@ -0,0 +1,258 @@
+// Command dlqreplay re-publishes the messages in the notification dead-letter topic to the
+// topic they originally came from. It reads the dead-letter topic as the consumer group
+// -group until every partition is caught up and then exits. The offset of a message is
+// committed once it was re-published, so a later run continues after the messages already
+// replayed, and a partition stops at its first failure to be retried by the next run.
+// Replaying is safe to repeat: notifications are deduplicated by event ID, so messages
+// that were already handled are ignored by the consumer.
+//
+//	go run ./cmd/dlqreplay -dlq url_failures.dlq
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/logger"
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
+)
+
+var errMissingTopic = errors.New("message has no original topic header, use -topic")
+
+func main() {
+	brokers := flag.String("brokers", envOr("KAFKA_BROKERS", "localhost:9092"), "comma separated Kafka brokers")
+	dlqTopic := flag.String("dlq", os.Getenv("KAFKA_DLQ_TOPIC"), "dead-letter topic to replay")
+	groupID := flag.String("group", "hcaas-dlq-replay", "consumer group whose offsets track the replayed messages")
+	target := flag.String("topic", "", "topic to publish to (default: the original topic of each message)")
+	idle := flag.Duration("idle", 10*time.Second, "time without messages after which a partition counts as caught up")
+	dryRun := flag.Bool("dry-run", false, "log the messages that would be replayed without publishing them")
+	flag.Parse()
+
+	if *dlqTopic == "" {
+		log.Fatal("a dead-letter topic is required (-dlq or KAFKA_DLQ_TOPIC)")
+	}
+
+	logr := logger.NewLogger()
+
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V2_1_0_0
+	cfg.Consumer.Return.Errors = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Return.Successes = true
+
+	client, err := sarama.NewClient(splitBrokers(*brokers), cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to Kafka: %v", err)
+	}
+	defer client.Close()
+
+	group, err := sarama.NewConsumerGroupFromClient(*groupID, client)
+	if err != nil {
+		log.Fatalf("failed to create consumer group: %v", err)
+	}
+	// Closing the group commits the offsets of the replayed messages
+	defer group.Close()
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		log.Fatalf("failed to create producer: %v", err)
+	}
+	defer producer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	r := &replayer{producer: producer, target: *target, dryRun: *dryRun, idle: *idle, log: logr}
+	if err := r.Run(ctx, group, *dlqTopic); err != nil {
+		logr.Error("Replay failed", slog.Any("error", err))
+		r.failed++
+	}
+
+	logr.Info("Replay finished", slog.Int("replayed", r.replayed), slog.Int("failed", r.failed), slog.Bool("dry_run", *dryRun))
+	if r.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// replayer is the consumer group handler re-publishing dead-lettered messages
+type replayer struct {
+	producer sarama.SyncProducer
+	target   string
+	dryRun   bool
+	idle     time.Duration
+	log      *slog.Logger
+
+	mu               sync.Mutex
+	replayed, failed int
+	// remaining counts the claims of the session that are not caught up yet
+	remaining int
+	// finish ends the session once every claim is caught up
+	finish context.CancelFunc
+}
+
+var _ sarama.ConsumerGroupHandler = (*replayer)(nil)
+
+// Run replays topic as a session of group until each claimed partition is caught up.
+func (r *replayer) Run(ctx context.Context, group sarama.ConsumerGroup, topic string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.finish = cancel
+
+	go func() {
+		for err := range group.Errors() {
+			r.log.Error("Consumer error", slog.Any("error", err))
+		}
+	}()
+
+	if err := group.Consume(ctx, []string{topic}, r); err != nil && !errors.Is(err, sarama.ErrClosedConsumerGroup) {
+		return err
+	}
+	return nil
+}
+
+func (r *replayer) Setup(sess sarama.ConsumerGroupSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remaining = 0
+	for _, partitions := range sess.Claims() {
+		r.remaining += len(partitions)
+	}
+	if r.remaining == 0 {
+		r.finish()
+	}
+	return nil
+}
+
+func (r *replayer) Cleanup(sess sarama.ConsumerGroupSession) error {
+	sess.Commit()
+	return nil
+}
+
+// ConsumeClaim replays the messages of a partition up to its high water mark. It then waits
+// for the other claims, as the session ends as soon as any claim returns.
+func (r *replayer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	r.replayClaim(sess, claim)
+
+	r.mu.Lock()
+	r.remaining--
+	if r.remaining == 0 {
+		r.finish()
+	}
+	r.mu.Unlock()
+
+	<-sess.Context().Done()
+	return nil
+}
+
+// replayClaim replays the messages of claim until it is caught up, idle or a message fails
+func (r *replayer) replayClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) {
+	partition := slog.Int("partition", int(claim.Partition()))
+	timer := time.NewTimer(r.idle)
+	defer timer.Stop()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return
+			}
+			if err := replayMessage(r.producer, msg, r.target, r.dryRun, r.log); err != nil {
+				r.log.Error("Failed to replay message", partition, slog.Int64("offset", msg.Offset), slog.Any("error", err))
+				r.count(0, 1)
+				// Later offsets are not committed, so the next run starts at this message
+				return
+			}
+			r.count(1, 0)
+			if !r.dryRun {
+				sess.MarkMessage(msg, "")
+			}
+			if msg.Offset+1 >= claim.HighWaterMarkOffset() {
+				return
+			}
+			timer.Reset(r.idle)
+		case <-timer.C:
+			r.log.Info("No more messages in partition", partition)
+			return
+		case <-sess.Context().Done():
+			return
+		}
+	}
+}
+
+func (r *replayer) count(replayed, failed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replayed += replayed
+	r.failed += failed
+}
+
+// replayMessage publishes msg back to its original topic without the dead-letter headers
+func replayMessage(producer sarama.SyncProducer, msg *sarama.ConsumerMessage, target string, dryRun bool, logr *slog.Logger) error {
+	out := &sarama.ProducerMessage{
+		Topic: target,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		key := string(h.Key)
+		if key == messaging.HeaderDLQOriginalTopic && out.Topic == "" {
+			out.Topic = string(h.Value)
+		}
+		if messaging.IsDLQHeader(key) {
+			continue
+		}
+		out.Headers = append(out.Headers, *h)
+	}
+	if out.Topic == "" {
+		return errMissingTopic
+	}
+
+	if dryRun {
+		logr.Info("Would replay message", slog.Int64("offset", msg.Offset), slog.String("topic", out.Topic),
+			slog.String("reason", headerValue(msg, messaging.HeaderDLQError)))
+		return nil
+	}
+	_, _, err := producer.SendMessage(out)
+	return err
+}
+
+func headerValue(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func splitBrokers(v string) []string {
+	brokers := strings.Split(v, ",")
+	for i, b := range brokers {
+		brokers[i] = strings.TrimSpace(b)
+	}
+	return brokers
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
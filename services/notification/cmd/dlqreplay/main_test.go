@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/events"
+	"github.com/kernelshard/hcaas/services/notification/internal/kafka/kafkatest"
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
+)
+
+// Test_replayer tests that dead-lettered messages are published to their original topic
+// without the dead-letter headers, and that the offsets of replayed messages are committed.
+// Table Driven Test Pattern used
+func Test_replayer(t *testing.T) {
+	const dlq = "url_failures.dlq"
+	dead := map[string]string{
+		messaging.HeaderDLQOriginalTopic:  "url_failures",
+		messaging.HeaderDLQOriginalOffset: "7",
+		messaging.HeaderDLQError:          "invalid payload",
+		events.HeaderSchemaVersion:        "1",
+	}
+
+	tests := []struct {
+		name          string
+		target        string
+		dryRun        bool
+		failWith      error
+		wantTopic     string
+		wantPublished int
+		wantCommitted int64
+		wantFailed    int
+	}{
+		{name: "replays to the original topic", wantTopic: "url_failures", wantPublished: 2, wantCommitted: 2},
+		{name: "replays to the -topic override", target: "url_failures.retry", wantTopic: "url_failures.retry", wantPublished: 2, wantCommitted: 2},
+		{name: "dry run commits nothing", dryRun: true, wantCommitted: 0},
+		{name: "failed publish is not committed", failWith: errors.New("broker down"), wantCommitted: 0, wantFailed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			group := kafkatest.NewConsumerGroup()
+			group.Produce(dlq, "u1", []byte(`{"url_id":"u1"}`), dead)
+			group.Produce(dlq, "u2", []byte(`{"url_id":"u2"}`), dead)
+			producer := kafkatest.NewSyncProducer()
+			producer.Fail(tt.failWith)
+
+			r := &replayer{producer: producer, target: tt.target, dryRun: tt.dryRun, idle: time.Second,
+				log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			if err := r.Run(ctx, group, dlq); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if ctx.Err() != nil {
+				t.Fatal("Run() did not stop once the partition was caught up")
+			}
+
+			if got := group.Committed(dlq); got != tt.wantCommitted {
+				t.Errorf("committed offset = %d, want %d", got, tt.wantCommitted)
+			}
+			if r.failed != tt.wantFailed {
+				t.Errorf("failed = %d, want %d", r.failed, tt.wantFailed)
+			}
+			published := producer.Messages()
+			if len(published) != tt.wantPublished {
+				t.Fatalf("published %d messages, want %d", len(published), tt.wantPublished)
+			}
+			for i, msg := range published {
+				if msg.Topic != tt.wantTopic {
+					t.Errorf("message %d topic = %q, want %q", i, msg.Topic, tt.wantTopic)
+				}
+				headers := map[string]string{}
+				for _, h := range msg.Headers {
+					headers[string(h.Key)] = string(h.Value)
+				}
+				if len(headers) != 1 || headers[events.HeaderSchemaVersion] != "1" {
+					t.Errorf("message %d headers = %v, want only the schema version", i, headers)
+				}
+				if key, _ := msg.Key.Encode(); string(key) != []string{"u1", "u2"}[i] {
+					t.Errorf("message %d key = %q", i, key)
+				}
+			}
+		})
+	}
+}
@@ -12,27 +12,29 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/IBM/sarama"
-	_ "github.com/lib/pq"
 	"github.com/samims/otelkit"
 
-	"github.com/kernelshard/hcaas/services/notification/internal/config"
-	"github.com/kernelshard/hcaas/services/notification/internal/handler"
-	"github.com/kernelshard/hcaas/services/notification/internal/kafka"
+	"github.com/kernelshard/hcaas/services/notification/app"
 	"github.com/kernelshard/hcaas/services/notification/internal/logger"
-	"github.com/kernelshard/hcaas/services/notification/internal/service"
-	"github.com/kernelshard/hcaas/services/notification/internal/store"
 )
 
 func main() {
 	ctx := context.Background()
 
 	// Load configuration from environment variables and exit on error.
-	cfg, err := config.LoadConfig()
+	cfg, err := app.LoadConfig()
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
+	// "notification migrate up|down [N]|status" manages the database schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(ctx, cfg, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("migration failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize the application logger.
 	logr := logger.NewLogger()
 
@@ -62,88 +64,27 @@ func main() {
 	}()
 
 	// --- Dependency Injection Setup ---
-
-	// The main function is responsible for creating a single, shared database connection pool.
-	db, err := store.ConnectPostgres(cfg.DBConfig)
+	notifApp, err := app.New(ctx, cfg, app.Options{}, logr)
 	if err != nil {
-		logr.Error("failed to create postgres storage with database connection", "error", err)
+		logr.Error("failed to initialize notification service", "error", err)
 		os.Exit(1)
 	}
-	defer db.Close() // Ensure the connection is closed when main exits.
-
-	// Now, inject this single database connection into the services that need it.
-	dbStore, err := store.NewPostgresStorage(db)
-	if err != nil {
-		logr.Error("failed to create postgres storage instance", "error", err)
-		os.Exit(1)
-	}
-
-	// Create tracer
-	tracer := otelkit.New("notification-service")
-
-	// Inject the store into the services that need it.
-	healthSvc := service.NewHealthService(dbStore)
-	delivery := service.NewDeliveryService(logr)
-	notifSvc := service.NewNotificationService(
-		dbStore, // The notification service now also depends on the store.
-		delivery,
-		cfg.WorkerLimit,
-		cfg.WorkerInterval,
-		logr,
-		tracer,
-	)
-
-	// Setup Kafka consumer group with a shared configuration.
-	saramaCfg := sarama.NewConfig()
-	saramaCfg.Version = sarama.V2_1_0_0
-	saramaCfg.Consumer.Return.Errors = true
-	consumerGroup, err := sarama.NewConsumerGroup(
-		cfg.ConsumerConfig.KafkaBrokers,
-		cfg.ConsumerConfig.KafkaConsumerGroup,
-		saramaCfg,
-	)
-	if err != nil {
-		logr.Error("failed to create Kafka consumer group", "error", err)
-		os.Exit(1)
-	}
-
-	// Create Kafka consumer, injecting the notification service as a handler.
-	consumer := kafka.NewKafkaConsumer(
-		cfg.ConsumerConfig.KafkaTopic,
-		consumerGroup,
-		notifSvc,
-		logr,
-	)
-
-	// HTTP health handler and server
-	hHandler := handler.NewHealthHandler(healthSvc)
-	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", hHandler.HealthCheck)
+	defer notifApp.Close()
 
 	hServer := &http.Server{
 		Addr:    ":" + cfg.AppCfg.Port,
-		Handler: mux,
+		Handler: notifApp.Handler(),
 	}
 
 	// Use a WaitGroup to gracefully shut down all goroutines.
 	var wg sync.WaitGroup
+	runCtx, stopWorkers := context.WithCancel(context.Background())
 
-	// Start notification worker in a separate goroutine.
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := notifSvc.Start(context.Background()); err != nil && err != context.Canceled {
-			logr.Error("notification worker stopped with error", "error", err)
-		}
-	}()
-
-	// Start Kafka consumer in a separate goroutine.
+	// Start notification worker and event consumer in a separate goroutine.
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := consumer.Start(context.Background()); err != nil && !errors.Is(err, context.Canceled) {
-			logr.Error("Kafka consumer stopped with error", "error", err)
-		}
+		notifApp.Run(runCtx)
 	}()
 
 	// Start HTTP server in a separate goroutine.
@@ -167,7 +108,8 @@ func main() {
 	defer cancel()
 	hServer.Shutdown(ctx)
 
-	// Wait for all worker goroutines to finish their work.
+	// Stop the workers and wait for all goroutines to finish their work.
+	stopWorkers()
 	wg.Wait()
 	logr.Info("Service shut down gracefully")
 }
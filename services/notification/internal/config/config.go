@@ -13,9 +13,60 @@ type Config struct {
 	WorkerLimit    int
 	WorkerInterval time.Duration
 	ConsumerConfig ConsumerConfig
+	BusConfig      BusConfig
 	DBConfig       DBConfig
 	AppCfg         AppConfig
 	OTLPConfig     OTLPConfig
+	AlertConfig    AlertConfig
+	RetryConfig    RetryConfig
+	QueueConfig    QueueConfig
+	AdminAPIToken  string
+}
+
+// QueueConfig controls how workers claim pending notifications.
+type QueueConfig struct {
+	// WorkerID identifies this replica in the lease of claimed notifications.
+	WorkerID string
+	// BatchSize bounds the number of notifications claimed per worker run.
+	BatchSize int
+	// LeaseDuration is how long a claim is held before other workers may reclaim it.
+	// It must comfortably exceed the time needed to deliver a batch.
+	LeaseDuration time.Duration
+}
+
+// RetryConfig controls the exponential backoff of failed deliveries.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Supported alerting channels.
+const (
+	AlertChannelLog       = "log"
+	AlertChannelPagerDuty = "pagerduty"
+	AlertChannelOpsgenie  = "opsgenie"
+)
+
+// AlertConfig selects the default channel notifications are delivered through
+// when no routing rule of the URL owner matches.
+type AlertConfig struct {
+	Channel   string
+	Timeout   time.Duration
+	PagerDuty PagerDutyConfig
+	Opsgenie  OpsgenieConfig
+}
+
+// PagerDutyConfig holds the PagerDuty Events API v2 settings.
+type PagerDutyConfig struct {
+	RoutingKey string
+	EventsURL  string
+}
+
+// OpsgenieConfig holds the Opsgenie Alert API settings.
+type OpsgenieConfig struct {
+	APIKey string
+	APIURL string
 }
 
 // OTLPConfig holds OpenTelemetry tracing configuration.
@@ -26,7 +77,8 @@ type OTLPConfig struct {
 }
 
 type AppConfig struct {
-	Port string
+	Port           string
+	AuthServiceURL string
 }
 
 // ConsumerConfig holds all the Kafka consumer settings.
@@ -34,13 +86,44 @@ type ConsumerConfig struct {
 	KafkaBrokers       []string
 	KafkaTopic         string
 	KafkaConsumerGroup string
+	// DLQTopic receives messages that cannot be decoded or keep failing.
+	DLQTopic string
+	// MaxRetries is how often a failing message is retried before it is dead-lettered.
+	MaxRetries   int
+	RetryBackoff time.Duration
 }
 
-// DBConfig holds the Postgres connection settings.
+// Supported message buses.
+const (
+	BusDriverKafka = "kafka"
+	BusDriverNATS  = "nats"
+	// BusDriverMemory is rejected: the in-memory bus only works inside the all-in-one
+	// hcaas binary, which hands it to the service directly.
+	BusDriverMemory = "memory"
+)
+
+// BusConfig selects the message bus notification events are consumed from. The topic,
+// consumer group and dead-letter topic of ConsumerConfig apply to every driver.
+type BusConfig struct {
+	// Driver is kafka or nats
+	Driver string
+	NATS   NATSConfig
+}
+
+// NATSConfig holds the NATS JetStream settings.
+type NATSConfig struct {
+	URL           string
+	Stream        string
+	SubjectPrefix string
+}
+
+// DBConfig holds the database connection settings.
 type DBConfig struct {
 	URL         string
 	MaxOpenConn int
 	ConnMaxIdle time.Duration
+	// MigrateOnStart applies pending schema migrations when the service starts
+	MigrateOnStart bool
 }
 
 // LoadConfig reads environment variables and returns a Config or an error.
@@ -86,6 +169,35 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	// Queue settings
+	cfg.QueueConfig.WorkerID = getString("WORKER_ID", defaultWorkerID())
+	if cfg.QueueConfig.BatchSize, err = getInt("BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.QueueConfig.BatchSize < 1 {
+		return nil, fmt.Errorf("invalid BATCH_SIZE: must be at least 1")
+	}
+	if cfg.QueueConfig.LeaseDuration, err = getDuration("LEASE_DURATION", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.QueueConfig.LeaseDuration <= 0 {
+		return nil, fmt.Errorf("invalid LEASE_DURATION: must be positive")
+	}
+
+	// Retry settings
+	if cfg.RetryConfig.MaxAttempts, err = getInt("RETRY_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.RetryConfig.MaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid RETRY_MAX_ATTEMPTS: must be at least 1")
+	}
+	if cfg.RetryConfig.BaseDelay, err = getDuration("RETRY_BASE_DELAY", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RetryConfig.MaxDelay, err = getDuration("RETRY_MAX_DELAY", 1*time.Hour); err != nil {
+		return nil, err
+	}
+
 	// Kafka settings
 	cfg.ConsumerConfig.KafkaBrokers = strings.Split(getString("KAFKA_BROKERS", "localhost:9092"), ",")
 	for i, b := range cfg.ConsumerConfig.KafkaBrokers {
@@ -93,6 +205,29 @@ func LoadConfig() (*Config, error) {
 	}
 	cfg.ConsumerConfig.KafkaTopic = getString("KAFKA_TOPIC", "notifications")
 	cfg.ConsumerConfig.KafkaConsumerGroup = getString("KAFKA_CONSUMER_GROUP", "notification-workers")
+	cfg.ConsumerConfig.DLQTopic = getString("KAFKA_DLQ_TOPIC", cfg.ConsumerConfig.KafkaTopic+".dlq")
+	if cfg.ConsumerConfig.MaxRetries, err = getInt("KAFKA_MAX_RETRIES", 3); err != nil {
+		return nil, err
+	}
+	if cfg.ConsumerConfig.MaxRetries < 0 {
+		return nil, fmt.Errorf("invalid KAFKA_MAX_RETRIES: must not be negative")
+	}
+	if cfg.ConsumerConfig.RetryBackoff, err = getDuration("KAFKA_RETRY_BACKOFF", 1*time.Second); err != nil {
+		return nil, err
+	}
+
+	// Message bus settings
+	cfg.BusConfig.Driver = strings.ToLower(getString("BUS_DRIVER", BusDriverKafka))
+	switch cfg.BusConfig.Driver {
+	case BusDriverKafka, BusDriverNATS:
+	case BusDriverMemory:
+		return nil, fmt.Errorf("BUS_DRIVER=%s is only supported by the all-in-one hcaas binary", BusDriverMemory)
+	default:
+		return nil, fmt.Errorf("invalid BUS_DRIVER: %q", cfg.BusConfig.Driver)
+	}
+	cfg.BusConfig.NATS.URL = getString("NATS_URL", "nats://localhost:4222")
+	cfg.BusConfig.NATS.Stream = getString("NATS_STREAM", "HCAAS")
+	cfg.BusConfig.NATS.SubjectPrefix = getString("NATS_SUBJECT_PREFIX", "hcaas")
 
 	// DB settings
 	cfg.DBConfig.URL = os.Getenv("DB_URL")
@@ -105,12 +240,40 @@ func LoadConfig() (*Config, error) {
 	if cfg.DBConfig.ConnMaxIdle, err = getDuration("DB_CONN_MAX_IDLE", 5*time.Minute); err != nil {
 		return nil, err
 	}
+	cfg.DBConfig.MigrateOnStart = getString("DB_MIGRATE_ON_START", "true") == "true"
 
 	port, err := getInt("PORT", 8083)
 	if err != nil {
 		return nil, err
 	}
 	cfg.AppCfg.Port = strconv.Itoa(port)
+	cfg.AppCfg.AuthServiceURL = getString("AUTH_SVC_URL", "http://hcaas_auth:8081/")
+	// Admin endpoints are disabled unless a token is configured
+	cfg.AdminAPIToken = os.Getenv("ADMIN_API_TOKEN")
+
+	// Alerting settings
+	cfg.AlertConfig.Channel = strings.ToLower(getString("ALERT_CHANNEL", AlertChannelLog))
+	if cfg.AlertConfig.Timeout, err = getDuration("ALERT_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.AlertConfig.PagerDuty.RoutingKey = os.Getenv("PAGERDUTY_ROUTING_KEY")
+	cfg.AlertConfig.PagerDuty.EventsURL = getString("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue")
+	cfg.AlertConfig.Opsgenie.APIKey = os.Getenv("OPSGENIE_API_KEY")
+	cfg.AlertConfig.Opsgenie.APIURL = strings.TrimSuffix(getString("OPSGENIE_API_URL", "https://api.opsgenie.com"), "/")
+
+	switch cfg.AlertConfig.Channel {
+	case AlertChannelLog:
+	case AlertChannelPagerDuty:
+		if cfg.AlertConfig.PagerDuty.RoutingKey == "" {
+			return nil, fmt.Errorf("PAGERDUTY_ROUTING_KEY is required when ALERT_CHANNEL=%s", AlertChannelPagerDuty)
+		}
+	case AlertChannelOpsgenie:
+		if cfg.AlertConfig.Opsgenie.APIKey == "" {
+			return nil, fmt.Errorf("OPSGENIE_API_KEY is required when ALERT_CHANNEL=%s", AlertChannelOpsgenie)
+		}
+	default:
+		return nil, fmt.Errorf("invalid ALERT_CHANNEL: %q", cfg.AlertConfig.Channel)
+	}
 
 	// OTLP tracing configuration - use standard OpenTelemetry environment variables
 	cfg.OTLPConfig.Endpoint = getString("OTEL_EXPORTER_OTLP_ENDPOINT", "hcaas_jaeger_all_in_one:4317")
@@ -119,3 +282,12 @@ func LoadConfig() (*Config, error) {
 
 	return cfg, nil
 }
+
+// defaultWorkerID derives a worker ID unique per process from the hostname and PID
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "notification"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
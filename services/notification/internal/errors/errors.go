@@ -1 +1,15 @@
+// Package errors holds the errors of the notification service. They carry problem codes, so
+// handlers write them with problem.Write.
 package errors
+
+import "github.com/kernelshard/hcaas/pkg/problem"
+
+var (
+	ErrNotFound     = problem.New(problem.CodeNotFound, "not found")
+	ErrInvalidInput = problem.New(problem.CodeInvalidInput, "invalid input")
+	ErrUnauthorized = problem.New(problem.CodeUnauthorized, "unauthorized")
+	// ErrDuplicate is returned when an event was already stored
+	ErrDuplicate = problem.New(problem.CodeConflict, "duplicate")
+	// ErrLeaseLost is returned when a worker reports on a notification whose lease it no longer holds
+	ErrLeaseLost = problem.New(problem.CodeConflict, "lease lost")
+)
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
+	"github.com/kernelshard/hcaas/services/notification/internal/service"
+)
+
+const (
+	defaultDeadPageSize = 50
+	maxDeadPageSize     = 500
+)
+
+// AdminHandler exposes operator endpoints to inspect and requeue dead notifications.
+type AdminHandler struct {
+	svc    service.NotificationService
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+}
+
+func NewAdminHandler(svc service.NotificationService, logger *slog.Logger, tracer *otelkit.Tracer) *AdminHandler {
+	return &AdminHandler{svc: svc, logger: logger, tracer: tracer}
+}
+
+// Register mounts the admin routes on mux behind admin
+func (h *AdminHandler) Register(mux *http.ServeMux, admin func(http.Handler) http.Handler) {
+	mux.Handle("GET /admin/notifications/dead", admin(http.HandlerFunc(h.ListDead)))
+	mux.Handle("POST /admin/notifications/{id}/requeue", admin(http.HandlerFunc(h.Requeue)))
+}
+
+// ListDead returns dead notifications, paginated with the limit and offset query parameters
+func (h *AdminHandler) ListDead(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "AdminHandler.ListDead")
+	defer span.End()
+
+	limit, err := queryInt(r, "limit", defaultDeadPageSize)
+	if err != nil || limit <= 0 || limit > maxDeadPageSize {
+		problem.Respond(w, problem.CodeInvalidInput, "invalid limit")
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		problem.Respond(w, problem.CodeInvalidInput, "invalid offset")
+		return
+	}
+
+	notifs, err := h.svc.ListDead(ctx, limit, offset)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		h.logger.Error("Failed to list dead notifications", slog.Any("error", err))
+		problem.Write(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, notifs)
+}
+
+// Requeue moves a dead notification back to pending
+func (h *AdminHandler) Requeue(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "AdminHandler.Requeue")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.Requeue(ctx, id); err != nil {
+		otelkit.RecordError(span, err)
+		if errors.Is(err, appErr.ErrNotFound) {
+			problem.Respond(w, problem.CodeNotFound, "dead notification not found")
+			return
+		}
+		h.logger.Error("Failed to requeue notification", slog.Int("id", id), slog.Any("error", err))
+		problem.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// queryInt parses an optional integer query parameter
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
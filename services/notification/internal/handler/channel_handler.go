@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
+	"github.com/kernelshard/hcaas/services/notification/internal/middleware"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/service"
+)
+
+// ChannelHandler exposes CRUD endpoints for the notification channels and
+// routing rules of the authenticated user.
+type ChannelHandler struct {
+	svc    service.ChannelService
+	logger *slog.Logger
+	tracer *otelkit.Tracer
+}
+
+func NewChannelHandler(svc service.ChannelService, logger *slog.Logger, tracer *otelkit.Tracer) *ChannelHandler {
+	return &ChannelHandler{svc: svc, logger: logger, tracer: tracer}
+}
+
+// Register mounts the channel and routing rule routes on mux behind auth
+func (h *ChannelHandler) Register(mux *http.ServeMux, auth func(http.Handler) http.Handler) {
+	mux.Handle("GET /channels", auth(http.HandlerFunc(h.ListChannels)))
+	mux.Handle("POST /channels", auth(http.HandlerFunc(h.CreateChannel)))
+	mux.Handle("GET /channels/{id}", auth(http.HandlerFunc(h.GetChannel)))
+	mux.Handle("PUT /channels/{id}", auth(http.HandlerFunc(h.UpdateChannel)))
+	mux.Handle("DELETE /channels/{id}", auth(http.HandlerFunc(h.DeleteChannel)))
+
+	mux.Handle("GET /routing-rules", auth(http.HandlerFunc(h.ListRules)))
+	mux.Handle("POST /routing-rules", auth(http.HandlerFunc(h.CreateRule)))
+	mux.Handle("GET /routing-rules/{id}", auth(http.HandlerFunc(h.GetRule)))
+	mux.Handle("PUT /routing-rules/{id}", auth(http.HandlerFunc(h.UpdateRule)))
+	mux.Handle("DELETE /routing-rules/{id}", auth(http.HandlerFunc(h.DeleteRule)))
+}
+
+func (h *ChannelHandler) ListChannels(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.ListChannels")
+	defer span.End()
+
+	userID, _ := middleware.UserIDFromContext(ctx)
+	channels, err := h.svc.ListChannels(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	for i := range channels {
+		channels[i] = channels[i].Redacted()
+	}
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func (h *ChannelHandler) CreateChannel(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.CreateChannel")
+	defer span.End()
+
+	var ch model.Channel
+	if err := json.NewDecoder(r.Body).Decode(&ch); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+	ch.UserID, _ = middleware.UserIDFromContext(ctx)
+
+	if err := h.svc.CreateChannel(ctx, &ch); err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, ch.Redacted())
+}
+
+func (h *ChannelHandler) GetChannel(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.GetChannel")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.UserIDFromContext(ctx)
+	ch, err := h.svc.GetChannel(ctx, userID, id)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ch.Redacted())
+}
+
+func (h *ChannelHandler) UpdateChannel(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.UpdateChannel")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var ch model.Channel
+	if err := json.NewDecoder(r.Body).Decode(&ch); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+	ch.ID = id
+	ch.UserID, _ = middleware.UserIDFromContext(ctx)
+
+	if err := h.svc.UpdateChannel(ctx, &ch); err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ch.Redacted())
+}
+
+func (h *ChannelHandler) DeleteChannel(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.DeleteChannel")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.UserIDFromContext(ctx)
+	if err := h.svc.DeleteChannel(ctx, userID, id); err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ChannelHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.ListRules")
+	defer span.End()
+
+	userID, _ := middleware.UserIDFromContext(ctx)
+	rules, err := h.svc.ListRules(ctx, userID)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (h *ChannelHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.CreateRule")
+	defer span.End()
+
+	var rule model.RoutingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+	rule.UserID, _ = middleware.UserIDFromContext(ctx)
+
+	if err := h.svc.CreateRule(ctx, &rule); err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *ChannelHandler) GetRule(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.GetRule")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.UserIDFromContext(ctx)
+	rule, err := h.svc.GetRule(ctx, userID, id)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (h *ChannelHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.UpdateRule")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var rule model.RoutingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		otelkit.RecordError(span, err)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
+		return
+	}
+	rule.ID = id
+	rule.UserID, _ = middleware.UserIDFromContext(ctx)
+
+	if err := h.svc.UpdateRule(ctx, &rule); err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (h *ChannelHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "ChannelHandler.DeleteRule")
+	defer span.End()
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.UserIDFromContext(ctx)
+	if err := h.svc.DeleteRule(ctx, userID, id); err != nil {
+		otelkit.RecordError(span, err)
+		h.respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondError writes service errors as problem details, logging unexpected ones
+func (h *ChannelHandler) respondError(w http.ResponseWriter, err error) {
+	if !errors.Is(err, appErr.ErrNotFound) && !errors.Is(err, appErr.ErrInvalidInput) {
+		h.logger.Error("Channel request failed", slog.Any("error", err))
+	}
+	problem.Write(w, err)
+}
+
+// pathID parses the {id} path value, writing a 400 response when it is invalid
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		problem.Respond(w, problem.CodeInvalidInput, "invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/kernelshard/hcaas/pkg/problem"
 	"github.com/kernelshard/hcaas/services/notification/internal/model"
 	"github.com/kernelshard/hcaas/services/notification/internal/service"
 	"github.com/samims/otelkit"
@@ -25,14 +26,14 @@ func (h *NotificationHandler) Notify(w http.ResponseWriter, r *http.Request) {
 	var notification model.Notification
 	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
 		otelkit.RecordError(span, err)
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid payload")
 		return
 	}
 
 	err := h.service.Send(ctx, &notification)
 	if err != nil {
 		otelkit.RecordError(span, err)
-		http.Error(w, "failed to send notification", http.StatusInternalServerError)
+		problem.Write(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
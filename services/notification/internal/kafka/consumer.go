@@ -2,38 +2,42 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/IBM/sarama"
 
-	"github.com/kernelshard/hcaas/services/notification/internal/model"
-	"github.com/kernelshard/hcaas/services/notification/internal/service"
+	"github.com/kernelshard/hcaas/pkg/bus"
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
 )
 
 // Consumer is responsible for handling Kafka message consumption from a topic using a consumer group.
 type Consumer struct {
-	topic           string
-	notificationSvc service.NotificationService
-	consumerGroup   sarama.ConsumerGroup
-	log             *slog.Logger
+	topic         string
+	consumerGroup sarama.ConsumerGroup
+	processor     *messaging.Processor
+	dlq           DeadLetterQueue
+	log           *slog.Logger
 }
 
 // NewKafkaConsumer constructs a new Kafka Consumer.
-// It receives its consumer group via dependency injection.
+// It receives its consumer group via dependency injection. Messages the processor gives up on
+// are moved to dlq.
 func NewKafkaConsumer(
 	topic string,
 	consumerGroup sarama.ConsumerGroup,
-	notificationSvc service.NotificationService,
+	processor *messaging.Processor,
+	dlq DeadLetterQueue,
 	log *slog.Logger,
 ) *Consumer {
 	return &Consumer{
-		topic:           topic,
-		consumerGroup:   consumerGroup,
-		notificationSvc: notificationSvc,
-		log:             log,
+		topic:         topic,
+		consumerGroup: consumerGroup,
+		processor:     processor,
+		dlq:           dlq,
+		log:           log,
 	}
 }
 
@@ -95,6 +99,8 @@ func (c *Consumer) Cleanup(_ sarama.ConsumerGroupSession) error {
 
 // ConsumeClaim is where the actual message consumption and processing happens.
 // Kafka calls this method for each assigned partition.
+// Every message is either handled or dead-lettered before its offset is marked, so a poison
+// message never blocks the partition and a failing one is never silently skipped.
 func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 
 	// fetches message & send to business logic
@@ -105,21 +111,17 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 			slog.Int64("offset", message.Offset),
 		)
 
-		// Parse the message
-		var notif model.Notification
-		if err := json.Unmarshal(message.Value, &notif); err != nil {
-			c.log.Error("Failed to decode message", slog.Any("error", err))
-			// skip the gibberish messages
-			session.MarkMessage(message, "")
-			continue
-		}
-
-		/*
-		 NOTE: This is the core business logic call
-		*/
-		if err := c.notificationSvc.Send(session.Context(), &notif); err != nil {
-			c.log.Error("Notification handling failed", slog.Any("error", err))
-			continue
+		err := c.processor.Process(session.Context(), toBusMessage(message))
+		if err != nil {
+			// The session ended while retrying; the message is redelivered to the next owner
+			if session.Context().Err() != nil {
+				return nil
+			}
+			if dlqErr := c.dlq.Publish(message, err); dlqErr != nil {
+				// Leave the offset uncommitted so the message is consumed again
+				c.log.Error("Failed to dead-letter message", slog.Any("error", dlqErr))
+				return dlqErr
+			}
 		}
 
 		// Mark the message as processed (committed offset)
@@ -127,3 +129,21 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 	}
 	return nil
 }
+
+// toBusMessage converts a consumed Kafka message to the bus representation used by the processor.
+// Its ID is the position of the message in the log, which is stable across redeliveries.
+func toBusMessage(message *sarama.ConsumerMessage) bus.Message {
+	headers := make(map[string]string, len(message.Headers))
+	for _, h := range message.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	return bus.Message{
+		Topic:   message.Topic,
+		Key:     string(message.Key),
+		Value:   message.Value,
+		Headers: headers,
+		ID:      fmt.Sprintf("kafka:%s:%d:%d", message.Topic, message.Partition, message.Offset),
+	}
+}
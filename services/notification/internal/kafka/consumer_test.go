@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/events"
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/kafka/kafkatest"
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/service"
+	"github.com/kernelshard/hcaas/services/notification/internal/store"
+)
+
+// TestConsumer_ConsumeClaim tests that every consumed message is either queued as a
+// notification or dead-lettered before its offset is committed.
+// Table Driven Test Pattern used
+func TestConsumer_ConsumeClaim(t *testing.T) {
+	const topic = "notifications"
+	valid := `{"event_id":"e1","url_id":"u1","user_id":"alice","type":"url_unhealthy","severity":"critical","created_at":"2025-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name       string
+		value      string
+		version    string
+		wantQueued int
+		wantDead   int
+	}{
+		{name: "valid event", value: valid, version: "1", wantQueued: 1},
+		{name: "undecodable payload", value: "{not json", version: "1", wantDead: 1},
+		{name: "unsupported schema version", value: valid, version: "99", wantDead: 1},
+		{name: "invalid event", value: `{"url_id":""}`, version: "1", wantDead: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			notifStore := store.NewMemoryStorage()
+			channels := service.NewChannelService(store.NewMemoryChannelStorage(), model.Channel{Type: model.ChannelTypeLog}, log)
+			svc := service.NewNotificationService(notifStore, channels, service.NewDeliveryService(log), 1, time.Second,
+				config.RetryConfig{MaxAttempts: 1}, config.QueueConfig{WorkerID: "test", BatchSize: 10, LeaseDuration: time.Minute},
+				log, otelkit.New("test"))
+
+			group := kafkatest.NewConsumerGroup()
+			dlqProducer := kafkatest.NewSyncProducer()
+			consumer := NewKafkaConsumer(topic, group, messaging.NewProcessor(svc, 0, time.Millisecond, log),
+				NewDeadLetterQueue(dlqProducer, topic+".dlq", log), log)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				consumer.Start(ctx)
+			}()
+
+			group.Produce(topic, "u1", []byte(tt.value), map[string]string{events.HeaderSchemaVersion: tt.version})
+			for group.Committed(topic) < 1 {
+				if ctx.Err() != nil {
+					t.Fatal("message offset was not committed")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			queued, err := notifStore.ClaimPending(context.Background(), "test", 10, time.Minute)
+			if err != nil {
+				t.Fatalf("ClaimPending() error = %v", err)
+			}
+			if len(queued) != tt.wantQueued {
+				t.Errorf("queued %d notifications, want %d", len(queued), tt.wantQueued)
+			}
+
+			dead := dlqProducer.Messages()
+			if len(dead) != tt.wantDead {
+				t.Fatalf("dead-lettered %d messages, want %d", len(dead), tt.wantDead)
+			}
+			if tt.wantDead > 0 {
+				value, _ := dead[0].Value.Encode()
+				if string(value) != tt.value {
+					t.Errorf("dead letter value = %q, want %q", value, tt.value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/messaging"
+)
+
+// DeadLetterQueue parks messages the consumer gives up on so they can be inspected and replayed.
+type DeadLetterQueue interface {
+	Publish(msg *sarama.ConsumerMessage, reason error) error
+}
+
+type deadLetterQueue struct {
+	producer sarama.SyncProducer
+	topic    string
+	log      *slog.Logger
+}
+
+// NewDeadLetterQueue publishes dead letters to topic. The producer must be synchronous so
+// the consumer only commits an offset once the message is safely stored in the DLQ.
+func NewDeadLetterQueue(producer sarama.SyncProducer, topic string, log *slog.Logger) DeadLetterQueue {
+	return &deadLetterQueue{producer: producer, topic: topic, log: log}
+}
+
+// Publish copies msg to the DLQ topic with its key, value and headers, adding the
+// origin of the message and the reason it was dead-lettered.
+func (q *deadLetterQueue) Publish(msg *sarama.ConsumerMessage, reason error) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+5)
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(messaging.HeaderDLQOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(messaging.HeaderDLQOriginalPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(messaging.HeaderDLQOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(messaging.HeaderDLQError), Value: []byte(reason.Error())},
+		sarama.RecordHeader{Key: []byte(messaging.HeaderDLQFailedAt), Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	dl := &sarama.ProducerMessage{
+		Topic:   q.topic,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		dl.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	partition, offset, err := q.producer.SendMessage(dl)
+	if err != nil {
+		return fmt.Errorf("failed to publish to dead-letter topic %s: %w", q.topic, err)
+	}
+	q.log.Warn("Message moved to dead-letter topic",
+		slog.String("topic", msg.Topic),
+		slog.Int("partition", int(msg.Partition)),
+		slog.Int64("offset", msg.Offset),
+		slog.String("dlq_topic", q.topic),
+		slog.Int("dlq_partition", int(partition)),
+		slog.Int64("dlq_offset", offset),
+		slog.String("reason", reason.Error()),
+	)
+	return nil
+}
@@ -0,0 +1,342 @@
+// Package kafkatest provides in-process fakes of the sarama clients used by the notification
+// service: a consumer group reading from an in-memory log and a recording sync producer.
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// errTransactionsUnsupported is returned by the transactional methods of the fakes
+var errTransactionsUnsupported = errors.New("kafkatest: transactions are not supported")
+
+// ConsumerGroup is a sarama.ConsumerGroup with a single member consuming partition 0 of each
+// topic from an in-memory log. A session starts at the committed offset of each topic, so
+// messages whose offset was not marked in an earlier session are delivered again, like after
+// a rebalance.
+type ConsumerGroup struct {
+	errors chan error
+
+	mu        sync.Mutex
+	logs      map[string][]*sarama.ConsumerMessage
+	committed map[string]int64
+	marked    []*sarama.ConsumerMessage
+	// produced is closed and replaced whenever a message is appended to a log
+	produced chan struct{}
+	closed   bool
+}
+
+// NewConsumerGroup returns an empty ConsumerGroup.
+func NewConsumerGroup() *ConsumerGroup {
+	return &ConsumerGroup{
+		errors:    make(chan error),
+		logs:      map[string][]*sarama.ConsumerMessage{},
+		committed: map[string]int64{},
+		produced:  make(chan struct{}),
+	}
+}
+
+// Produce appends a message to the log of topic and returns it.
+func (g *ConsumerGroup) Produce(topic, key string, value []byte, headers map[string]string) *sarama.ConsumerMessage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	msg := &sarama.ConsumerMessage{
+		Topic:  topic,
+		Offset: int64(len(g.logs[topic])),
+		Value:  value,
+	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	g.logs[topic] = append(g.logs[topic], msg)
+
+	close(g.produced)
+	g.produced = make(chan struct{})
+	return msg
+}
+
+// Marked returns the messages marked as consumed in the order they were marked.
+func (g *ConsumerGroup) Marked() []*sarama.ConsumerMessage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*sarama.ConsumerMessage(nil), g.marked...)
+}
+
+// Committed returns the offset of the next message consumed from topic.
+func (g *ConsumerGroup) Committed(topic string) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.committed[topic]
+}
+
+// Consume runs a session claiming topics until ctx is cancelled or a claim handler fails.
+func (g *ConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	g.mu.Lock()
+	closed := g.closed
+	g.mu.Unlock()
+	if closed {
+		return sarama.ErrClosedConsumerGroup
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sess := &session{group: g, ctx: ctx, claims: map[string][]int32{}}
+	for _, topic := range topics {
+		sess.claims[topic] = []int32{0}
+	}
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(topics))
+	for _, topic := range topics {
+		c := &claim{group: g, topic: topic, messages: make(chan *sarama.ConsumerMessage)}
+		claimCtx, stopClaim := context.WithCancel(ctx)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			g.feed(claimCtx, c)
+		}()
+		go func() {
+			defer wg.Done()
+			// A failed claim ends the session of all claims, as a rebalance would
+			if err := handler.ConsumeClaim(sess, c); err != nil {
+				errs <- err
+				cancel()
+			}
+			// Unmarked messages the feeder still hands out are delivered again next session
+			stopClaim()
+			for range c.messages {
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	cleanupErr := handler.Cleanup(sess)
+	if err, ok := <-errs; ok {
+		return err
+	}
+	return cleanupErr
+}
+
+// feed sends the messages of c.topic from the committed offset until ctx is done
+func (g *ConsumerGroup) feed(ctx context.Context, c *claim) {
+	defer close(c.messages)
+
+	g.mu.Lock()
+	next := g.committed[c.topic]
+	g.mu.Unlock()
+
+	for {
+		g.mu.Lock()
+		log, produced := g.logs[c.topic], g.produced
+		g.mu.Unlock()
+
+		if next < int64(len(log)) {
+			select {
+			case c.messages <- log[next]:
+				next++
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		select {
+		case <-produced:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// mark commits the offset following msg
+func (g *ConsumerGroup) mark(topic string, offset int64, msg *sarama.ConsumerMessage) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if offset+1 > g.committed[topic] {
+		g.committed[topic] = offset + 1
+	}
+	if msg != nil {
+		g.marked = append(g.marked, msg)
+	}
+}
+
+func (g *ConsumerGroup) Errors() <-chan error {
+	return g.errors
+}
+
+func (g *ConsumerGroup) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	return nil
+}
+
+func (g *ConsumerGroup) Pause(map[string][]int32) {}
+
+func (g *ConsumerGroup) Resume(map[string][]int32) {}
+
+func (g *ConsumerGroup) PauseAll() {}
+
+func (g *ConsumerGroup) ResumeAll() {}
+
+var _ sarama.ConsumerGroup = (*ConsumerGroup)(nil)
+
+type session struct {
+	group  *ConsumerGroup
+	ctx    context.Context
+	claims map[string][]int32
+}
+
+func (s *session) Claims() map[string][]int32 {
+	return s.claims
+}
+
+func (s *session) MemberID() string {
+	return "kafkatest"
+}
+
+func (s *session) GenerationID() int32 {
+	return 1
+}
+
+func (s *session) MarkOffset(topic string, _ int32, offset int64, _ string) {
+	// Like sarama, the marked offset is the next one to consume
+	s.group.mark(topic, offset-1, nil)
+}
+
+func (s *session) Commit() {}
+
+func (s *session) ResetOffset(topic string, _ int32, offset int64, _ string) {
+	s.group.mu.Lock()
+	defer s.group.mu.Unlock()
+	s.group.committed[topic] = offset
+}
+
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.group.mark(msg.Topic, msg.Offset, msg)
+}
+
+func (s *session) Context() context.Context {
+	return s.ctx
+}
+
+type claim struct {
+	group    *ConsumerGroup
+	topic    string
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *claim) Topic() string {
+	return c.topic
+}
+
+func (c *claim) Partition() int32 {
+	return 0
+}
+
+func (c *claim) InitialOffset() int64 {
+	return sarama.OffsetOldest
+}
+
+// HighWaterMarkOffset returns the offset the next message produced to the topic gets.
+func (c *claim) HighWaterMarkOffset() int64 {
+	c.group.mu.Lock()
+	defer c.group.mu.Unlock()
+	return int64(len(c.group.logs[c.topic]))
+}
+
+func (c *claim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// SyncProducer is a sarama.SyncProducer that records the messages it sends, or rejects them
+// while a failure is set with Fail.
+type SyncProducer struct {
+	mu       sync.Mutex
+	messages []*sarama.ProducerMessage
+	fail     error
+}
+
+// NewSyncProducer returns an empty SyncProducer.
+func NewSyncProducer() *SyncProducer {
+	return &SyncProducer{}
+}
+
+// Fail makes the producer reject every following message with err until it is called with nil.
+func (p *SyncProducer) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail = err
+}
+
+// Messages returns the sent messages in the order they were sent.
+func (p *SyncProducer) Messages() []*sarama.ProducerMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*sarama.ProducerMessage(nil), p.messages...)
+}
+
+func (p *SyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		return -1, -1, p.fail
+	}
+	msg.Partition, msg.Offset = 0, int64(len(p.messages))
+	p.messages = append(p.messages, msg)
+	return msg.Partition, msg.Offset, nil
+}
+
+func (p *SyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	for _, msg := range msgs {
+		if _, _, err := p.SendMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *SyncProducer) Close() error {
+	return nil
+}
+
+func (p *SyncProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return sarama.ProducerTxnFlagReady
+}
+
+func (p *SyncProducer) IsTransactional() bool {
+	return false
+}
+
+func (p *SyncProducer) BeginTxn() error {
+	return errTransactionsUnsupported
+}
+
+func (p *SyncProducer) CommitTxn() error {
+	return errTransactionsUnsupported
+}
+
+func (p *SyncProducer) AbortTxn() error {
+	return errTransactionsUnsupported
+}
+
+func (p *SyncProducer) AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata, string) error {
+	return errTransactionsUnsupported
+}
+
+func (p *SyncProducer) AddMessageToTxn(*sarama.ConsumerMessage, string, *string) error {
+	return errTransactionsUnsupported
+}
+
+var _ sarama.SyncProducer = (*SyncProducer)(nil)
@@ -0,0 +1,60 @@
+package messaging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+)
+
+// busConsumer consumes notification events from a generic bus such as NATS JetStream
+// or the in-memory bus.
+type busConsumer struct {
+	subscriber bus.Subscriber
+	topic      string
+	group      string
+	processor  *Processor
+	dlq        *BusDeadLetterQueue
+	log        *slog.Logger
+}
+
+// NewBusConsumer creates a consumer of topic as a member of group. Messages the processor
+// gives up on are moved to dlq and acknowledged.
+func NewBusConsumer(
+	subscriber bus.Subscriber,
+	topic, group string,
+	processor *Processor,
+	dlq *BusDeadLetterQueue,
+	log *slog.Logger,
+) Consumer {
+	return &busConsumer{
+		subscriber: subscriber,
+		topic:      topic,
+		group:      group,
+		processor:  processor,
+		dlq:        dlq,
+		log:        log,
+	}
+}
+
+func (c *busConsumer) Start(ctx context.Context) error {
+	c.log.Info("Bus consumer started", slog.String("topic", c.topic), slog.String("group", c.group))
+	return c.subscriber.Subscribe(ctx, c.topic, c.group, c.handle)
+}
+
+// handle acknowledges a message once it is processed or dead-lettered
+func (c *busConsumer) handle(ctx context.Context, msg bus.Message) error {
+	err := c.processor.Process(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	// Shutting down while retrying; leave the message for redelivery
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if dlqErr := c.dlq.Publish(ctx, msg, err); dlqErr != nil {
+		c.log.Error("Failed to dead-letter message", slog.Any("error", dlqErr))
+		return dlqErr
+	}
+	return nil
+}
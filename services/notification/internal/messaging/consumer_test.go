@@ -0,0 +1,72 @@
+package messaging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+	"github.com/kernelshard/hcaas/pkg/events"
+)
+
+// TestBusConsumer_DeadLettersPoisonMessages tests that messages which can never be processed
+// are moved to the dead-letter topic with their original payload.
+// Table Driven Test Pattern used
+func TestBusConsumer_DeadLettersPoisonMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		version string
+	}{
+		{name: "undecodable payload", value: "{not json", version: "1"},
+		{name: "unsupported schema version", value: `{"url_id":"u1"}`, version: "99"},
+		{name: "invalid event", value: `{"url_id":""}`, version: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			b := bus.NewMemory()
+			defer b.Close()
+
+			dead := make(chan bus.Message, 1)
+			go b.Subscribe(ctx, "notifications.dlq", "test", func(_ context.Context, msg bus.Message) error {
+				dead <- msg
+				return nil
+			})
+
+			processor := NewProcessor(nil, 0, time.Millisecond, log)
+			dlq := NewBusDeadLetterQueue(b, "notifications.dlq", log)
+			consumer := NewBusConsumer(b, "notifications", "workers", processor, dlq, log)
+			go consumer.Start(ctx)
+
+			msg := bus.Message{
+				Topic:   "notifications",
+				Value:   []byte(tt.value),
+				Headers: map[string]string{events.HeaderSchemaVersion: tt.version},
+			}
+			if err := b.Publish(ctx, msg); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			select {
+			case got := <-dead:
+				if string(got.Value) != tt.value {
+					t.Errorf("dead letter value = %q, want %q", got.Value, tt.value)
+				}
+				if got.Headers[HeaderDLQOriginalTopic] != "notifications" {
+					t.Errorf("original topic header = %q, want notifications", got.Headers[HeaderDLQOriginalTopic])
+				}
+				if got.Headers[HeaderDLQError] == "" {
+					t.Error("dead letter has no error header")
+				}
+			case <-ctx.Done():
+				t.Fatal("message was not dead-lettered")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+)
+
+// Headers added to dead-lettered messages, next to the original headers.
+const (
+	HeaderDLQOriginalTopic     = "x-dlq-original-topic"
+	HeaderDLQOriginalPartition = "x-dlq-original-partition"
+	HeaderDLQOriginalOffset    = "x-dlq-original-offset"
+	HeaderDLQOriginalID        = "x-dlq-original-id"
+	HeaderDLQError             = "x-dlq-error"
+	HeaderDLQFailedAt          = "x-dlq-failed-at"
+)
+
+// IsDLQHeader reports whether key is one of the headers added by a dead-letter queue.
+func IsDLQHeader(key string) bool {
+	switch key {
+	case HeaderDLQOriginalTopic, HeaderDLQOriginalPartition, HeaderDLQOriginalOffset,
+		HeaderDLQOriginalID, HeaderDLQError, HeaderDLQFailedAt:
+		return true
+	}
+	return false
+}
+
+// BusDeadLetterQueue parks messages consumed from a generic bus on a dead-letter topic.
+type BusDeadLetterQueue struct {
+	publisher bus.Publisher
+	topic     string
+	log       *slog.Logger
+}
+
+func NewBusDeadLetterQueue(publisher bus.Publisher, topic string, log *slog.Logger) *BusDeadLetterQueue {
+	return &BusDeadLetterQueue{publisher: publisher, topic: topic, log: log}
+}
+
+// Publish copies msg to the dead-letter topic with its origin and the reason it failed.
+func (q *BusDeadLetterQueue) Publish(ctx context.Context, msg bus.Message, reason error) error {
+	headers := make(map[string]string, len(msg.Headers)+4)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderDLQOriginalTopic] = msg.Topic
+	headers[HeaderDLQOriginalID] = msg.ID
+	headers[HeaderDLQError] = reason.Error()
+	headers[HeaderDLQFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	dl := bus.Message{Topic: q.topic, Key: msg.Key, Value: msg.Value, Headers: headers}
+	if err := q.publisher.Publish(ctx, dl); err != nil {
+		return fmt.Errorf("failed to publish to dead-letter topic %s: %w", q.topic, err)
+	}
+	q.log.Warn("Message moved to dead-letter topic",
+		slog.String("topic", msg.Topic),
+		slog.String("message_id", msg.ID),
+		slog.String("dlq_topic", q.topic),
+		slog.String("reason", reason.Error()),
+	)
+	return nil
+}
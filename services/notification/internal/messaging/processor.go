@@ -0,0 +1,91 @@
+// Package messaging turns notification events consumed from the message bus into
+// queued notifications, independently of the bus in use.
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+	"github.com/kernelshard/hcaas/pkg/events"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/service"
+)
+
+// Consumer consumes notification events until ctx is cancelled.
+type Consumer interface {
+	Start(ctx context.Context) error
+}
+
+// Processor decodes notification events and queues them through the notification service.
+type Processor struct {
+	notificationSvc service.NotificationService
+	maxRetries      int
+	retryBackoff    time.Duration
+	log             *slog.Logger
+}
+
+// NewProcessor creates a processor that retries a failing send up to maxRetries times,
+// doubling retryBackoff between attempts.
+func NewProcessor(notificationSvc service.NotificationService, maxRetries int, retryBackoff time.Duration, log *slog.Logger) *Processor {
+	return &Processor{
+		notificationSvc: notificationSvc,
+		maxRetries:      maxRetries,
+		retryBackoff:    retryBackoff,
+		log:             log,
+	}
+}
+
+// Process decodes and sends a message, retrying failed sends up to maxRetries times.
+// A returned error means the message should be dead-lettered.
+func (p *Processor) Process(ctx context.Context, msg bus.Message) error {
+	// Reject events of schema versions this consumer does not understand
+	if err := events.CheckSchemaVersion(msg.Headers[events.HeaderSchemaVersion]); err != nil {
+		p.log.Error("Unsupported event schema", slog.Any("error", err))
+		return err
+	}
+
+	// Parse the message
+	var event events.Notification
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		p.log.Error("Failed to decode message", slog.Any("error", err))
+		// undecodable messages never succeed, so they are not retried
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	// Events from producers without event IDs are keyed by their position in the log,
+	// which is stable across redeliveries of the same message.
+	if event.EventID == "" {
+		event.EventID = msg.ID
+	}
+	if err := event.Validate(); err != nil {
+		p.log.Error("Invalid notification event", slog.Any("error", err))
+		return err
+	}
+	notif := model.FromEvent(event)
+
+	var err error
+	for attempt := 0; attempt <= p.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(p.retryBackoff * time.Duration(1<<(attempt-1))):
+			}
+		}
+		/*
+		 NOTE: This is the core business logic call
+		*/
+		if err = p.notificationSvc.Send(ctx, &notif); err == nil {
+			return nil
+		}
+		p.log.Error("Notification handling failed",
+			slog.Int("attempt", attempt+1),
+			slog.String("message_id", msg.ID),
+			slog.Any("error", err))
+	}
+	return fmt.Errorf("send failed after %d attempts: %w", p.maxRetries+1, err)
+}
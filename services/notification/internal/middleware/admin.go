@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+)
+
+// AdminMiddleware only lets requests through that carry the configured admin token
+// as a bearer token. All requests are rejected when no token is configured.
+func AdminMiddleware(token string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				problem.Respond(w, problem.CodeForbidden, "admin API is disabled")
+				return
+			}
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				logger.Warn("Unauthorized admin request", "path", r.URL.Path)
+				problem.Respond(w, problem.CodeUnauthorized, "invalid admin token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
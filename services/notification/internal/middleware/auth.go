@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/kernelshard/hcaas/pkg/authn"
+	"github.com/kernelshard/hcaas/pkg/problem"
+)
+
+type key string
+
+const contextUserIDKey key = "user_id"
+
+// UserIDFromContext returns the authenticated user ID set by AuthMiddleware
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	uid, ok := ctx.Value(contextUserIDKey).(string)
+	return uid, ok && uid != ""
+}
+
+// AuthMiddleware validates the bearer token with validator and
+// stores the user ID in the request context.
+func AuthMiddleware(validator authn.Validator, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := authn.BearerToken(r)
+			if !ok {
+				logger.Warn("Unauthorized: missing or malformed token")
+				problem.Respond(w, problem.CodeUnauthorized, "missing token")
+				return
+			}
+
+			identity, err := validator.Validate(r.Context(), token)
+			if err != nil {
+				logger.Warn("Token validation failed", "error", err)
+				problem.Respond(w, problem.CodeUnauthorized, "invalid token")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), contextUserIDKey, identity.UserID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
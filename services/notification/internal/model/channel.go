@@ -0,0 +1,106 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Channel types a notification can be delivered through.
+const (
+	ChannelTypeLog       = "log"
+	ChannelTypeWebhook   = "webhook"
+	ChannelTypePagerDuty = "pagerduty"
+	ChannelTypeOpsgenie  = "opsgenie"
+)
+
+// DefaultChannelID identifies the service-wide channel configured by ALERT_CHANNEL.
+// It is used when no routing rule of the owner matches a notification.
+const DefaultChannelID = 0
+
+// RedactedValue replaces secret channel settings in API responses. Updates that send it
+// back keep the stored secret.
+const RedactedValue = "********"
+
+// secretConfigKeys are the channel settings that are never returned to clients.
+var secretConfigKeys = []string{"routing_key", "api_key", "secret"}
+
+// Channel is a user-owned delivery target, e.g. a webhook URL or a PagerDuty service.
+type Channel struct {
+	ID     int    `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	Name   string `json:"name" db:"name"`
+	Type   string `json:"type" db:"type"`
+	// Config holds type specific settings such as "url" for webhooks
+	// or "routing_key" for PagerDuty.
+	Config    StringMap `json:"config" db:"config"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Redacted returns a copy of the channel with its secret settings replaced by RedactedValue.
+func (c Channel) Redacted() Channel {
+	config := make(StringMap, len(c.Config))
+	for k, v := range c.Config {
+		if v != "" && slices.Contains(secretConfigKeys, k) {
+			v = RedactedValue
+		}
+		config[k] = v
+	}
+	c.Config = config
+	return c
+}
+
+// KeepSecrets replaces settings that were sent back redacted with the values of old.
+func (c *Channel) KeepSecrets(old *Channel) {
+	for _, k := range secretConfigKeys {
+		if c.Config[k] == RedactedValue {
+			c.Config[k] = old.Config[k]
+		}
+	}
+}
+
+// RoutingRule maps notifications of a user to one or more channels.
+// Empty match fields match everything.
+type RoutingRule struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	URLIDs     StringList `json:"url_ids" db:"url_ids"`
+	Severities StringList `json:"severities" db:"severities"`
+	Labels     StringMap  `json:"labels" db:"labels"`
+	ChannelIDs IntList    `json:"channel_ids" db:"channel_ids"`
+	Enabled    bool       `json:"enabled" db:"enabled"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Matches reports whether the rule applies to n.
+func (r *RoutingRule) Matches(n *Notification) bool {
+	if !r.Enabled || r.UserID != n.UserID {
+		return false
+	}
+	if len(r.URLIDs) > 0 && !slices.Contains(r.URLIDs, n.UrlId) {
+		return false
+	}
+	if len(r.Severities) > 0 && !slices.Contains(r.Severities, n.Severity) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if n.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Delivery tracks the delivery of a notification through a single channel.
+type Delivery struct {
+	ID             int       `json:"id" db:"id"`
+	NotificationID int       `json:"notification_id" db:"notification_id"`
+	ChannelID      int       `json:"channel_id" db:"channel_id"`
+	Status         string    `json:"status" db:"status"` // pending, sent, failed
+	Error          string    `json:"error,omitempty" db:"error"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
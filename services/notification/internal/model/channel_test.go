@@ -0,0 +1,86 @@
+package model
+
+import "testing"
+
+// TestRoutingRule_Matches tests routing rule matching on monitors, severities and labels.
+// Table Driven Test Pattern used
+func TestRoutingRule_Matches(t *testing.T) {
+	notif := &Notification{
+		UrlId:    "url-1",
+		UserID:   "user-1",
+		Severity: SeverityCritical,
+		Labels:   StringMap{"env": "prod", "team": "core"},
+	}
+
+	tests := []struct {
+		name string
+		rule RoutingRule
+		want bool
+	}{
+		{
+			name: "empty rule matches everything of the owner",
+			rule: RoutingRule{UserID: "user-1", Enabled: true},
+			want: true,
+		},
+		{
+			name: "disabled rule never matches",
+			rule: RoutingRule{UserID: "user-1", Enabled: false},
+			want: false,
+		},
+		{
+			name: "rule of another user",
+			rule: RoutingRule{UserID: "user-2", Enabled: true},
+			want: false,
+		},
+		{
+			name: "monitor and severity match",
+			rule: RoutingRule{UserID: "user-1", Enabled: true, URLIDs: StringList{"url-1"}, Severities: StringList{SeverityCritical}},
+			want: true,
+		},
+		{
+			name: "other monitor",
+			rule: RoutingRule{UserID: "user-1", Enabled: true, URLIDs: StringList{"url-2"}},
+			want: false,
+		},
+		{
+			name: "other severity",
+			rule: RoutingRule{UserID: "user-1", Enabled: true, Severities: StringList{SeverityInfo}},
+			want: false,
+		},
+		{
+			name: "all labels match",
+			rule: RoutingRule{UserID: "user-1", Enabled: true, Labels: StringMap{"env": "prod"}},
+			want: true,
+		},
+		{
+			name: "label value differs",
+			rule: RoutingRule{UserID: "user-1", Enabled: true, Labels: StringMap{"env": "staging"}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(notif); got != tt.want {
+				t.Errorf("RoutingRule.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestChannel_Redacted tests that secret channel settings are masked and kept on updates.
+func TestChannel_Redacted(t *testing.T) {
+	ch := Channel{Type: ChannelTypeWebhook, Config: StringMap{"url": "https://example.com/hook", "secret": "s3cret"}}
+
+	got := ch.Redacted()
+	if got.Config["secret"] != RedactedValue || got.Config["url"] != "https://example.com/hook" {
+		t.Errorf("Redacted().Config = %v, want the secret masked", got.Config)
+	}
+	if ch.Config["secret"] != "s3cret" {
+		t.Errorf("Redacted() modified the channel: %v", ch.Config)
+	}
+
+	got.KeepSecrets(&ch)
+	if got.Config["secret"] != "s3cret" {
+		t.Errorf("KeepSecrets() secret = %q, want the stored one", got.Config["secret"])
+	}
+}
@@ -1,19 +1,85 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/kernelshard/hcaas/pkg/events"
+)
 
 type Notification struct {
-	ID        int       `json:"id" db:"id"`
-	UrlId     string    `json:"url_id" db:"url_id"`
-	Type      string    `json:"type" db:"type"` // email, sms, webhook
-	Message   string    `json:"message" db:"message"`
-	Status    string    `json:"status" db:"status"` // pending, sent, failed
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID int `json:"id" db:"id"`
+	// EventID is the producer assigned ID of the event; a notification is created once per event.
+	EventID  string `json:"event_id" db:"event_id"`
+	UrlId    string `json:"url_id" db:"url_id"`
+	UserID   string `json:"user_id" db:"user_id"`
+	Type     string `json:"type" db:"type"`         // url_unhealthy, url_recovered
+	Severity string `json:"severity" db:"severity"` // critical, warning, info
+	// IncidentKey is shared by the trigger and the recovery notification of an incident.
+	IncidentKey string    `json:"incident_key" db:"incident_key"`
+	Message     string    `json:"message" db:"message"`
+	Labels      StringMap `json:"labels,omitempty" db:"labels"`
+	Status      string    `json:"status" db:"status"` // pending, processing, sent, dead
+	// Attempts counts failed delivery rounds; the notification is retried at NextAttemptAt
+	// until the retry policy gives up and marks it dead.
+	Attempts      int       `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty" db:"last_error"`
+	// LockedBy and LeaseExpiresAt identify the worker processing the notification. A lease
+	// that expires before the worker reports back is reclaimed by another worker.
+	LockedBy       string     `json:"locked_by,omitempty" db:"locked_by"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 const (
 	StatusPending = "pending"
-	StatusSent    = "sent"
-	StatusFailed  = "failed"
+	// StatusProcessing marks a notification claimed by a worker under a lease.
+	StatusProcessing = "processing"
+	StatusSent       = "sent"
+	StatusFailed     = "failed"
+	// StatusDead is terminal: delivery failed MaxAttempts times and needs a manual requeue.
+	StatusDead = "dead"
+)
+
+// Notification types produced by the URL service.
+const (
+	TypeURLUnhealthy = events.TypeURLUnhealthy
+	TypeURLRecovered = events.TypeURLRecovered
+)
+
+// Notification severities.
+const (
+	SeverityCritical = events.SeverityCritical
+	SeverityWarning  = events.SeverityWarning
+	SeverityInfo     = events.SeverityInfo
 )
+
+// FromEvent maps a notification event of the shared contract to a notification to be queued.
+func FromEvent(e events.Notification) Notification {
+	return Notification{
+		EventID:     e.EventID,
+		UrlId:       e.URLID,
+		UserID:      e.UserID,
+		Type:        e.Type,
+		Severity:    e.Severity,
+		IncidentKey: e.IncidentKey,
+		Message:     e.Message,
+		Labels:      StringMap(e.Labels),
+		CreatedAt:   e.CreatedAt,
+	}
+}
+
+// DedupKey returns the key used to correlate the trigger and resolve events of an incident.
+// Notifications produced before incident keys existed fall back to the URL ID.
+func (n *Notification) DedupKey() string {
+	if n.IncidentKey != "" {
+		return n.IncidentKey
+	}
+	return "hcaas-url-" + n.UrlId
+}
+
+// IsResolve reports whether the notification closes an incident rather than opening one.
+func (n *Notification) IsResolve() bool {
+	return n.Type == TypeURLRecovered
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringMap is a map stored as a JSON column
+type StringMap map[string]string
+
+// Value implements driver.Valuer
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan implements sql.Scanner
+func (m *StringMap) Scan(src any) error {
+	return scanJSON(src, m)
+}
+
+// StringList is a string slice stored as a JSON column
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(src any) error {
+	return scanJSON(src, l)
+}
+
+// IntList is an int slice stored as a JSON column
+type IntList []int
+
+// Value implements driver.Valuer
+func (l IntList) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan implements sql.Scanner
+func (l *IntList) Scan(src any) error {
+	return scanJSON(src, l)
+}
+
+// scanJSON decodes a JSON column value into dst
+func scanJSON(src any, dst any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+)
+
+// backoff returns the delay before retrying after the given number of failed attempts.
+// The delay doubles with every attempt up to MaxDelay; half of it is randomized (equal
+// jitter) so notifications that failed together do not retry in lockstep.
+func backoff(cfg config.RetryConfig, attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	// Compare before shifting, BaseDelay<<shift overflows long before shift reaches 64
+	d := cfg.MaxDelay
+	if shift := attempts - 1; cfg.BaseDelay <= cfg.MaxDelay>>shift {
+		d = cfg.BaseDelay << shift
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+)
+
+// Test_backoff checks the delay doubles per attempt, is capped and stays within the jitter bounds.
+// Table Driven Test Pattern used
+func Test_backoff(t *testing.T) {
+	cfg := config.RetryConfig{MaxAttempts: 5, BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+	// defaults are RETRY_BASE_DELAY and RETRY_MAX_DELAY, whose shifted delay overflows at attempt 30
+	defaults := config.RetryConfig{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+	tests := []struct {
+		name     string
+		cfg      config.RetryConfig
+		attempts int
+		ceiling  time.Duration
+	}{
+		{name: "first retry", cfg: cfg, attempts: 1, ceiling: 10 * time.Second},
+		{name: "doubles", cfg: cfg, attempts: 2, ceiling: 20 * time.Second},
+		{name: "doubles again", cfg: cfg, attempts: 3, ceiling: 40 * time.Second},
+		{name: "capped", cfg: cfg, attempts: 4, ceiling: time.Minute},
+		{name: "large attempt count does not overflow", cfg: cfg, attempts: 200, ceiling: time.Minute},
+		{name: "defaults capped before overflow", cfg: defaults, attempts: 29, ceiling: time.Hour},
+		{name: "defaults at overflow", cfg: defaults, attempts: 30, ceiling: time.Hour},
+		{name: "defaults past overflow", cfg: defaults, attempts: 31, ceiling: time.Hour},
+		{name: "defaults at shift width", cfg: defaults, attempts: 65, ceiling: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := backoff(tt.cfg, tt.attempts)
+				if got < tt.ceiling/2 || got > tt.ceiling {
+					t.Fatalf("backoff(%d) = %v, want within [%v, %v]", tt.attempts, got, tt.ceiling/2, tt.ceiling)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/store"
+)
+
+// supportedChannelTypes lists the channel types users can register
+var supportedChannelTypes = []string{
+	model.ChannelTypeLog,
+	model.ChannelTypeWebhook,
+	model.ChannelTypePagerDuty,
+	model.ChannelTypeOpsgenie,
+}
+
+var supportedSeverities = []string{model.SeverityCritical, model.SeverityWarning, model.SeverityInfo}
+
+// ChannelService manages the notification channels and routing rules of users
+// and resolves which channels a notification is delivered through.
+type ChannelService interface {
+	CreateChannel(ctx context.Context, ch *model.Channel) error
+	GetChannel(ctx context.Context, userID string, id int) (*model.Channel, error)
+	ListChannels(ctx context.Context, userID string) ([]model.Channel, error)
+	UpdateChannel(ctx context.Context, ch *model.Channel) error
+	DeleteChannel(ctx context.Context, userID string, id int) error
+
+	CreateRule(ctx context.Context, rule *model.RoutingRule) error
+	GetRule(ctx context.Context, userID string, id int) (*model.RoutingRule, error)
+	ListRules(ctx context.Context, userID string) ([]model.RoutingRule, error)
+	UpdateRule(ctx context.Context, rule *model.RoutingRule) error
+	DeleteRule(ctx context.Context, userID string, id int) error
+
+	// ResolveChannels returns every enabled channel matched by the owner's routing rules,
+	// or only the default channel when nothing matches.
+	ResolveChannels(ctx context.Context, n *model.Notification) ([]model.Channel, error)
+	// DeliveryChannel returns the channel a delivery targets, including the default channel.
+	DeliveryChannel(ctx context.Context, userID string, id int) (*model.Channel, error)
+}
+
+// channelService is the default implementation of ChannelService
+type channelService struct {
+	store          store.ChannelStorage
+	defaultChannel model.Channel
+	l              *slog.Logger
+}
+
+// NewChannelService creates a new channel service. defaultChannel receives
+// notifications that are not matched by any routing rule.
+func NewChannelService(store store.ChannelStorage, defaultChannel model.Channel, logger *slog.Logger) ChannelService {
+	return &channelService{store: store, defaultChannel: defaultChannel, l: logger}
+}
+
+func (s *channelService) CreateChannel(ctx context.Context, ch *model.Channel) error {
+	if err := validateChannel(ch); err != nil {
+		return err
+	}
+	return s.store.CreateChannel(ctx, ch)
+}
+
+func (s *channelService) GetChannel(ctx context.Context, userID string, id int) (*model.Channel, error) {
+	return s.store.GetChannel(ctx, userID, id)
+}
+
+func (s *channelService) ListChannels(ctx context.Context, userID string) ([]model.Channel, error) {
+	return s.store.ListChannels(ctx, userID)
+}
+
+func (s *channelService) UpdateChannel(ctx context.Context, ch *model.Channel) error {
+	if ch == nil {
+		return problem.Errorf(appErr.ErrInvalidInput, "channel cannot be nil")
+	}
+	old, err := s.store.GetChannel(ctx, ch.UserID, ch.ID)
+	if err != nil {
+		return err
+	}
+	ch.KeepSecrets(old)
+	if err := validateChannel(ch); err != nil {
+		return err
+	}
+	return s.store.UpdateChannel(ctx, ch)
+}
+
+func (s *channelService) DeleteChannel(ctx context.Context, userID string, id int) error {
+	return s.store.DeleteChannel(ctx, userID, id)
+}
+
+func (s *channelService) CreateRule(ctx context.Context, rule *model.RoutingRule) error {
+	if err := s.validateRule(ctx, rule); err != nil {
+		return err
+	}
+	return s.store.CreateRule(ctx, rule)
+}
+
+func (s *channelService) GetRule(ctx context.Context, userID string, id int) (*model.RoutingRule, error) {
+	return s.store.GetRule(ctx, userID, id)
+}
+
+func (s *channelService) ListRules(ctx context.Context, userID string) ([]model.RoutingRule, error) {
+	return s.store.ListRules(ctx, userID)
+}
+
+func (s *channelService) UpdateRule(ctx context.Context, rule *model.RoutingRule) error {
+	if err := s.validateRule(ctx, rule); err != nil {
+		return err
+	}
+	return s.store.UpdateRule(ctx, rule)
+}
+
+func (s *channelService) DeleteRule(ctx context.Context, userID string, id int) error {
+	return s.store.DeleteRule(ctx, userID, id)
+}
+
+// ResolveChannels fans a notification out to the channels of all matching rules.
+// Channels referenced by several rules are only returned once.
+func (s *channelService) ResolveChannels(ctx context.Context, n *model.Notification) ([]model.Channel, error) {
+	if n.UserID == "" {
+		return []model.Channel{s.defaultChannel}, nil
+	}
+
+	rules, err := s.store.ListRules(ctx, n.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routing rules: %w", err)
+	}
+	channels, err := s.store.ListChannels(ctx, n.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+	byID := make(map[int]model.Channel, len(channels))
+	for _, ch := range channels {
+		byID[ch.ID] = ch
+	}
+
+	var matched []model.Channel
+	seen := make(map[int]bool)
+	for _, rule := range rules {
+		if !rule.Matches(n) {
+			continue
+		}
+		for _, id := range rule.ChannelIDs {
+			ch, ok := byID[id]
+			if !ok || !ch.Enabled || seen[id] {
+				continue
+			}
+			seen[id] = true
+			matched = append(matched, ch)
+		}
+	}
+
+	if len(matched) == 0 {
+		s.l.DebugContext(ctx, "No routing rule matched, using default channel",
+			slog.Int("notification_id", n.ID), slog.String("user_id", n.UserID))
+		return []model.Channel{s.defaultChannel}, nil
+	}
+	return matched, nil
+}
+
+func (s *channelService) DeliveryChannel(ctx context.Context, userID string, id int) (*model.Channel, error) {
+	if id == model.DefaultChannelID {
+		ch := s.defaultChannel
+		return &ch, nil
+	}
+	return s.store.GetChannel(ctx, userID, id)
+}
+
+// validateChannel checks the fields and type specific config of a channel
+func validateChannel(ch *model.Channel) error {
+	if ch == nil {
+		return problem.Errorf(appErr.ErrInvalidInput, "channel cannot be nil")
+	}
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" {
+		return problem.Errorf(appErr.ErrInvalidInput, "channel name is required")
+	}
+	if !slices.Contains(supportedChannelTypes, ch.Type) {
+		return problem.Errorf(appErr.ErrInvalidInput, "unsupported channel type %q", ch.Type)
+	}
+	if ch.Type == model.ChannelTypeWebhook {
+		u, err := url.Parse(ch.Config["url"])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return problem.Errorf(appErr.ErrInvalidInput, "webhook channel requires a valid http(s) url")
+		}
+	}
+	// Only the default channel falls back to the service wide PAGERDUTY_ROUTING_KEY and
+	// OPSGENIE_API_KEY; user channels must bring their own.
+	if ch.Type == model.ChannelTypePagerDuty && strings.TrimSpace(ch.Config["routing_key"]) == "" {
+		return problem.Errorf(appErr.ErrInvalidInput, "pagerduty channel requires a routing_key")
+	}
+	if ch.Type == model.ChannelTypeOpsgenie && strings.TrimSpace(ch.Config["api_key"]) == "" {
+		return problem.Errorf(appErr.ErrInvalidInput, "opsgenie channel requires an api_key")
+	}
+	if ch.Config == nil {
+		ch.Config = model.StringMap{}
+	}
+	return nil
+}
+
+// validateRule checks a routing rule and that it only references the owner's channels
+func (s *channelService) validateRule(ctx context.Context, rule *model.RoutingRule) error {
+	if rule == nil {
+		return problem.Errorf(appErr.ErrInvalidInput, "routing rule cannot be nil")
+	}
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return problem.Errorf(appErr.ErrInvalidInput, "routing rule name is required")
+	}
+	if len(rule.ChannelIDs) == 0 {
+		return problem.Errorf(appErr.ErrInvalidInput, "routing rule needs at least one channel")
+	}
+	for _, sev := range rule.Severities {
+		if !slices.Contains(supportedSeverities, sev) {
+			return problem.Errorf(appErr.ErrInvalidInput, "unsupported severity %q", sev)
+		}
+	}
+	for _, id := range rule.ChannelIDs {
+		if _, err := s.store.GetChannel(ctx, rule.UserID, id); err != nil {
+			if errors.Is(err, appErr.ErrNotFound) {
+				return problem.Errorf(appErr.ErrInvalidInput, "channel %d cannot be used by this rule", id)
+			}
+			return err
+		}
+	}
+	return nil
+}
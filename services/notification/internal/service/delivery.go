@@ -9,9 +9,9 @@ import (
 	"github.com/kernelshard/hcaas/services/notification/internal/model"
 )
 
-// DeliveryService handles the actual delivery of notification
+// DeliveryService handles the actual delivery of notification through a channel
 type DeliveryService interface {
-	Deliver(ctx context.Context, n *model.Notification) error
+	Deliver(ctx context.Context, ch *model.Channel, n *model.Notification) error
 }
 
 // deliveryService is an implementation of DeliveryService
@@ -25,11 +25,38 @@ func NewDeliveryService(log *slog.Logger) DeliveryService {
 }
 
 // Deliver simulates the delivery of a notification
-func (s *deliveryService) Deliver(ctx context.Context, n *model.Notification) error {
+func (s *deliveryService) Deliver(ctx context.Context, ch *model.Channel, n *model.Notification) error {
 	if n == nil {
 		return fmt.Errorf("notification cannot be nil")
 	}
-	s.log.Info("Simulating delivery", slog.String("type", n.Type), slog.String("url_id", n.UrlId))
+	s.log.Info("Simulating delivery",
+		slog.String("type", n.Type),
+		slog.String("url_id", n.UrlId),
+		slog.Int("channel_id", ch.ID),
+		slog.String("channel", ch.Name))
 	time.Sleep(500 * time.Millisecond) // simulating network latency for now
 	return nil
 }
+
+// dispatcher delivers through the DeliveryService registered for the channel type
+type dispatcher struct {
+	byType map[string]DeliveryService
+}
+
+// NewDispatcher creates a DeliveryService that routes every delivery to the
+// implementation registered for its channel type.
+func NewDispatcher(byType map[string]DeliveryService) DeliveryService {
+	return &dispatcher{byType: byType}
+}
+
+// Deliver hands the notification to the channel type specific DeliveryService
+func (d *dispatcher) Deliver(ctx context.Context, ch *model.Channel, n *model.Notification) error {
+	if ch == nil {
+		return fmt.Errorf("channel cannot be nil")
+	}
+	delivery, ok := d.byType[ch.Type]
+	if !ok {
+		return fmt.Errorf("unsupported channel type %q", ch.Type)
+	}
+	return delivery.Deliver(ctx, ch, n)
+}
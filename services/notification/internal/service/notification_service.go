@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -10,6 +11,8 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
 	"github.com/kernelshard/hcaas/services/notification/internal/model"
 	"github.com/kernelshard/hcaas/services/notification/internal/store"
 	"github.com/samims/otelkit"
@@ -22,14 +25,21 @@ type NotificationService interface {
 	Start(ctx context.Context) error
 	// Send queues or sends a notification
 	Send(ctx context.Context, n *model.Notification) error
+	// ListDead returns notifications that exhausted their delivery attempts
+	ListDead(ctx context.Context, limit, offset int) ([]model.Notification, error)
+	// Requeue schedules a dead notification for immediate redelivery
+	Requeue(ctx context.Context, id int) error
 }
 
 // notificationService is the default implementation of NotificationService
 type notificationService struct {
 	store       store.NotificationStorage
+	channels    ChannelService
 	delivery    DeliveryService
 	workerLimit int
 	interval    time.Duration
+	retry       config.RetryConfig
+	queue       config.QueueConfig
 	l           *slog.Logger
 	tracer      *otelkit.Tracer
 }
@@ -37,17 +47,23 @@ type notificationService struct {
 // NewNotificationService creates a new notification service instance
 func NewNotificationService(
 	store store.NotificationStorage,
+	channels ChannelService,
 	delivery DeliveryService,
 	workerLimit int,
 	interval time.Duration,
+	retry config.RetryConfig,
+	queue config.QueueConfig,
 	logger *slog.Logger,
 	tracer *otelkit.Tracer,
 ) NotificationService {
 	return &notificationService{
 		store:       store,
+		channels:    channels,
 		delivery:    delivery,
 		workerLimit: workerLimit,
 		interval:    interval,
+		retry:       retry,
+		queue:       queue,
 		l:           logger,
 		tracer:      tracer,
 	}
@@ -70,13 +86,23 @@ func (s *notificationService) Send(ctx context.Context, n *model.Notification) e
 	n.Status = model.StatusPending
 	n.CreatedAt = time.Now()
 	n.UpdatedAt = n.CreatedAt
+	n.NextAttemptAt = n.CreatedAt
 
 	span.SetAttributes(attribute.String("notification.url_id", n.UrlId))
 	span.SetAttributes(attribute.String("notification.status", string(n.Status)))
 
 	s.l.Info("Queuing new notification for processing", slog.String("url_id", n.UrlId))
 
+	span.SetAttributes(attribute.String("notification.event_id", n.EventID))
+
 	if err := s.store.Save(ctx, n); err != nil {
+		// Redelivered events are already stored; accepting them again keeps Send idempotent
+		if errors.Is(err, appErr.ErrDuplicate) {
+			s.l.InfoContext(ctx, "Ignoring duplicate notification event",
+				slog.String("event_id", n.EventID), slog.String("url_id", n.UrlId))
+			span.SetAttributes(attribute.String("result", "duplicate"))
+			return nil
+		}
 		span.RecordError(err)
 		s.l.Error("Failed to save notification to store", slog.String("url_id", n.UrlId), slog.Any("error", err))
 		span.SetStatus(codes.Error, err.Error())
@@ -89,7 +115,8 @@ func (s *notificationService) Send(ctx context.Context, n *model.Notification) e
 
 // Start begins periodic processing of queued notifications
 func (s *notificationService) Start(ctx context.Context) error {
-	s.l.InfoContext(ctx, "Starting notification worker", slog.Int("max_workers", s.workerLimit))
+	s.l.InfoContext(ctx, "Starting notification worker", slog.Int("max_workers", s.workerLimit),
+		slog.String("worker_id", s.queue.WorkerID), slog.Int("batch_size", s.queue.BatchSize))
 	var err error
 	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
@@ -107,12 +134,12 @@ func (s *notificationService) Start(ctx context.Context) error {
 	}
 }
 
-// processBatch fetches ending notifications and processes them concurrently
+// processBatch claims a batch of due notifications and processes them concurrently
 func (s *notificationService) processBatch(ctx context.Context) error {
-	// Fetch all pending notifications from the store layer.
-	notifs, err := s.store.GetPending(ctx)
+	// Claim a bounded batch so other replicas can work on the rest of the queue.
+	notifs, err := s.store.ClaimPending(ctx, s.queue.WorkerID, s.queue.BatchSize, s.queue.LeaseDuration)
 	if err != nil {
-		s.l.ErrorContext(ctx, "Error fetching pending notifications from store", slog.Any("error", err))
+		s.l.ErrorContext(ctx, "Error claiming pending notifications from store", slog.Any("error", err))
 		return err
 	}
 	// If no notifications are pending, we exit early
@@ -124,7 +151,8 @@ func (s *notificationService) processBatch(ctx context.Context) error {
 	s.l.InfoContext(ctx, "Processing batch of pending notifications", slog.Int("count", len(notifs)))
 
 	// Create an error group to manage concurrent goroutines and collect their errors.
-	eg, ctx := errgroup.WithContext(ctx)
+	// A plain group is used so a failing notification does not cancel the rest of the batch.
+	var eg errgroup.Group
 	// Create a buffered channel to act as a semaphore, limiting concurrency to s.workerLimit.
 	sem := make(chan struct{}, s.workerLimit)
 
@@ -145,7 +173,9 @@ func (s *notificationService) processBatch(ctx context.Context) error {
 	return eg.Wait()
 }
 
-// processNotification handles delivery and updates status
+// processNotification fans the notification out to every channel it is routed to.
+// Each channel has its own delivery record, so a failing channel does not affect the others
+// and channels that already succeeded are not delivered to again.
 func (s *notificationService) processNotification(ctx context.Context, n *model.Notification) error {
 	ctx, span := s.tracer.StartClientSpan(ctx, "notificationService.processNotification")
 	defer span.End()
@@ -162,37 +192,193 @@ func (s *notificationService) processNotification(ctx context.Context, n *model.
 	span.SetAttributes(attribute.String("notification.url_id", n.UrlId))
 
 	start := time.Now()
-	s.l.InfoContext(ctx, "Attempting to deliver notification", slog.Int("id", n.ID), slog.String("url_id", n.UrlId))
+	var deliveryErrs []error
+	errType := "delivery_error"
+	// Reclaims of expired leases count as attempts. A notification whose reclaims spent the
+	// budget crashed or stalled its workers every time, so it is not delivered again.
+	exhausted := n.Attempts >= s.retry.MaxAttempts
+	var deliveries []model.Delivery
+	var err error
+	if exhausted {
+		s.l.ErrorContext(ctx, "Notification exhausted its attempts on expired leases", slog.Int("id", n.ID),
+			slog.Int("attempts", n.Attempts))
+		deliveryErrs = append(deliveryErrs, errors.New(n.LastError))
+		errType = "lease_expired"
+	} else if deliveries, err = s.deliveriesFor(ctx, n); err != nil {
+		// A routing failure counts as a failed attempt, so it is retried with backoff and the
+		// notification dies once its budget is spent instead of being reclaimed forever.
+		s.l.ErrorContext(ctx, "Failed to route notification", slog.Int("id", n.ID), slog.Any("error", err))
+		deliveryErrs = append(deliveryErrs, err)
+		errType = "routing_error"
+	}
+	span.SetAttributes(attribute.Int("notification.deliveries", len(deliveries)))
+
+	// Channels are only delivered to while the lease holds, so another worker reclaiming the
+	// notification does not deliver them a second time. The rest wait for the retry.
+	deadline := s.deliveryDeadline(n)
+	for i := range deliveries {
+		d := &deliveries[i]
+		if d.Status == model.StatusSent {
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("channel %d: lease ends before delivery", d.ChannelID))
+			continue
+		}
+		if err := s.deliver(ctx, deadline, n, d); err != nil {
+			deliveryErrs = append(deliveryErrs, err)
+		}
+	}
 
-	if err := s.delivery.Deliver(ctx, n); err != nil {
+	status := model.StatusSent
+	if len(deliveryErrs) > 0 {
+		err := errors.Join(deliveryErrs...)
+		if exhausted {
+			status = model.StatusDead
+		} else {
+			status = s.scheduleRetry(n, err)
+		}
 		span.RecordError(err)
-		s.l.ErrorContext(ctx, "Notification delivery failed", slog.Int("id", n.ID), slog.String("url_id", n.UrlId), slog.Any("error", err))
 		span.SetStatus(codes.Error, err.Error())
-		span.SetAttributes(attribute.String("error.type", "delivery_error"))
-
-		updateErr := s.store.UpdateStatus(ctx, n.ID, model.StatusFailed)
-		if updateErr != nil {
-			span.RecordError(updateErr)
-			s.l.ErrorContext(ctx, "Failed to update status to failed after delivery error", slog.Int("id", n.ID), slog.Any("delivery_error", err), slog.Any("update_error", updateErr))
-			span.SetAttributes(attribute.String("error.type", "delivery_and_update_error"))
-			return fmt.Errorf("notification delivery failed: %w; status update to 'failed' also failed: %w", err, updateErr)
-		}
-		return err
+		span.SetAttributes(attribute.String("error.type", errType))
 	}
 
 	duration := time.Since(start)
-	s.l.InfoContext(ctx, "Notification delivery succeeded", slog.Int("id", n.ID), slog.String("url_id", n.UrlId), slog.Duration("duration", duration))
-	span.SetAttributes(attribute.String("notification.status", string(model.StatusSent)))
+	s.l.InfoContext(ctx, "Notification processed", slog.Int("id", n.ID), slog.String("url_id", n.UrlId),
+		slog.String("status", status), slog.Int("failed_channels", len(deliveryErrs)),
+		slog.Int("attempts", n.Attempts), slog.Duration("duration", duration))
+	span.SetAttributes(attribute.String("notification.status", status))
+	span.SetAttributes(attribute.Int("notification.attempts", n.Attempts))
 	span.SetAttributes(attribute.Int64("notification.duration_ms", duration.Milliseconds()))
 
-	updateErr := s.store.UpdateStatus(ctx, n.ID, model.StatusSent)
-	if updateErr != nil {
+	n.Status = status
+	if updateErr := s.store.UpdateAttempt(ctx, n); updateErr != nil {
 		span.RecordError(updateErr)
-		s.l.Error("Failed to update status to sent after successful delivery", slog.Int("id", n.ID), slog.Any("error", updateErr))
-		span.SetStatus(codes.Error, updateErr.Error())
+		if errors.Is(updateErr, appErr.ErrLeaseLost) {
+			// The lease expired while delivering and another worker reclaimed the notification;
+			// it owns the outcome now.
+			s.l.WarnContext(ctx, "Notification lease lost before completion", slog.Int("id", n.ID),
+				slog.String("worker_id", n.LockedBy))
+			span.SetAttributes(attribute.String("error.type", "lease_lost"))
+			return updateErr
+		}
+		s.l.ErrorContext(ctx, "Failed to update notification status", slog.Int("id", n.ID), slog.String("status", status), slog.Any("error", updateErr))
 		span.SetAttributes(attribute.String("error.type", "status_update_error"))
-		return updateErr
+		return errors.Join(append(deliveryErrs, updateErr)...)
+	}
+	if len(deliveryErrs) > 0 {
+		return fmt.Errorf("notification %d: %w", n.ID, errors.Join(deliveryErrs...))
 	}
 	span.SetAttributes(attribute.String("result", "success"))
 	return nil
 }
+
+// scheduleRetry records a failed delivery round on n. The notification stays pending with an
+// exponentially growing delay until the retry budget is spent, after which it is dead.
+func (s *notificationService) scheduleRetry(n *model.Notification, err error) string {
+	n.Attempts++
+	n.LastError = err.Error()
+	if n.Attempts >= s.retry.MaxAttempts {
+		n.Status = model.StatusDead
+		s.l.Warn("Notification exhausted its delivery attempts", slog.Int("id", n.ID),
+			slog.String("url_id", n.UrlId), slog.Int("attempts", n.Attempts))
+		return n.Status
+	}
+	n.Status = model.StatusPending
+	n.NextAttemptAt = time.Now().Add(backoff(s.retry, n.Attempts))
+	s.l.Info("Notification delivery will be retried", slog.Int("id", n.ID),
+		slog.Int("attempts", n.Attempts), slog.Time("next_attempt_at", n.NextAttemptAt))
+	return n.Status
+}
+
+// ListDead returns a page of dead notifications
+func (s *notificationService) ListDead(ctx context.Context, limit, offset int) ([]model.Notification, error) {
+	ctx, span := s.tracer.StartClientSpan(ctx, "notificationService.ListDead")
+	defer span.End()
+
+	notifs, err := s.store.ListDead(ctx, limit, offset)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("notification.count", len(notifs)))
+	return notifs, nil
+}
+
+// Requeue gives a dead notification a fresh retry budget
+func (s *notificationService) Requeue(ctx context.Context, id int) error {
+	ctx, span := s.tracer.StartClientSpan(ctx, "notificationService.Requeue")
+	defer span.End()
+	span.SetAttributes(attribute.Int("notification.id", id))
+
+	if err := s.store.Requeue(ctx, id); err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	s.l.InfoContext(ctx, "Dead notification requeued", slog.Int("id", id))
+	return nil
+}
+
+// deliveriesFor returns the deliveries of n, routing it and creating them on first processing
+func (s *notificationService) deliveriesFor(ctx context.Context, n *model.Notification) ([]model.Delivery, error) {
+	deliveries, err := s.store.GetDeliveries(ctx, n.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deliveries: %w", err)
+	}
+	if len(deliveries) > 0 {
+		return deliveries, nil
+	}
+
+	channels, err := s.channels.ResolveChannels(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	deliveries = make([]model.Delivery, 0, len(channels))
+	for _, ch := range channels {
+		deliveries = append(deliveries, model.Delivery{
+			NotificationID: n.ID,
+			ChannelID:      ch.ID,
+			Status:         model.StatusPending,
+		})
+	}
+	if err := s.store.SaveDeliveries(ctx, deliveries); err != nil {
+		return nil, fmt.Errorf("failed to save deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// deliveryDeadline returns when the deliveries of n must be done, leaving a tenth of the lease
+// to record their outcome before it expires
+func (s *notificationService) deliveryDeadline(n *model.Notification) time.Time {
+	if n.LeaseExpiresAt == nil {
+		return time.Now().Add(s.queue.LeaseDuration * 9 / 10)
+	}
+	return n.LeaseExpiresAt.Add(-s.queue.LeaseDuration / 10)
+}
+
+// deliver sends n through the channel of d, giving up at deadline, and records the outcome on d
+func (s *notificationService) deliver(ctx context.Context, deadline time.Time, n *model.Notification, d *model.Delivery) error {
+	ch, err := s.channels.DeliveryChannel(ctx, n.UserID, d.ChannelID)
+	if err == nil {
+		s.l.InfoContext(ctx, "Attempting to deliver notification", slog.Int("id", n.ID),
+			slog.String("url_id", n.UrlId), slog.Int("channel_id", ch.ID), slog.String("channel_type", ch.Type))
+		deliverCtx, cancel := context.WithDeadline(ctx, deadline)
+		err = s.delivery.Deliver(deliverCtx, ch, n)
+		cancel()
+	}
+
+	status, errMsg := model.StatusSent, ""
+	if err != nil {
+		status, errMsg = model.StatusFailed, err.Error()
+		s.l.ErrorContext(ctx, "Notification delivery failed", slog.Int("id", n.ID),
+			slog.Int("channel_id", d.ChannelID), slog.Any("error", err))
+	}
+	if updateErr := s.store.UpdateDeliveryStatus(ctx, d.ID, status, errMsg); updateErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to update delivery %d: %w", d.ID, updateErr))
+	}
+	d.Status, d.Error = status, errMsg
+	if err != nil {
+		return fmt.Errorf("channel %d: %w", d.ChannelID, err)
+	}
+	return nil
+}
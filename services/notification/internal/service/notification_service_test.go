@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/store"
+)
+
+// unroutableStorage is a notification store whose deliveries cannot be read
+type unroutableStorage struct {
+	store.NotificationStorage
+}
+
+func (unroutableStorage) GetDeliveries(context.Context, int) ([]model.Delivery, error) {
+	return nil, errors.New("connection refused")
+}
+
+// Test_processNotification_routingError tests that routing failures use up the retry budget
+// until the notification is dead, instead of leaving it to be claimed again forever.
+func Test_processNotification_routingError(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	notifs := unroutableStorage{store.NewMemoryStorage()}
+	channels := NewChannelService(store.NewMemoryChannelStorage(), model.Channel{Type: model.ChannelTypeLog}, log)
+	svc := NewNotificationService(notifs, channels, NewDeliveryService(log), 1, time.Second,
+		config.RetryConfig{MaxAttempts: 2}, config.QueueConfig{WorkerID: "test", BatchSize: 10, LeaseDuration: time.Minute},
+		log, otelkit.New("test")).(*notificationService)
+
+	if err := svc.Send(ctx, &model.Notification{EventID: "e1", UrlId: "u1", Type: "url_down"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		claimed, err := notifs.ClaimPending(ctx, "test", 10, time.Minute)
+		if err != nil || len(claimed) != 1 {
+			t.Fatalf("attempt %d: ClaimPending() = %d notifications, %v, want 1", attempt, len(claimed), err)
+		}
+		if err := svc.processNotification(ctx, &claimed[0]); err == nil {
+			t.Fatalf("attempt %d: processNotification() error = nil, want the routing error", attempt)
+		}
+		if claimed[0].Attempts != attempt {
+			t.Errorf("attempt %d: Attempts = %d", attempt, claimed[0].Attempts)
+		}
+	}
+
+	dead, err := notifs.ListDead(ctx, 10, 0)
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("ListDead() = %d notifications, %v, want 1", len(dead), err)
+	}
+	if claimed, _ := notifs.ClaimPending(ctx, "test", 10, time.Minute); len(claimed) != 0 {
+		t.Errorf("dead notification was claimed again")
+	}
+}
+
+// stallingDelivery is a delivery that hangs until its context ends, giving up after a second
+type stallingDelivery struct {
+	calls int
+}
+
+func (d *stallingDelivery) Deliver(ctx context.Context, _ *model.Channel, _ *model.Notification) error {
+	d.calls++
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Second):
+		return errors.New("delivery was not cancelled")
+	}
+}
+
+// Test_processNotification_expiredLeases tests that a notification whose lease keeps expiring
+// dies once the reclaims spent its retry budget, and that a stalled delivery is abandoned
+// before the lease expires.
+func Test_processNotification_expiredLeases(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	notifs := store.NewMemoryStorage()
+	channels := NewChannelService(store.NewMemoryChannelStorage(), model.Channel{Type: model.ChannelTypeLog}, log)
+	delivery := &stallingDelivery{}
+	lease := 200 * time.Millisecond
+	svc := NewNotificationService(notifs, channels, delivery, 1, time.Second,
+		config.RetryConfig{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour},
+		config.QueueConfig{WorkerID: "test", BatchSize: 10, LeaseDuration: lease},
+		log, otelkit.New("test")).(*notificationService)
+
+	if err := svc.Send(ctx, &model.Notification{EventID: "e1", UrlId: "u1", Type: "url_down"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	claimed, err := notifs.ClaimPending(ctx, "test", 10, lease)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimPending() = %d notifications, %v, want 1", len(claimed), err)
+	}
+	start := time.Now()
+	if err := svc.processNotification(ctx, &claimed[0]); err == nil {
+		t.Fatal("processNotification() error = nil, want the stalled delivery")
+	}
+	if elapsed := time.Since(start); elapsed >= lease {
+		t.Errorf("processNotification() took %v, want less than the %v lease", elapsed, lease)
+	}
+
+	if claimed[0].Status != model.StatusPending || claimed[0].Attempts != 1 {
+		t.Errorf("stalled notification = %s after %d attempts, want pending after 1", claimed[0].Status, claimed[0].Attempts)
+	}
+
+	// The workers of e2 crash twice; each reclaim of the expired lease counts as an attempt
+	if err := svc.Send(ctx, &model.Notification{EventID: "e2", UrlId: "u2", Type: "url_down"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	for _, l := range []time.Duration{-time.Second, -time.Second, lease} {
+		if claimed, err = notifs.ClaimPending(ctx, "test", 10, l); err != nil || len(claimed) != 1 {
+			t.Fatalf("ClaimPending() = %d notifications, %v, want 1", len(claimed), err)
+		}
+	}
+	calls := delivery.calls
+	if err := svc.processNotification(ctx, &claimed[0]); err == nil {
+		t.Fatal("processNotification() error = nil, want the expired leases")
+	}
+	if delivery.calls != calls {
+		t.Errorf("notification out of attempts was delivered")
+	}
+	dead, err := notifs.ListDead(ctx, 10, 0)
+	if err != nil || len(dead) != 1 || dead[0].EventID != "e2" {
+		t.Fatalf("ListDead() = %+v, %v, want e2", dead, err)
+	}
+}
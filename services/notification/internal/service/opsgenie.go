@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+// opsgenieAlert is the request body for creating an Opsgenie alert
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// opsgenieClose is the request body for closing an Opsgenie alert
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// opsgenieDelivery delivers notifications as Opsgenie alerts
+type opsgenieDelivery struct {
+	cfg    config.OpsgenieConfig
+	client *http.Client
+	log    *slog.Logger
+}
+
+// NewOpsgenieDelivery creates a DeliveryService backed by the Opsgenie Alert API
+func NewOpsgenieDelivery(cfg config.OpsgenieConfig, client *http.Client, log *slog.Logger) DeliveryService {
+	return &opsgenieDelivery{cfg: cfg, client: client, log: log}
+}
+
+// Deliver creates an alert aliased by the incident dedup key for unhealthy URLs
+// and closes the alert with that alias once the URL recovers.
+// User channels use their "api_key", the default channel OPSGENIE_API_KEY.
+func (d *opsgenieDelivery) Deliver(ctx context.Context, ch *model.Channel, n *model.Notification) error {
+	if n == nil {
+		return fmt.Errorf("notification cannot be nil")
+	}
+	apiKey := channelSetting(ch, "api_key", d.cfg.APIKey)
+	if apiKey == "" {
+		return fmt.Errorf("opsgenie channel %d has no api key", ch.ID)
+	}
+
+	alias := n.DedupKey()
+	action := "create"
+	endpoint := d.cfg.APIURL + "/v2/alerts"
+	var payload any = opsgenieAlert{
+		Message:     truncate(n.Message, 130), // Opsgenie rejects longer messages
+		Alias:       alias,
+		Description: n.Message,
+		Source:      "hcaas",
+		Priority:    "P1",
+		Details: map[string]string{
+			"url_id": n.UrlId,
+			"type":   n.Type,
+		},
+	}
+	if n.IsResolve() {
+		action = "close"
+		endpoint = d.cfg.APIURL + "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"
+		payload = opsgenieClose{Source: "hcaas", Note: n.Message}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal opsgenie request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create opsgenie request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+apiKey)
+
+	if err := doAlertRequest(d.client, req); err != nil {
+		return fmt.Errorf("opsgenie %s alert failed: %w", action, err)
+	}
+
+	d.log.InfoContext(ctx, "Opsgenie alert request sent",
+		slog.String("action", action),
+		slog.String("alias", alias),
+		slog.String("url_id", n.UrlId))
+	return nil
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+// Test_opsgenieDelivery_Deliver tests that an incident's alert is created under its key as
+// alias and closed by that alias once the URL recovers, and the handling of rejected requests.
+// Table Driven Test Pattern used
+func Test_opsgenieDelivery_Deliver(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	status := http.StatusAccepted
+	srv, reqs := newAlertServer(t, &status)
+	d := NewOpsgenieDelivery(config.OpsgenieConfig{APIKey: "default-key", APIURL: srv.URL}, srv.Client(), log)
+
+	down := &model.Notification{UrlId: "u1", Type: model.TypeURLUnhealthy, IncidentKey: "hcaas-u1/1", Message: strings.Repeat("x", 200)}
+	up := &model.Notification{UrlId: "u1", Type: model.TypeURLRecovered, IncidentKey: "hcaas-u1/1", Message: "https://example.com recovered"}
+	userChannel := &model.Channel{ID: 7, Type: model.ChannelTypeOpsgenie, Config: model.StringMap{"api_key": "user-key"}}
+	defaultChannel := &model.Channel{ID: model.DefaultChannelID, Type: model.ChannelTypeOpsgenie}
+
+	tests := []struct {
+		name     string
+		ch       *model.Channel
+		n        *model.Notification
+		status   int
+		wantErr  string
+		wantPath string
+		wantAuth string
+		check    func(body map[string]any) bool
+	}{
+		{
+			name: "create", ch: userChannel, n: down, status: http.StatusAccepted,
+			wantPath: "/v2/alerts", wantAuth: "GenieKey user-key",
+			check: func(body map[string]any) bool {
+				return body["alias"] == "hcaas-u1/1" && body["message"] == strings.Repeat("x", 130) &&
+					body["description"] == down.Message && body["priority"] == "P1"
+			},
+		},
+		{
+			name: "close by alias on recovery", ch: userChannel, n: up, status: http.StatusAccepted,
+			wantPath: "/v2/alerts/hcaas-u1%2F1/close?identifierType=alias", wantAuth: "GenieKey user-key",
+			check: func(body map[string]any) bool { return body["source"] == "hcaas" && body["note"] == up.Message },
+		},
+		{
+			name: "default channel uses the service key", ch: defaultChannel, n: down, status: http.StatusAccepted,
+			wantPath: "/v2/alerts", wantAuth: "GenieKey default-key",
+			check: func(body map[string]any) bool { return body["alias"] == "hcaas-u1/1" },
+		},
+		{name: "user channel without a key", ch: &model.Channel{ID: 8, Type: model.ChannelTypeOpsgenie}, n: down, wantErr: "has no api key"},
+		{name: "rate limited", ch: userChannel, n: down, status: http.StatusTooManyRequests, wantErr: "unexpected status 429"},
+		{name: "unknown alias", ch: userChannel, n: up, status: http.StatusNotFound, wantErr: "opsgenie close alert failed: unexpected status 404"},
+		{name: "server error", ch: userChannel, n: down, status: http.StatusInternalServerError, wantErr: "unexpected status 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			sent := len(*reqs)
+			err := d.Deliver(ctx, tt.ch, tt.n)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Deliver() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Deliver() error = %v", err)
+			}
+			if len(*reqs) != sent+1 {
+				t.Fatalf("requests = %d, want 1", len(*reqs)-sent)
+			}
+
+			req := (*reqs)[sent]
+			if req.method != http.MethodPost || req.path != tt.wantPath {
+				t.Errorf("request = %s %s, want POST %s", req.method, req.path, tt.wantPath)
+			}
+			if got := req.header.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+			}
+			if !tt.check(req.body) {
+				t.Errorf("body = %v", req.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+// pagerDutyEvent is the request body of the PagerDuty Events API v2
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"` // trigger, resolve
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyDelivery delivers notifications as PagerDuty trigger/resolve events
+type pagerDutyDelivery struct {
+	cfg    config.PagerDutyConfig
+	client *http.Client
+	log    *slog.Logger
+}
+
+// NewPagerDutyDelivery creates a DeliveryService backed by the PagerDuty Events API v2
+func NewPagerDutyDelivery(cfg config.PagerDutyConfig, client *http.Client, log *slog.Logger) DeliveryService {
+	return &pagerDutyDelivery{cfg: cfg, client: client, log: log}
+}
+
+// Deliver sends a trigger event for unhealthy URLs and a resolve event with the
+// same dedup key once the URL recovers, so the PagerDuty incident closes itself.
+// User channels use their "routing_key", the default channel PAGERDUTY_ROUTING_KEY.
+func (d *pagerDutyDelivery) Deliver(ctx context.Context, ch *model.Channel, n *model.Notification) error {
+	if n == nil {
+		return fmt.Errorf("notification cannot be nil")
+	}
+	routingKey := channelSetting(ch, "routing_key", d.cfg.RoutingKey)
+	if routingKey == "" {
+		return fmt.Errorf("pagerduty channel %d has no routing key", ch.ID)
+	}
+
+	event := pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    n.DedupKey(),
+	}
+	if n.IsResolve() {
+		event.EventAction = "resolve"
+	} else {
+		event.Payload = &pagerDutyPayload{
+			Summary:   n.Message,
+			Source:    "hcaas",
+			Severity:  "critical",
+			Timestamp: n.CreatedAt.UTC().Format(time.RFC3339),
+			CustomDetails: map[string]string{
+				"url_id": n.UrlId,
+				"type":   n.Type,
+			},
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pagerduty event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.EventsURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create pagerduty request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := doAlertRequest(d.client, req); err != nil {
+		return fmt.Errorf("pagerduty %s event failed: %w", event.EventAction, err)
+	}
+
+	d.log.InfoContext(ctx, "PagerDuty event sent",
+		slog.String("action", event.EventAction),
+		slog.String("dedup_key", event.DedupKey),
+		slog.String("url_id", n.UrlId))
+	return nil
+}
+
+// channelSetting returns the channel config value for key. def, a service wide setting, is
+// only used by the default channel, so user channels never deliver with the operator's keys.
+func channelSetting(ch *model.Channel, key, def string) string {
+	if ch != nil {
+		if v := ch.Config[key]; v != "" {
+			return v
+		}
+		if ch.ID != model.DefaultChannelID {
+			return ""
+		}
+	}
+	return def
+}
+
+// doAlertRequest executes req and treats any non-2xx response as an error
+func doAlertRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
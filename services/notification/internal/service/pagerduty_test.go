@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/config"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+// alertRequest is a request received by an alerting API stub
+type alertRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   map[string]any
+}
+
+// newAlertServer starts an alerting API stub answering with status and recording the requests
+func newAlertServer(t *testing.T, status *int) (*httptest.Server, *[]alertRequest) {
+	t.Helper()
+	var reqs []alertRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := alertRequest{method: r.Method, path: r.URL.RequestURI(), header: r.Header.Clone()}
+		if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+			t.Errorf("decoding request body: %v", err)
+		}
+		reqs = append(reqs, req)
+		w.WriteHeader(*status)
+		_, _ = io.WriteString(w, `{"status":"test"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+// Test_pagerDutyDelivery_Deliver tests the Events API v2 requests of an incident's trigger
+// and auto-resolve, and the handling of rejected events.
+// Table Driven Test Pattern used
+func Test_pagerDutyDelivery_Deliver(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	status := http.StatusAccepted
+	srv, reqs := newAlertServer(t, &status)
+	d := NewPagerDutyDelivery(config.PagerDutyConfig{RoutingKey: "default-key", EventsURL: srv.URL + "/v2/enqueue"}, srv.Client(), log)
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	down := &model.Notification{UrlId: "u1", Type: model.TypeURLUnhealthy, IncidentKey: "hcaas-u1-1", Message: "https://example.com is down", CreatedAt: createdAt}
+	up := &model.Notification{UrlId: "u1", Type: model.TypeURLRecovered, IncidentKey: "hcaas-u1-1", Message: "https://example.com recovered", CreatedAt: createdAt}
+	userChannel := &model.Channel{ID: 7, Type: model.ChannelTypePagerDuty, Config: model.StringMap{"routing_key": "user-key"}}
+	defaultChannel := &model.Channel{ID: model.DefaultChannelID, Type: model.ChannelTypePagerDuty}
+
+	tests := []struct {
+		name           string
+		ch             *model.Channel
+		n              *model.Notification
+		status         int
+		wantErr        string
+		wantRoutingKey string
+		wantAction     string
+		wantPayload    bool
+	}{
+		{name: "trigger", ch: userChannel, n: down, status: http.StatusAccepted, wantRoutingKey: "user-key", wantAction: "trigger", wantPayload: true},
+		{name: "auto-resolve of the same incident", ch: userChannel, n: up, status: http.StatusAccepted, wantRoutingKey: "user-key", wantAction: "resolve"},
+		{name: "default channel uses the service key", ch: defaultChannel, n: down, status: http.StatusAccepted, wantRoutingKey: "default-key", wantAction: "trigger", wantPayload: true},
+		{name: "user channel without a key", ch: &model.Channel{ID: 8, Type: model.ChannelTypePagerDuty}, n: down, wantErr: "has no routing key"},
+		{name: "rate limited", ch: userChannel, n: down, status: http.StatusTooManyRequests, wantErr: "unexpected status 429"},
+		{name: "rejected event", ch: userChannel, n: up, status: http.StatusBadRequest, wantErr: "pagerduty resolve event failed: unexpected status 400"},
+		{name: "server error", ch: userChannel, n: down, status: http.StatusInternalServerError, wantErr: "unexpected status 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			sent := len(*reqs)
+			err := d.Deliver(ctx, tt.ch, tt.n)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Deliver() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Deliver() error = %v", err)
+			}
+			if len(*reqs) != sent+1 {
+				t.Fatalf("requests = %d, want 1", len(*reqs)-sent)
+			}
+
+			req := (*reqs)[sent]
+			if req.method != http.MethodPost || req.path != "/v2/enqueue" {
+				t.Errorf("request = %s %s, want POST /v2/enqueue", req.method, req.path)
+			}
+			if got := req.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if req.body["routing_key"] != tt.wantRoutingKey {
+				t.Errorf("routing_key = %v, want %s", req.body["routing_key"], tt.wantRoutingKey)
+			}
+			if req.body["event_action"] != tt.wantAction {
+				t.Errorf("event_action = %v, want %s", req.body["event_action"], tt.wantAction)
+			}
+			if req.body["dedup_key"] != tt.n.IncidentKey {
+				t.Errorf("dedup_key = %v, want the incident key %s", req.body["dedup_key"], tt.n.IncidentKey)
+			}
+			payload, ok := req.body["payload"].(map[string]any)
+			if ok != tt.wantPayload {
+				t.Fatalf("payload = %v, want present %v", req.body["payload"], tt.wantPayload)
+			}
+			if ok && (payload["summary"] != tt.n.Message || payload["severity"] != "critical" || payload["timestamp"] != "2025-01-02T03:04:05Z") {
+				t.Errorf("payload = %v", payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the body when the channel has a secret
+const webhookSignatureHeader = "X-HCaaS-Signature"
+
+// webhookDelivery posts notifications as JSON to a user supplied URL
+type webhookDelivery struct {
+	client *http.Client
+	log    *slog.Logger
+}
+
+// NewWebhookDelivery creates a DeliveryService for webhook channels.
+// The channel config must contain "url" and may contain a "secret" used to sign the body.
+func NewWebhookDelivery(client *http.Client, log *slog.Logger) DeliveryService {
+	return &webhookDelivery{client: client, log: log}
+}
+
+// Deliver posts the notification to the channel's webhook URL
+func (d *webhookDelivery) Deliver(ctx context.Context, ch *model.Channel, n *model.Notification) error {
+	if n == nil {
+		return fmt.Errorf("notification cannot be nil")
+	}
+	target := channelSetting(ch, "url", "")
+	if target == "" {
+		return fmt.Errorf("webhook channel %d has no url", ch.ID)
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := channelSetting(ch, "secret", ""); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	if err := doAlertRequest(d.client, req); err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+
+	d.log.InfoContext(ctx, "Webhook delivered",
+		slog.Int("channel_id", ch.ID),
+		slog.Int("notification_id", n.ID),
+		slog.String("url_id", n.UrlId))
+	return nil
+}
@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/services/notification/internal/store"
+	"github.com/kernelshard/hcaas/services/notification/internal/store/storetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (store.NotificationStorage, store.ChannelStorage) {
+		return store.NewMemoryStorage(), store.NewMemoryChannelStorage()
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (store.NotificationStorage, store.ChannelStorage) {
+		sqlDB, err := database.OpenSQLite("sqlite::memory:")
+		if err != nil {
+			t.Fatalf("OpenSQLite() error = %v", err)
+		}
+		db := sqlx.NewDb(sqlDB, "sqlite")
+		t.Cleanup(func() { db.Close() })
+		migrator, err := store.NewMigrator(sqlDB, database.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return store.NewSQLiteStorage(db), store.NewSQLiteChannelStorage(db)
+	})
+}
+
+// TestPostgresConformance runs against the database of TEST_POSTGRES_URL, which must be
+// migrated. Its tables are truncated.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	storetest.Run(t, func(t *testing.T) (store.NotificationStorage, store.ChannelStorage) {
+		db, err := sqlx.Connect("postgres", dsn)
+		if err != nil {
+			t.Fatalf("sqlx.Connect() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		const truncate = `TRUNCATE notifications, notification_deliveries, notification_channels, routing_rules RESTART IDENTITY`
+		if _, err := db.Exec(truncate); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		notifStore, err := store.NewPostgresStorage(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return notifStore, store.NewPostgresChannelStorage(db)
+	})
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/jmoiron/sqlx"
 
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
 	"github.com/kernelshard/hcaas/services/notification/internal/config"
 )
 
@@ -24,3 +26,66 @@ func ConnectPostgres(dbCfg config.DBConfig) (*sqlx.DB, error) {
 	}
 	return db, nil
 }
+
+// Stores are the stores of the notification service sharing one database
+type Stores struct {
+	Notifications NotificationStorage
+	Channels      ChannelStorage
+	// Migrator manages the schema of the database
+	Migrator *migrate.Migrator
+	db       *sqlx.DB
+}
+
+// Close closes the database of the stores
+func (s *Stores) Close() error {
+	return s.db.Close()
+}
+
+// Open connects to the database of dbCfg.URL. The backend is selected by the DSN scheme,
+// see package database. The schema is not migrated; see Stores.Migrator.
+func Open(dbCfg config.DBConfig) (*Stores, error) {
+	backend, err := database.BackendOf(dbCfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == database.SQLite {
+		sqlDB, err := database.OpenSQLite(dbCfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := NewMigrator(sqlDB, backend)
+		if err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+		db := sqlx.NewDb(sqlDB, "sqlite")
+		return &Stores{
+			Notifications: NewSQLiteStorage(db),
+			Channels:      NewSQLiteChannelStorage(db),
+			Migrator:      migrator,
+			db:            db,
+		}, nil
+	}
+
+	db, err := ConnectPostgres(dbCfg)
+	if err != nil {
+		return nil, err
+	}
+	notifStore, err := NewPostgresStorage(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	migrator, err := NewMigrator(db.DB, backend)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Stores{
+		Notifications: notifStore,
+		Channels:      NewPostgresChannelStorage(db),
+		Migrator:      migrator,
+		db:            db,
+	}, nil
+}
@@ -2,15 +2,50 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/kernelshard/hcaas/services/notification/internal/model"
 )
 
+// leaseExpiredError is the last error of a notification reclaimed after its lease expired
+const leaseExpiredError = "lease expired before the worker reported the outcome"
+
 // NotificationStorage defines DB operations for notifications
 // Allows persisting notification requests for async processing
 type NotificationStorage interface {
 	Save(ctx context.Context, n *model.Notification) error
-	GetPending(ctx context.Context) ([]model.Notification, error)
-	UpdateStatus(ctx context.Context, id int, status string) error
+	// ClaimPending atomically moves up to limit due notifications to processing under a lease
+	// owned by workerID. Notifications whose lease expired are claimed again, so work held by
+	// a crashed worker is recovered. Such a reclaim counts as a failed attempt, so a notification
+	// that keeps crashing or stalling its worker runs out of attempts and dies instead of being
+	// reclaimed forever. Concurrent workers never claim the same notification.
+	ClaimPending(ctx context.Context, workerID string, limit int, lease time.Duration) ([]model.Notification, error)
+	// UpdateAttempt persists the status, attempt count, next attempt time and last error of n
+	// and releases its lease. It fails with ErrLeaseLost when n is no longer held by n.LockedBy.
+	UpdateAttempt(ctx context.Context, n *model.Notification) error
+	// ListDead returns dead notifications, most recently failed first
+	ListDead(ctx context.Context, limit, offset int) ([]model.Notification, error)
+	// Requeue moves a dead notification back to pending with a fresh attempt budget
+	Requeue(ctx context.Context, id int) error
+	// SaveDeliveries creates the per-channel deliveries of a notification
+	SaveDeliveries(ctx context.Context, deliveries []model.Delivery) error
+	GetDeliveries(ctx context.Context, notificationID int) ([]model.Delivery, error)
+	UpdateDeliveryStatus(ctx context.Context, id int, status, errMsg string) error
 	Ping(ctx context.Context) error
 }
+
+// ChannelStorage defines DB operations for the notification channels and
+// routing rules owned by users. Lookups are scoped to the owning user.
+type ChannelStorage interface {
+	CreateChannel(ctx context.Context, ch *model.Channel) error
+	GetChannel(ctx context.Context, userID string, id int) (*model.Channel, error)
+	ListChannels(ctx context.Context, userID string) ([]model.Channel, error)
+	UpdateChannel(ctx context.Context, ch *model.Channel) error
+	DeleteChannel(ctx context.Context, userID string, id int) error
+
+	CreateRule(ctx context.Context, rule *model.RoutingRule) error
+	GetRule(ctx context.Context, userID string, id int) (*model.RoutingRule, error)
+	ListRules(ctx context.Context, userID string) ([]model.RoutingRule, error)
+	UpdateRule(ctx context.Context, rule *model.RoutingRule) error
+	DeleteRule(ctx context.Context, userID string, id int) error
+}
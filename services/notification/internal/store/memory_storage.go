@@ -0,0 +1,402 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+type memoryStorage struct {
+	mu             sync.Mutex
+	notifications  map[int]*model.Notification
+	deliveries     map[int]*model.Delivery
+	nextID         int
+	nextDeliveryID int
+}
+
+// NewMemoryStorage returns a NotificationStorage keeping notifications in memory. It has the
+// semantics of the database backends and is meant for tests; nothing is persisted.
+func NewMemoryStorage() NotificationStorage {
+	return &memoryStorage{
+		notifications: map[int]*model.Notification{},
+		deliveries:    map[int]*model.Delivery{},
+	}
+}
+
+// copyNotification returns n with its own labels and lease, so callers cannot modify stored state
+func copyNotification(n *model.Notification) model.Notification {
+	c := *n
+	c.Labels = maps.Clone(n.Labels)
+	if n.LeaseExpiresAt != nil {
+		lease := *n.LeaseExpiresAt
+		c.LeaseExpiresAt = &lease
+	}
+	return c
+}
+
+// Save stores a new notification. A notification whose event ID was already stored is
+// ignored and ErrDuplicate is returned.
+func (s *memoryStorage) Save(_ context.Context, notif *model.Notification) error {
+	if notif == nil {
+		return fmt.Errorf("notification cannot be nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if notif.EventID != "" {
+		for _, n := range s.notifications {
+			if n.EventID == notif.EventID {
+				return fmt.Errorf("event %s: %w", notif.EventID, appErr.ErrDuplicate)
+			}
+		}
+	}
+	s.nextID++
+	notif.ID = s.nextID
+	stored := copyNotification(notif)
+	s.notifications[notif.ID] = &stored
+	return nil
+}
+
+// ClaimPending claims due notifications and notifications with an expired lease, oldest first.
+// A reclaim counts as a failed attempt.
+func (s *memoryStorage) ClaimPending(_ context.Context, workerID string, limit int, lease time.Duration) ([]model.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*model.Notification
+	for _, n := range s.notifications {
+		pending := n.Status == model.StatusPending && !n.NextAttemptAt.After(now)
+		expired := n.Status == model.StatusProcessing && n.LeaseExpiresAt != nil && n.LeaseExpiresAt.Before(now)
+		if pending || expired {
+			due = append(due, n)
+		}
+	}
+	slices.SortFunc(due, func(a, b *model.Notification) int {
+		return cmp.Or(a.NextAttemptAt.Compare(b.NextAttemptAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	claimed := []model.Notification{}
+	leaseExpiresAt := now.Add(lease)
+	for _, n := range due[:min(limit, len(due))] {
+		if n.Status == model.StatusProcessing {
+			n.Attempts++
+			n.LastError = leaseExpiredError
+		}
+		n.Status = model.StatusProcessing
+		n.LockedBy = workerID
+		n.LeaseExpiresAt = &leaseExpiresAt
+		n.UpdatedAt = now
+		claimed = append(claimed, copyNotification(n))
+	}
+	return claimed, nil
+}
+
+// UpdateAttempt records the outcome of a delivery round of a notification and releases its lease
+func (s *memoryStorage) UpdateAttempt(_ context.Context, n *model.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.notifications[n.ID]
+	if !ok || stored.Status != model.StatusProcessing || stored.LockedBy != n.LockedBy {
+		return fmt.Errorf("notification %d: %w", n.ID, appErr.ErrLeaseLost)
+	}
+	n.UpdatedAt = time.Now()
+	stored.Status = n.Status
+	stored.Attempts = n.Attempts
+	stored.NextAttemptAt = n.NextAttemptAt
+	stored.LastError = n.LastError
+	stored.UpdatedAt = n.UpdatedAt
+	stored.LockedBy, stored.LeaseExpiresAt = "", nil
+	n.LockedBy, n.LeaseExpiresAt = "", nil
+	return nil
+}
+
+// ListDead returns a page of dead notifications
+func (s *memoryStorage) ListDead(_ context.Context, limit, offset int) ([]model.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dead []*model.Notification
+	for _, n := range s.notifications {
+		if n.Status == model.StatusDead {
+			dead = append(dead, n)
+		}
+	}
+	slices.SortFunc(dead, func(a, b *model.Notification) int {
+		return cmp.Or(b.UpdatedAt.Compare(a.UpdatedAt), cmp.Compare(b.ID, a.ID))
+	})
+
+	notifs := []model.Notification{}
+	for _, n := range dead[min(offset, len(dead)):min(offset+limit, len(dead))] {
+		notifs = append(notifs, copyNotification(n))
+	}
+	return notifs, nil
+}
+
+// Requeue resets a dead notification so the worker picks it up on its next run
+func (s *memoryStorage) Requeue(_ context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notifications[id]
+	if !ok || n.Status != model.StatusDead {
+		return fmt.Errorf("dead notification %d: %w", id, appErr.ErrNotFound)
+	}
+	now := time.Now()
+	n.Status = model.StatusPending
+	n.Attempts = 0
+	n.NextAttemptAt = now
+	n.LastError = ""
+	n.UpdatedAt = now
+	return nil
+}
+
+// SaveDeliveries stores the deliveries of a notification; none are stored when one of them
+// already exists for its notification and channel.
+func (s *memoryStorage) SaveDeliveries(_ context.Context, deliveries []model.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, d := range deliveries {
+		if _, ok := s.notifications[d.NotificationID]; !ok {
+			return fmt.Errorf("failed to insert delivery: notification %d: %w", d.NotificationID, appErr.ErrNotFound)
+		}
+		exists := slices.ContainsFunc(deliveries[:i], func(o model.Delivery) bool {
+			return o.NotificationID == d.NotificationID && o.ChannelID == d.ChannelID
+		})
+		for _, o := range s.deliveries {
+			exists = exists || (o.NotificationID == d.NotificationID && o.ChannelID == d.ChannelID)
+		}
+		if exists {
+			return fmt.Errorf("failed to insert delivery: channel %d of notification %d already exists",
+				d.ChannelID, d.NotificationID)
+		}
+	}
+
+	now := time.Now()
+	for i := range deliveries {
+		d := &deliveries[i]
+		s.nextDeliveryID++
+		d.ID = s.nextDeliveryID
+		d.CreatedAt, d.UpdatedAt = now, now
+		stored := *d
+		s.deliveries[d.ID] = &stored
+	}
+	return nil
+}
+
+// GetDeliveries returns the deliveries of a notification
+func (s *memoryStorage) GetDeliveries(_ context.Context, notificationID int) ([]model.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveries []model.Delivery
+	for _, d := range s.deliveries {
+		if d.NotificationID == notificationID {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b model.Delivery) int { return cmp.Compare(a.ID, b.ID) })
+	return deliveries, nil
+}
+
+// UpdateDeliveryStatus updates the status and last error of a delivery
+func (s *memoryStorage) UpdateDeliveryStatus(_ context.Context, id int, status, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return fmt.Errorf("delivery %d: %w", id, appErr.ErrNotFound)
+	}
+	d.Status, d.Error, d.UpdatedAt = status, errMsg, time.Now()
+	return nil
+}
+
+func (s *memoryStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+type memoryChannelStorage struct {
+	mu       sync.Mutex
+	channels map[int]*model.Channel
+	rules    map[int]*model.RoutingRule
+	// Channels and rules are numbered independently, like their tables
+	nextChannelID int
+	nextRuleID    int
+}
+
+// NewMemoryChannelStorage returns a ChannelStorage keeping channels and routing rules in memory
+func NewMemoryChannelStorage() ChannelStorage {
+	return &memoryChannelStorage{
+		channels: map[int]*model.Channel{},
+		rules:    map[int]*model.RoutingRule{},
+	}
+}
+
+func copyChannel(ch *model.Channel) model.Channel {
+	c := *ch
+	c.Config = maps.Clone(ch.Config)
+	return c
+}
+
+func copyRule(rule *model.RoutingRule) model.RoutingRule {
+	c := *rule
+	c.URLIDs = slices.Clone(rule.URLIDs)
+	c.Severities = slices.Clone(rule.Severities)
+	c.Labels = maps.Clone(rule.Labels)
+	c.ChannelIDs = slices.Clone(rule.ChannelIDs)
+	return c
+}
+
+// CreateChannel stores a new channel
+func (s *memoryChannelStorage) CreateChannel(_ context.Context, ch *model.Channel) error {
+	if ch == nil {
+		return fmt.Errorf("channel cannot be nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextChannelID++
+	ch.ID = s.nextChannelID
+	ch.CreatedAt = time.Now()
+	ch.UpdatedAt = ch.CreatedAt
+	stored := copyChannel(ch)
+	s.channels[ch.ID] = &stored
+	return nil
+}
+
+// GetChannel returns a channel owned by userID
+func (s *memoryChannelStorage) GetChannel(_ context.Context, userID string, id int) (*model.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, ok := s.channels[id]
+	if !ok || ch.UserID != userID {
+		return nil, fmt.Errorf("channel %d: %w", id, appErr.ErrNotFound)
+	}
+	c := copyChannel(ch)
+	return &c, nil
+}
+
+// ListChannels returns all channels owned by userID
+func (s *memoryChannelStorage) ListChannels(_ context.Context, userID string) ([]model.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := []model.Channel{}
+	for _, ch := range s.channels {
+		if ch.UserID == userID {
+			channels = append(channels, copyChannel(ch))
+		}
+	}
+	slices.SortFunc(channels, func(a, b model.Channel) int { return cmp.Compare(a.ID, b.ID) })
+	return channels, nil
+}
+
+// UpdateChannel replaces the mutable fields of a channel
+func (s *memoryChannelStorage) UpdateChannel(_ context.Context, ch *model.Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.channels[ch.ID]
+	if !ok || stored.UserID != ch.UserID {
+		return fmt.Errorf("channel %d: %w", ch.ID, appErr.ErrNotFound)
+	}
+	ch.CreatedAt, ch.UpdatedAt = stored.CreatedAt, time.Now()
+	updated := copyChannel(ch)
+	s.channels[ch.ID] = &updated
+	return nil
+}
+
+// DeleteChannel removes a channel owned by userID
+func (s *memoryChannelStorage) DeleteChannel(_ context.Context, userID string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.channels[id]; !ok || ch.UserID != userID {
+		return fmt.Errorf("channel %d: %w", id, appErr.ErrNotFound)
+	}
+	delete(s.channels, id)
+	return nil
+}
+
+// CreateRule stores a new routing rule
+func (s *memoryChannelStorage) CreateRule(_ context.Context, rule *model.RoutingRule) error {
+	if rule == nil {
+		return fmt.Errorf("routing rule cannot be nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextRuleID++
+	rule.ID = s.nextRuleID
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+	stored := copyRule(rule)
+	s.rules[rule.ID] = &stored
+	return nil
+}
+
+// GetRule returns a routing rule owned by userID
+func (s *memoryChannelStorage) GetRule(_ context.Context, userID string, id int) (*model.RoutingRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.rules[id]
+	if !ok || rule.UserID != userID {
+		return nil, fmt.Errorf("routing rule %d: %w", id, appErr.ErrNotFound)
+	}
+	r := copyRule(rule)
+	return &r, nil
+}
+
+// ListRules returns all routing rules owned by userID
+func (s *memoryChannelStorage) ListRules(_ context.Context, userID string) ([]model.RoutingRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := []model.RoutingRule{}
+	for _, rule := range s.rules {
+		if rule.UserID == userID {
+			rules = append(rules, copyRule(rule))
+		}
+	}
+	slices.SortFunc(rules, func(a, b model.RoutingRule) int { return cmp.Compare(a.ID, b.ID) })
+	return rules, nil
+}
+
+// UpdateRule replaces the mutable fields of a routing rule
+func (s *memoryChannelStorage) UpdateRule(_ context.Context, rule *model.RoutingRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.rules[rule.ID]
+	if !ok || stored.UserID != rule.UserID {
+		return fmt.Errorf("routing rule %d: %w", rule.ID, appErr.ErrNotFound)
+	}
+	rule.CreatedAt, rule.UpdatedAt = stored.CreatedAt, time.Now()
+	updated := copyRule(rule)
+	s.rules[rule.ID] = &updated
+	return nil
+}
+
+// DeleteRule removes a routing rule owned by userID
+func (s *memoryChannelStorage) DeleteRule(_ context.Context, userID string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rule, ok := s.rules[id]; !ok || rule.UserID != userID {
+		return fmt.Errorf("routing rule %d: %w", id, appErr.ErrNotFound)
+	}
+	delete(s.rules, id)
+	return nil
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+)
+
+// migrationsFS holds the schema migrations of the notification service, one directory per backend
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// MigrationTable records the applied migrations of the notification service
+const MigrationTable = "notification_schema_migrations"
+
+// NewMigrator returns the schema migrator of the notification service for a database of backend
+func NewMigrator(db *sql.DB, backend database.Backend) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrationsFS, "migrations/"+string(backend))
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, backend, fsys, MigrationTable)
+}
@@ -0,0 +1,68 @@
+-- Initial schema of the notification service. IF NOT EXISTS adopts databases created before migrations.
+CREATE TABLE IF NOT EXISTS notifications (
+    id               SERIAL PRIMARY KEY,
+    event_id         TEXT        NOT NULL DEFAULT '',
+    url_id           TEXT        NOT NULL,
+    user_id          TEXT        NOT NULL DEFAULT '',
+    type             TEXT        NOT NULL,
+    severity         TEXT        NOT NULL DEFAULT '',
+    incident_key     TEXT        NOT NULL DEFAULT '',
+    message          TEXT        NOT NULL,
+    labels           JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    status           TEXT        NOT NULL DEFAULT 'pending',
+    attempts         INTEGER     NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error       TEXT        NOT NULL DEFAULT '',
+    locked_by        TEXT        NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Deduplicates redelivered events; notifications created without an event ID are not deduplicated
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_event_id ON notifications (event_id) WHERE event_id <> '';
+CREATE INDEX IF NOT EXISTS idx_notifications_status_next_attempt ON notifications (status, next_attempt_at);
+-- Lets workers find expired leases of crashed replicas
+CREATE INDEX IF NOT EXISTS idx_notifications_lease ON notifications (lease_expires_at) WHERE status = 'processing';
+
+-- User owned delivery targets (webhook, pagerduty, ...)
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT        NOT NULL,
+    name       TEXT        NOT NULL,
+    type       TEXT        NOT NULL,
+    config     JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    enabled    BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channels_user_id ON notification_channels (user_id);
+
+-- Rules mapping monitors/labels/severities of a user to channels
+CREATE TABLE IF NOT EXISTS routing_rules (
+    id          SERIAL PRIMARY KEY,
+    user_id     TEXT        NOT NULL,
+    name        TEXT        NOT NULL,
+    url_ids     JSONB       NOT NULL DEFAULT '[]'::jsonb,
+    severities  JSONB       NOT NULL DEFAULT '[]'::jsonb,
+    labels      JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    channel_ids JSONB       NOT NULL DEFAULT '[]'::jsonb,
+    enabled     BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_routing_rules_user_id ON routing_rules (user_id);
+
+-- Per channel delivery status of a notification; channel_id 0 is the default channel
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id              SERIAL PRIMARY KEY,
+    notification_id INTEGER     NOT NULL REFERENCES notifications (id) ON DELETE CASCADE,
+    channel_id      INTEGER     NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending',
+    error           TEXT        NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (notification_id, channel_id)
+);
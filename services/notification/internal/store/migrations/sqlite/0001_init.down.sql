@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS routing_rules;
+DROP TABLE IF EXISTS notification_channels;
+DROP TABLE IF EXISTS notifications;
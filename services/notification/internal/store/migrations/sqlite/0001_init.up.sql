@@ -0,0 +1,62 @@
+-- SQLite counterpart of the Postgres migration of the same version
+CREATE TABLE IF NOT EXISTS notifications (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id         TEXT      NOT NULL DEFAULT '',
+    url_id           TEXT      NOT NULL,
+    user_id          TEXT      NOT NULL DEFAULT '',
+    type             TEXT      NOT NULL,
+    severity         TEXT      NOT NULL DEFAULT '',
+    incident_key     TEXT      NOT NULL DEFAULT '',
+    message          TEXT      NOT NULL,
+    labels           TEXT      NOT NULL DEFAULT '{}',
+    status           TEXT      NOT NULL DEFAULT 'pending',
+    attempts         INTEGER   NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error       TEXT      NOT NULL DEFAULT '',
+    locked_by        TEXT      NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMP,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_event_id ON notifications (event_id) WHERE event_id <> '';
+CREATE INDEX IF NOT EXISTS idx_notifications_status_next_attempt ON notifications (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    TEXT      NOT NULL,
+    name       TEXT      NOT NULL,
+    type       TEXT      NOT NULL,
+    config     TEXT      NOT NULL DEFAULT '{}',
+    enabled    BOOLEAN   NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channels_user_id ON notification_channels (user_id);
+
+CREATE TABLE IF NOT EXISTS routing_rules (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     TEXT      NOT NULL,
+    name        TEXT      NOT NULL,
+    url_ids     TEXT      NOT NULL DEFAULT '[]',
+    severities  TEXT      NOT NULL DEFAULT '[]',
+    labels      TEXT      NOT NULL DEFAULT '{}',
+    channel_ids TEXT      NOT NULL DEFAULT '[]',
+    enabled     BOOLEAN   NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_routing_rules_user_id ON routing_rules (user_id);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    notification_id INTEGER   NOT NULL REFERENCES notifications (id) ON DELETE CASCADE,
+    channel_id      INTEGER   NOT NULL,
+    status          TEXT      NOT NULL DEFAULT 'pending',
+    error           TEXT      NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (notification_id, channel_id)
+);
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+type postgresChannelStorage struct {
+	db *sqlx.DB
+}
+
+// NewPostgresChannelStorage creates a ChannelStorage on top of the shared connection pool
+func NewPostgresChannelStorage(db *sqlx.DB) ChannelStorage {
+	return &postgresChannelStorage{db: db}
+}
+
+// CreateChannel inserts a new channel
+func (s *postgresChannelStorage) CreateChannel(ctx context.Context, ch *model.Channel) error {
+	if ch == nil {
+		return fmt.Errorf("channel cannot be nil")
+	}
+	now := time.Now()
+	query := `INSERT INTO notification_channels
+		(user_id, name, type, config, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
+
+	row := s.db.QueryRowxContext(ctx, query, ch.UserID, ch.Name, ch.Type, ch.Config, ch.Enabled, now, now)
+	return row.Scan(&ch.ID, &ch.CreatedAt, &ch.UpdatedAt)
+}
+
+// GetChannel returns a channel owned by userID
+func (s *postgresChannelStorage) GetChannel(ctx context.Context, userID string, id int) (*model.Channel, error) {
+	var ch model.Channel
+	query := `SELECT * FROM notification_channels WHERE id = $1 AND user_id = $2`
+	if err := s.db.GetContext(ctx, &ch, query, id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("channel %d: %w", id, appErr.ErrNotFound)
+		}
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// ListChannels returns all channels owned by userID
+func (s *postgresChannelStorage) ListChannels(ctx context.Context, userID string) ([]model.Channel, error) {
+	channels := []model.Channel{}
+	query := `SELECT * FROM notification_channels WHERE user_id = $1 ORDER BY id`
+	if err := s.db.SelectContext(ctx, &channels, query, userID); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// UpdateChannel replaces the mutable fields of a channel
+func (s *postgresChannelStorage) UpdateChannel(ctx context.Context, ch *model.Channel) error {
+	query := `UPDATE notification_channels
+		SET name = $1, type = $2, config = $3, enabled = $4, updated_at = $5
+		WHERE id = $6 AND user_id = $7
+		RETURNING created_at, updated_at`
+
+	row := s.db.QueryRowxContext(ctx, query, ch.Name, ch.Type, ch.Config, ch.Enabled, time.Now(), ch.ID, ch.UserID)
+	if err := row.Scan(&ch.CreatedAt, &ch.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("channel %d: %w", ch.ID, appErr.ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteChannel removes a channel owned by userID
+func (s *postgresChannelStorage) DeleteChannel(ctx context.Context, userID string, id int) error {
+	query := `DELETE FROM notification_channels WHERE id = $1 AND user_id = $2`
+	return s.execOne(ctx, fmt.Sprintf("channel %d", id), query, id, userID)
+}
+
+// CreateRule inserts a new routing rule
+func (s *postgresChannelStorage) CreateRule(ctx context.Context, rule *model.RoutingRule) error {
+	if rule == nil {
+		return fmt.Errorf("routing rule cannot be nil")
+	}
+	now := time.Now()
+	query := `INSERT INTO routing_rules
+		(user_id, name, url_ids, severities, labels, channel_ids, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
+
+	row := s.db.QueryRowxContext(ctx, query, rule.UserID, rule.Name, rule.URLIDs, rule.Severities,
+		rule.Labels, rule.ChannelIDs, rule.Enabled, now, now)
+	return row.Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+}
+
+// GetRule returns a routing rule owned by userID
+func (s *postgresChannelStorage) GetRule(ctx context.Context, userID string, id int) (*model.RoutingRule, error) {
+	var rule model.RoutingRule
+	query := `SELECT * FROM routing_rules WHERE id = $1 AND user_id = $2`
+	if err := s.db.GetContext(ctx, &rule, query, id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("routing rule %d: %w", id, appErr.ErrNotFound)
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ListRules returns all routing rules owned by userID
+func (s *postgresChannelStorage) ListRules(ctx context.Context, userID string) ([]model.RoutingRule, error) {
+	rules := []model.RoutingRule{}
+	query := `SELECT * FROM routing_rules WHERE user_id = $1 ORDER BY id`
+	if err := s.db.SelectContext(ctx, &rules, query, userID); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// UpdateRule replaces the mutable fields of a routing rule
+func (s *postgresChannelStorage) UpdateRule(ctx context.Context, rule *model.RoutingRule) error {
+	query := `UPDATE routing_rules
+		SET name = $1, url_ids = $2, severities = $3, labels = $4, channel_ids = $5, enabled = $6, updated_at = $7
+		WHERE id = $8 AND user_id = $9
+		RETURNING created_at, updated_at`
+
+	row := s.db.QueryRowxContext(ctx, query, rule.Name, rule.URLIDs, rule.Severities, rule.Labels,
+		rule.ChannelIDs, rule.Enabled, time.Now(), rule.ID, rule.UserID)
+	if err := row.Scan(&rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("routing rule %d: %w", rule.ID, appErr.ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteRule removes a routing rule owned by userID
+func (s *postgresChannelStorage) DeleteRule(ctx context.Context, userID string, id int) error {
+	query := `DELETE FROM routing_rules WHERE id = $1 AND user_id = $2`
+	return s.execOne(ctx, fmt.Sprintf("routing rule %d", id), query, id, userID)
+}
+
+// execOne runs a statement that must affect exactly one row
+func (s *postgresChannelStorage) execOne(ctx context.Context, what, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", what, appErr.ErrNotFound)
+	}
+	return nil
+}
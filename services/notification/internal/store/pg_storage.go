@@ -2,12 +2,14 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
 	"github.com/kernelshard/hcaas/services/notification/internal/model"
 )
 
@@ -20,50 +22,158 @@ func NewPostgresStorage(db *sqlx.DB) (NotificationStorage, error) {
 	return &postgresStorage{db: db}, nil
 }
 
-// Save inserts a new notification with status pending
+// Save inserts a new notification with status pending.
+// A notification whose event ID was already stored is ignored and ErrDuplicate is returned.
 func (s *postgresStorage) Save(ctx context.Context, notif *model.Notification) error {
 	if notif == nil {
 		return fmt.Errorf("notification cannot be nil")
 	}
 	query := `INSERT INTO notifications
-		(url_id, type, message, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`
+		(event_id, url_id, user_id, type, severity, incident_key, message, labels, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (event_id) WHERE event_id <> '' DO NOTHING
+		RETURNING id, created_at, updated_at`
 
 	row := s.db.QueryRowxContext(
-		ctx, query, notif.UrlId, notif.Type, notif.Message, notif.Status, notif.CreatedAt, notif.UpdatedAt)
+		ctx, query, notif.EventID, notif.UrlId, notif.UserID, notif.Type, notif.Severity, notif.IncidentKey,
+		notif.Message, notif.Labels, notif.Status, notif.NextAttemptAt, notif.CreatedAt, notif.UpdatedAt)
 	if err := row.Scan(&notif.ID, &notif.CreatedAt, &notif.UpdatedAt); err != nil {
+		// DO NOTHING returns no row when the event ID already exists
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("event %s: %w", notif.EventID, appErr.ErrDuplicate)
+		}
 		return err
 	}
 	return nil
 }
 
-// GetPending returns notifications with status pending
-func (s *postgresStorage) GetPending(ctx context.Context) ([]model.Notification, error) {
+// ClaimPending claims a batch of due notifications for workerID. Reclaiming an expired lease
+// counts as a failed attempt.
+// FOR UPDATE SKIP LOCKED lets concurrent workers claim disjoint batches without blocking each other.
+func (s *postgresStorage) ClaimPending(ctx context.Context, workerID string, limit int, lease time.Duration) ([]model.Notification, error) {
 	var notifs []model.Notification
-	query := `SELECT * FROM notifications where status = $1`
-	err := s.db.SelectContext(ctx, &notifs, query, model.StatusPending)
+	query := `UPDATE notifications
+		SET status = $1, locked_by = $2, lease_expires_at = $3, updated_at = $4,
+			attempts = CASE WHEN status = $1 THEN attempts + 1 ELSE attempts END,
+			last_error = CASE WHEN status = $1 THEN $7 ELSE last_error END
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE (status = $5 AND next_attempt_at <= $4)
+			   OR (status = $1 AND lease_expires_at < $4)
+			ORDER BY next_attempt_at
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+	now := time.Now()
+	err := s.db.SelectContext(ctx, &notifs, query,
+		model.StatusProcessing, workerID, now.Add(lease), now, model.StatusPending, limit, leaseExpiredError)
 	if err != nil {
 		return nil, err
 	}
 	return notifs, nil
 }
 
-// UpdateStatus updates notification status and timestamp
-func (s *postgresStorage) UpdateStatus(ctx context.Context, id int, status string) error {
-	query := "UPDATE notifications SET status=$1, updated_at=$2 where id=$3"
-	res, err := s.db.ExecContext(ctx, query, status, time.Now(), id)
+// UpdateAttempt records the outcome of a delivery round of a notification and releases its lease
+func (s *postgresStorage) UpdateAttempt(ctx context.Context, n *model.Notification) error {
+	query := `UPDATE notifications
+		SET status=$1, attempts=$2, next_attempt_at=$3, last_error=$4, updated_at=$5,
+			locked_by='', lease_expires_at=NULL
+		WHERE id=$6 AND status=$7 AND locked_by=$8`
+	n.UpdatedAt = time.Now()
+	res, err := s.db.ExecContext(ctx, query, n.Status, n.Attempts, n.NextAttemptAt, n.LastError, n.UpdatedAt,
+		n.ID, model.StatusProcessing, n.LockedBy)
 	if err != nil {
 		return err
 	}
-	// Always check the error returned
-	//by RowsAffected.
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("notification %d: %w", n.ID, appErr.ErrLeaseLost)
+	}
+	n.LockedBy, n.LeaseExpiresAt = "", nil
+	return nil
+}
+
+// ListDead returns a page of dead notifications
+func (s *postgresStorage) ListDead(ctx context.Context, limit, offset int) ([]model.Notification, error) {
+	notifs := []model.Notification{}
+	query := `SELECT * FROM notifications WHERE status = $1 ORDER BY updated_at DESC, id DESC LIMIT $2 OFFSET $3`
+	if err := s.db.SelectContext(ctx, &notifs, query, model.StatusDead, limit, offset); err != nil {
+		return nil, err
+	}
+	return notifs, nil
+}
 
+// Requeue resets a dead notification so the worker picks it up on its next run.
+// Failed deliveries are retried, deliveries that already succeeded are kept.
+func (s *postgresStorage) Requeue(ctx context.Context, id int) error {
+	query := `UPDATE notifications
+		SET status=$1, attempts=0, next_attempt_at=$2, last_error='', updated_at=$2
+		WHERE id=$3 AND status=$4`
+	res, err := s.db.ExecContext(ctx, query, model.StatusPending, time.Now(), id, model.StatusDead)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("dead notification %d: %w", id, appErr.ErrNotFound)
+	}
+	return nil
+}
+
+// SaveDeliveries inserts the deliveries of a notification in a single transaction
+func (s *postgresStorage) SaveDeliveries(ctx context.Context, deliveries []model.Delivery) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO notification_deliveries
+		(notification_id, channel_id, status, error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	now := time.Now()
+	for i := range deliveries {
+		d := &deliveries[i]
+		d.CreatedAt, d.UpdatedAt = now, now
+		row := tx.QueryRowxContext(ctx, query, d.NotificationID, d.ChannelID, d.Status, d.Error, d.CreatedAt, d.UpdatedAt)
+		if err := row.Scan(&d.ID); err != nil {
+			return fmt.Errorf("failed to insert delivery: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDeliveries returns the deliveries of a notification
+func (s *postgresStorage) GetDeliveries(ctx context.Context, notificationID int) ([]model.Delivery, error) {
+	var deliveries []model.Delivery
+	query := `SELECT * FROM notification_deliveries WHERE notification_id = $1 ORDER BY id`
+	if err := s.db.SelectContext(ctx, &deliveries, query, notificationID); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateDeliveryStatus updates the status and last error of a delivery
+func (s *postgresStorage) UpdateDeliveryStatus(ctx context.Context, id int, status, errMsg string) error {
+	query := "UPDATE notification_deliveries SET status=$1, error=$2, updated_at=$3 WHERE id=$4"
+	res, err := s.db.ExecContext(ctx, query, status, errMsg, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 	if rowsAffected == 0 {
-		return errors.New("no rows were updated, check if the ID is correct")
+		return fmt.Errorf("delivery %d: %w", id, appErr.ErrNotFound)
 	}
 	return nil
 }
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+)
+
+// sqliteStorage runs the portable statements of the Postgres store and overrides those
+// relying on row locks or on comparing timestamps.
+//
+// Timestamps are stored as text, so they are compared through julianday(): the text of
+// two times only sorts like the times themselves when both have the same offset and
+// fractional digits.
+type sqliteStorage struct {
+	*postgresStorage
+}
+
+// NewSQLiteStorage creates a NotificationStorage on top of a SQLite database
+func NewSQLiteStorage(db *sqlx.DB) NotificationStorage {
+	return &sqliteStorage{postgresStorage: &postgresStorage{db: db}}
+}
+
+// ClaimPending claims a batch of due notifications for workerID. Reclaiming an expired lease
+// counts as a failed attempt.
+// SQLite serializes writers, so a single UPDATE claims the batch atomically without row locks.
+func (s *sqliteStorage) ClaimPending(ctx context.Context, workerID string, limit int, lease time.Duration) ([]model.Notification, error) {
+	var notifs []model.Notification
+	query := `UPDATE notifications
+		SET status = $1, locked_by = $2, lease_expires_at = $3, updated_at = $4,
+			attempts = CASE WHEN status = $1 THEN attempts + 1 ELSE attempts END,
+			last_error = CASE WHEN status = $1 THEN $7 ELSE last_error END
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE (status = $5 AND julianday(next_attempt_at) <= julianday($4))
+			   OR (status = $1 AND julianday(lease_expires_at) < julianday($4))
+			ORDER BY julianday(next_attempt_at)
+			LIMIT $6
+		)
+		RETURNING *`
+	now := time.Now()
+	err := s.db.SelectContext(ctx, &notifs, query,
+		model.StatusProcessing, workerID, now.Add(lease), now, model.StatusPending, limit, leaseExpiredError)
+	if err != nil {
+		return nil, err
+	}
+	return notifs, nil
+}
+
+// ListDead returns a page of dead notifications
+func (s *sqliteStorage) ListDead(ctx context.Context, limit, offset int) ([]model.Notification, error) {
+	notifs := []model.Notification{}
+	query := `SELECT * FROM notifications WHERE status = $1
+		ORDER BY julianday(updated_at) DESC, id DESC LIMIT $2 OFFSET $3`
+	if err := s.db.SelectContext(ctx, &notifs, query, model.StatusDead, limit, offset); err != nil {
+		return nil, err
+	}
+	return notifs, nil
+}
+
+// NewSQLiteChannelStorage creates a ChannelStorage on top of a SQLite database.
+// The statements of the Postgres channel store are portable.
+func NewSQLiteChannelStorage(db *sqlx.DB) ChannelStorage {
+	return &postgresChannelStorage{db: db}
+}
@@ -0,0 +1,351 @@
+// Package storetest is the conformance suite every backend of the notification stores must pass.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appErr "github.com/kernelshard/hcaas/services/notification/internal/errors"
+	"github.com/kernelshard/hcaas/services/notification/internal/model"
+	"github.com/kernelshard/hcaas/services/notification/internal/store"
+)
+
+// Factory returns empty stores sharing one database.
+type Factory func(t *testing.T) (store.NotificationStorage, store.ChannelStorage)
+
+// Run runs the conformance suite against the stores returned by newStores.
+func Run(t *testing.T, newStores Factory) {
+	t.Run("SaveDeduplicates", func(t *testing.T) { testSaveDeduplicates(t, newStores) })
+	t.Run("ClaimPending", func(t *testing.T) { testClaimPending(t, newStores) })
+	t.Run("UpdateAttempt", func(t *testing.T) { testUpdateAttempt(t, newStores) })
+	t.Run("DeadAndRequeue", func(t *testing.T) { testDeadAndRequeue(t, newStores) })
+	t.Run("Deliveries", func(t *testing.T) { testDeliveries(t, newStores) })
+	t.Run("Channels", func(t *testing.T) { testChannels(t, newStores) })
+	t.Run("Rules", func(t *testing.T) { testRules(t, newStores) })
+}
+
+func newNotification(eventID string, nextAttemptAt time.Time) *model.Notification {
+	now := time.Now()
+	return &model.Notification{
+		EventID:       eventID,
+		UrlId:         "url-1",
+		UserID:        "user-1",
+		Type:          model.TypeURLUnhealthy,
+		Severity:      model.SeverityCritical,
+		IncidentKey:   "hcaas-url-url-1",
+		Message:       "url-1 is down",
+		Labels:        model.StringMap{"env": "prod"},
+		Status:        model.StatusPending,
+		NextAttemptAt: nextAttemptAt,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func mustSave(t *testing.T, s store.NotificationStorage, notifs ...*model.Notification) {
+	t.Helper()
+	for _, n := range notifs {
+		if err := s.Save(context.Background(), n); err != nil {
+			t.Fatalf("Save(%s) error = %v", n.EventID, err)
+		}
+	}
+}
+
+func mustClaim(t *testing.T, s store.NotificationStorage, workerID string, limit int, lease time.Duration) []model.Notification {
+	t.Helper()
+	claimed, err := s.ClaimPending(context.Background(), workerID, limit, lease)
+	if err != nil {
+		t.Fatalf("ClaimPending() error = %v", err)
+	}
+	return claimed
+}
+
+func testSaveDeduplicates(t *testing.T, newStores Factory) {
+	s, _ := newStores(t)
+	first := newNotification("e1", time.Now())
+	mustSave(t, s, first)
+	if first.ID == 0 {
+		t.Fatal("Save() did not assign an ID")
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		eventID string
+		wantErr error
+	}{
+		{name: "redelivered event", eventID: "e1", wantErr: appErr.ErrDuplicate},
+		{name: "new event", eventID: "e2"},
+		{name: "without event id", eventID: ""},
+		{name: "another without event id", eventID: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Save(context.Background(), newNotification(tt.eventID, time.Now()))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Save() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func testClaimPending(t *testing.T, newStores Factory) {
+	s, _ := newStores(t)
+	now := time.Now()
+	later := newNotification("later", now.Add(time.Hour))
+	second := newNotification("second", now.Add(-time.Minute))
+	first := newNotification("first", now.Add(-time.Hour))
+	mustSave(t, s, later, second, first)
+
+	claimed := mustClaim(t, s, "worker-1", 10, time.Minute)
+	if len(claimed) != 2 {
+		t.Fatalf("ClaimPending() claimed %d notifications, want the 2 due ones", len(claimed))
+	}
+	for _, n := range claimed {
+		if n.Status != model.StatusProcessing || n.LockedBy != "worker-1" || n.LeaseExpiresAt == nil {
+			t.Errorf("claimed notification %s = %s by %q, want processing by worker-1 under a lease", n.EventID, n.Status, n.LockedBy)
+		}
+		if n.Labels["env"] != "prod" {
+			t.Errorf("claimed notification %s has labels %v, want env=prod", n.EventID, n.Labels)
+		}
+	}
+
+	if again := mustClaim(t, s, "worker-2", 10, time.Minute); len(again) != 0 {
+		t.Errorf("ClaimPending() claimed %d notifications held under a lease, want 0", len(again))
+	}
+
+	// A claim with an already expired lease is recovered by the next worker
+	s2, _ := newStores(t)
+	mustSave(t, s2, newNotification("e1", now.Add(-time.Minute)))
+	mustClaim(t, s2, "crashed", 10, -time.Second)
+	reclaimed := mustClaim(t, s2, "worker-2", 10, time.Minute)
+	if len(reclaimed) != 1 || reclaimed[0].LockedBy != "worker-2" {
+		t.Errorf("ClaimPending() reclaimed %+v, want the expired claim for worker-2", reclaimed)
+	}
+
+	// Every reclaim of an expired lease counts as a failed attempt, so a notification that keeps
+	// crashing its worker uses up its retry budget
+	s4, _ := newStores(t)
+	mustSave(t, s4, newNotification("e1", now.Add(-time.Minute)))
+	if first := mustClaim(t, s4, "crashed-0", 10, -time.Second); len(first) != 1 || first[0].Attempts != 0 {
+		t.Fatalf("ClaimPending() = %+v, want the new notification without attempts", first)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		reclaimed := mustClaim(t, s4, "crashed", 10, -time.Second)
+		if len(reclaimed) != 1 || reclaimed[0].Attempts != attempt || reclaimed[0].LastError == "" {
+			t.Fatalf("reclaim %d: ClaimPending() = %+v, want %d attempts with the lease error", attempt, reclaimed, attempt)
+		}
+	}
+
+	// The oldest due notification is claimed first
+	s3, _ := newStores(t)
+	mustSave(t, s3, newNotification("second", now.Add(-time.Minute)), newNotification("first", now.Add(-time.Hour)))
+	if batch := mustClaim(t, s3, "worker-1", 1, time.Minute); len(batch) != 1 || batch[0].EventID != "first" {
+		t.Errorf("ClaimPending() = %+v, want the oldest due notification", batch)
+	}
+}
+
+func testUpdateAttempt(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+	mustSave(t, s, newNotification("e1", time.Now().Add(-time.Minute)))
+	n := mustClaim(t, s, "worker-1", 1, time.Minute)[0]
+
+	stale := n
+	stale.LockedBy = "worker-2"
+	if err := s.UpdateAttempt(ctx, &stale); !errors.Is(err, appErr.ErrLeaseLost) {
+		t.Errorf("UpdateAttempt() by another worker error = %v, want ErrLeaseLost", err)
+	}
+
+	n.Status, n.Attempts, n.LastError = model.StatusPending, 1, "timeout"
+	n.NextAttemptAt = time.Now().Add(-time.Second)
+	if err := s.UpdateAttempt(ctx, &n); err != nil {
+		t.Fatalf("UpdateAttempt() error = %v", err)
+	}
+	if n.LockedBy != "" || n.LeaseExpiresAt != nil {
+		t.Errorf("UpdateAttempt() kept the lease of %q", n.LockedBy)
+	}
+	if err := s.UpdateAttempt(ctx, &n); !errors.Is(err, appErr.ErrLeaseLost) {
+		t.Errorf("UpdateAttempt() of a released notification error = %v, want ErrLeaseLost", err)
+	}
+
+	retried := mustClaim(t, s, "worker-1", 1, time.Minute)
+	if len(retried) != 1 || retried[0].Attempts != 1 || retried[0].LastError != "timeout" {
+		t.Errorf("ClaimPending() after a failed attempt = %+v, want the retried notification", retried)
+	}
+}
+
+func testDeadAndRequeue(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+	mustSave(t, s, newNotification("e1", time.Now().Add(-time.Minute)), newNotification("e2", time.Now().Add(-time.Minute)))
+
+	for _, n := range mustClaim(t, s, "worker-1", 10, time.Minute) {
+		n.Status, n.Attempts, n.LastError = model.StatusDead, 5, "gave up"
+		if err := s.UpdateAttempt(ctx, &n); err != nil {
+			t.Fatalf("UpdateAttempt() error = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond) // distinct updated_at
+	}
+
+	dead, err := s.ListDead(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("ListDead() error = %v", err)
+	}
+	if len(dead) != 2 || !dead[0].UpdatedAt.After(dead[1].UpdatedAt) {
+		t.Fatalf("ListDead() = %+v, want 2 notifications, most recently failed first", dead)
+	}
+	if page, _ := s.ListDead(ctx, 1, 1); len(page) != 1 || page[0].ID != dead[1].ID {
+		t.Errorf("ListDead(1, 1) = %+v, want the second dead notification", page)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		id      int
+		wantErr error
+	}{
+		{name: "dead notification", id: dead[0].ID},
+		{name: "already requeued", id: dead[0].ID, wantErr: appErr.ErrNotFound},
+		{name: "unknown notification", id: 999999, wantErr: appErr.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := s.Requeue(ctx, tt.id); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Requeue() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	requeued := mustClaim(t, s, "worker-1", 10, time.Minute)
+	if len(requeued) != 1 || requeued[0].ID != dead[0].ID || requeued[0].Attempts != 0 {
+		t.Errorf("ClaimPending() after Requeue() = %+v, want the requeued notification with a fresh budget", requeued)
+	}
+}
+
+func testDeliveries(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+	n := newNotification("e1", time.Now())
+	mustSave(t, s, n)
+
+	deliveries := []model.Delivery{
+		{NotificationID: n.ID, ChannelID: model.DefaultChannelID, Status: model.StatusPending},
+		{NotificationID: n.ID, ChannelID: 7, Status: model.StatusPending},
+	}
+	if err := s.SaveDeliveries(ctx, deliveries); err != nil {
+		t.Fatalf("SaveDeliveries() error = %v", err)
+	}
+	if deliveries[0].ID == 0 || deliveries[1].ID == 0 {
+		t.Fatalf("SaveDeliveries() did not assign IDs: %+v", deliveries)
+	}
+	if err := s.SaveDeliveries(ctx, deliveries[:1]); err == nil {
+		t.Error("SaveDeliveries() of an existing channel delivery succeeded, want an error")
+	}
+
+	if err := s.UpdateDeliveryStatus(ctx, deliveries[1].ID, model.StatusFailed, "refused"); err != nil {
+		t.Fatalf("UpdateDeliveryStatus() error = %v", err)
+	}
+	if err := s.UpdateDeliveryStatus(ctx, 999999, model.StatusSent, ""); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("UpdateDeliveryStatus() of an unknown delivery error = %v, want ErrNotFound", err)
+	}
+
+	got, err := s.GetDeliveries(ctx, n.ID)
+	if err != nil {
+		t.Fatalf("GetDeliveries() error = %v", err)
+	}
+	if len(got) != 2 || got[1].Status != model.StatusFailed || got[1].Error != "refused" {
+		t.Errorf("GetDeliveries() = %+v, want the second delivery failed", got)
+	}
+}
+
+func testChannels(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	_, s := newStores(t)
+
+	ch := &model.Channel{UserID: "user-1", Name: "ops", Type: model.ChannelTypeWebhook,
+		Config: model.StringMap{"url": "https://example.com/hook"}, Enabled: true}
+	if err := s.CreateChannel(ctx, ch); err != nil {
+		t.Fatalf("CreateChannel() error = %v", err)
+	}
+
+	got, err := s.GetChannel(ctx, "user-1", ch.ID)
+	if err != nil {
+		t.Fatalf("GetChannel() error = %v", err)
+	}
+	if got.Name != "ops" || !got.Enabled || got.Config["url"] != "https://example.com/hook" {
+		t.Errorf("GetChannel() = %+v, want %+v", *got, *ch)
+	}
+
+	ch.Name, ch.Enabled = "ops-disabled", false
+	if err := s.UpdateChannel(ctx, ch); err != nil {
+		t.Fatalf("UpdateChannel() error = %v", err)
+	}
+	if list, _ := s.ListChannels(ctx, "user-1"); len(list) != 1 || list[0].Enabled || list[0].Name != "ops-disabled" {
+		t.Errorf("ListChannels() = %+v, want the updated channel", list)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "get of another user", call: func() error { _, err := s.GetChannel(ctx, "user-2", ch.ID); return err }},
+		{name: "update of another user", call: func() error {
+			other := *ch
+			other.UserID = "user-2"
+			return s.UpdateChannel(ctx, &other)
+		}},
+		{name: "delete of another user", call: func() error { return s.DeleteChannel(ctx, "user-2", ch.ID) }},
+		{name: "get after delete", call: func() error {
+			if err := s.DeleteChannel(ctx, "user-1", ch.ID); err != nil {
+				return err
+			}
+			_, err := s.GetChannel(ctx, "user-1", ch.ID)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, appErr.ErrNotFound) {
+			t.Errorf("%s: error = %v, want ErrNotFound", tt.name, err)
+		}
+	}
+}
+
+func testRules(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	_, s := newStores(t)
+
+	rule := &model.RoutingRule{UserID: "user-1", Name: "prod", URLIDs: model.StringList{"url-1"},
+		Severities: model.StringList{model.SeverityCritical}, Labels: model.StringMap{"env": "prod"},
+		ChannelIDs: model.IntList{1, 2}, Enabled: true}
+	if err := s.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule() error = %v", err)
+	}
+
+	got, err := s.GetRule(ctx, "user-1", rule.ID)
+	if err != nil {
+		t.Fatalf("GetRule() error = %v", err)
+	}
+	if len(got.URLIDs) != 1 || len(got.ChannelIDs) != 2 || got.Labels["env"] != "prod" || !got.Enabled {
+		t.Errorf("GetRule() = %+v, want %+v", *got, *rule)
+	}
+
+	rule.ChannelIDs = model.IntList{3}
+	if err := s.UpdateRule(ctx, rule); err != nil {
+		t.Fatalf("UpdateRule() error = %v", err)
+	}
+	if list, _ := s.ListRules(ctx, "user-1"); len(list) != 1 || len(list[0].ChannelIDs) != 1 || list[0].ChannelIDs[0] != 3 {
+		t.Errorf("ListRules() = %+v, want the updated rule", list)
+	}
+	if list, _ := s.ListRules(ctx, "user-2"); len(list) != 0 {
+		t.Errorf("ListRules() of another user = %+v, want none", list)
+	}
+
+	if err := s.DeleteRule(ctx, "user-1", rule.ID); err != nil {
+		t.Fatalf("DeleteRule() error = %v", err)
+	}
+	if _, err := s.GetRule(ctx, "user-1", rule.ID); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("GetRule() after DeleteRule() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package app wires the URL service: its storage, HTTP routes, URL checker and outbox relay.
+// It is used by cmd/url and embedded by the all-in-one binary.
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
+	"github.com/kernelshard/hcaas/pkg/bus"
+	"github.com/kernelshard/hcaas/pkg/bus/natsbus"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+	"github.com/kernelshard/hcaas/services/url/internal/checker"
+	"github.com/kernelshard/hcaas/services/url/internal/config"
+	"github.com/kernelshard/hcaas/services/url/internal/handler"
+	"github.com/kernelshard/hcaas/services/url/internal/kafka"
+	"github.com/kernelshard/hcaas/services/url/internal/messaging"
+	"github.com/kernelshard/hcaas/services/url/internal/metrics"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/kernelshard/hcaas/services/url/internal/outbox"
+	"github.com/kernelshard/hcaas/services/url/internal/router"
+	"github.com/kernelshard/hcaas/services/url/internal/service"
+	"github.com/kernelshard/hcaas/services/url/internal/storage"
+)
+
+// ServiceName identifies the URL service in traces and metrics.
+const ServiceName = "url-service"
+
+const (
+	checkInterval    = 1 * time.Minute
+	checkTimeout     = 5 * time.Second
+	concurrencyLimit = 10
+)
+
+// Config holds the settings of the URL service.
+type Config = config.Config
+
+// LoadConfig reads the URL service settings from environment variables.
+func LoadConfig() (*Config, error) {
+	return config.LoadConfig()
+}
+
+// Options replace the remote dependencies of the service, e.g. with in-process ones.
+type Options struct {
+	// Validator validates bearer tokens. Defaults to the auth service at AUTH_SVC_URL, as
+	// selected by AUTH_VALIDATION.
+	Validator authn.Validator
+	// Publisher receives notification events. Defaults to the bus selected by BUS_DRIVER.
+	Publisher bus.Publisher
+}
+
+// App is a wired URL service.
+type App struct {
+	handler  http.Handler
+	urlSvc   service.URLService
+	producer messaging.NotificationProducer
+	checker  *checker.URLChecker
+	relay    *outbox.Relay
+	stores   *storage.Stores
+	wg       sync.WaitGroup
+	logger   *slog.Logger
+}
+
+var registerMetrics sync.Once
+
+// New connects to the database and the message bus and wires the service.
+func New(ctx context.Context, cfg *Config, opts Options, l *slog.Logger) (*App, error) {
+	registerMetrics.Do(metrics.Init)
+	tracer := otelkit.New(ServiceName)
+	a := &App{logger: l}
+
+	// The database backend is selected by the scheme of DATABASE_URL
+	stores, err := storage.Open(ctx, cfg.DBConfig.URL, tracer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	a.stores = stores
+
+	if cfg.DBConfig.MigrateOnStart {
+		n, err := stores.Migrator.Up(ctx)
+		if err != nil {
+			stores.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		l.Info("Database schema migrated", "applied", n)
+	}
+
+	// Initialize layers
+	ps := stores.URLs
+	urlSvc := service.NewURLService(ps, audit.NewRecorder(stores.Audit, l), l, tracer)
+	healthSvc := service.NewHealthService(ps, l)
+	a.urlSvc = urlSvc
+
+	// Message bus producer setup, selected by BUS_DRIVER unless a publisher is given
+	if opts.Publisher != nil {
+		a.producer = messaging.NewBusProducer(opts.Publisher, cfg.KafkaConfig.NotifTopic, l, tracer)
+	} else if a.producer, err = newNotificationProducer(ctx, cfg, l, &a.wg, tracer); err != nil {
+		stores.Close()
+		return nil, fmt.Errorf("failed to create notification producer: %w", err)
+	}
+
+	httpClient := &http.Client{Timeout: checkTimeout}
+	a.checker = checker.NewURLChecker(urlSvc, l, httpClient, checkInterval, tracer, concurrencyLimit)
+
+	// Status transitions are written to the outbox by the checker and published from there
+	a.relay = outbox.NewRelay(stores.Outbox, a.producer, cfg.OutboxConfig, l, tracer)
+
+	validator := opts.Validator
+	if validator == nil {
+		validator = newValidator(cfg)
+	}
+	urlHandler := handler.NewURLHandler(urlSvc, l, tracer)
+	adminHandler := handler.NewAdminHandler(stores.Audit, l, tracer)
+	healthHandler := handler.NewHealthHandler(healthSvc, l)
+	a.handler = router.NewRouter(urlHandler, adminHandler, healthHandler, validator,
+		cfg.AppCfg.AdminUserIDs, cfg.AppCfg.TrustProxyHeaders, l, ServiceName)
+
+	return a, nil
+}
+
+// Migrate runs the migrate subcommand args, e.g. ["up"], against the database of cfg and
+// writes its report to w. See migrate.Run.
+func Migrate(ctx context.Context, cfg *Config, args []string, w io.Writer) error {
+	stores, err := storage.Open(ctx, cfg.DBConfig.URL, otelkit.New(ServiceName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer stores.Close()
+	return migrate.Run(ctx, stores.Migrator, args, w)
+}
+
+// Handler returns the HTTP routes of the service.
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// DeleteUserURLs deletes the URLs of a user in process, e.g. when the auth service deletes
+// the account. The deletions are audited as acts of the user unless ctx names an actor.
+func (a *App) DeleteUserURLs(ctx context.Context, userID string) error {
+	ctx = context.WithValue(ctx, model.ContextUserIDKey, userID)
+	if actorID, _ := audit.ActorFrom(ctx); actorID == "" {
+		ctx = audit.WithActor(ctx, userID, "")
+	}
+	_, err := a.urlSvc.DeleteAllByUserID(ctx)
+	return err
+}
+
+// Run starts the producer, the URL checker and the outbox relay and blocks until ctx is cancelled.
+func (a *App) Run(ctx context.Context) {
+	a.producer.Start(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		a.checker.Start(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		a.relay.Start(ctx)
+	}()
+	wg.Wait()
+}
+
+// Close flushes the producer and closes the database. Run must have returned.
+func (a *App) Close() {
+	a.producer.Close(context.Background())
+	a.stores.Close()
+}
+
+// newNotificationProducer creates the producer for the configured message bus
+func newNotificationProducer(
+	ctx context.Context,
+	cfg *config.Config,
+	l *slog.Logger,
+	wg *sync.WaitGroup,
+	tracer *otelkit.Tracer,
+) (messaging.NotificationProducer, error) {
+	topic := cfg.KafkaConfig.NotifTopic
+
+	switch cfg.BusConfig.Driver {
+	case config.BusDriverNATS:
+		natsBus, err := natsbus.Connect(ctx, cfg.BusConfig.NATS.URL, cfg.BusConfig.NATS.Stream, cfg.BusConfig.NATS.SubjectPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return messaging.NewBusProducer(natsBus, topic, l, tracer), nil
+	}
+
+	// Kafka producers setup
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll // Acks from all replicas
+	saramaConfig.Producer.Retry.Max = 5
+	saramaConfig.Producer.Return.Successes = true // Acknowledgements are reported back to Publish
+	saramaConfig.Producer.Return.Errors = true
+	saramaConfig.ClientID = "url-service-producer"
+
+	kafkaAsyncProducer, err := sarama.NewAsyncProducer(cfg.KafkaConfig.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sarama producer: %w", err)
+	}
+	return kafka.NewProducer(kafkaAsyncProducer, topic, cfg.KafkaConfig.PublishTimeout, l, wg, tracer), nil
+}
+
+// newValidator creates the token validator selected by AUTH_VALIDATION
+func newValidator(cfg *config.Config) authn.Validator {
+	client := &http.Client{Timeout: checkTimeout}
+	remote := authn.NewRemoteValidator(cfg.AppCfg.AuthServiceURL, client)
+
+	// API keys are opaque, only the auth service can validate them
+	switch cfg.AppCfg.AuthValidation {
+	case "remote":
+		return remote
+	case "local":
+		return authn.WithAPIKeys(authn.NewJWKSValidator(cfg.AppCfg.AuthServiceURL, client, nil), remote)
+	}
+	return authn.WithAPIKeys(authn.NewJWKSValidator(cfg.AppCfg.AuthServiceURL, client, remote), remote)
+}
@@ -7,27 +7,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
-	"github.com/IBM/sarama"
 	"github.com/joho/godotenv"
 
-	"github.com/kernelshard/hcaas/services/url/internal/checker"
-	"github.com/kernelshard/hcaas/services/url/internal/config"
-	"github.com/kernelshard/hcaas/services/url/internal/handler"
-	"github.com/kernelshard/hcaas/services/url/internal/kafka"
+	"github.com/kernelshard/hcaas/services/url/app"
 	"github.com/kernelshard/hcaas/services/url/internal/logger"
-	"github.com/kernelshard/hcaas/services/url/internal/metrics"
-	"github.com/kernelshard/hcaas/services/url/internal/router"
-	"github.com/kernelshard/hcaas/services/url/internal/service"
-	"github.com/kernelshard/hcaas/services/url/internal/storage"
 	"github.com/samims/otelkit"
 )
 
 const (
-	serviceName = "url-service"
+	serviceName = app.ServiceName
 	// collectorEndpoint = "otel-collector:4371" //mEnsure this matches your docker-compose setup
 	// collectorEndpoint = "hcaas_jaeger_all_in_one:4317"
 )
@@ -41,19 +32,26 @@ func main() {
 	l := logger.NewLogger()
 	slog.SetDefault(l)
 
-	metrics.Init()
-
 	if err := godotenv.Load(); err != nil {
 		l.Error("Error loading .env file", "err", err)
 	}
 
 	// Load configuration from environment variables
-	cfg, err := config.LoadConfig()
+	cfg, err := app.LoadConfig()
 	if err != nil {
 		l.Error("Failed to load configuration", "err", err)
 		os.Exit(1)
 	}
 
+	// "url migrate up|down [N]|status" manages the database schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(ctx, cfg, os.Args[2:], os.Stdout); err != nil {
+			l.Error("Migration failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup OpenTelemetry tracing with custom provider configuration
 	tracingConfig := otelkit.NewProviderConfig(serviceName, "v1.0.0").
 		WithOTLPExporter(cfg.OTLPConfig.Endpoint, cfg.OTLPConfig.Protocol, cfg.OTLPConfig.Insecure).
@@ -81,55 +79,23 @@ func main() {
 		}
 	}()
 
-	tracer := otelkit.New(serviceName)
-
-	dbPool, err := storage.NewPostgresPool(ctx, cfg.DBConfig.URL)
+	urlApp, err := app.New(ctx, cfg, app.Options{}, l)
 	if err != nil {
-		l.Error("Failed to connect to database", "err", err)
+		l.Error("Failed to initialize URL service", "err", err)
 		os.Exit(1)
 	}
-	defer dbPool.Close()
-
-	// Initialize layers
-	ps := storage.NewPostgresStorage(dbPool, tracer)
-	urlSvc := service.NewURLService(ps, l, tracer)
-	healthSvc := service.NewHealthService(ps, l)
-
-	// Kafka producers setup
-	saramaConfig := sarama.NewConfig()
-	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll // Acks from all replicas
-	saramaConfig.Producer.Retry.Max = 5
-	saramaConfig.Producer.Return.Successes = true
-	saramaConfig.ClientID = "url-service-producer"
+	defer urlApp.Close()
 
-	kafkaAsyncProducer, err := sarama.NewAsyncProducer(cfg.KafkaConfig.Brokers, saramaConfig)
-	if err != nil {
-		l.Error("Failed to create sarama producer", slog.Any("error", err))
-		os.Exit(1)
-	}
-
-	var wg sync.WaitGroup
-
-	l.Info("Before NewProducer")
-	notificationProducer := kafka.NewProducer(kafkaAsyncProducer, cfg.KafkaConfig.NotifTopic, l, &wg, tracer)
-	l.Info("After NewProducer")
-
-	l.Info("Calling notificationProducer.Start()")
-	notificationProducer.Start(ctx)
-
-	httpClient := &http.Client{Timeout: 5 * time.Second}
-	concurrencyLimit := 10
-	chkr := checker.NewURLChecker(urlSvc, l, httpClient, 1*time.Minute, notificationProducer, tracer, concurrencyLimit)
-	go chkr.Start(ctx)
-
-	urlHandler := handler.NewURLHandler(urlSvc, l, tracer)
-	healthHandler := handler.NewHealthHandler(healthSvc, l)
+	// Checker, outbox relay and producer run until shutdown
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		urlApp.Run(ctx)
+	}()
+	defer func() { <-runDone }()
 
 	// Setup router and server
-	r := router.NewRouter(urlHandler, healthHandler, l, serviceName)
-	// Apply OpenTelemetry HTTP server middleware to the router.
-	// This will automatically create spans for incoming requests and propagate context.
-	// Pass the service name to the middleware
+	r := urlApp.Handler()
 
 	server := &http.Server{
 		Addr:    ":" + cfg.AppCfg.Port,
@@ -152,8 +118,9 @@ func main() {
 
 	l.Info("Shutting down server...")
 
-	ctxTimeout, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	cancel()
+	ctxTimeout, cancelTimeout := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTimeout()
 
 	if err := server.Shutdown(ctxTimeout); err != nil {
 		l.Error("Shutdown failed", "err", err)
@@ -2,6 +2,7 @@ package checker
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"sync"
@@ -9,7 +10,7 @@ import (
 
 	"go.opentelemetry.io/otel/attribute"
 
-	"github.com/kernelshard/hcaas/services/url/internal/kafka"
+	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
 	"github.com/kernelshard/hcaas/services/url/internal/metrics"
 	"github.com/kernelshard/hcaas/services/url/internal/model"
 	"github.com/kernelshard/hcaas/services/url/internal/service"
@@ -22,14 +23,13 @@ const (
 )
 
 type URLChecker struct {
-	svc                  service.URLService
-	logger               *slog.Logger
-	httpClient           *http.Client
-	interval             time.Duration
-	notificationProducer kafka.NotificationProducer
-	tracer               *otelkit.Tracer
-	concurrencyLimit     int
-	httpTimeOut          time.Duration
+	svc              service.URLService
+	logger           *slog.Logger
+	httpClient       *http.Client
+	interval         time.Duration
+	tracer           *otelkit.Tracer
+	concurrencyLimit int
+	httpTimeOut      time.Duration
 }
 
 func NewURLChecker(
@@ -37,25 +37,19 @@ func NewURLChecker(
 	logger *slog.Logger,
 	client *http.Client,
 	interval time.Duration,
-	producer kafka.NotificationProducer,
 	tracer *otelkit.Tracer,
 	concurrencyLimit int,
 ) *URLChecker {
-	if producer == nil {
-		// This panic indicates a serious configuration error that should be caught
-		panic("NewURLChecker: notificationProducer cannot be nil")
-	}
 	if tracer == nil {
 		panic("NewURLChecker: tracer cannot be nil")
 	}
 	return &URLChecker{
-		svc:                  svc,
-		logger:               logger,
-		httpClient:           client,
-		interval:             interval,
-		notificationProducer: producer,
-		tracer:               tracer,
-		concurrencyLimit:     concurrencyLimit,
+		svc:              svc,
+		logger:           logger,
+		httpClient:       client,
+		interval:         interval,
+		tracer:           tracer,
+		concurrencyLimit: concurrencyLimit,
 	}
 }
 
@@ -112,8 +106,22 @@ func (uc *URLChecker) CheckAllURLs(ctx context.Context) {
 				attribute.String("url.status", status),
 			)
 
-			err := uc.svc.UpdateStatus(ctx, url.ID, status)
-			if err != nil {
+			// The event of a transition is stored with the status in one transaction
+			// and published by the outbox relay.
+			var event *model.Notification
+			if notification, ok := transitionNotification(url, status); ok {
+				event = &notification
+			}
+
+			// Conditional on the status read above, so of two checkers seeing the same
+			// transition only one records it and its event
+			err := uc.svc.UpdateStatus(ctx, url.ID, url.Status, status, event)
+			if errors.Is(err, appErr.ErrConflict) {
+				uc.logger.Info("URL status changed during the check, dropping result",
+					slog.String("urlID", url.ID),
+					slog.String("status", status),
+				)
+			} else if err != nil {
 				uc.logger.Error("Failed to update URL status",
 					slog.String("urlID", url.ID),
 					slog.String("status", status),
@@ -125,24 +133,8 @@ func (uc *URLChecker) CheckAllURLs(ctx context.Context) {
 					slog.String("urlID", url.ID),
 					slog.String("address", url.Address),
 					slog.String("status", status),
+					slog.Bool("transition", event != nil),
 				)
-
-				if status == StatusDown {
-					notification := model.Notification{
-						UrlID:     url.ID,
-						Type:      "url_unhealthy",
-						Message:   "URL is unhealthy: " + url.Address,
-						Status:    "pending",
-						CreatedAt: time.Now(),
-					}
-
-					if err := uc.notificationProducer.Publish(ctx, notification); err != nil {
-						uc.logger.Error("Failed to publish notification",
-							slog.String("url_id", url.ID),
-							slog.Any("error", err))
-						otelkit.RecordError(span, err)
-					}
-				}
 			}
 		}(url)
 	}
@@ -150,6 +142,33 @@ func (uc *URLChecker) CheckAllURLs(ctx context.Context) {
 	wg.Wait()
 }
 
+// transitionNotification builds the notification for a status change of url.
+// A URL going down triggers an incident and a down URL coming back up resolves it;
+// both share the same incident key. No notification is emitted when the status is unchanged.
+func transitionNotification(url model.URL, status string) (model.Notification, bool) {
+	notification := model.Notification{
+		URLID:       url.ID,
+		UserID:      url.UserID,
+		IncidentKey: model.IncidentKey(url.ID),
+		Labels:      url.Labels,
+		CreatedAt:   time.Now(),
+	}
+
+	switch {
+	case status == StatusDown && url.Status != StatusDown:
+		notification.Type = model.NotificationTypeURLUnhealthy
+		notification.Severity = model.SeverityCritical
+		notification.Message = "URL is unhealthy: " + url.Address
+	case status == StatusUP && url.Status == StatusDown:
+		notification.Type = model.NotificationTypeURLRecovered
+		notification.Severity = model.SeverityInfo
+		notification.Message = "URL has recovered: " + url.Address
+	default:
+		return model.Notification{}, false
+	}
+	return notification, true
+}
+
 // ping performs a HTTP GET with timeout and metrics
 func (uc *URLChecker) ping(parentCtx context.Context, target string) string {
 	ctx, cancel := context.WithTimeout(parentCtx, 10*time.Second)
@@ -0,0 +1,192 @@
+package checker_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/events"
+	"github.com/kernelshard/hcaas/services/url/internal/checker"
+	"github.com/kernelshard/hcaas/services/url/internal/config"
+	"github.com/kernelshard/hcaas/services/url/internal/kafka"
+	"github.com/kernelshard/hcaas/services/url/internal/kafka/kafkatest"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/kernelshard/hcaas/services/url/internal/outbox"
+	"github.com/kernelshard/hcaas/services/url/internal/service"
+	"github.com/kernelshard/hcaas/services/url/internal/storage"
+)
+
+// harness runs the checker against local HTTP servers and relays its events through the
+// outbox to a fake Kafka producer.
+type harness struct {
+	checker  *checker.URLChecker
+	urls     storage.Storage
+	producer *kafkatest.AsyncProducer
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tracer := otelkit.New("test")
+	urls, outboxStore := storage.NewMemoryStorage()
+
+	asyncProducer := kafkatest.NewAsyncProducer()
+	var wg sync.WaitGroup
+	producer := kafka.NewProducer(asyncProducer, "notifications", time.Second, logger, &wg, tracer)
+	producer.Start(ctx)
+	relay := outbox.NewRelay(outboxStore, producer,
+		config.OutboxConfig{PollInterval: 5 * time.Millisecond, BatchSize: 10, MaxAttempts: 3}, logger, tracer)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		producer.Close(context.Background())
+	})
+
+	svc := service.NewURLService(urls, audit.Discard, logger, tracer)
+	return &harness{
+		checker:  checker.NewURLChecker(svc, logger, http.DefaultClient, time.Minute, tracer, 4),
+		urls:     urls,
+		producer: asyncProducer,
+	}
+}
+
+// monitor registers a local server as a monitored URL; it answers 200 while healthy is set
+// and 500 otherwise.
+func (h *harness) monitor(t *testing.T, id string, healthy *atomic.Bool) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	url := &model.URL{ID: id, UserID: "alice", Address: srv.URL, Status: model.StatusUnknown, CheckedAt: time.Now()}
+	if err := h.urls.Save(context.Background(), url); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+}
+
+// published waits until n events were published and returns them
+func (h *harness) published(t *testing.T, n int) []events.Notification {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.producer.Messages()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("published %d events, want %d", len(h.producer.Messages()), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var notifs []events.Notification
+	for _, msg := range h.producer.Messages() {
+		value, _ := msg.Value.Encode()
+		var notif events.Notification
+		if err := json.Unmarshal(value, &notif); err != nil {
+			t.Fatalf("invalid event %s: %v", value, err)
+		}
+		if key, _ := msg.Key.Encode(); string(key) != notif.URLID {
+			t.Errorf("event key = %s, want url id %s", key, notif.URLID)
+		}
+		notifs = append(notifs, notif)
+	}
+	return notifs
+}
+
+// TestURLChecker_Transitions checks URLs going up and down and asserts the stored status
+// and the events published for each transition.
+// Table Driven Test Pattern used
+func TestURLChecker_Transitions(t *testing.T) {
+	h := newHarness(t)
+	var flaky, broken atomic.Bool
+	h.monitor(t, "flaky", &flaky)
+	h.monitor(t, "broken", &broken)
+
+	type event struct{ urlID, typ string }
+	tests := []struct {
+		name       string
+		flakyUp    bool
+		wantStatus map[string]string
+		wantEvents []event // events published by the check
+	}{
+		{
+			name:       "first check",
+			flakyUp:    true,
+			wantStatus: map[string]string{"flaky": model.StatusUP, "broken": model.StatusDown},
+			wantEvents: []event{{"broken", model.NotificationTypeURLUnhealthy}},
+		},
+		{
+			name:       "goes down",
+			flakyUp:    false,
+			wantStatus: map[string]string{"flaky": model.StatusDown, "broken": model.StatusDown},
+			wantEvents: []event{{"flaky", model.NotificationTypeURLUnhealthy}},
+		},
+		{
+			name:       "stays down",
+			flakyUp:    false,
+			wantStatus: map[string]string{"flaky": model.StatusDown, "broken": model.StatusDown},
+		},
+		{
+			name:       "recovers",
+			flakyUp:    true,
+			wantStatus: map[string]string{"flaky": model.StatusUP, "broken": model.StatusDown},
+			wantEvents: []event{{"flaky", model.NotificationTypeURLRecovered}},
+		},
+	}
+
+	var want []event
+	for _, tt := range tests {
+		flaky.Store(tt.flakyUp)
+		h.checker.CheckAllURLs(context.Background())
+
+		for id, status := range tt.wantStatus {
+			url, err := h.urls.FindByID(context.Background(), id)
+			if err != nil {
+				t.Fatalf("%s: FindByID(%s) error = %v", tt.name, id, err)
+			}
+			if url.Status != status {
+				t.Errorf("%s: status of %s = %s, want %s", tt.name, id, url.Status, status)
+			}
+		}
+
+		want = append(want, tt.wantEvents...)
+		var got []event
+		for _, n := range h.published(t, len(want)) {
+			got = append(got, event{n.URLID, n.Type})
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: published %v, want %v", tt.name, got, want)
+		}
+	}
+
+	// The trigger and the recovery of an incident share its key
+	notifs := h.published(t, len(want))
+	var keys []string
+	for _, n := range notifs {
+		if n.URLID == "flaky" {
+			keys = append(keys, n.IncidentKey)
+		}
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("incident keys of flaky = %v, want one shared key", keys)
+	}
+}
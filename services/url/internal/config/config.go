@@ -4,15 +4,28 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds the application settings loaded from environment variables.
 type Config struct {
-	DBConfig    DBConfig
-	AppCfg      AppConfig
-	OTLPConfig  OTLPConfig
-	KafkaConfig KafkaConfig
+	DBConfig     DBConfig
+	AppCfg       AppConfig
+	OTLPConfig   OTLPConfig
+	KafkaConfig  KafkaConfig
+	BusConfig    BusConfig
+	OutboxConfig OutboxConfig
+}
+
+// OutboxConfig controls the relay publishing outbox events to the message bus.
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts is the number of failed publishes after which an event is parked
+	MaxAttempts int
+	// Retention is how long published events are kept; zero keeps them forever
+	Retention time.Duration
 }
 
 // OTLPConfig holds OpenTelemetry tracing configuration.
@@ -23,14 +36,49 @@ type OTLPConfig struct {
 }
 
 type AppConfig struct {
-	Port string
+	Port           string
+	AuthServiceURL string
+	// AuthValidation selects how bearer tokens are validated: "local" verifies them with the
+	// key set of the auth service, "remote" asks the auth service and "local+remote" asks it
+	// only for tokens that cannot be verified locally.
+	AuthValidation string
+	// AdminUserIDs are the users allowed to use the admin endpoints
+	AdminUserIDs []string
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For, which is only safe behind
+	// a proxy that sets it
+	TrustProxyHeaders bool
 }
 
-// DBConfig holds the Postgres connection settings.
+// DBConfig holds the database connection settings.
 type DBConfig struct {
 	URL         string
 	MaxOpenConn int
 	ConnMaxIdle time.Duration
+	// MigrateOnStart applies pending schema migrations when the service starts
+	MigrateOnStart bool
+}
+
+// Supported message buses.
+const (
+	BusDriverKafka = "kafka"
+	BusDriverNATS  = "nats"
+	// BusDriverMemory is rejected: the in-memory bus only works inside the all-in-one
+	// hcaas binary, which hands it to the service directly.
+	BusDriverMemory = "memory"
+)
+
+// BusConfig selects the message bus notification events are published to.
+type BusConfig struct {
+	// Driver is kafka or nats
+	Driver string
+	NATS   NATSConfig
+}
+
+// NATSConfig holds the NATS JetStream settings.
+type NATSConfig struct {
+	URL           string
+	Stream        string
+	SubjectPrefix string
 }
 
 // KafkaConfig holds Kafka configuration
@@ -38,6 +86,8 @@ type KafkaConfig struct {
 	Brokers       []string
 	NotifTopic    string
 	ConsumerGroup string
+	// PublishTimeout bounds how long a publish waits for the brokers to acknowledge a message
+	PublishTimeout time.Duration
 }
 
 // LoadConfig reads environment variables and returns a Config or an error.
@@ -86,6 +136,7 @@ func LoadConfig() (*Config, error) {
 	if cfg.DBConfig.ConnMaxIdle, err = getDuration("DB_CONN_MAX_IDLE", 5*time.Minute); err != nil {
 		return nil, err
 	}
+	cfg.DBConfig.MigrateOnStart = getString("DB_MIGRATE_ON_START", "true") == "true"
 
 	// App settings
 	port, err := getInt("PORT", 8080)
@@ -93,11 +144,60 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 	cfg.AppCfg.Port = strconv.Itoa(port)
+	cfg.AppCfg.AuthServiceURL = getString("AUTH_SVC_URL", "http://hcaas_auth:8081/")
+	cfg.AppCfg.AuthValidation = getString("AUTH_VALIDATION", "local+remote")
+	switch cfg.AppCfg.AuthValidation {
+	case "local", "remote", "local+remote":
+	default:
+		return nil, fmt.Errorf("invalid AUTH_VALIDATION %q: want local, remote or local+remote", cfg.AppCfg.AuthValidation)
+	}
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			cfg.AppCfg.AdminUserIDs = append(cfg.AppCfg.AdminUserIDs, id)
+		}
+	}
+	cfg.AppCfg.TrustProxyHeaders = getString("TRUST_PROXY_HEADERS", "false") == "true"
 
 	// Kafka settings
 	cfg.KafkaConfig.Brokers = []string{getString("KAFKA_BROKERS", "localhost:9092")}
 	cfg.KafkaConfig.NotifTopic = getString("KAFKA_NOTIF_TOPIC", "notifications")
 	cfg.KafkaConfig.ConsumerGroup = getString("KAFKA_CONSUMER_GROUP", "url-service")
+	if cfg.KafkaConfig.PublishTimeout, err = getDuration("KAFKA_PUBLISH_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+
+	// Message bus settings
+	cfg.BusConfig.Driver = strings.ToLower(getString("BUS_DRIVER", BusDriverKafka))
+	switch cfg.BusConfig.Driver {
+	case BusDriverKafka, BusDriverNATS:
+	case BusDriverMemory:
+		return nil, fmt.Errorf("BUS_DRIVER=%s is only supported by the all-in-one hcaas binary", BusDriverMemory)
+	default:
+		return nil, fmt.Errorf("invalid BUS_DRIVER: %q", cfg.BusConfig.Driver)
+	}
+	cfg.BusConfig.NATS.URL = getString("NATS_URL", "nats://localhost:4222")
+	cfg.BusConfig.NATS.Stream = getString("NATS_STREAM", "HCAAS")
+	cfg.BusConfig.NATS.SubjectPrefix = getString("NATS_SUBJECT_PREFIX", "hcaas")
+
+	// Outbox relay settings
+	if cfg.OutboxConfig.PollInterval, err = getDuration("OUTBOX_POLL_INTERVAL", 1*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxConfig.BatchSize, err = getInt("OUTBOX_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxConfig.BatchSize < 1 {
+		return nil, fmt.Errorf("invalid OUTBOX_BATCH_SIZE: must be at least 1")
+	}
+	if cfg.OutboxConfig.MaxAttempts, err = getInt("OUTBOX_MAX_ATTEMPTS", 20); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxConfig.MaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid OUTBOX_MAX_ATTEMPTS: must be at least 1")
+	}
+	if cfg.OutboxConfig.Retention, err = getDuration("OUTBOX_RETENTION", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
 
 	// OTLP tracing configuration - use standard OpenTelemetry environment variables
 	cfg.OTLPConfig.Endpoint = getString("OTEL_EXPORTER_OTLP_ENDPOINT", "hcaas_jaeger_all_in_one:4317")
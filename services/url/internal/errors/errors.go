@@ -1,35 +1,34 @@
+// Package errors holds the errors of the URL service. They carry problem codes, so handlers
+// write them with problem.Write, and instances made by the constructors match their
+// sentinels with errors.Is.
 package errors
 
-import (
-	"errors"
-	"fmt"
-)
+import "github.com/kernelshard/hcaas/pkg/problem"
 
 var (
-	ErrNotFound = errors.New("not found")
-	ErrConflict = errors.New("conflict")
+	ErrNotFound     = problem.New(problem.CodeNotFound, "not found")
+	ErrConflict     = problem.New(problem.CodeConflict, "conflict")
+	ErrInvalidInput = problem.New(problem.CodeInvalidInput, "invalid input")
+	ErrInternal     = problem.New(problem.CodeInternal, "internal error")
 )
 
-func NewInternal(format string, a ...interface{}) error {
-	return fmt.Errorf("INTERNAL: "+format, a...)
-}
-
-func NewNotFound(format string, a ...interface{}) error {
-	return fmt.Errorf("NOT FOUND: "+format, a...)
-}
-
-func NewConflict(format string, a ...interface{}) error {
-	return fmt.Errorf("CONFLICT: "+format, a...)
+// NewInternal returns an ErrInternal with message, caused by err. Only message is shown to
+// clients.
+func NewInternal(err error, message string) error {
+	return problem.Wrap(ErrInternal, err, message)
 }
 
-func IsNotFound(err error) bool {
-	return errors.Is(err, ErrNotFound)
+// NewNotFound returns an ErrNotFound with a formatted message.
+func NewNotFound(format string, a ...any) error {
+	return problem.Errorf(ErrNotFound, format, a...)
 }
 
-func IsConflict(err error) bool {
-	return errors.Is(err, ErrConflict)
+// NewConflict returns an ErrConflict with a formatted message.
+func NewConflict(format string, a ...any) error {
+	return problem.Errorf(ErrConflict, format, a...)
 }
 
-func IsInternal(err error) bool {
-	return err != nil && !IsNotFound(err) && !IsConflict(err)
+// NewInvalidInput returns an ErrInvalidInput with a formatted message.
+func NewInvalidInput(format string, a ...any) error {
+	return problem.Errorf(ErrInvalidInput, format, a...)
 }
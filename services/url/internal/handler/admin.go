@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/problem"
+)
+
+// AdminHandler handles the admin endpoints
+type AdminHandler struct {
+	auditLog audit.Store
+	logger   *slog.Logger
+	tracer   *otelkit.Tracer
+}
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(auditLog audit.Store, logger *slog.Logger, tracer *otelkit.Tracer) *AdminHandler {
+	return &AdminHandler{auditLog: auditLog, logger: logger, tracer: tracer}
+}
+
+// Audit returns events of the audit log, newest first, selected by the actor, action, since,
+// until, limit and offset query parameters, see audit.ParseFilter
+func (h *AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), "admin.handler.Audit")
+	defer span.End()
+	span.SetAttributes(attribute.String("operation", "query_audit_log"))
+
+	filter, err := audit.ParseFilter(r.URL.Query())
+	if err != nil {
+		problem.Respond(w, problem.CodeInvalidInput, err.Error())
+		return
+	}
+
+	events, err := h.auditLog.Query(ctx, filter)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		h.logger.Error("Audit query failed", slog.Any("error", err))
+		problem.Respond(w, problem.CodeInternal, "failed to query audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/kernelshard/hcaas/pkg/problem"
 	"github.com/kernelshard/hcaas/services/url/internal/service"
 )
 
@@ -19,7 +20,7 @@ func NewHealthHandler(svc service.HealthService, l *slog.Logger) *HealthHandler
 func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
 	err := h.service.Liveness(r.Context())
 	if err != nil {
-		http.Error(w, "unhealthy", http.StatusInternalServerError)
+		problem.Respond(w, problem.CodeUnavailable, "unhealthy")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -29,7 +30,7 @@ func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
 func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 	err := h.service.Readiness(r.Context())
 	if err != nil {
-		http.Error(w, "not ready", http.StatusInternalServerError)
+		problem.Respond(w, problem.CodeUnavailable, "not ready")
 		return
 	}
 
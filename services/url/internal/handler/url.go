@@ -2,13 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"go.opentelemetry.io/otel/codes"
 
-	"github.com/kernelshard/hcaas/services/url/internal/errors"
+	"github.com/kernelshard/hcaas/pkg/problem"
+	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
 	"github.com/kernelshard/hcaas/services/url/internal/model"
 	"github.com/kernelshard/hcaas/services/url/internal/service"
 	"github.com/samims/otelkit"
@@ -26,7 +28,9 @@ const (
 	spanGetAllByUserID = "auth.handler.GetAllByUserID"
 	spanGetByID        = "auth.handler.GetByID"
 	spanAdd            = "auth.handler.Add"
-	spanUpdateStatus   = "auth.handler.UpdateStatus"
+	spanUpdate         = "auth.handler.Update"
+	spanDelete         = "auth.handler.Delete"
+	spanDeleteByUserID = "auth.handler.DeleteAllByUserID"
 )
 
 func NewURLHandler(s service.URLService, logger *slog.Logger, tracer *otelkit.Tracer) *URLHandler {
@@ -41,7 +45,7 @@ func (h *URLHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		otelkit.RecordError(span, err)
 		h.logger.Error("GetAll failed", slog.Any("error", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, err)
 		return
 	}
 	json.NewEncoder(w).Encode(urls)
@@ -56,13 +60,28 @@ func (h *URLHandler) GetAllByUserID(w http.ResponseWriter, r *http.Request) {
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, err.Error())
 		h.logger.Error("GetAllByUserID failed", slog.Any("error", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(urls)
 }
 
+// DeleteAllByUserID deletes the URLs of the user, e.g. when the account is deleted
+func (h *URLHandler) DeleteAllByUserID(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), spanDeleteByUserID)
+	defer span.End()
+
+	if _, err := h.svc.DeleteAllByUserID(ctx); err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		h.logger.Error("DeleteAllByUserID failed", slog.Any("error", err))
+		problem.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *URLHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	ctx, span := h.tracer.StartServerSpan(r.Context(), spanGetByID)
 	defer span.End()
@@ -70,17 +89,14 @@ func (h *URLHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	url, err := h.svc.GetByID(ctx, id)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, err.Error())
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, appErr.ErrNotFound) {
 			h.logger.Warn("URL not found", "id", id)
-			http.Error(w, err.Error(), http.StatusNotFound)
 		} else {
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, err.Error())
 			h.logger.Error("GetByID failed", "id", id, "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		problem.Write(w, err)
 		return
 	}
 	json.NewEncoder(w).Encode(url)
@@ -95,59 +111,74 @@ func (h *URLHandler) Add(w http.ResponseWriter, r *http.Request) {
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, err.Error())
 		h.logger.Warn("Invalid request body for Add")
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		problem.Respond(w, problem.CodeInvalidInput, "invalid request body")
 		return
 	}
 	url.Status = model.StatusUnknown
 
 	if err := h.svc.Add(ctx, url); err != nil {
-		if errors.IsInternal(err) {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, appErr.ErrConflict) || errors.Is(err, appErr.ErrInvalidInput) {
 			h.logger.Warn("Duplicate or invalid Add", "url", url, "error", err)
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, err.Error())
-			http.Error(w, err.Error(), http.StatusConflict)
 		} else {
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, err.Error())
 			h.logger.Error("Add failed", "url", url, "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		problem.Write(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (h *URLHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
-	ctx, span := h.tracer.StartServerSpan(r.Context(), spanUpdateStatus)
+// Update changes the address or labels of a URL of the user
+func (h *URLHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), spanUpdate)
 	defer span.End()
 
 	id := chi.URLParam(r, "id")
 
-	var body struct {
-		Status string `json:"status"`
+	var update model.URLUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil || (update.Address == nil && update.Labels == nil) {
+		h.logger.Warn("Invalid request body for Update", "id", id)
+		if err != nil {
+			otelkit.RecordError(span, err)
+		}
+		span.SetStatus(codes.Error, "invalid request body")
+		problem.Respond(w, problem.CodeInvalidInput, "invalid request body")
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		h.logger.Warn("Invalid request body for UpdateStatus", "id", id)
+
+	url, err := h.svc.Update(ctx, id, update)
+	if err != nil {
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, err.Error())
-
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		if errors.Is(err, appErr.ErrInternal) {
+			h.logger.Error("Update failed", "id", id, "error", err)
+		} else {
+			h.logger.Warn("Update rejected", "id", id, "error", err)
+		}
+		problem.Write(w, err)
 		return
 	}
+	json.NewEncoder(w).Encode(url)
+}
 
-	if err := h.svc.UpdateStatus(ctx, id, body.Status); err != nil {
-		if errors.IsNotFound(err) {
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, err.Error())
+// Delete deletes a URL of the user
+func (h *URLHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.StartServerSpan(r.Context(), spanDelete)
+	defer span.End()
 
-			h.logger.Warn("URL not found for update", "id", id)
-			http.Error(w, err.Error(), http.StatusNotFound)
+	id := chi.URLParam(r, "id")
+	if err := h.svc.Delete(ctx, id); err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, appErr.ErrNotFound) {
+			h.logger.Warn("URL not found for delete", "id", id)
 		} else {
-			otelkit.RecordError(span, err)
-			span.SetStatus(codes.Error, err.Error())
-			h.logger.Error("UpdateStatus failed", "id", id, "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger.Error("Delete failed", "id", id, "error", err)
 		}
+		problem.Write(w, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,131 @@
+// Package kafkatest provides in-process fakes of the sarama clients used by the URL service.
+package kafkatest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// errTransactionsUnsupported is returned by the transactional methods of the fakes
+var errTransactionsUnsupported = errors.New("kafkatest: transactions are not supported")
+
+// AsyncProducer is a sarama.AsyncProducer that records the messages it is given and
+// acknowledges them on its Successes channel, or reports them on its Errors channel while a
+// failure is set with Fail. Successes and errors are always returned, as NewProducer requires.
+type AsyncProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	closeOnce sync.Once
+	done      chan struct{}
+
+	mu       sync.Mutex
+	messages []*sarama.ProducerMessage
+	fail     error
+	offset   int64
+}
+
+// NewAsyncProducer returns a running AsyncProducer.
+func NewAsyncProducer() *AsyncProducer {
+	p := &AsyncProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage, 64),
+		errors:    make(chan *sarama.ProducerError, 64),
+		done:      make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// run acknowledges the input until the producer is closed
+func (p *AsyncProducer) run() {
+	defer close(p.done)
+	defer close(p.successes)
+	defer close(p.errors)
+
+	for msg := range p.input {
+		p.mu.Lock()
+		err := p.fail
+		if err == nil {
+			msg.Partition = 0
+			msg.Offset = p.offset
+			p.offset++
+			p.messages = append(p.messages, msg)
+		}
+		p.mu.Unlock()
+
+		if err != nil {
+			p.errors <- &sarama.ProducerError{Msg: msg, Err: err}
+			continue
+		}
+		p.successes <- msg
+	}
+}
+
+// Fail makes the producer reject every following message with err until it is called with nil.
+func (p *AsyncProducer) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail = err
+}
+
+// Messages returns the acknowledged messages in the order they were produced.
+func (p *AsyncProducer) Messages() []*sarama.ProducerMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*sarama.ProducerMessage(nil), p.messages...)
+}
+
+func (p *AsyncProducer) AsyncClose() {
+	p.closeOnce.Do(func() { close(p.input) })
+}
+
+func (p *AsyncProducer) Close() error {
+	p.AsyncClose()
+	<-p.done
+	return nil
+}
+
+func (p *AsyncProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *AsyncProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+func (p *AsyncProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+func (p *AsyncProducer) IsTransactional() bool {
+	return false
+}
+
+func (p *AsyncProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return sarama.ProducerTxnFlagReady
+}
+
+func (p *AsyncProducer) BeginTxn() error {
+	return errTransactionsUnsupported
+}
+
+func (p *AsyncProducer) CommitTxn() error {
+	return errTransactionsUnsupported
+}
+
+func (p *AsyncProducer) AbortTxn() error {
+	return errTransactionsUnsupported
+}
+
+func (p *AsyncProducer) AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata, string) error {
+	return errTransactionsUnsupported
+}
+
+func (p *AsyncProducer) AddMessageToTxn(*sarama.ConsumerMessage, string, *string) error {
+	return errTransactionsUnsupported
+}
+
+var _ sarama.AsyncProducer = (*AsyncProducer)(nil)
@@ -2,7 +2,7 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
@@ -10,32 +10,39 @@ import (
 
 	"github.com/IBM/sarama"
 
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/propagation"
 
+	"github.com/kernelshard/hcaas/services/url/internal/messaging"
+	"github.com/kernelshard/hcaas/services/url/internal/metrics"
 	"github.com/kernelshard/hcaas/services/url/internal/model"
 	"github.com/samims/otelkit"
 )
 
-// NotificationProducer defines the interface for Kafka publishing
-type NotificationProducer interface {
-	Start(ctx context.Context)
-	Publish(ctx context.Context, notif model.Notification) error
-	Close(ctx context.Context)
-}
+// ErrPublishTimeout is returned when Kafka does not acknowledge a message in time.
+// The message may still be delivered later.
+var ErrPublishTimeout = errors.New("timed out waiting for kafka acknowledgement")
 
 type producer struct {
-	asyncProducer sarama.AsyncProducer
-	topic         string
-	log           *slog.Logger
-	wg            *sync.WaitGroup
-	closeOnce     sync.Once
-	tracer        *otelkit.Tracer
+	asyncProducer  sarama.AsyncProducer
+	topic          string
+	publishTimeout time.Duration
+	log            *slog.Logger
+	wg             *sync.WaitGroup
+	closeOnce      sync.Once
+	tracer         *otelkit.Tracer
 }
 
 // NewProducer uses DI to inject AsyncProducer, logger, topic, WaitGroup, and tracer.
-func NewProducer(asyncProducer sarama.AsyncProducer, topic string, log *slog.Logger, wg *sync.WaitGroup, tracer *otelkit.Tracer) NotificationProducer {
+// The AsyncProducer must be configured with Producer.Return.Successes and Producer.Return.Errors,
+// acknowledgements are reported back to Publish through the message metadata.
+func NewProducer(
+	asyncProducer sarama.AsyncProducer,
+	topic string,
+	publishTimeout time.Duration,
+	log *slog.Logger,
+	wg *sync.WaitGroup,
+	tracer *otelkit.Tracer,
+) messaging.NotificationProducer {
 	if asyncProducer == nil || log == nil || wg == nil || tracer == nil {
 		panic("NewProducer: nil dependencies provided")
 	}
@@ -43,11 +50,12 @@ func NewProducer(asyncProducer sarama.AsyncProducer, topic string, log *slog.Log
 		panic("NewProducer: topic must not be empty")
 	}
 	return &producer{
-		asyncProducer: asyncProducer,
-		topic:         topic,
-		log:           log,
-		wg:            wg,
-		tracer:        tracer,
+		asyncProducer:  asyncProducer,
+		topic:          topic,
+		publishTimeout: publishTimeout,
+		log:            log,
+		wg:             wg,
+		tracer:         tracer,
 	}
 }
 
@@ -70,6 +78,9 @@ func (p *producer) handleSuccess(ctx context.Context) {
 				return
 			}
 
+			metrics.KafkaMessagesProduced.WithLabelValues(msg.Topic).Inc()
+			reportResult(msg, nil)
+
 			key, _ := msg.Key.Encode()
 			p.log.Info("Message delivered",
 				slog.String("topic", msg.Topic),
@@ -92,6 +103,9 @@ func (p *producer) handleErrors(ctx context.Context) {
 				p.log.Info("Kafka errors channel closed")
 				return
 			}
+			metrics.KafkaMessagesFailed.WithLabelValues(err.Msg.Topic).Inc()
+			reportResult(err.Msg, err.Err)
+
 			p.log.Error("Message delivery failed",
 				slog.String("topic", err.Msg.Topic),
 				slog.Any("error", err.Err))
@@ -108,61 +122,77 @@ func (p *producer) Publish(ctx context.Context, notif model.Notification) error
 	defer span.End()
 
 	p.log.Info("Kafka publish called ")
-	data, err := json.Marshal(notif)
+	data, values, err := messaging.Encode(ctx, &notif)
 	if err != nil {
-		p.log.Error("Failed to marshal notification",
+		p.log.Error("Failed to encode notification",
 			slog.Any("notification", notif),
 			slog.Any("error", err))
 		span.RecordError(err)
-		return fmt.Errorf("failed to marshal notification: %w", err)
+		return err
 	}
 
-	// Inject trace context into Kafka headers for propagation to consumer
-	headers := injectTraceContextToKafkaHeaders(ctx)
+	// Trace context and schema version travel as Kafka headers
+	headers := make([]sarama.RecordHeader, 0, len(values))
+	for key, value := range values {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
 
+	// The success and error handlers report the outcome of the message on result
+	result := make(chan error, 1)
 	msg := &sarama.ProducerMessage{
 		Topic:     p.topic,
-		Key:       sarama.StringEncoder(notif.UrlID),
+		Key:       sarama.StringEncoder(notif.URLID),
 		Value:     sarama.ByteEncoder(data),
 		Timestamp: time.Now(),
 		Headers:   headers,
+		Metadata:  result,
 	}
+	span.SetAttributes(
+		attribute.String("kafka.topic", p.topic),
+		attribute.String("kafka.key", notif.URLID),
+		attribute.String("notification.type", notif.Type),
+		attribute.String("notification.event_id", notif.EventID),
+	)
 
 	select {
 	case p.asyncProducer.Input() <- msg:
 		p.log.Info("Message queued to Kafka",
 			slog.String("topic", p.topic),
-			slog.String("key", notif.UrlID),
+			slog.String("key", notif.URLID),
 			slog.Any("notification", notif))
-		span.SetAttributes(
-			attribute.String("kafka.topic", p.topic),
-			attribute.String("kafka.key", notif.UrlID),
-			attribute.String("notification.type", notif.Type),
-		)
-		return nil
 	case <-ctx.Done():
 		p.log.Warn("Publish cancelled by context",
-			slog.String("url_id", notif.UrlID))
+			slog.String("url_id", notif.URLID))
 		span.SetStatus(2, "Publish cancelled by context") // 2 = Error
 		return ctx.Err()
 	}
-}
 
-// injectTraceContextToKafkaHeaders injects the current trace context into Kafka headers
-func injectTraceContextToKafkaHeaders(ctx context.Context) []sarama.RecordHeader {
-	propagator := otel.GetTextMapPropagator()
-	carrier := propagation.MapCarrier{}
-	propagator.Inject(ctx, carrier)
-
-	headers := make([]sarama.RecordHeader, 0, len(carrier))
-	for key, value := range carrier {
-		headers = append(headers, sarama.RecordHeader{
-			Key:   []byte(key),
-			Value: []byte(value),
-		})
+	timer := time.NewTimer(p.publishTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("kafka delivery failed: %w", err)
+		}
+		return nil
+	case <-timer.C:
+		// A late acknowledgement is still counted by the success or error handler
+		metrics.KafkaPublishTimeouts.WithLabelValues(p.topic).Inc()
+		span.RecordError(ErrPublishTimeout)
+		return ErrPublishTimeout
+	case <-ctx.Done():
+		span.SetStatus(2, "Publish cancelled by context") // 2 = Error
+		return ctx.Err()
 	}
+}
 
-	return headers
+// reportResult hands the delivery outcome to the Publish call waiting for msg
+func reportResult(msg *sarama.ProducerMessage, err error) {
+	if result, ok := msg.Metadata.(chan error); ok {
+		result <- err
+	}
 }
 
 // Close shuts down the producer and waits for workers
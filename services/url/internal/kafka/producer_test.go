@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+)
+
+// TestProducer_Publish checks that Publish reports the broker acknowledgement of each message.
+// Table Driven Test Pattern used
+func TestProducer_Publish(t *testing.T) {
+	brokerErr := errors.New("leader not available")
+
+	tests := []struct {
+		name    string
+		expect  func(mp *mocks.AsyncProducer)
+		wantErr error
+	}{
+		{
+			name:   "acknowledged",
+			expect: func(mp *mocks.AsyncProducer) { mp.ExpectInputAndSucceed() },
+		},
+		{
+			name:    "rejected by the broker",
+			expect:  func(mp *mocks.AsyncProducer) { mp.ExpectInputAndFail(brokerErr) },
+			wantErr: brokerErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mocks.NewTestConfig()
+			cfg.Producer.Return.Successes = true
+			mp := mocks.NewAsyncProducer(t, cfg)
+			tt.expect(mp)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var wg sync.WaitGroup
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			p := NewProducer(mp, "notifications", time.Second, logger, &wg, otelkit.New("test"))
+			p.Start(ctx)
+			defer p.Close(ctx)
+
+			err := p.Publish(ctx, model.Notification{
+				URLID:     "url-1",
+				Type:      model.NotificationTypeURLUnhealthy,
+				CreatedAt: time.Now(),
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Publish() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package messaging publishes notification events independently of the message bus in use.
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/kernelshard/hcaas/pkg/bus"
+	"github.com/kernelshard/hcaas/pkg/events"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/samims/otelkit"
+)
+
+// NotificationProducer publishes notification events to the message bus
+type NotificationProducer interface {
+	Start(ctx context.Context)
+	// Publish sends a notification and waits until the bus acknowledged it,
+	// returning the delivery error reported by the bus.
+	Publish(ctx context.Context, notif model.Notification) error
+	Close(ctx context.Context)
+}
+
+// Encode validates notif and returns its payload and headers: the schema version and the
+// trace context of ctx. An event ID is assigned when notif has none.
+func Encode(ctx context.Context, notif *model.Notification) ([]byte, map[string]string, error) {
+	// Assigned once per event, so retries of the same message share the ID
+	if notif.EventID == "" {
+		notif.EventID = uuid.NewString()
+	}
+	if err := notif.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid notification: %w", err)
+	}
+	data, err := json.Marshal(notif)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	// Inject trace context into the headers for propagation to the consumer
+	headers := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+	headers[events.HeaderSchemaVersion] = strconv.Itoa(events.SchemaVersion)
+	return data, headers, nil
+}
+
+type busProducer struct {
+	publisher bus.Publisher
+	topic     string
+	log       *slog.Logger
+	tracer    *otelkit.Tracer
+}
+
+// NewBusProducer publishes notifications through a generic bus such as NATS JetStream
+// or the in-memory bus.
+func NewBusProducer(publisher bus.Publisher, topic string, log *slog.Logger, tracer *otelkit.Tracer) NotificationProducer {
+	return &busProducer{publisher: publisher, topic: topic, log: log, tracer: tracer}
+}
+
+// Start is a no-op, bus publishes are synchronous
+func (p *busProducer) Start(_ context.Context) {}
+
+func (p *busProducer) Publish(ctx context.Context, notif model.Notification) error {
+	ctx, span := p.tracer.StartClientSpan(ctx, "BusPublish")
+	defer span.End()
+
+	data, headers, err := Encode(ctx, &notif)
+	if err != nil {
+		p.log.Error("Failed to encode notification", slog.Any("notification", notif), slog.Any("error", err))
+		otelkit.RecordError(span, err)
+		return err
+	}
+	span.SetAttributes(
+		attribute.String("bus.topic", p.topic),
+		attribute.String("notification.type", notif.Type),
+		attribute.String("notification.event_id", notif.EventID),
+	)
+
+	err = p.publisher.Publish(ctx, bus.Message{Topic: p.topic, Key: notif.URLID, Value: data, Headers: headers})
+	if err != nil {
+		otelkit.RecordError(span, err)
+		return err
+	}
+	p.log.Info("Message published", slog.String("topic", p.topic), slog.String("key", notif.URLID))
+	return nil
+}
+
+func (p *busProducer) Close(_ context.Context) {
+	if err := p.publisher.Close(); err != nil {
+		p.log.Warn("Failed to close bus publisher", slog.Any("error", err))
+	}
+}
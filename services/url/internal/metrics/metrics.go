@@ -38,8 +38,37 @@ var (
 		},
 		[]string{"status"},
 	)
+
+	// KafkaMessagesProduced counts messages acknowledged by the brokers
+	KafkaMessagesProduced = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hcaas_kafka_messages_produced_total",
+			Help: "Number of messages acknowledged by Kafka",
+		},
+		[]string{"topic"},
+	)
+
+	// KafkaMessagesFailed counts messages Kafka rejected
+	KafkaMessagesFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hcaas_kafka_messages_failed_total",
+			Help: "Number of messages that failed to be produced to Kafka",
+		},
+		[]string{"topic"},
+	)
+
+	// KafkaPublishTimeouts counts publishes that gave up waiting for an acknowledgement.
+	// The message may still be acknowledged later and then counts as produced.
+	KafkaPublishTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hcaas_kafka_publish_timeouts_total",
+			Help: "Number of publishes that timed out waiting for a Kafka acknowledgement",
+		},
+		[]string{"topic"},
+	)
 )
 
 func Init() {
-	prometheus.MustRegister(RequestCount, RequestDuration, URLCheckStatus, URLCheckDuration)
+	prometheus.MustRegister(RequestCount, RequestDuration, URLCheckStatus, URLCheckDuration,
+		KafkaMessagesProduced, KafkaMessagesFailed, KafkaPublishTimeouts)
 }
@@ -2,103 +2,98 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
-	"io"
 	"log/slog"
 	"net/http"
-	"strings"
+	"slices"
 
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
+	"github.com/kernelshard/hcaas/pkg/problem"
 	"github.com/kernelshard/hcaas/services/url/internal/model"
 )
 
-func AuthMiddleware(authServiceURL string, logger *slog.Logger) func(http.Handler) http.Handler {
+// AuthMiddleware validates the bearer token with validator and stores the user ID and
+// email in the request context, also as the actor of audit events.
+func AuthMiddleware(validator authn.Validator, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			token, ok := authn.BearerToken(r)
+			if !ok {
 				logger.Warn("Unauthorized: missing or malformed token")
-				http.Error(w, "Unauthorized: missing token", http.StatusUnauthorized)
+				problem.Respond(w, problem.CodeUnauthorized, "missing token")
 				return
 			}
-			token := strings.TrimPrefix(authHeader, "Bearer ")
 
-			validateURL := authServiceURL + "auth/validate"
-			logger.Debug("Calling auth service validation endpoint",
-				"url", validateURL,
-				"method", r.Method,
-				"path", r.URL.Path)
-
-			req, err := http.NewRequest(http.MethodGet, validateURL, nil)
-			if err != nil {
-				logger.Error("Failed to create request to auth service", "error", err)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-			req.Header.Set("Authorization", "Bearer "+token)
-			client := http.Client{}
-			resp, err := client.Do(req)
+			identity, err := validator.Validate(r.Context(), token)
 			if err != nil {
-				logger.Error("Failed to call auth service", "error", err)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				logger.Warn("Token validation failed",
+					"error", err,
+					"method", r.Method,
+					"path", r.URL.Path)
+				problem.Respond(w, problem.CodeUnauthorized, "invalid token")
 				return
 			}
-			defer resp.Body.Close()
 
-			if resp.StatusCode != http.StatusOK {
-				bodyBytes, _ := io.ReadAll(resp.Body)
-				logger.Warn("Auth service validation failed", "status", resp.StatusCode, "body", string(bodyBytes))
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+			if identity.Email == "" {
+				logger.Error("No email found in auth response", slog.String("user_id", identity.UserID))
 			}
 
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				logger.Error("Failed to read auth response body", "error", err)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			logger.Debug("Auth service response", "body", string(bodyBytes))
+			ctx := context.WithValue(r.Context(), model.ContextUserIDKey, identity.UserID)
+			ctx = context.WithValue(ctx, model.ContextEmailKey, identity.Email)
+			ctx = context.WithValue(ctx, model.ContextScopeKey, identity.Scope)
+			ctx = audit.WithActor(ctx, identity.UserID, identity.Email)
+			logger.Info("User authenticated",
+				"user_id", identity.UserID,
+				"method", r.Method,
+				"path", r.URL.Path)
 
-			var authResponse struct {
-				UserID string `json:"user_id"`
-				Email  string `json:"email"`
-			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-			if err := json.Unmarshal(bodyBytes, &authResponse); err != nil {
-				logger.Error("Failed to decode auth service response",
-					"error", err,
-					"response", string(bodyBytes))
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+// ScopeMiddleware lets API keys through only within their scopes: reads require readScope
+// and all other methods writeScope. User tokens have no scope and always pass. It must run
+// after AuthMiddleware.
+func ScopeMiddleware(readScope, writeScope string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := writeScope
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = readScope
 			}
 
-			if authResponse.UserID == "" {
-				logger.Error("No user identifier found in auth response",
-					slog.String("response", string(bodyBytes)))
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			granted, _ := r.Context().Value(model.ContextScopeKey).(string)
+			if !(authn.Identity{Scope: granted}).HasScope(scope) {
+				logger.Warn("API key lacks scope",
+					"scope", scope,
+					"method", r.Method,
+					"path", r.URL.Path)
+				problem.Respond(w, problem.CodeForbidden, "API key lacks scope "+scope)
 				return
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			if authResponse.Email == "" {
-				logger.Error("No email found in auth response", slog.String("response", string(bodyBytes)))
-			}
-
-			ctx := context.WithValue(r.Context(), model.ContextUserIDKey, authResponse.UserID)
-			ctx = context.WithValue(ctx, model.ContextEmailKey, authResponse.Email)
-			logger.Info("User authenticated",
-				"user_id", authResponse.UserID,
-				"method", r.Method,
-				"path", r.URL.Path)
-
-			// Verify context value is set correctly
-			if ctx.Value(model.ContextUserIDKey) == nil {
-				logger.Error("Failed to set user_id in context")
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+// RequireAdmin lets through only the users with one of adminUserIDs signed in with a user
+// token; API keys are rejected. Users are matched by ID rather than email, which they can
+// change to any unverified address. It must run after AuthMiddleware.
+func RequireAdmin(adminUserIDs []string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value(model.ContextUserIDKey).(string)
+			scope, _ := r.Context().Value(model.ContextScopeKey).(string)
+			if userID == "" || scope != "" || !slices.Contains(adminUserIDs, userID) {
+				logger.Warn("Admin access denied",
+					"user_id", userID,
+					"method", r.Method,
+					"path", r.URL.Path)
+				problem.Respond(w, problem.CodeForbidden, "admin access required")
 				return
 			}
-
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
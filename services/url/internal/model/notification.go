@@ -1,15 +1,24 @@
 package model
 
-import (
-	"time"
+import "github.com/kernelshard/hcaas/pkg/events"
+
+// Notification types published by the URL checker.
+const (
+	NotificationTypeURLUnhealthy = events.TypeURLUnhealthy
+	NotificationTypeURLRecovered = events.TypeURLRecovered
+)
+
+// Notification severities, used by routing rules in the notification service.
+const (
+	SeverityCritical = events.SeverityCritical
+	SeverityInfo     = events.SeverityInfo
 )
 
-// Notification struct represents a notification
-// This shall match the message model consumed by notification service
-type Notification struct {
-	UrlID     string    `json:"url_id"`
-	Type      string    `json:"type"`
-	Message   string    `json:"message"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+// Notification is the event consumed by the notification service.
+// The contract is owned by the shared events package.
+type Notification = events.Notification
+
+// IncidentKey returns the stable incident/dedup key for a monitored URL.
+func IncidentKey(urlID string) string {
+	return events.IncidentKey(urlID)
 }
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// OutboxEvent is an event stored in the same transaction as the state change that
+// produced it and published to Kafka afterwards by the outbox relay.
+type OutboxEvent struct {
+	ID int64
+	// AggregateID is the ID of the URL the event belongs to, used as the Kafka key
+	AggregateID string
+	EventType   string
+	Payload     []byte
+	Attempts    int
+	CreatedAt   time.Time
+}
@@ -5,14 +5,24 @@ import "time"
 const (
 	ContextUserIDKey = "user_id"
 	ContextEmailKey  = "email"
+	// ContextScopeKey holds the scopes of an API key; empty for user tokens
+	ContextScopeKey = "scope"
 )
 
 type URL struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Address   string    `json:"address"`
-	Status    string    `json:"status"`     // "up" or "down"
-	CheckedAt time.Time `json:"checked_at"` // last checked time
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Address   string            `json:"address"`
+	Status    string            `json:"status"`     // "up" or "down"
+	CheckedAt time.Time         `json:"checked_at"` // last checked time
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// URLUpdate holds the changes to a URL. A nil Address or Labels stays unchanged; empty
+// labels remove all labels.
+type URLUpdate struct {
+	Address *string           `json:"address"`
+	Labels  map[string]string `json:"labels"`
 }
 
 const (
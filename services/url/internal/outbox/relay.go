@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kernelshard/hcaas/services/url/internal/config"
+	"github.com/kernelshard/hcaas/services/url/internal/messaging"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/kernelshard/hcaas/services/url/internal/storage"
+	"github.com/samims/otelkit"
+)
+
+// maxBackoff caps the delay between relay runs while the message bus keeps failing
+const maxBackoff = time.Minute
+
+// purgeInterval is the time between two sweeps of published events
+const purgeInterval = time.Hour
+
+// Relay publishes the events of the outbox table to the message bus. Events are only marked
+// published after the bus acknowledged them, so every stored event is eventually published at least
+// once; consumers deduplicate by event ID.
+type Relay struct {
+	store       storage.OutboxStorage
+	producer    messaging.NotificationProducer
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	retention   time.Duration
+	logger      *slog.Logger
+	tracer      *otelkit.Tracer
+}
+
+func NewRelay(
+	store storage.OutboxStorage,
+	producer messaging.NotificationProducer,
+	cfg config.OutboxConfig,
+	logger *slog.Logger,
+	tracer *otelkit.Tracer,
+) *Relay {
+	return &Relay{
+		store:       store,
+		producer:    producer,
+		interval:    cfg.PollInterval,
+		batchSize:   cfg.BatchSize,
+		maxAttempts: cfg.MaxAttempts,
+		retention:   cfg.Retention,
+		logger:      logger.With("component", "outboxRelay"),
+		tracer:      tracer,
+	}
+}
+
+// Start polls the outbox until ctx is cancelled. While publishing fails, for example
+// because the message bus is unavailable, the delay between runs doubles up to maxBackoff;
+// the events stay in the outbox and are retried in order. Published events older than the
+// retention are deleted every purgeInterval.
+func (r *Relay) Start(ctx context.Context) {
+	r.logger.Info("Outbox relay started", slog.Duration("interval", r.interval), slog.Int("batch_size", r.batchSize),
+		slog.Int("max_attempts", r.maxAttempts), slog.Duration("retention", r.retention))
+
+	delay := r.interval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastPurge time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopped")
+			return
+		case <-timer.C:
+			if err := r.drain(ctx); err != nil {
+				delay = min(delay*2, max(maxBackoff, r.interval))
+				r.logger.Warn("Outbox relay backing off", slog.Duration("delay", delay), slog.Any("error", err))
+			} else {
+				delay = r.interval
+			}
+			if r.retention > 0 && time.Since(lastPurge) >= purgeInterval {
+				lastPurge = time.Now()
+				r.purge(ctx)
+			}
+			timer.Reset(delay)
+		}
+	}
+}
+
+// purge deletes the events published longer than the retention ago
+func (r *Relay) purge(ctx context.Context) {
+	n, err := r.store.PurgePublished(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		r.logger.Error("Failed to purge published outbox events", slog.Any("error", err))
+		return
+	}
+	if n > 0 {
+		r.logger.Info("Purged published outbox events", slog.Int("purged", n))
+	}
+}
+
+// drain relays batches until the outbox is empty or a publish fails
+func (r *Relay) drain(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := r.store.PublishPending(ctx, r.batchSize, r.maxAttempts, r.publish)
+		if err != nil {
+			r.logger.Error("Failed to relay outbox events", slog.Int("published", n), slog.Any("error", err))
+			return err
+		}
+		if n > 0 {
+			r.logger.Info("Relayed outbox events", slog.Int("published", n))
+		}
+		if n < r.batchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// publish decodes and publishes e. Events that cannot be decoded or are invalid fail with
+// storage.ErrUnpublishable, so they are parked at once.
+func (r *Relay) publish(ctx context.Context, e model.OutboxEvent) (err error) {
+	ctx, span := r.tracer.StartClientSpan(ctx, "OutboxRelay.publish")
+	defer span.End()
+	defer func() {
+		if err != nil && (errors.Is(err, storage.ErrUnpublishable) || e.Attempts+1 >= r.maxAttempts) {
+			r.logger.Error("Parking outbox event", slog.Int64("id", e.ID), slog.String("aggregate_id", e.AggregateID),
+				slog.Int("attempts", e.Attempts+1), slog.Any("error", err))
+		}
+	}()
+
+	var notif model.Notification
+	if err := json.Unmarshal(e.Payload, &notif); err != nil {
+		otelkit.RecordError(span, err)
+		return fmt.Errorf("outbox event %d: failed to decode payload: %w: %w", e.ID, storage.ErrUnpublishable, err)
+	}
+	if err := notif.Validate(); err != nil {
+		otelkit.RecordError(span, err)
+		return fmt.Errorf("outbox event %d: %w: %w", e.ID, storage.ErrUnpublishable, err)
+	}
+	if err := r.producer.Publish(ctx, notif); err != nil {
+		otelkit.RecordError(span, err)
+		return fmt.Errorf("outbox event %d: %w", e.ID, err)
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package router
 
 import (
 	"net/http"
-	"os"
 	"time"
 
 	"log/slog"
@@ -12,14 +11,27 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/authn"
 	"github.com/kernelshard/hcaas/services/url/internal/handler"
 	customMiddleware "github.com/kernelshard/hcaas/services/url/internal/middleware"
 )
 
-func NewRouter(h *handler.URLHandler, healthHandler *handler.HealthHandler, logger *slog.Logger, serviceName string) http.Handler {
+// NewRouter creates the HTTP routes of the URL service. The /urls routes require a token
+// or API key accepted by validator; API keys need the urls:read or urls:write scope. The
+// /admin routes require the token of a user with one of adminUserIDs.
+func NewRouter(
+	h *handler.URLHandler,
+	adminHandler *handler.AdminHandler,
+	healthHandler *handler.HealthHandler,
+	validator authn.Validator,
+	adminUserIDs []string,
+	trustProxyHeaders bool,
+	logger *slog.Logger,
+	serviceName string,
+) http.Handler {
 	r := chi.NewRouter()
-	authSvcURL := os.Getenv("AUTH_SVC_URL")
-	authMiddleware := customMiddleware.AuthMiddleware(authSvcURL, logger)
+	authMiddleware := customMiddleware.AuthMiddleware(validator, logger)
 
 	// Middleware
 	r.Use(customMiddleware.MetricsMiddleware)
@@ -27,6 +39,7 @@ func NewRouter(h *handler.URLHandler, healthHandler *handler.HealthHandler, logg
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(30 * time.Second))
+	r.Use(audit.Middleware(trustProxyHeaders))
 
 	// Add OpenTelemetry middleware
 	r.Use(func(next http.Handler) http.Handler {
@@ -35,10 +48,20 @@ func NewRouter(h *handler.URLHandler, healthHandler *handler.HealthHandler, logg
 
 	r.Route("/urls", func(r chi.Router) {
 		r.Use(authMiddleware)
+		r.Use(customMiddleware.ScopeMiddleware(authn.ScopeURLsRead, authn.ScopeURLsWrite, logger))
 		r.Get("/", h.GetAll)
 		r.Get("/{id}", h.GetByID)
 		r.Get("/me", h.GetAllByUserID)
+		r.Delete("/me", h.DeleteAllByUserID)
 		r.Post("/", h.Add)
+		r.Patch("/{id}", h.Update)
+		r.Delete("/{id}", h.Delete)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Use(customMiddleware.RequireAdmin(adminUserIDs, logger))
+		r.Get("/audit", adminHandler.Audit)
 	})
 
 	// Health & Readiness Routes
@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	neturl "net/url"
 	"time"
 
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 
+	"github.com/kernelshard/hcaas/pkg/audit"
 	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
 	"github.com/kernelshard/hcaas/services/url/internal/model"
 	"github.com/kernelshard/hcaas/services/url/internal/storage"
@@ -20,18 +22,18 @@ import (
 func getUserIDFromContext(ctx context.Context) (string, error) {
 	val := ctx.Value(model.ContextUserIDKey)
 	if val == nil {
-		return "", appErr.NewInternal("context missing user_id - verify auth middleware is properly configured and executed before service methods")
+		return "", appErr.NewInternal(errors.New("context missing user_id - verify auth middleware is properly configured and executed before service methods"), "missing user")
 	}
 
 	userID, ok := val.(string)
 	if !ok {
-		return "", appErr.NewInternal(fmt.Sprintf(
+		return "", appErr.NewInternal(fmt.Errorf(
 			"invalid user_id type in context - got %T (%v), expected string",
-			val, val))
+			val, val), "missing user")
 	}
 
 	if userID == "" {
-		return "", appErr.NewInternal("empty user_id in context - verify auth service is returning valid user identifier")
+		return "", appErr.NewInternal(errors.New("empty user_id in context - verify auth service is returning valid user identifier"), "missing user")
 	}
 	slog.Debug("Successfully extracted user_id from context",
 		"user_id", userID,
@@ -39,29 +41,73 @@ func getUserIDFromContext(ctx context.Context) (string, error) {
 	return userID, nil
 }
 
+// validateAddress checks that address is an absolute http or https URL, which the checker
+// can request
+func validateAddress(address string) error {
+	u, err := neturl.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return appErr.NewInvalidInput("address must be an http or https URL")
+	}
+	return nil
+}
+
 type URLService interface {
 	GetAll(ctx context.Context) ([]model.URL, error)
 	GetByID(ctx context.Context, id string) (*model.URL, error)
 	GetAllByUserID(ctx context.Context) ([]model.URL, error)
 	Add(ctx context.Context, url model.URL) error
-	UpdateStatus(ctx context.Context, id string, status string) error
+	// Update changes the address or labels of a URL of the user in ctx and returns the
+	// updated URL. URLs of other users are not found.
+	Update(ctx context.Context, id string, update model.URLUpdate) (*model.URL, error)
+	// Delete deletes a URL of the user in ctx. URLs of other users are not found.
+	Delete(ctx context.Context, id string) error
+	// UpdateStatus records the result of a check together with the notification event of a
+	// status transition, if any. The event is published asynchronously by the outbox relay.
+	// UpdateStatus records a check of a URL whose status was from. It returns ErrConflict when
+	// the status changed meanwhile, so a transition is only recorded by one checker.
+	UpdateStatus(ctx context.Context, id, from, status string, event *model.Notification) error
+	// DeleteAllByUserID deletes the URLs of the user in ctx, e.g. when the account is
+	// deleted, and returns how many there were
+	DeleteAllByUserID(ctx context.Context) (int, error)
 }
 
 type urlService struct {
 	store  storage.Storage
+	audit  audit.Recorder
 	logger *slog.Logger
 	tracer *otelkit.Tracer
 }
 
-func NewURLService(store storage.Storage, logger *slog.Logger, tracer *otelkit.Tracer) URLService {
+// NewURLService creates a URLService. Created, updated and deleted URLs are recorded to rec.
+func NewURLService(store storage.Storage, rec audit.Recorder, logger *slog.Logger, tracer *otelkit.Tracer) URLService {
 	l := logger.With("layer", "service", "component", "urlService")
 	return &urlService{
 		store:  store,
+		audit:  rec,
 		logger: l,
 		tracer: tracer,
 	}
 }
 
+// record records a change of the monitor id; before is nil for creations and after for
+// deletions
+func (s *urlService) record(ctx context.Context, action, id string, before, after *model.URL) {
+	e := audit.Event{Action: action, TargetType: "monitor", TargetID: id}
+	var err error
+	// Typed nil pointers would encode as null objects rather than be left out
+	var b, a any
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	if e.Before, e.After, err = audit.Diff(b, a); err != nil {
+		s.logger.Warn("failed to diff audited change", slog.String("action", action), slog.String("error", err.Error()))
+	}
+	s.audit.Record(ctx, e)
+}
+
 // GetAllByUserID fetches urls for the user
 func (s *urlService) GetAllByUserID(ctx context.Context) ([]model.URL, error) {
 	ctx, span := s.tracer.StartServerSpan(ctx, "GetAllByUserID", attribute.String("file", "url_service"))
@@ -86,7 +132,7 @@ func (s *urlService) GetAllByUserID(ctx context.Context) ([]model.URL, error) {
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, err.Error())
 		span.SetAttributes(attribute.String("error.type", "storage_error"))
-		return nil, appErr.NewInternal("failed to fetch URLs: %v", err)
+		return nil, appErr.NewInternal(err, "failed to fetch URLs")
 	}
 	span.SetAttributes(attribute.Int("url.count", len(userURLs)))
 	s.logger.Info("GetAllByUserID succeeded", slog.Int("count", len(userURLs)), slog.String("user_id", userID))
@@ -104,7 +150,7 @@ func (s *urlService) GetAll(ctx context.Context) ([]model.URL, error) {
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, err.Error())
 		span.SetAttributes(attribute.String("error.type", "storage_error"))
-		return nil, appErr.NewInternal("failed to fetch URLs: %v", err)
+		return nil, appErr.NewInternal(err, "failed to fetch URLs")
 	}
 
 	span.SetAttributes(attribute.Int("url.count", len(urls)))
@@ -137,7 +183,7 @@ func (s *urlService) GetByID(ctx context.Context, id string) (*model.URL, error)
 			otelkit.RecordError(span, err)
 			span.SetStatus(codes.Error, err.Error())
 			span.SetAttributes(attribute.String("error.type", "not_found_error"))
-			return nil, appErr.NewNotFound(fmt.Sprintf("URL with ID %s not found", id))
+			return nil, appErr.NewNotFound("URL with ID %s not found", id)
 		}
 		s.logger.Error("failed to fetch URL by ID",
 			slog.String("id", id),
@@ -147,7 +193,7 @@ func (s *urlService) GetByID(ctx context.Context, id string) (*model.URL, error)
 		otelkit.RecordError(span, err)
 		span.SetStatus(codes.Error, err.Error())
 		span.SetAttributes(attribute.String("error.type", "storage_error"))
-		return nil, appErr.NewInternal("failed to fetch URL by ID: %v", err)
+		return nil, appErr.NewInternal(err, "failed to fetch URL by ID")
 	}
 
 	// Verify URL belongs to requesting user
@@ -160,7 +206,7 @@ func (s *urlService) GetByID(ctx context.Context, id string) (*model.URL, error)
 		otelkit.RecordError(span, ownershipErr)
 		span.SetStatus(codes.Error, ownershipErr.Error())
 		span.SetAttributes(attribute.String("error.type", "access_denied"))
-		return nil, appErr.NewNotFound(fmt.Sprintf("URL with ID %s not found", id))
+		return nil, appErr.NewNotFound("URL with ID %s not found", id)
 	}
 
 	s.logger.Info("GetByID succeeded", slog.String("id", id), slog.String("user_id", userID))
@@ -177,6 +223,12 @@ func (s *urlService) Add(ctx context.Context, url model.URL) error {
 	)
 	s.logger.Info("Add url called", slog.String("url", url.Address))
 
+	if err := validateAddress(url.Address); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
 	userID, err := getUserIDFromContext(ctx)
 	if err != nil {
 		span.RecordError(err)
@@ -205,7 +257,7 @@ func (s *urlService) Add(ctx context.Context, url model.URL) error {
 		s.logger.Error("failed to check URL address uniqueness",
 			slog.String("address", url.Address),
 			slog.Any("error", err))
-		err = appErr.NewInternal("failed to check URL address uniqueness: %v", err)
+		err = appErr.NewInternal(err, "failed to check URL address uniqueness")
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
@@ -228,17 +280,100 @@ func (s *urlService) Add(ctx context.Context, url model.URL) error {
 		s.logger.Error("failed to add URL", slog.String("id", url.ID), slog.String("error", err.Error()))
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return appErr.NewInternal("failed to add URL: %v", err)
+		return appErr.NewInternal(err, "failed to add URL")
 	}
 
 	span.SetAttributes(attribute.String("url.id", url.ID))
 	s.logger.Info("Add succeeded", slog.String("id", url.ID), slog.String("user_id", userID))
+	s.record(ctx, audit.ActionMonitorCreated, url.ID, nil, &url)
+	return nil
+}
+
+// Update changes the address or labels of a URL of the user
+func (s *urlService) Update(ctx context.Context, id string, update model.URLUpdate) (*model.URL, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "Update", attribute.String("file", "url_service"))
+	defer span.End()
+
+	span.SetAttributes(attribute.String("url.id", id))
+	s.logger.Info("Update called", slog.String("id", id))
+
+	if update.Address != nil {
+		if err := validateAddress(*update.Address); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	// GetByID hides the URLs of other users
+	before, err := s.GetByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	after := *before
+	if update.Address != nil {
+		after.Address = *update.Address
+	}
+	if update.Labels != nil {
+		after.Labels = update.Labels
+	}
+
+	if err := s.store.Update(ctx, &after); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		switch {
+		case errors.Is(err, appErr.ErrConflict):
+			s.logger.Warn("URL address already exists for user", slog.String("address", after.Address), slog.String("user_id", before.UserID))
+			return nil, appErr.NewConflict("URL address %s already exists", after.Address)
+		case errors.Is(err, appErr.ErrNotFound):
+			return nil, appErr.NewNotFound("URL with ID %s not found", id)
+		}
+		s.logger.Error("failed to update URL", slog.String("id", id), slog.String("error", err.Error()))
+		return nil, appErr.NewInternal(err, "failed to update URL")
+	}
+
+	s.logger.Info("Update succeeded", slog.String("id", id), slog.String("user_id", before.UserID))
+	s.record(ctx, audit.ActionMonitorUpdated, id, before, &after)
+	return &after, nil
+}
+
+// Delete deletes a URL of the user
+func (s *urlService) Delete(ctx context.Context, id string) error {
+	ctx, span := s.tracer.StartServerSpan(ctx, "Delete", attribute.String("file", "url_service"))
+	defer span.End()
+
+	span.SetAttributes(attribute.String("url.id", id))
+	s.logger.Info("Delete called", slog.String("id", id))
+
+	// GetByID hides the URLs of other users
+	url, err := s.GetByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if err := s.store.Delete(ctx, id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, appErr.ErrNotFound) {
+			return appErr.NewNotFound("URL with ID %s not found", id)
+		}
+		s.logger.Error("failed to delete URL", slog.String("id", id), slog.String("error", err.Error()))
+		return appErr.NewInternal(err, "failed to delete URL")
+	}
+
+	s.logger.Info("Delete succeeded", slog.String("id", id), slog.String("user_id", url.UserID))
+	s.record(ctx, audit.ActionMonitorDeleted, id, url, nil)
 	return nil
 }
 
 // UpdateStatus updates the status of a URL by its ID.
 // This is the new, non-user-scoped method for the background checker.
-func (s *urlService) UpdateStatus(ctx context.Context, id string, status string) error {
+func (s *urlService) UpdateStatus(ctx context.Context, id, from, status string, event *model.Notification) error {
 	s.logger.Info("UpdateStatus called by bg task", slog.String("id", id), slog.String("status", status))
 
 	ctx, span := s.tracer.StartServerSpan(ctx, "UpdateStatus", attribute.String("file", "url_service"))
@@ -250,10 +385,27 @@ func (s *urlService) UpdateStatus(ctx context.Context, id string, status string)
 	)
 	s.logger.Info("UpdateStatus called", slog.String("id", id), slog.String("status", status))
 
-	if err := s.store.UpdateStatus(ctx, id, status, time.Now()); err != nil {
+	if event != nil {
+		// Assigned before the event is stored so every publish attempt carries the same ID
+		if event.EventID == "" {
+			event.EventID = uuid.New().String()
+		}
+		if err := event.Validate(); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return appErr.NewInternal(err, "invalid notification event")
+		}
+		span.SetAttributes(attribute.String("notification.event_id", event.EventID))
+	}
+
+	if err := s.store.UpdateStatus(ctx, id, from, status, time.Now(), event); err != nil {
+		if errors.Is(err, appErr.ErrConflict) {
+			span.RecordError(err)
+			return appErr.NewConflict("status of URL %s changed during the check", id)
+		}
 		if errors.Is(err, appErr.ErrNotFound) {
 			s.logger.Warn("URL not found for update", slog.String("id", id))
-			err := appErr.NewNotFound(fmt.Sprintf("cannot update: URL with ID %s not found", id))
+			err := appErr.NewNotFound("cannot update: URL with ID %s not found", id)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			return err
@@ -261,9 +413,54 @@ func (s *urlService) UpdateStatus(ctx context.Context, id string, status string)
 		s.logger.Error("failed to update status", slog.String("id", id), slog.String("error", err.Error()))
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return appErr.NewInternal("failed to update URL status: %v", err)
+		return appErr.NewInternal(err, "failed to update URL status")
 	}
 
 	s.logger.Info("UpdateStatus succeeded", slog.String("id", id), slog.String("status", status))
 	return nil
 }
+
+// DeleteAllByUserID deletes the urls of the user
+func (s *urlService) DeleteAllByUserID(ctx context.Context) (int, error) {
+	ctx, span := s.tracer.StartServerSpan(ctx, "DeleteAllByUserID", attribute.String("file", "url_service"))
+	defer span.End()
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("error.type", "context_error"))
+		return 0, err
+	}
+	span.SetAttributes(attribute.String("user.id", userID))
+
+	// Listed first, so every deleted URL can be audited
+	urls, err := s.store.FindAllByUserID(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to fetch URLs",
+			slog.String("error", err.Error()),
+			slog.String("user_id", userID))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("error.type", "storage_error"))
+		return 0, appErr.NewInternal(err, "failed to fetch URLs")
+	}
+
+	n, err := s.store.DeleteAllByUserID(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to delete URLs",
+			slog.String("error", err.Error()),
+			slog.String("user_id", userID))
+		otelkit.RecordError(span, err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("error.type", "storage_error"))
+		return 0, appErr.NewInternal(err, "failed to delete URLs")
+	}
+
+	span.SetAttributes(attribute.Int("url.count", n))
+	s.logger.Info("DeleteAllByUserID succeeded", slog.Int("count", n), slog.String("user_id", userID))
+	for _, url := range urls {
+		s.record(ctx, audit.ActionMonitorDeleted, url.ID, &url, nil)
+	}
+	return n, nil
+}
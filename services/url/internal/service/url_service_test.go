@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/kernelshard/hcaas/services/url/internal/storage"
+)
+
+// Test_urlService tests adding, changing and deleting URLs, the errors returned for invalid
+// and foreign URLs, and the audit events of the changes.
+// Table Driven Test Pattern used
+func Test_urlService(t *testing.T) {
+	urls, _ := storage.NewMemoryStorage()
+	events := audit.NewMemoryStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(urls, audit.NewRecorder(events, logger), logger, otelkit.New("test"))
+
+	as := func(userID string) context.Context {
+		return context.WithValue(context.Background(), model.ContextUserIDKey, userID)
+	}
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		call      func() error
+		wantErr   error
+		wantAudit []string
+	}{
+		{name: "add", call: func() error { return svc.Add(as("alice"), model.URL{ID: "u1", Address: "https://example.com"}) }, wantAudit: []string{audit.ActionMonitorCreated}},
+		{name: "add without scheme", call: func() error { return svc.Add(as("alice"), model.URL{Address: "example.com"}) }, wantErr: appErr.ErrInvalidInput},
+		{name: "add duplicate address", call: func() error { return svc.Add(as("alice"), model.URL{Address: "https://example.com"}) }, wantErr: appErr.ErrConflict},
+		{name: "add same address for another user", call: func() error { return svc.Add(as("bob"), model.URL{ID: "u2", Address: "https://example.com"}) }, wantAudit: []string{audit.ActionMonitorCreated}},
+		{
+			name: "update",
+			call: func() error {
+				u, err := svc.Update(as("alice"), "u1", model.URLUpdate{Address: str("https://example.org"), Labels: map[string]string{"env": "prod"}})
+				if err == nil && (u.Address != "https://example.org" || u.Labels["env"] != "prod") {
+					t.Errorf("Update() = %+v, want the new address and labels", *u)
+				}
+				return err
+			},
+			wantAudit: []string{audit.ActionMonitorUpdated},
+		},
+		{name: "update with invalid address", call: func() error { _, err := svc.Update(as("alice"), "u1", model.URLUpdate{Address: str("")}); return err }, wantErr: appErr.ErrInvalidInput},
+		{name: "update of another user", call: func() error {
+			_, err := svc.Update(as("bob"), "u1", model.URLUpdate{Labels: map[string]string{}})
+			return err
+		}, wantErr: appErr.ErrNotFound},
+		{name: "get unknown", call: func() error { _, err := svc.GetByID(as("alice"), "missing"); return err }, wantErr: appErr.ErrNotFound},
+		{name: "delete of another user", call: func() error { return svc.Delete(as("bob"), "u1") }, wantErr: appErr.ErrNotFound},
+		{name: "delete", call: func() error { return svc.Delete(as("alice"), "u1") }, wantAudit: []string{audit.ActionMonitorDeleted}},
+		{name: "delete again", call: func() error { return svc.Delete(as("alice"), "u1") }, wantErr: appErr.ErrNotFound},
+		{name: "missing user", call: func() error { _, err := svc.GetAllByUserID(context.Background()); return err }, wantErr: appErr.ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := events.Query(context.Background(), audit.Filter{})
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			after, _ := events.Query(context.Background(), audit.Filter{})
+			var got []string
+			for _, e := range slices.Backward(after[:len(after)-len(before)]) {
+				got = append(got, e.Action)
+			}
+			if !slices.Equal(got, tt.wantAudit) {
+				t.Errorf("audit events = %v, want %v", got, tt.wantAudit)
+			}
+		})
+	}
+}
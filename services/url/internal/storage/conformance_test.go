@@ -0,0 +1,88 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/audit/audittest"
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/services/url/internal/storage"
+	"github.com/kernelshard/hcaas/services/url/internal/storage/storagetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (storage.Storage, storage.OutboxStorage) {
+		return storage.NewMemoryStorage()
+	})
+}
+
+// newSQLiteDB returns a migrated in-memory SQLite database
+func newSQLiteDB(t *testing.T) *sql.DB {
+	db, err := database.OpenSQLite("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := storage.NewMigrator(db, database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	tracer := otelkit.New("test")
+	storagetest.Run(t, func(t *testing.T) (storage.Storage, storage.OutboxStorage) {
+		db := newSQLiteDB(t)
+		return storage.NewSQLiteStorage(db, tracer), storage.NewSQLiteOutboxStorage(db, tracer)
+	})
+}
+
+func TestSQLiteAuditConformance(t *testing.T) {
+	tracer := otelkit.New("test")
+	audittest.Run(t, func(t *testing.T) audit.Store {
+		return audit.NewSQLiteStore(newSQLiteDB(t), tracer)
+	})
+}
+
+// TestPostgresConformance runs against the database of TEST_POSTGRES_URL, which must be
+// migrated. Its tables are truncated.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	tracer := otelkit.New("test")
+	storagetest.Run(t, func(t *testing.T) (storage.Storage, storage.OutboxStorage) {
+		pool := newPostgresPool(t, dsn)
+		return storage.NewPostgresStorage(pool, tracer), storage.NewPostgresOutboxStorage(pool, tracer)
+	})
+	t.Run("Audit", func(t *testing.T) {
+		audittest.Run(t, func(t *testing.T) audit.Store {
+			return audit.NewPostgresStore(newPostgresPool(t, dsn), tracer)
+		})
+	})
+}
+
+// newPostgresPool connects to the database of dsn and truncates its tables
+func newPostgresPool(t *testing.T, dsn string) *pgxpool.Pool {
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New() error = %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := pool.Exec(ctx, "TRUNCATE urls, outbox, audit_events RESTART IDENTITY"); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	return pool
+}
@@ -5,6 +5,12 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/samims/otelkit"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
 )
 
 func NewPostgresPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
@@ -18,3 +24,73 @@ func NewPostgresPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	}
 	return pool, nil
 }
+
+// Stores are the stores of the URL service sharing one database.
+type Stores struct {
+	URLs   Storage
+	Outbox OutboxStorage
+	// Audit holds the audit log
+	Audit audit.Store
+	// Migrator manages the schema of the database
+	Migrator *migrate.Migrator
+	close    func()
+}
+
+// Close closes the database of the stores.
+func (s *Stores) Close() {
+	s.close()
+}
+
+// Open connects to the database of dsn. The backend is selected by the DSN scheme, see
+// package database. The schema is not migrated; see Stores.Migrator.
+func Open(ctx context.Context, dsn string, tracer *otelkit.Tracer) (*Stores, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("DATABASE_URL is required")
+	}
+	backend, err := database.BackendOf(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == database.SQLite {
+		db, err := database.OpenSQLite(dsn)
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := NewMigrator(db, backend)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &Stores{
+			URLs:     NewSQLiteStorage(db, tracer),
+			Outbox:   NewSQLiteOutboxStorage(db, tracer),
+			Audit:    audit.NewSQLiteStore(db, tracer),
+			Migrator: migrator,
+			close:    func() { db.Close() },
+		}, nil
+	}
+
+	pool, err := NewPostgresPool(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Migrations run through database/sql on connections of the pool
+	db := stdlib.OpenDBFromPool(pool)
+	migrator, err := NewMigrator(db, backend)
+	if err != nil {
+		db.Close()
+		pool.Close()
+		return nil, err
+	}
+	return &Stores{
+		URLs:     NewPostgresStorage(pool, tracer),
+		Outbox:   NewPostgresOutboxStorage(pool, tracer),
+		Audit:    audit.NewPostgresStore(pool, tracer),
+		Migrator: migrator,
+		close: func() {
+			db.Close()
+			pool.Close()
+		},
+	}, nil
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+)
+
+// memoryState is the data shared by the in-memory URL and outbox stores
+type memoryState struct {
+	mu     sync.Mutex
+	urls   map[string]model.URL
+	order  []string // URL IDs in insertion order
+	outbox []memoryOutboxEvent
+	nextID int64
+	// publishMu serializes PublishPending and PurgePublished the way a database transaction would
+	publishMu sync.Mutex
+}
+
+type memoryOutboxEvent struct {
+	model.OutboxEvent
+	lastError   string
+	publishedAt time.Time
+	parked      bool
+}
+
+type memoryStorage struct {
+	state *memoryState
+}
+
+type memoryOutboxStorage struct {
+	state *memoryState
+}
+
+// NewMemoryStorage returns a Storage and an OutboxStorage sharing in-memory state. They keep
+// the semantics of the database backends and are meant for tests and local experiments;
+// nothing is persisted.
+func NewMemoryStorage() (Storage, OutboxStorage) {
+	state := &memoryState{urls: map[string]model.URL{}}
+	return &memoryStorage{state: state}, &memoryOutboxStorage{state: state}
+}
+
+// copyURL returns url with its own labels map, so callers cannot modify the stored URL
+func copyURL(url model.URL) model.URL {
+	url.Labels = maps.Clone(url.Labels)
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+	return url
+}
+
+func (ms *memoryStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+func (ms *memoryStorage) Save(_ context.Context, url *model.URL) error {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	if _, ok := ms.state.urls[url.ID]; ok {
+		return appErr.ErrConflict
+	}
+	for _, existing := range ms.state.urls {
+		if existing.UserID == url.UserID && existing.Address == url.Address {
+			return appErr.ErrConflict
+		}
+	}
+
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+	ms.state.urls[url.ID] = copyURL(*url)
+	ms.state.order = append(ms.state.order, url.ID)
+	return nil
+}
+
+func (ms *memoryStorage) FindAll(_ context.Context) ([]model.URL, error) {
+	return ms.find(func(model.URL) bool { return true }), nil
+}
+
+func (ms *memoryStorage) FindAllByUserID(_ context.Context, userID string) ([]model.URL, error) {
+	return ms.find(func(url model.URL) bool { return url.UserID == userID }), nil
+}
+
+// find returns the URLs matching match in insertion order
+func (ms *memoryStorage) find(match func(model.URL) bool) []model.URL {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	var urls []model.URL
+	for _, id := range ms.state.order {
+		if url := ms.state.urls[id]; match(url) {
+			urls = append(urls, copyURL(url))
+		}
+	}
+	return urls
+}
+
+func (ms *memoryStorage) FindByID(_ context.Context, id string) (model.URL, error) {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	url, ok := ms.state.urls[id]
+	if !ok {
+		return model.URL{}, fmt.Errorf("url not found: %w", appErr.ErrNotFound)
+	}
+	return copyURL(url), nil
+}
+
+func (ms *memoryStorage) FindByAddress(_ context.Context, address string) (model.URL, error) {
+	urls := ms.find(func(url model.URL) bool { return url.Address == address })
+	if len(urls) == 0 {
+		return model.URL{}, appErr.ErrNotFound
+	}
+	return urls[0], nil
+}
+
+func (ms *memoryStorage) UpdateStatus(_ context.Context, id, from, status string, checkedAt time.Time, event *model.Notification) error {
+	var payload []byte
+	if event != nil {
+		var err error
+		if payload, err = json.Marshal(event); err != nil {
+			return fmt.Errorf("failed to marshal outbox event: %w", err)
+		}
+	}
+
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	url, ok := ms.state.urls[id]
+	if !ok {
+		return fmt.Errorf("no record found to update with id %s: %w", id, appErr.ErrNotFound)
+	}
+	if url.Status != from {
+		return fmt.Errorf("status of %s is no longer %s: %w", id, from, appErr.ErrConflict)
+	}
+	url.Status = status
+	url.CheckedAt = checkedAt
+	ms.state.urls[id] = url
+
+	if event != nil {
+		ms.state.nextID++
+		ms.state.outbox = append(ms.state.outbox, memoryOutboxEvent{OutboxEvent: model.OutboxEvent{
+			ID:          ms.state.nextID,
+			AggregateID: event.URLID,
+			EventType:   event.Type,
+			Payload:     payload,
+			CreatedAt:   time.Now(),
+		}})
+	}
+	return nil
+}
+
+func (ms *memoryStorage) Update(_ context.Context, url *model.URL) error {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	stored, ok := ms.state.urls[url.ID]
+	if !ok {
+		return fmt.Errorf("no record found to update with id %s: %w", url.ID, appErr.ErrNotFound)
+	}
+	for id, existing := range ms.state.urls {
+		if id != url.ID && existing.UserID == stored.UserID && existing.Address == url.Address {
+			return appErr.ErrConflict
+		}
+	}
+
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+	stored.Address = url.Address
+	stored.Labels = maps.Clone(url.Labels)
+	ms.state.urls[url.ID] = stored
+	return nil
+}
+
+func (ms *memoryStorage) Delete(_ context.Context, id string) error {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	if _, ok := ms.state.urls[id]; !ok {
+		return fmt.Errorf("no record found to delete with id %s: %w", id, appErr.ErrNotFound)
+	}
+	delete(ms.state.urls, id)
+	ms.state.order = slices.DeleteFunc(ms.state.order, func(other string) bool { return other == id })
+	return nil
+}
+
+func (ms *memoryStorage) DeleteAllByUserID(_ context.Context, userID string) (int, error) {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+
+	order := ms.state.order[:0]
+	for _, id := range ms.state.order {
+		if ms.state.urls[id].UserID == userID {
+			delete(ms.state.urls, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	n := len(ms.state.order) - len(order)
+	ms.state.order = order
+	return n, nil
+}
+
+func (mos *memoryOutboxStorage) PublishPending(
+	ctx context.Context,
+	limit, maxAttempts int,
+	publish func(ctx context.Context, e model.OutboxEvent) error,
+) (int, error) {
+	mos.state.publishMu.Lock()
+	defer mos.state.publishMu.Unlock()
+
+	// publish runs without holding mu, so checks can record results meanwhile
+	mos.state.mu.Lock()
+	var pending []int
+	for i, e := range mos.state.outbox {
+		if len(pending) == limit {
+			break
+		}
+		if e.publishedAt.IsZero() && !e.parked {
+			pending = append(pending, i)
+		}
+	}
+	events := make([]model.OutboxEvent, len(pending))
+	for i, idx := range pending {
+		events[i] = mos.state.outbox[idx].OutboxEvent
+	}
+	mos.state.mu.Unlock()
+
+	published := 0
+	for i, e := range events {
+		err := publish(ctx, e)
+
+		mos.state.mu.Lock()
+		stored := &mos.state.outbox[pending[i]]
+		if err != nil {
+			stored.parked = parkedAt(err, stored.Attempts, maxAttempts) != nil
+			stored.Attempts++
+			stored.lastError = err.Error()
+		} else {
+			stored.publishedAt = time.Now()
+		}
+		parked := stored.parked
+		mos.state.mu.Unlock()
+
+		if parked {
+			continue
+		}
+		if err != nil {
+			return published, fmt.Errorf("outbox event publish failed: %w", err)
+		}
+		published++
+	}
+	return published, nil
+}
+
+func (mos *memoryOutboxStorage) PurgePublished(_ context.Context, olderThan time.Time) (int, error) {
+	mos.state.publishMu.Lock()
+	defer mos.state.publishMu.Unlock()
+	mos.state.mu.Lock()
+	defer mos.state.mu.Unlock()
+
+	n := len(mos.state.outbox)
+	mos.state.outbox = slices.DeleteFunc(mos.state.outbox, func(e memoryOutboxEvent) bool {
+		return !e.publishedAt.IsZero() && e.publishedAt.Before(olderThan)
+	})
+	return n - len(mos.state.outbox), nil
+}
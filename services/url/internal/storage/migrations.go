@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/kernelshard/hcaas/pkg/audit"
+	"github.com/kernelshard/hcaas/pkg/database"
+	"github.com/kernelshard/hcaas/pkg/migrate"
+)
+
+// migrationsFS holds the schema migrations of the URL service, one directory per backend
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// MigrationTable records the applied migrations of the URL service
+const MigrationTable = "url_schema_migrations"
+
+// auditMigrationVersion is the version the shared audit_log migration runs at,
+// kept where it was applied before the schema moved to pkg/audit
+const auditMigrationVersion = 2
+
+// NewMigrator returns the schema migrator of the URL service for a database of backend
+func NewMigrator(db *sql.DB, backend database.Backend) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrationsFS, "migrations/"+string(backend))
+	if err != nil {
+		return nil, err
+	}
+	auditMigration, err := audit.Migration(backend, auditMigrationVersion)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, backend, fsys, MigrationTable, auditMigration)
+}
@@ -0,0 +1,29 @@
+-- Initial schema of the URL service. IF NOT EXISTS adopts databases created before migrations.
+CREATE TABLE IF NOT EXISTS urls (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT        NOT NULL,
+    address    TEXT        NOT NULL,
+    status     TEXT        NOT NULL DEFAULT 'unknown',
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    labels     JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls (user_id);
+
+-- Transactional outbox: events written with the state change that produced them
+-- and published to Kafka by the outbox relay
+CREATE TABLE IF NOT EXISTS outbox (
+    id           BIGSERIAL PRIMARY KEY,
+    aggregate_id TEXT        NOT NULL,
+    event_type   TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (id) WHERE published_at IS NULL;
@@ -0,0 +1,9 @@
+-- Events that failed too often, or cannot be published at all, are parked instead of
+-- blocking the events behind them
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS parked_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (id) WHERE published_at IS NULL AND parked_at IS NULL;
+
+-- Serves the retention sweep of published events
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at) WHERE published_at IS NOT NULL;
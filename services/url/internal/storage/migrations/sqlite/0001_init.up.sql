@@ -0,0 +1,27 @@
+-- SQLite counterpart of the Postgres migration of the same version
+CREATE TABLE IF NOT EXISTS urls (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT      NOT NULL,
+    address    TEXT      NOT NULL,
+    status     TEXT      NOT NULL DEFAULT 'unknown',
+    checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    labels     TEXT      NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls (user_id);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_id TEXT      NOT NULL,
+    event_type   TEXT      NOT NULL,
+    payload      TEXT      NOT NULL,
+    attempts     INTEGER   NOT NULL DEFAULT 0,
+    last_error   TEXT      NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (id) WHERE published_at IS NULL;
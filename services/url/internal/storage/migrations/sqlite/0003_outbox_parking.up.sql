@@ -0,0 +1,7 @@
+-- SQLite counterpart of the Postgres migration of the same version
+ALTER TABLE outbox ADD COLUMN parked_at TIMESTAMP;
+
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (id) WHERE published_at IS NULL AND parked_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/samims/otelkit"
+)
+
+// ErrUnpublishable marks publish errors caused by the event itself, such as a payload that
+// does not decode. Such events are parked at once instead of being retried.
+var ErrUnpublishable = errors.New("outbox event cannot be published")
+
+// OutboxStorage gives the outbox relay access to unpublished events.
+type OutboxStorage interface {
+	// PublishPending locks up to limit unpublished events in insertion order and passes them to
+	// publish. Events publish accepts are marked published. A failure is recorded on the event:
+	// events that failed maxAttempts times or with ErrUnpublishable are parked and skipped from
+	// then on, any other failure stops the batch so the event is retried first on the next run.
+	// Rows locked by another relay are skipped, so several replicas can relay concurrently.
+	PublishPending(ctx context.Context, limit, maxAttempts int, publish func(ctx context.Context, e model.OutboxEvent) error) (int, error)
+	// PurgePublished deletes the events published before olderThan and returns how many there
+	// were. Parked events are kept for inspection.
+	PurgePublished(ctx context.Context, olderThan time.Time) (int, error)
+}
+
+// parkedAt returns when an event failing with err after attempts earlier failures is
+// parked, or nil when it is retried.
+func parkedAt(err error, attempts, maxAttempts int) *time.Time {
+	if !errors.Is(err, ErrUnpublishable) && attempts+1 < maxAttempts {
+		return nil
+	}
+	now := time.Now()
+	return &now
+}
+
+type postgresOutboxStorage struct {
+	db     *pgxpool.Pool
+	tracer *otelkit.Tracer
+}
+
+func NewPostgresOutboxStorage(pool *pgxpool.Pool, tracer *otelkit.Tracer) OutboxStorage {
+	return &postgresOutboxStorage{db: pool, tracer: tracer}
+}
+
+// insertOutboxEvent writes a notification event to the outbox within tx
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, event *model.Notification) error {
+	const query = `
+		INSERT INTO outbox(aggregate_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox event: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, event.URLID, event.Type, payload, time.Now()); err != nil {
+		return fmt.Errorf("failed to insert outbox event: %w", err)
+	}
+	return nil
+}
+
+func (ops *postgresOutboxStorage) PublishPending(
+	ctx context.Context,
+	limit, maxAttempts int,
+	publish func(ctx context.Context, e model.OutboxEvent) error,
+) (int, error) {
+	ctx, span := ops.tracer.StartClientSpan(ctx, "PublishPending")
+	defer span.End()
+
+	const selectQuery = `
+		SELECT id, aggregate_id, event_type, payload, attempts, created_at
+		FROM outbox
+		WHERE published_at IS NULL AND parked_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	const publishedQuery = `UPDATE outbox SET published_at = $1 WHERE id = $2`
+	const failedQuery = `UPDATE outbox SET attempts = attempts + 1, last_error = $1, parked_at = $2 WHERE id = $3`
+
+	tx, err := ops.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, selectQuery, limit)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("query failed: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.OutboxEvent, error) {
+		var e model.OutboxEvent
+		err := row.Scan(&e.ID, &e.AggregateID, &e.EventType, &e.Payload, &e.Attempts, &e.CreatedAt)
+		return e, err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("scan failed: %w", err)
+	}
+
+	published, parked := 0, 0
+	var publishErr error
+	for _, e := range events {
+		if err := publish(ctx, e); err != nil {
+			parkAt := parkedAt(err, e.Attempts, maxAttempts)
+			if _, execErr := tx.Exec(ctx, failedQuery, err.Error(), parkAt, e.ID); execErr != nil {
+				span.RecordError(execErr)
+				return 0, fmt.Errorf("failed to record outbox failure: %w", execErr)
+			}
+			if parkAt != nil {
+				parked++
+				continue
+			}
+			publishErr = err
+			break
+		}
+		if _, err := tx.Exec(ctx, publishedQuery, time.Now(), e.ID); err != nil {
+			span.RecordError(err)
+			return 0, fmt.Errorf("failed to mark outbox event published: %w", err)
+		}
+		published++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to commit outbox batch: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.Int("outbox.fetched", len(events)),
+		attribute.Int("outbox.published", published),
+		attribute.Int("outbox.parked", parked),
+	)
+	if publishErr != nil {
+		span.RecordError(publishErr)
+		return published, fmt.Errorf("outbox event publish failed: %w", publishErr)
+	}
+	return published, nil
+}
+
+func (ops *postgresOutboxStorage) PurgePublished(ctx context.Context, olderThan time.Time) (int, error) {
+	ctx, span := ops.tracer.StartClientSpan(ctx, "PurgePublished")
+	defer span.End()
+
+	tag, err := ops.db.Exec(ctx, `DELETE FROM outbox WHERE published_at < $1`, olderThan)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge published outbox events: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("outbox.purged", tag.RowsAffected()))
+	return int(tag.RowsAffected()), nil
+}
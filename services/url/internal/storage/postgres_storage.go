@@ -23,7 +23,19 @@ type Storage interface {
 	FindAllByUserID(ctx context.Context, userID string) ([]model.URL, error)
 	FindByID(ctx context.Context, id string) (model.URL, error)
 	FindByAddress(ctx context.Context, address string) (model.URL, error)
-	UpdateStatus(ctx context.Context, id, status string, checkedAt time.Time) error
+	// UpdateStatus stores the result of a check of a URL whose status was from. A non-nil event
+	// is written to the outbox in the same transaction, so a status transition is never recorded
+	// without its event. It returns ErrConflict when the status is no longer from, for example
+	// because another checker recorded the transition first, and ErrNotFound when no URL has
+	// the ID.
+	UpdateStatus(ctx context.Context, id, from, status string, checkedAt time.Time, event *model.Notification) error
+	// Update stores the address and labels of url. It returns ErrNotFound when no URL has
+	// its ID and ErrConflict when its user already monitors the address.
+	Update(ctx context.Context, url *model.URL) error
+	// Delete deletes a URL. It returns ErrNotFound when no URL has the ID.
+	Delete(ctx context.Context, id string) error
+	// DeleteAllByUserID deletes the URLs of a user and returns how many there were
+	DeleteAllByUserID(ctx context.Context, userID string) (int, error)
 }
 
 type postgresStorage struct {
@@ -44,19 +56,19 @@ func (ps *postgresStorage) FindByID(ctx context.Context, id string) (model.URL,
 	defer span.End()
 
 	const query = `
-		SELECT id, user_id, address, status, checked_at, updated_at, created_at
+		SELECT id, user_id, address, status, checked_at, labels
 		FROM urls
 		WHERE id = $1
 	`
 
 	var url model.URL
 	err := ps.db.QueryRow(ctx, query, id).Scan(
-		&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt,
+		&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt, &url.Labels,
 	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return model.URL{}, fmt.Errorf("url not found: %w", err)
+			return model.URL{}, fmt.Errorf("url not found: %w", appErr.ErrNotFound)
 		}
 		span.RecordError(err)
 		return model.URL{}, fmt.Errorf("find by id failed: %w", err)
@@ -70,7 +82,7 @@ func (ps *postgresStorage) FindAll(ctx context.Context) ([]model.URL, error) {
 	defer span.End()
 
 	const query = `
-		SELECT id, user_id, address, status, checked_at
+		SELECT id, user_id, address, status, checked_at, labels
 		FROM urls
 	`
 
@@ -85,7 +97,7 @@ func (ps *postgresStorage) FindAll(ctx context.Context) ([]model.URL, error) {
 
 	for rows.Next() {
 		var url model.URL
-		if err := rows.Scan(&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt); err != nil {
+		if err := rows.Scan(&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt, &url.Labels); err != nil {
 			span.RecordError(err)
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
@@ -105,7 +117,7 @@ func (ps *postgresStorage) FindAllByUserID(ctx context.Context, userID string) (
 	defer span.End()
 
 	const query = `
-		SELECT id, user_id, address, status, checked_at
+		SELECT id, user_id, address, status, checked_at, labels
 		from urls
 		where user_id = $1
 	`
@@ -120,7 +132,7 @@ func (ps *postgresStorage) FindAllByUserID(ctx context.Context, userID string) (
 
 	for rows.Next() {
 		var url model.URL
-		if err := rows.Scan(&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt); err != nil {
+		if err := rows.Scan(&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt, &url.Labels); err != nil {
 			span.RecordError(err)
 			return nil, fmt.Errorf("scan failed %w", err)
 		}
@@ -141,12 +153,16 @@ func (ps *postgresStorage) Save(ctx context.Context, url *model.URL) error {
 	defer span.End()
 
 	const queryStr = `
-		INSERT INTO urls(id, user_id, address, status, checked_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO urls(id, user_id, address, status, checked_at, labels)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
 	`
 
-	err := ps.db.QueryRow(ctx, queryStr, url.ID, url.UserID, url.Address, url.Status, url.CheckedAt).Scan(&url.ID)
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+
+	err := ps.db.QueryRow(ctx, queryStr, url.ID, url.UserID, url.Address, url.Status, url.CheckedAt, url.Labels).Scan(&url.ID)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -162,28 +178,56 @@ func (ps *postgresStorage) Save(ctx context.Context, url *model.URL) error {
 	return nil
 }
 
-func (ps *postgresStorage) UpdateStatus(ctx context.Context, id string, status string, checkedAt time.Time) error {
+func (ps *postgresStorage) UpdateStatus(ctx context.Context, id, from, status string, checkedAt time.Time, event *model.Notification) error {
 	ctx, span := ps.tracer.StartClientSpan(ctx, "UpdateStatus")
 	defer span.End()
 
 	const query = `
 		UPDATE urls
 		SET status = $1, checked_at = $2
-		WHERE id = $3
+		WHERE id = $3 AND status = $4
 	`
 
-	cmdTags, err := ps.db.Exec(ctx, query, status, checkedAt, id)
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmdTags, err := tx.Exec(ctx, query, status, checkedAt, id, from)
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to update status: %w", err)
 	}
 
 	if cmdTags.RowsAffected() == 0 {
-		err := fmt.Errorf("no record found to update with id %s", id)
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM urls WHERE id = $1)`, id).Scan(&exists); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+		err := fmt.Errorf("no record found to update with id %s: %w", id, appErr.ErrNotFound)
+		if exists {
+			err = fmt.Errorf("status of %s is no longer %s: %w", id, from, appErr.ErrConflict)
+		}
 		span.RecordError(err)
 		return err
 	}
 
+	if event != nil {
+		if err := insertOutboxEvent(ctx, tx, event); err != nil {
+			span.RecordError(err)
+			return err
+		}
+		span.SetAttributes(attribute.String("outbox.event_id", event.EventID))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to commit status update: %w", err)
+	}
+
 	span.SetAttributes(attribute.String("url.id", id))
 	span.SetAttributes(attribute.String("url.status", status))
 	return nil
@@ -194,14 +238,14 @@ func (ps *postgresStorage) FindByAddress(ctx context.Context, address string) (m
 	defer span.End()
 
 	const query = `
-		SELECT id, user_id, address, status, checked_at
+		SELECT id, user_id, address, status, checked_at, labels
 		FROM urls
 		WHERE address = $1
 	`
 
 	var url model.URL
 	err := ps.db.QueryRow(ctx, query, address).Scan(
-		&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt,
+		&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt, &url.Labels,
 	)
 
 	if err != nil {
@@ -214,3 +258,65 @@ func (ps *postgresStorage) FindByAddress(ctx context.Context, address string) (m
 
 	return url, nil
 }
+
+func (ps *postgresStorage) Update(ctx context.Context, url *model.URL) error {
+	ctx, span := ps.tracer.StartClientSpan(ctx, "Update")
+	defer span.End()
+
+	const query = `
+		UPDATE urls
+		SET address = $1, labels = $2, updated_at = NOW()
+		WHERE id = $3
+	`
+
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+
+	cmdTags, err := ps.db.Exec(ctx, query, url.Address, url.Labels, url.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return appErr.ErrConflict
+		}
+		span.RecordError(err)
+		return fmt.Errorf("failed to update URL: %w", err)
+	}
+	if cmdTags.RowsAffected() == 0 {
+		return fmt.Errorf("no record found to update with id %s: %w", url.ID, appErr.ErrNotFound)
+	}
+
+	span.SetAttributes(attribute.String("url.id", url.ID))
+	return nil
+}
+
+func (ps *postgresStorage) Delete(ctx context.Context, id string) error {
+	ctx, span := ps.tracer.StartClientSpan(ctx, "Delete")
+	defer span.End()
+
+	cmdTags, err := ps.db.Exec(ctx, `DELETE FROM urls WHERE id = $1`, id)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	if cmdTags.RowsAffected() == 0 {
+		return fmt.Errorf("no record found to delete with id %s: %w", id, appErr.ErrNotFound)
+	}
+
+	span.SetAttributes(attribute.String("url.id", id))
+	return nil
+}
+
+func (ps *postgresStorage) DeleteAllByUserID(ctx context.Context, userID string) (int, error) {
+	ctx, span := ps.tracer.StartClientSpan(ctx, "DeleteAllByUserID")
+	defer span.End()
+
+	cmdTags, err := ps.db.Exec(ctx, `DELETE FROM urls WHERE user_id = $1`, userID)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete URLs: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int64("url.count", cmdTags.RowsAffected()))
+	return int(cmdTags.RowsAffected()), nil
+}
@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samims/otelkit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kernelshard/hcaas/pkg/database"
+	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+)
+
+type sqliteStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteStorage returns a Storage backed by SQLite. Labels are stored as JSON text.
+func NewSQLiteStorage(db *sql.DB, tracer *otelkit.Tracer) Storage {
+	return &sqliteStorage{db: db, tracer: tracer}
+}
+
+const sqliteURLColumns = `id, user_id, address, status, checked_at, labels`
+
+// scanSQLiteURL scans a row of sqliteURLColumns
+func scanSQLiteURL(row interface{ Scan(dest ...any) error }) (model.URL, error) {
+	var url model.URL
+	var labels string
+	if err := row.Scan(&url.ID, &url.UserID, &url.Address, &url.Status, &url.CheckedAt, &labels); err != nil {
+		return model.URL{}, err
+	}
+	if err := json.Unmarshal([]byte(labels), &url.Labels); err != nil {
+		return model.URL{}, fmt.Errorf("invalid labels of url %s: %w", url.ID, err)
+	}
+	return url, nil
+}
+
+func (ss *sqliteStorage) Ping(ctx context.Context) error {
+	return ss.db.PingContext(ctx)
+}
+
+func (ss *sqliteStorage) FindByID(ctx context.Context, id string) (model.URL, error) {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "FindByID")
+	defer span.End()
+
+	query := `SELECT ` + sqliteURLColumns + ` FROM urls WHERE id = $1`
+	url, err := scanSQLiteURL(ss.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.URL{}, fmt.Errorf("url not found: %w", appErr.ErrNotFound)
+		}
+		span.RecordError(err)
+		return model.URL{}, fmt.Errorf("find by id failed: %w", err)
+	}
+	return url, nil
+}
+
+func (ss *sqliteStorage) FindByAddress(ctx context.Context, address string) (model.URL, error) {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "FindByAddress")
+	defer span.End()
+
+	query := `SELECT ` + sqliteURLColumns + ` FROM urls WHERE address = $1`
+	url, err := scanSQLiteURL(ss.db.QueryRowContext(ctx, query, address))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.URL{}, appErr.ErrNotFound
+		}
+		span.RecordError(err)
+		return model.URL{}, fmt.Errorf("find by address failed: %w", err)
+	}
+	return url, nil
+}
+
+func (ss *sqliteStorage) FindAll(ctx context.Context) ([]model.URL, error) {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "FindAll")
+	defer span.End()
+
+	urls, err := ss.findURLs(ctx, `SELECT `+sqliteURLColumns+` FROM urls`)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (ss *sqliteStorage) FindAllByUserID(ctx context.Context, userID string) ([]model.URL, error) {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "FindAllByUserID")
+	defer span.End()
+
+	urls, err := ss.findURLs(ctx, `SELECT `+sqliteURLColumns+` FROM urls WHERE user_id = $1`, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("url.count", len(urls)))
+	return urls, nil
+}
+
+// findURLs returns the URLs selected by query
+func (ss *sqliteStorage) findURLs(ctx context.Context, query string, args ...any) ([]model.URL, error) {
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []model.URL
+	for rows.Next() {
+		url, err := scanSQLiteURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration failed: %w", err)
+	}
+	return urls, nil
+}
+
+func (ss *sqliteStorage) Save(ctx context.Context, url *model.URL) error {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "Save")
+	defer span.End()
+
+	const query = `
+		INSERT INTO urls(id, user_id, address, status, checked_at, labels)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+	labels, err := json.Marshal(url.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal labels: %w", err)
+	}
+
+	_, err = ss.db.ExecContext(ctx, query, url.ID, url.UserID, url.Address, url.Status, url.CheckedAt, string(labels))
+	if err != nil {
+		if database.IsSQLiteUniqueViolation(err) {
+			return appErr.ErrConflict
+		}
+		span.RecordError(err)
+		return fmt.Errorf("failed to save URL: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("url.id", url.ID))
+	return nil
+}
+
+func (ss *sqliteStorage) Update(ctx context.Context, url *model.URL) error {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "Update")
+	defer span.End()
+
+	const query = `UPDATE urls SET address = $1, labels = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`
+
+	if url.Labels == nil {
+		url.Labels = map[string]string{}
+	}
+	labels, err := json.Marshal(url.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal labels: %w", err)
+	}
+
+	res, err := ss.db.ExecContext(ctx, query, url.Address, string(labels), url.ID)
+	if err != nil {
+		if database.IsSQLiteUniqueViolation(err) {
+			return appErr.ErrConflict
+		}
+		span.RecordError(err)
+		return fmt.Errorf("failed to update URL: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("no record found to update with id %s: %w", url.ID, appErr.ErrNotFound)
+	}
+
+	span.SetAttributes(attribute.String("url.id", url.ID))
+	return nil
+}
+
+func (ss *sqliteStorage) Delete(ctx context.Context, id string) error {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "Delete")
+	defer span.End()
+
+	res, err := ss.db.ExecContext(ctx, `DELETE FROM urls WHERE id = $1`, id)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("no record found to delete with id %s: %w", id, appErr.ErrNotFound)
+	}
+
+	span.SetAttributes(attribute.String("url.id", id))
+	return nil
+}
+
+func (ss *sqliteStorage) DeleteAllByUserID(ctx context.Context, userID string) (int, error) {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "DeleteAllByUserID")
+	defer span.End()
+
+	res, err := ss.db.ExecContext(ctx, `DELETE FROM urls WHERE user_id = $1`, userID)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete URLs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to delete URLs: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int64("url.count", n))
+	return int(n), nil
+}
+
+func (ss *sqliteStorage) UpdateStatus(ctx context.Context, id, from, status string, checkedAt time.Time, event *model.Notification) error {
+	ctx, span := ss.tracer.StartClientSpan(ctx, "UpdateStatus")
+	defer span.End()
+
+	const query = `UPDATE urls SET status = $1, checked_at = $2 WHERE id = $3 AND status = $4`
+	const outboxQuery = `
+		INSERT INTO outbox(aggregate_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, status, checkedAt, id, from)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if n == 0 {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM urls WHERE id = $1)`, id).Scan(&exists); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+		err := fmt.Errorf("no record found to update with id %s: %w", id, appErr.ErrNotFound)
+		if exists {
+			err = fmt.Errorf("status of %s is no longer %s: %w", id, from, appErr.ErrConflict)
+		}
+		span.RecordError(err)
+		return err
+	}
+
+	if event != nil {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox event: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, outboxQuery, event.URLID, event.Type, string(payload), time.Now()); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to insert outbox event: %w", err)
+		}
+		span.SetAttributes(attribute.String("outbox.event_id", event.EventID))
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to commit status update: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("url.id", id))
+	span.SetAttributes(attribute.String("url.status", status))
+	return nil
+}
+
+type sqliteOutboxStorage struct {
+	db     *sql.DB
+	tracer *otelkit.Tracer
+}
+
+// NewSQLiteOutboxStorage returns an OutboxStorage backed by SQLite. SQLite has no row locks,
+// so concurrent relays may publish an event twice; consumers drop duplicates by event ID.
+func NewSQLiteOutboxStorage(db *sql.DB, tracer *otelkit.Tracer) OutboxStorage {
+	return &sqliteOutboxStorage{db: db, tracer: tracer}
+}
+
+// PublishPending publishes outside of any transaction: the pool has a single connection,
+// which a transaction would hold for as long as the brokers take to respond. The outcome
+// of the batch is written in one short transaction afterwards.
+func (sos *sqliteOutboxStorage) PublishPending(
+	ctx context.Context,
+	limit, maxAttempts int,
+	publish func(ctx context.Context, e model.OutboxEvent) error,
+) (int, error) {
+	ctx, span := sos.tracer.StartClientSpan(ctx, "PublishPending")
+	defer span.End()
+
+	const selectQuery = `
+		SELECT id, aggregate_id, event_type, payload, attempts, created_at
+		FROM outbox
+		WHERE published_at IS NULL AND parked_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`
+	const publishedQuery = `UPDATE outbox SET published_at = $1 WHERE id = $2 AND published_at IS NULL`
+	const failedQuery = `UPDATE outbox SET attempts = attempts + 1, last_error = $1, parked_at = $2 WHERE id = $3 AND published_at IS NULL`
+
+	events, err := selectOutboxEvents(ctx, sos.db, selectQuery, limit)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	// failure is a publish error to record on its event
+	type failure struct {
+		event  model.OutboxEvent
+		err    error
+		parkAt *time.Time
+	}
+	var (
+		publishedIDs []int64
+		failures     []failure
+		parked       int
+		publishErr   error
+	)
+	for _, e := range events {
+		if err := publish(ctx, e); err != nil {
+			parkAt := parkedAt(err, e.Attempts, maxAttempts)
+			failures = append(failures, failure{event: e, err: err, parkAt: parkAt})
+			if parkAt != nil {
+				parked++
+				continue
+			}
+			publishErr = err
+			break
+		}
+		publishedIDs = append(publishedIDs, e.ID)
+	}
+
+	// The brokers already have the published events, so their outcome is recorded even if
+	// ctx was cancelled meanwhile
+	wctx := context.WithoutCancel(ctx)
+	tx, err := sos.db.BeginTx(wctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, id := range publishedIDs {
+		if _, err := tx.ExecContext(wctx, publishedQuery, now, id); err != nil {
+			span.RecordError(err)
+			return 0, fmt.Errorf("failed to mark outbox event published: %w", err)
+		}
+	}
+	for _, f := range failures {
+		if _, err := tx.ExecContext(wctx, failedQuery, f.err.Error(), f.parkAt, f.event.ID); err != nil {
+			span.RecordError(err)
+			return 0, fmt.Errorf("failed to record outbox failure: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to commit outbox batch: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.Int("outbox.fetched", len(events)),
+		attribute.Int("outbox.published", len(publishedIDs)),
+		attribute.Int("outbox.parked", parked),
+	)
+	if publishErr != nil {
+		span.RecordError(publishErr)
+		return len(publishedIDs), fmt.Errorf("outbox event publish failed: %w", publishErr)
+	}
+	return len(publishedIDs), nil
+}
+
+func (sos *sqliteOutboxStorage) PurgePublished(ctx context.Context, olderThan time.Time) (int, error) {
+	ctx, span := sos.tracer.StartClientSpan(ctx, "PurgePublished")
+	defer span.End()
+
+	res, err := sos.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, olderThan.UTC())
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge published outbox events: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to purge published outbox events: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("outbox.purged", n))
+	return int(n), nil
+}
+
+// selectOutboxEvents reads the outbox events selected by query
+func selectOutboxEvents(ctx context.Context, db *sql.DB, query string, args ...any) ([]model.OutboxEvent, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var events []model.OutboxEvent
+	for rows.Next() {
+		var e model.OutboxEvent
+		var payload string
+		if err := rows.Scan(&e.ID, &e.AggregateID, &e.EventType, &payload, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration failed: %w", err)
+	}
+	return events, nil
+}
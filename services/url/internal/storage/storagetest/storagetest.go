@@ -0,0 +1,423 @@
+// Package storagetest is the conformance suite every backend of the URL service stores must pass.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	appErr "github.com/kernelshard/hcaas/services/url/internal/errors"
+	"github.com/kernelshard/hcaas/services/url/internal/model"
+	"github.com/kernelshard/hcaas/services/url/internal/storage"
+)
+
+// Factory returns empty stores sharing one database.
+type Factory func(t *testing.T) (storage.Storage, storage.OutboxStorage)
+
+// Run runs the conformance suite against the stores returned by newStores.
+func Run(t *testing.T, newStores Factory) {
+	t.Run("SaveAndFind", func(t *testing.T) { testSaveAndFind(t, newStores) })
+	t.Run("SaveConflict", func(t *testing.T) { testSaveConflict(t, newStores) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newStores) })
+	t.Run("UpdateStatus", func(t *testing.T) { testUpdateStatus(t, newStores) })
+	t.Run("UpdateAndDelete", func(t *testing.T) { testUpdateAndDelete(t, newStores) })
+	t.Run("DeleteAllByUserID", func(t *testing.T) { testDeleteAllByUserID(t, newStores) })
+	t.Run("PublishPending", func(t *testing.T) { testPublishPending(t, newStores) })
+	t.Run("ParkFailingEvents", func(t *testing.T) { testParkFailingEvents(t, newStores) })
+	t.Run("PurgePublished", func(t *testing.T) { testPurgePublished(t, newStores) })
+	t.Run("WriteWhilePublishing", func(t *testing.T) { testWriteWhilePublishing(t, newStores) })
+}
+
+func newURL(id, userID, address string) *model.URL {
+	return &model.URL{
+		ID:        id,
+		UserID:    userID,
+		Address:   address,
+		Status:    model.StatusUnknown,
+		CheckedAt: time.Now().UTC().Truncate(time.Microsecond),
+		Labels:    map[string]string{"env": "prod"},
+	}
+}
+
+func mustSave(t *testing.T, s storage.Storage, urls ...*model.URL) {
+	t.Helper()
+	for _, u := range urls {
+		if err := s.Save(context.Background(), u); err != nil {
+			t.Fatalf("Save(%s) error = %v", u.ID, err)
+		}
+	}
+}
+
+func testSaveAndFind(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+	want := newURL("u1", "alice", "https://example.com")
+	mustSave(t, s, want, newURL("u2", "alice", "https://example.org"), newURL("u3", "bob", "https://example.com"))
+
+	got, err := s.FindByID(ctx, "u1")
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.ID != want.ID || got.UserID != want.UserID || got.Address != want.Address || got.Status != want.Status {
+		t.Errorf("FindByID() = %+v, want %+v", got, *want)
+	}
+	if !got.CheckedAt.Equal(want.CheckedAt) {
+		t.Errorf("FindByID() CheckedAt = %v, want %v", got.CheckedAt, want.CheckedAt)
+	}
+	if got.Labels["env"] != "prod" {
+		t.Errorf("FindByID() Labels = %v, want env=prod", got.Labels)
+	}
+
+	byAddress, err := s.FindByAddress(ctx, "https://example.org")
+	if err != nil || byAddress.ID != "u2" {
+		t.Errorf("FindByAddress() = %s, %v, want u2", byAddress.ID, err)
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		userID string
+		want   int
+	}{
+		{userID: "alice", want: 2},
+		{userID: "bob", want: 1},
+		{userID: "carol", want: 0},
+	}
+	for _, tt := range tests {
+		urls, err := s.FindAllByUserID(ctx, tt.userID)
+		if err != nil {
+			t.Fatalf("FindAllByUserID(%s) error = %v", tt.userID, err)
+		}
+		if len(urls) != tt.want {
+			t.Errorf("FindAllByUserID(%s) returned %d urls, want %d", tt.userID, len(urls), tt.want)
+		}
+	}
+
+	all, err := s.FindAll(ctx)
+	if err != nil || len(all) != 3 {
+		t.Errorf("FindAll() returned %d urls, %v, want 3", len(all), err)
+	}
+}
+
+func testSaveConflict(t *testing.T, newStores Factory) {
+	s, _ := newStores(t)
+	mustSave(t, s, newURL("u1", "alice", "https://example.com"))
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name string
+		url  *model.URL
+	}{
+		{name: "same id", url: newURL("u1", "bob", "https://example.org")},
+		{name: "same user and address", url: newURL("u2", "alice", "https://example.com")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Save(context.Background(), tt.url); !errors.Is(err, appErr.ErrConflict) {
+				t.Errorf("Save() error = %v, want ErrConflict", err)
+			}
+		})
+	}
+}
+
+func testNotFound(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+
+	if _, err := s.FindByID(ctx, "missing"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("FindByID() error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.FindByAddress(ctx, "https://missing.example"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("FindByAddress() error = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateStatus(ctx, "missing", model.StatusUnknown, model.StatusUP, time.Now(), nil); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("UpdateStatus() error = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdateAndDelete(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+	mustSave(t, s, newURL("u1", "alice", "https://example.com"), newURL("u2", "alice", "https://example.org"),
+		newURL("u3", "bob", "https://example.net"))
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name    string
+		url     *model.URL
+		wantErr error
+	}{
+		{name: "address and labels", url: &model.URL{ID: "u1", Address: "https://example.com/health", Labels: map[string]string{"env": "staging"}}},
+		{name: "address of another user", url: &model.URL{ID: "u1", Address: "https://example.net"}},
+		{name: "address of the same user", url: &model.URL{ID: "u1", Address: "https://example.org"}, wantErr: appErr.ErrConflict},
+		{name: "unknown id", url: &model.URL{ID: "missing", Address: "https://example.com"}, wantErr: appErr.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := s.Update(ctx, tt.url); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Update() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	got, err := s.FindByID(ctx, "u1")
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.UserID != "alice" || got.Address != "https://example.net" || len(got.Labels) != 0 || got.Status != model.StatusUnknown {
+		t.Errorf("FindByID() = %+v, want the address of the last update, no labels and the status kept", got)
+	}
+
+	if err := s.Delete(ctx, "u1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.Delete(ctx, "u1"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("Delete() of a deleted URL error = %v, want ErrNotFound", err)
+	}
+	if urls, err := s.FindAllByUserID(ctx, "alice"); err != nil || len(urls) != 1 || urls[0].ID != "u2" {
+		t.Errorf("FindAllByUserID() = %v, %v, want only u2", urls, err)
+	}
+}
+
+func testDeleteAllByUserID(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, _ := newStores(t)
+	mustSave(t, s, newURL("u1", "alice", "https://example.com"), newURL("u2", "alice", "https://example.org"),
+		newURL("u3", "bob", "https://example.com"))
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		userID string
+		want   int
+	}{
+		{userID: "alice", want: 2},
+		{userID: "alice", want: 0},
+		{userID: "carol", want: 0},
+	}
+	for _, tt := range tests {
+		if n, err := s.DeleteAllByUserID(ctx, tt.userID); err != nil || n != tt.want {
+			t.Errorf("DeleteAllByUserID(%s) = %d, %v, want %d", tt.userID, n, err, tt.want)
+		}
+	}
+
+	if _, err := s.FindByID(ctx, "u1"); !errors.Is(err, appErr.ErrNotFound) {
+		t.Errorf("FindByID(u1) error = %v, want ErrNotFound", err)
+	}
+	// The URLs of other users stay, and the address can be monitored again
+	if urls, err := s.FindAll(ctx); err != nil || len(urls) != 1 || urls[0].ID != "u3" {
+		t.Errorf("FindAll() = %v, %v, want only u3", urls, err)
+	}
+	mustSave(t, s, newURL("u4", "alice", "https://example.com"))
+}
+
+func testUpdateStatus(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, outbox := newStores(t)
+	mustSave(t, s, newURL("u1", "alice", "https://example.com"))
+
+	checkedAt := time.Now().UTC().Add(time.Minute).Truncate(time.Microsecond)
+	event := &model.Notification{EventID: "e1", URLID: "u1", UserID: "alice", Type: model.NotificationTypeURLUnhealthy}
+	if err := s.UpdateStatus(ctx, "u1", model.StatusUnknown, model.StatusDown, checkedAt, event); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	// A second checker that read the old status loses, and its event is not stored
+	other := &model.Notification{EventID: "e2", URLID: "u1", UserID: "alice", Type: model.NotificationTypeURLUnhealthy}
+	if err := s.UpdateStatus(ctx, "u1", model.StatusUnknown, model.StatusDown, time.Now(), other); !errors.Is(err, appErr.ErrConflict) {
+		t.Errorf("UpdateStatus() with a stale status error = %v, want ErrConflict", err)
+	}
+
+	got, err := s.FindByID(ctx, "u1")
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.Status != model.StatusDown || !got.CheckedAt.Equal(checkedAt) {
+		t.Errorf("FindByID() = %s at %v, want %s at %v", got.Status, got.CheckedAt, model.StatusDown, checkedAt)
+	}
+
+	var published []model.OutboxEvent
+	n, err := outbox.PublishPending(ctx, 10, 3, func(_ context.Context, e model.OutboxEvent) error {
+		published = append(published, e)
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("PublishPending() = %d, %v, want 1 event", n, err)
+	}
+	e := published[0]
+	if e.AggregateID != "u1" || e.EventType != model.NotificationTypeURLUnhealthy {
+		t.Errorf("outbox event = %+v, want aggregate u1 of type %s", e, model.NotificationTypeURLUnhealthy)
+	}
+	var payload model.Notification
+	if err := json.Unmarshal(e.Payload, &payload); err != nil || payload.EventID != "e1" {
+		t.Errorf("outbox payload = %s, %v, want event e1", e.Payload, err)
+	}
+}
+
+func testPublishPending(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, outbox := newStores(t)
+	addEvents(t, s, "e1", "e2", "e3")
+
+	// The batch stops at the first failure and retries it first on the next run
+	var seen []string
+	failOn := "e2"
+	publish := func(_ context.Context, e model.OutboxEvent) error {
+		id := eventID(t, e)
+		seen = append(seen, id)
+		if id == failOn {
+			return errors.New("bus unavailable")
+		}
+		return nil
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name      string
+		failOn    string
+		limit     int
+		want      int
+		wantErr   bool
+		wantFirst string
+	}{
+		{name: "stops at failure", failOn: "e2", limit: 10, want: 1, wantErr: true, wantFirst: "e1"},
+		{name: "retries failed event first", failOn: "", limit: 1, want: 1, wantFirst: "e2"},
+		{name: "publishes the rest", failOn: "", limit: 10, want: 1, wantFirst: "e3"},
+		{name: "nothing pending", failOn: "", limit: 10, want: 0},
+	}
+	for _, tt := range tests {
+		seen, failOn = nil, tt.failOn
+		n, err := outbox.PublishPending(ctx, tt.limit, 3, publish)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: PublishPending() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if n != tt.want {
+			t.Errorf("%s: PublishPending() = %d, want %d", tt.name, n, tt.want)
+		}
+		if tt.wantFirst != "" && (len(seen) == 0 || seen[0] != tt.wantFirst) {
+			t.Errorf("%s: published %v, want %s first", tt.name, seen, tt.wantFirst)
+		}
+	}
+}
+
+func testParkFailingEvents(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, outbox := newStores(t)
+	addEvents(t, s, "e1", "e2", "e3")
+
+	// e1 keeps failing until it is parked after two attempts, e3 cannot be published at all
+	var seen []string
+	publish := func(_ context.Context, e model.OutboxEvent) error {
+		id := eventID(t, e)
+		seen = append(seen, id)
+		switch id {
+		case "e1":
+			return errors.New("bus unavailable")
+		case "e3":
+			return fmt.Errorf("invalid payload: %w", storage.ErrUnpublishable)
+		}
+		return nil
+	}
+
+	// Table Driven Test Pattern used
+	tests := []struct {
+		name     string
+		want     int
+		wantErr  bool
+		wantSeen []string
+	}{
+		{name: "failure stops the batch", want: 0, wantErr: true, wantSeen: []string{"e1"}},
+		{name: "parked after max attempts", want: 1, wantSeen: []string{"e1", "e2", "e3"}},
+		{name: "parked events are skipped", want: 0, wantSeen: nil},
+	}
+	for _, tt := range tests {
+		seen = nil
+		n, err := outbox.PublishPending(ctx, 10, 2, publish)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: PublishPending() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if n != tt.want || !slices.Equal(seen, tt.wantSeen) {
+			t.Errorf("%s: PublishPending() = %d after %v, want %d after %v", tt.name, n, seen, tt.want, tt.wantSeen)
+		}
+	}
+}
+
+func testPurgePublished(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, outbox := newStores(t)
+	addEvents(t, s, "e1", "e2")
+
+	// e1 is published, e2 fails and stays
+	n, err := outbox.PublishPending(ctx, 10, 3, func(_ context.Context, e model.OutboxEvent) error {
+		if eventID(t, e) == "e2" {
+			return errors.New("bus unavailable")
+		}
+		return nil
+	})
+	if n != 1 || err == nil {
+		t.Fatalf("PublishPending() = %d, %v, want 1 and an error", n, err)
+	}
+
+	if n, err := outbox.PurgePublished(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PurgePublished() of recent events = %d, %v, want 0", n, err)
+	}
+	if n, err := outbox.PurgePublished(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("PurgePublished() = %d, %v, want 1", n, err)
+	}
+
+	var pending []string
+	if _, err := outbox.PublishPending(ctx, 10, 3, func(_ context.Context, e model.OutboxEvent) error {
+		pending = append(pending, eventID(t, e))
+		return nil
+	}); err != nil || !slices.Equal(pending, []string{"e2"}) {
+		t.Errorf("pending after purge = %v, %v, want [e2]", pending, err)
+	}
+}
+
+func testWriteWhilePublishing(t *testing.T, newStores Factory) {
+	ctx := context.Background()
+	s, outbox := newStores(t)
+	addEvents(t, s, "e1")
+
+	// Checks keep recording results while the relay waits for the bus
+	n, err := outbox.PublishPending(ctx, 10, 3, func(ctx context.Context, _ model.OutboxEvent) error {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		event := &model.Notification{EventID: "e2", URLID: "u1", Type: model.NotificationTypeURLRecovered}
+		return s.UpdateStatus(ctx, "u1", model.StatusDown, model.StatusUP, time.Now(), event)
+	})
+	if n != 1 || err != nil {
+		t.Fatalf("PublishPending() = %d, %v, want 1 and no error", n, err)
+	}
+
+	var pending []string
+	if _, err := outbox.PublishPending(ctx, 10, 3, func(_ context.Context, e model.OutboxEvent) error {
+		pending = append(pending, eventID(t, e))
+		return nil
+	}); err != nil || !slices.Equal(pending, []string{"e2"}) {
+		t.Errorf("pending after publishing = %v, %v, want [e2]", pending, err)
+	}
+}
+
+// addEvents records a check of u1 for each event ID, storing the events in the outbox
+func addEvents(t *testing.T, s storage.Storage, ids ...string) {
+	t.Helper()
+	ctx := context.Background()
+	mustSave(t, s, newURL("u1", "alice", "https://example.com"))
+	from := model.StatusUnknown
+	for _, id := range ids {
+		event := &model.Notification{EventID: id, URLID: "u1", Type: model.NotificationTypeURLUnhealthy}
+		if err := s.UpdateStatus(ctx, "u1", from, model.StatusDown, time.Now(), event); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		from = model.StatusDown
+	}
+}
+
+func eventID(t *testing.T, e model.OutboxEvent) string {
+	t.Helper()
+	var n model.Notification
+	if err := json.Unmarshal(e.Payload, &n); err != nil {
+		t.Fatalf("invalid outbox payload: %v", err)
+	}
+	return n.EventID
+}